@@ -0,0 +1,35 @@
+// k8sm-admin inspects and operates a running kubernetes-mesos scheduler
+// through its HTTP API.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/version/verflag"
+	"github.com/mesosphere/kubernetes-mesos/pkg/admin"
+	"github.com/spf13/pflag"
+)
+
+func main() {
+	a := admin.New()
+	a.AddFlags(pflag.CommandLine)
+	pflag.Usage = func() {
+		fmt.Fprint(os.Stderr, admin.Usage())
+		fmt.Fprintln(os.Stderr, "\nflags:")
+		pflag.PrintDefaults()
+	}
+
+	util.InitFlags()
+	util.InitLogs()
+
+	verflag.PrintAndExitIfRequested()
+
+	err := a.Run(pflag.CommandLine.Args())
+	util.FlushLogs()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -19,6 +19,9 @@ limitations under the License.
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/version/verflag"
 	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/service"
@@ -26,6 +29,11 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		simulate()
+		return
+	}
+
 	s := service.NewSchedulerServer()
 	s.AddFlags(pflag.CommandLine)
 
@@ -37,3 +45,21 @@ func main() {
 
 	s.Run(pflag.CommandLine.Args())
 }
+
+// simulate runs a workload against a simulated cluster and prints a report,
+// see SimulationServer.
+func simulate() {
+	os.Args = append(os.Args[:1], os.Args[2:]...)
+	s := service.NewSimulationServer()
+	s.AddFlags(pflag.CommandLine)
+
+	util.InitFlags()
+	util.InitLogs()
+
+	err := s.Run(pflag.CommandLine.Args())
+	util.FlushLogs()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulation failed: %v\n", err)
+		os.Exit(1)
+	}
+}
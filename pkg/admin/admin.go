@@ -0,0 +1,151 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/master/ports"
+	"github.com/spf13/pflag"
+)
+
+const usage = `usage: k8sm-admin [flags] <command> [arguments]
+
+commands:
+  tasks [taskId]            list tasks, or show one, filtered by --state, --namespace and --slave
+  offers [offerId]          list live and lingering offers, or show one, filtered by --state and --slave
+  slaves [slaveId]          list slaves, or show one; slaves may be named by id or hostname
+  queue                     list the pods waiting to be scheduled, filtered by --namespace
+  explain <namespace/name>  explain why a pod's task does, or doesn't, fit each live offer
+  reconcile                 start an explicit reconciliation of running tasks
+  drain <slave>             stop launching tasks on a slave and kill those it runs, so that their pods are rescheduled
+  undrain <slave>           allow tasks to be launched on a drained slave once again
+  orphans                   list tasks whose pods no longer exist
+  kill-orphans [taskId...]  kill the orphaned tasks of deleted pods (or the given orphans), unless --dry_run
+`
+
+// Admin inspects and operates a running scheduler through its API
+type Admin struct {
+	Scheduler string
+	Output    string
+	State     string
+	Namespace string
+	Slave     string
+	DryRun    bool
+
+	out    io.Writer
+	client *Client
+}
+
+// New creates a new Admin with default parameters
+func New() *Admin {
+	return &Admin{
+		Scheduler: fmt.Sprintf("http://localhost:%d", ports.SchedulerPort),
+		Output:    TableOutput,
+		out:       os.Stdout,
+	}
+}
+
+func (a *Admin) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&a.Scheduler, "scheduler", a.Scheduler, "URL of the scheduler's HTTP API.")
+	fs.StringVar(&a.Output, "output", a.Output, fmt.Sprintf("Output format, one of %v.", OutputFormats()))
+	fs.StringVar(&a.State, "state", a.State, "Only list tasks in this state (pending, running or finished), or offers in this state (live or lingering).")
+	fs.StringVar(&a.Namespace, "namespace", a.Namespace, "Only list tasks or queued pods of this namespace.")
+	fs.StringVar(&a.Slave, "slave", a.Slave, "Only list tasks or offers of this slave, by id or hostname.")
+	fs.BoolVar(&a.DryRun, "dry_run", a.DryRun, "Report the tasks that kill-orphans would kill, without killing them.")
+}
+
+func Usage() string {
+	return usage
+}
+
+// Run executes the command named by the first argument
+func (a *Admin) Run(args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	if a.client == nil {
+		a.client = NewClient(a.Scheduler)
+	}
+	command, args := args[0], args[1:]
+	var (
+		result interface{}
+		err    error
+	)
+	switch command {
+	case "tasks":
+		if len(args) > 0 {
+			result, err = a.client.Task(args[0])
+		} else {
+			result, err = a.client.Tasks(a.State, a.Namespace, a.Slave)
+		}
+	case "offers":
+		if len(args) > 0 {
+			result, err = a.client.Offer(args[0])
+		} else {
+			result, err = a.client.Offers(a.State, a.Slave)
+		}
+	case "slaves":
+		if len(args) > 0 {
+			result, err = a.client.Slave(args[0])
+		} else {
+			result, err = a.client.Slaves()
+		}
+	case "queue":
+		result, err = a.client.Queue(a.Namespace)
+	case "explain":
+		if len(args) != 1 || len(strings.Split(args[0], "/")) != 2 {
+			return errors.New("explain requires a pod, as namespace/name")
+		}
+		parts := strings.Split(args[0], "/")
+		result, err = a.client.Explain(parts[0], parts[1])
+	case "reconcile":
+		result, err = a.client.Reconcile()
+	case "drain", "undrain":
+		if len(args) != 1 {
+			return fmt.Errorf("%v requires a slave id or hostname", command)
+		}
+		result, err = a.client.Drain(args[0], command == "drain")
+	case "orphans":
+		result, err = a.client.Orphans()
+	case "kill-orphans":
+		result, err = a.killOrphans(args)
+	default:
+		return fmt.Errorf("unknown command %q\n%v", command, usage)
+	}
+	if err != nil {
+		return err
+	}
+	return Print(a.out, a.Output, result)
+}
+
+// kills the orphaned tasks that the scheduler reports, optionally limited to
+// the given task ids. tasks that aren't orphaned are never killed, and tasks
+// unknown to the scheduler, which have no pod, are only killed when given.
+func (a *Admin) killOrphans(taskIds []string) (interface{}, error) {
+	if !a.DryRun {
+		return a.client.KillOrphans(taskIds)
+	}
+	orphans, err := a.client.Orphans()
+	if err != nil {
+		return nil, err
+	}
+	all, wanted := len(taskIds) == 0, map[string]bool{}
+	for _, id := range taskIds {
+		wanted[id] = true
+	}
+	targets := orphans.Items[:0]
+	for _, o := range orphans.Items {
+		if (all && o.Task.Pod != "") || wanted[o.Task.Id] {
+			targets = append(targets, o)
+			delete(wanted, o.Task.Id)
+		}
+	}
+	for id := range wanted {
+		return nil, fmt.Errorf("task %v is not orphaned", id)
+	}
+	orphans.Items = targets
+	return orphans, nil
+}
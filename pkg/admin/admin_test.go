@@ -0,0 +1,141 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/api/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+// a scheduler API that reports two orphans of deleted pods and a task unknown
+// to the scheduler, and records the tasks it's asked to kill
+func newFakeScheduler(killed *[]string) *httptest.Server {
+	orphans := v1.OrphanList{Items: []v1.Orphan{
+		{Task: v1.Task{Id: "task1", Pod: "default/foo", State: "running"}, Reason: "pod not found"},
+		{Task: v1.Task{Id: "task2", Pod: "default/bar", State: "running"}, Reason: "pod replaced"},
+		{Task: v1.Task{Id: "task4", State: "unknown"}, Reason: "task unknown to the scheduler"},
+	}}
+	mux := http.NewServeMux()
+	mux.HandleFunc(v1.PathPrefix+"orphans", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(orphans)
+	})
+	mux.HandleFunc(v1.PathPrefix+"orphans/kill", func(w http.ResponseWriter, r *http.Request) {
+		targets := r.URL.Query()["task"]
+		if len(targets) == 0 {
+			for _, o := range orphans.Items {
+				if o.Task.Pod != "" {
+					targets = append(targets, o.Task.Id)
+				}
+			}
+		}
+		for _, id := range targets {
+			if id != "task1" && id != "task2" && id != "task4" {
+				http.Error(w, "task "+id+" is not orphaned", http.StatusConflict)
+				return
+			}
+		}
+		*killed = append(*killed, targets...)
+		json.NewEncoder(w).Encode(v1.Status{Message: "killed", Tasks: targets})
+	})
+	mux.HandleFunc(v1.PathPrefix+"tasks/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, v1.PathPrefix+"tasks/"), "/")
+		if r.Method != "POST" || len(parts) != 2 || parts[1] != "kill" {
+			http.NotFound(w, r)
+			return
+		}
+		*killed = append(*killed, parts[0])
+		json.NewEncoder(w).Encode(v1.Status{Message: "killed", Tasks: parts[:1]})
+	})
+	mux.HandleFunc(v1.PathPrefix+"reconcile", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Task reconciliation is already running", http.StatusConflict)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestKillOrphans(t *testing.T) {
+	assert := assert.New(t)
+	killed := []string{}
+	server := newFakeScheduler(&killed)
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	a := New()
+	a.Scheduler = server.URL
+	a.out = out
+
+	a.DryRun = true
+	assert.NoError(a.Run([]string{"kill-orphans"}))
+	assert.Empty(killed)
+	assert.Contains(out.String(), "task1")
+	assert.Contains(out.String(), "pod replaced")
+	assert.False(strings.Contains(out.String(), "task4"))
+
+	out.Reset()
+	assert.NoError(a.Run([]string{"kill-orphans", "task4"}))
+	assert.Contains(out.String(), "task4")
+
+	a.DryRun = false
+	assert.Error(a.Run([]string{"kill-orphans", "task3"}))
+	assert.Empty(killed)
+
+	assert.NoError(a.Run([]string{"kill-orphans", "task2"}))
+	assert.Equal([]string{"task2"}, killed)
+
+	assert.NoError(a.Run([]string{"kill-orphans"}))
+	assert.Equal([]string{"task2", "task1", "task2"}, killed)
+
+	assert.NoError(a.Run([]string{"kill-orphans", "task4"}))
+	assert.Equal([]string{"task2", "task1", "task2", "task4"}, killed)
+	assert.Contains(out.String(), "task1")
+}
+
+func TestClientReportsSchedulerErrors(t *testing.T) {
+	server := newFakeScheduler(&[]string{})
+	defer server.Close()
+
+	_, err := NewClient(server.URL).Reconcile()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "409")
+		assert.Contains(t, err.Error(), "already running")
+	}
+}
+
+func TestPrint(t *testing.T) {
+	assert := assert.New(t)
+	offers := &v1.OfferList{Items: []v1.Offer{{
+		Id:       "offer1",
+		Hostname: "h1",
+		State:    "live",
+		Cpus:     2,
+		Mem:      1024,
+		Ports:    []v1.PortRange{{Begin: 31005, End: 31005}, {Begin: 31000, End: 31002}},
+		Deadline: time.Now().Add(time.Minute),
+	}}}
+
+	out := &bytes.Buffer{}
+	assert.NoError(Print(out, TableOutput, offers))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if assert.Len(lines, 2) {
+		assert.Equal([]string{"ID", "HOST", "STATE", "ACQUIRED", "CPUS", "MEM", "PORTS", "DEADLINE"}, strings.Fields(lines[0]))
+		assert.Equal([]string{"offer1", "h1", "live", "false", "2", "1024", "31000-31002,31005", "in"}, strings.Fields(lines[1])[:8])
+	}
+
+	out.Reset()
+	assert.NoError(Print(out, YamlOutput, offers))
+	assert.Contains(out.String(), "hostname: h1")
+
+	out.Reset()
+	assert.NoError(Print(out, JsonOutput, offers))
+	decoded := &v1.OfferList{}
+	if assert.NoError(json.Unmarshal(out.Bytes(), decoded)) {
+		assert.Equal("offer1", decoded.Items[0].Id)
+	}
+
+	assert.Error(Print(out, "xml", offers))
+}
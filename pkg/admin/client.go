@@ -0,0 +1,145 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/api/v1"
+)
+
+const defaultClientTimeout = 30 * time.Second
+
+// Client talks to the versioned JSON API of a scheduler
+type Client struct {
+	base   string // URL of the scheduler, e.g. http://localhost:10251
+	client *http.Client
+}
+
+func NewClient(base string) *Client {
+	return &Client{
+		base:   strings.TrimRight(base, "/"),
+		client: &http.Client{Timeout: defaultClientTimeout},
+	}
+}
+
+func (c *Client) Tasks(state, namespace, slave string) (*v1.TaskList, error) {
+	result := &v1.TaskList{}
+	return result, c.do("GET", "tasks", filters("state", state, "namespace", namespace, "slave", slave), result)
+}
+
+func (c *Client) Task(id string) (*v1.Task, error) {
+	result := &v1.Task{}
+	return result, c.do("GET", "tasks/"+url.QueryEscape(id), nil, result)
+}
+
+func (c *Client) Orphans() (*v1.OrphanList, error) {
+	result := &v1.OrphanList{}
+	return result, c.do("GET", "orphans", nil, result)
+}
+
+func (c *Client) KillTask(id string) (*v1.Status, error) {
+	result := &v1.Status{}
+	return result, c.do("POST", "tasks/"+url.QueryEscape(id)+"/kill", nil, result)
+}
+
+// KillOrphans kills the given orphaned tasks, or all of them if none are
+// given. nothing is killed if any of the given tasks isn't orphaned.
+func (c *Client) KillOrphans(ids []string) (*v1.Status, error) {
+	query := url.Values{}
+	for _, id := range ids {
+		query.Add("task", id)
+	}
+	result := &v1.Status{}
+	return result, c.do("POST", "orphans/kill", query, result)
+}
+
+func (c *Client) Offers(state, slave string) (*v1.OfferList, error) {
+	result := &v1.OfferList{}
+	return result, c.do("GET", "offers", filters("state", state, "slave", slave), result)
+}
+
+func (c *Client) Offer(id string) (*v1.Offer, error) {
+	result := &v1.Offer{}
+	return result, c.do("GET", "offers/"+url.QueryEscape(id), nil, result)
+}
+
+func (c *Client) Slaves() (*v1.SlaveList, error) {
+	result := &v1.SlaveList{}
+	return result, c.do("GET", "slaves", nil, result)
+}
+
+func (c *Client) Slave(id string) (*v1.Slave, error) {
+	result := &v1.Slave{}
+	return result, c.do("GET", "slaves/"+url.QueryEscape(id), nil, result)
+}
+
+// Drain stops the scheduler from launching tasks on a slave, and kills those
+// that it's running so that their pods are scheduled elsewhere; undrain
+// reverses the former.
+func (c *Client) Drain(slave string, drain bool) (*v1.Status, error) {
+	action := "drain"
+	if !drain {
+		action = "undrain"
+	}
+	result := &v1.Status{}
+	return result, c.do("POST", "slaves/"+url.QueryEscape(slave)+"/"+action, nil, result)
+}
+
+func (c *Client) Queue(namespace string) (*v1.QueuedPodList, error) {
+	result := &v1.QueuedPodList{}
+	return result, c.do("GET", "queue", filters("namespace", namespace), result)
+}
+
+func (c *Client) Explain(namespace, name string) (*v1.PodExplanation, error) {
+	result := &v1.PodExplanation{}
+	return result, c.do("GET", "pods/"+url.QueryEscape(namespace)+"/"+url.QueryEscape(name)+"/explain", nil, result)
+}
+
+func (c *Client) Reconcile() (*v1.Status, error) {
+	result := &v1.Status{}
+	return result, c.do("POST", "reconcile", nil, result)
+}
+
+// returns the non-empty values of the given name, value pairs
+func filters(pairs ...string) url.Values {
+	query := url.Values{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] != "" {
+			query.Set(pairs[i], pairs[i+1])
+		}
+	}
+	return query
+}
+
+// sends a request to the API and decodes the JSON response into result.
+// responses other than 200 are reported as errors that carry the message
+// of the scheduler.
+func (c *Client) do(method, path string, query url.Values, result interface{}) error {
+	u := c.base + v1.PathPrefix + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v %v: %v: %v", method, u, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, result)
+}
@@ -0,0 +1,186 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/api/v1"
+	"gopkg.in/v2/yaml"
+)
+
+// formats of command output
+const (
+	TableOutput = "table"
+	JsonOutput  = "json"
+	YamlOutput  = "yaml"
+)
+
+func OutputFormats() []string {
+	return []string{TableOutput, JsonOutput, YamlOutput}
+}
+
+// Print writes an object of the scheduler API in the given format
+func Print(w io.Writer, format string, obj interface{}) error {
+	switch format {
+	case JsonOutput:
+		data, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case YamlOutput:
+		// round trip through json so that the keys of the document are the
+		// same as those of the API
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		var generic interface{}
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return err
+		}
+		if data, err = yaml.Marshal(generic); err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case TableOutput:
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		if err := printTable(tw, obj, time.Now()); err != nil {
+			return err
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("unsupported output format %q, expected one of %v", format, OutputFormats())
+}
+
+func printTable(w io.Writer, obj interface{}, now time.Time) error {
+	row := func(columns ...interface{}) {
+		s := make([]string, len(columns))
+		for i, c := range columns {
+			s[i] = fmt.Sprint(c)
+		}
+		fmt.Fprintln(w, strings.Join(s, "\t"))
+	}
+	switch obj := obj.(type) {
+	case *v1.Task:
+		return printTable(w, &v1.TaskList{Items: []v1.Task{*obj}}, now)
+	case *v1.TaskList:
+		row("ID", "POD", "STATE", "HOST", "PORTS", "FLAGS", "AGE")
+		for _, t := range obj.Items {
+			ports := []string{}
+			for _, p := range t.Ports {
+				ports = append(ports, fmt.Sprintf("%d->%d", p.HostPort, p.ContainerPort))
+			}
+			row(t.Id, t.Pod, t.State, orNone(t.Hostname), orNone(strings.Join(ports, ",")), orNone(strings.Join(t.Flags, ",")), age(now, t.Created))
+		}
+	case *v1.Offer:
+		return printTable(w, &v1.OfferList{Items: []v1.Offer{*obj}}, now)
+	case *v1.OfferList:
+		row("ID", "HOST", "STATE", "ACQUIRED", "CPUS", "MEM", "PORTS", "DEADLINE")
+		for _, o := range obj.Items {
+			row(o.Id, o.Hostname, o.State, o.Acquired, o.Cpus, o.Mem, orNone(portRanges(o.Ports)), until(now, o.Deadline))
+		}
+	case *v1.Slave:
+		return printTable(w, &v1.SlaveList{Items: []v1.Slave{*obj}}, now)
+	case *v1.SlaveList:
+		row("ID", "HOST", "DRAINING", "OFFERS", "TASKS", "ATTRIBUTES")
+		for _, s := range obj.Items {
+			attributes := []string{}
+			for name, value := range s.Attributes {
+				attributes = append(attributes, name+"="+value)
+			}
+			sort.Strings(attributes)
+			row(s.Id, s.Hostname, s.Draining, len(s.Offers), len(s.Tasks), orNone(strings.Join(attributes, ",")))
+		}
+	case *v1.QueuedPodList:
+		row("POD", "PRIORITY", "DEADLINE", "BACKOFF")
+		for _, p := range obj.Items {
+			deadline := "<none>"
+			if p.Deadline != nil {
+				deadline = until(now, *p.Deadline)
+			}
+			row(p.Pod, orNone(p.Priority), deadline, orNone(p.Delay))
+		}
+	case *v1.OrphanList:
+		row("ID", "POD", "STATE", "HOST", "REASON")
+		for _, o := range obj.Items {
+			row(o.Task.Id, o.Task.Pod, o.Task.State, orNone(o.Task.Hostname), o.Reason)
+		}
+	case *v1.PodExplanation:
+		fmt.Fprintf(w, "pod %v requires %v cpus and %v MB of memory, %d offers fit\n",
+			obj.Pod, obj.Demand["cpus"], obj.Demand["mem"], obj.Fits)
+		if obj.Error != "" {
+			fmt.Fprintf(w, "error: %v\n", obj.Error)
+		}
+		row("SLAVE", "HOST", "OFFER", "FITS", "SCORE", "FAILURES")
+		for _, s := range obj.Slaves {
+			for _, o := range s.Offers {
+				failures := []string{}
+				for _, f := range o.Failures {
+					failures = append(failures, f.Check+": "+f.Message)
+				}
+				row(s.SlaveId, s.Hostname, o.OfferId, o.Fits, o.Score, orNone(strings.Join(failures, "; ")))
+			}
+		}
+	case *v1.Status:
+		fmt.Fprintln(w, obj.Message)
+		for _, id := range obj.Tasks {
+			fmt.Fprintf(w, "  %v\n", id)
+		}
+	default:
+		return fmt.Errorf("no table format for %T", obj)
+	}
+	return nil
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
+
+// returns the time elapsed since t, in whole seconds
+func age(now, t time.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	return (now.Sub(t) / time.Second * time.Second).String()
+}
+
+// returns the time remaining until t, in whole seconds, or how long ago t passed
+func until(now, t time.Time) string {
+	d := t.Sub(now) / time.Second * time.Second
+	if d < 0 {
+		return (-d).String() + " ago"
+	}
+	return "in " + d.String()
+}
+
+// formats offered port ranges, e.g. 31000-31002,31005
+func portRanges(ports []v1.PortRange) string {
+	sorted := append([]v1.PortRange(nil), ports...)
+	sort.Sort(portRangeList(sorted))
+	ranges := []string{}
+	for _, r := range sorted {
+		if r.Begin == r.End {
+			ranges = append(ranges, fmt.Sprint(r.Begin))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", r.Begin, r.End))
+		}
+	}
+	return strings.Join(ranges, ",")
+}
+
+type portRangeList []v1.PortRange
+
+func (s portRangeList) Len() int           { return len(s) }
+func (s portRangeList) Less(i, j int) bool { return s[i].Begin < s[j].Begin }
+func (s portRangeList) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
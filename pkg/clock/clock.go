@@ -0,0 +1,22 @@
+package clock
+
+import (
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+	// returns a channel that receives the time once the duration has elapsed
+	After(d time.Duration) <-chan time.Time
+}
+
+// RealClock is a Clock that tells the wall time
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
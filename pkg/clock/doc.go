@@ -0,0 +1,6 @@
+/*
+Package clock abstracts the passage of time so that timing behaviour, such as
+offer expiration, queue deadlines and backoff, can be tested deterministically
+by advancing a fake clock explicitly instead of sleeping.
+*/
+package clock
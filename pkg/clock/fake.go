@@ -0,0 +1,93 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+type waiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// Fake is a Clock whose time only moves when it's told to: channels returned
+// by After receive once the clock has been stepped past their deadline.
+type Fake struct {
+	lock    sync.Mutex
+	cond    sync.Cond
+	now     time.Time
+	waiters []*waiter
+}
+
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond.L = &f.lock
+	return f
+}
+
+func (f *Fake) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+	f.waiters = append(f.waiters, &waiter{deadline: f.now.Add(d), ch: ch})
+	f.cond.Broadcast()
+	return ch
+}
+
+// advances the clock by the given duration
+func (f *Fake) Step(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.set(f.now.Add(d))
+}
+
+// sets the clock to the given time, which may be in the past; waiters are
+// only ever woken by moving the clock forward.
+func (f *Fake) Set(t time.Time) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.set(t)
+}
+
+// assumes that the caller holds the lock
+func (f *Fake) set(t time.Time) {
+	f.now = t
+	pending := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.deadline.After(t) {
+			pending = append(pending, w)
+		} else {
+			w.ch <- t
+		}
+	}
+	f.waiters = pending
+}
+
+// returns the number of channels returned by After that haven't fired yet,
+// including those whose receivers have given up on them.
+func (f *Fake) Waiters() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.waiters)
+}
+
+// blocks until at least n channels returned by After are waiting to fire;
+// useful for stepping the clock only once some goroutine is waiting on it.
+func (f *Fake) BlockUntil(n int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
@@ -0,0 +1,64 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeAfter(t *testing.T) {
+	start := time.Unix(1000, 0)
+	f := NewFake(start)
+
+	if now := <-f.After(0); !now.Equal(start) {
+		t.Fatalf("expected %v instead of %v", start, now)
+	}
+
+	ch1 := f.After(time.Second)
+	ch2 := f.After(2 * time.Second)
+	if n := f.Waiters(); n != 2 {
+		t.Fatalf("expected 2 waiters instead of %d", n)
+	}
+
+	f.Step(999 * time.Millisecond)
+	select {
+	case <-ch1:
+		t.Fatalf("fired before its deadline")
+	default:
+	}
+
+	f.Step(time.Millisecond)
+	if now := <-ch1; !now.Equal(start.Add(time.Second)) {
+		t.Fatalf("expected %v instead of %v", start.Add(time.Second), now)
+	}
+	select {
+	case <-ch2:
+		t.Fatalf("fired before its deadline")
+	default:
+	}
+
+	f.Set(start.Add(time.Hour))
+	<-ch2
+	if n := f.Waiters(); n != 0 {
+		t.Fatalf("expected no waiters instead of %d", n)
+	}
+	if now := f.Now(); !now.Equal(start.Add(time.Hour)) {
+		t.Fatalf("expected %v instead of %v", start.Add(time.Hour), now)
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	f := NewFake(time.Unix(1000, 0))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-f.After(time.Minute)
+	}()
+
+	f.BlockUntil(1)
+	f.Step(time.Minute)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the waiter to fire")
+	}
+}
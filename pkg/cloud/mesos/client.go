@@ -65,8 +65,30 @@ func newMesosClient(md detector.Master) (*mesosClient, error) {
 	return client, nil
 }
 
-// return an array of slave host names
-func (c *mesosClient) EnumerateSlaves(ctx context.Context) ([]string, error) {
+// the subset of the leading master's state.json that we care about
+type masterState struct {
+	Slaves []*struct {
+		Id       string `json:"id"`       // ex: 20150106-162714-3815890698-5050-2453-S2
+		Pid      string `json:"pid"`      // ex: slave(1)@10.22.211.18:5051
+		Hostname string `json:"hostname"` // ex: 10.22.211.18, or slave-123.nowhere.com
+	} `json:"slaves"`
+	Frameworks []*struct {
+		Id    string  `json:"id"`
+		Tasks []*Task `json:"tasks"` // tasks that haven't terminated
+	} `json:"frameworks"`
+	OrphanTasks []*Task `json:"orphan_tasks"` // tasks of frameworks that haven't re-registered since a master failover
+}
+
+// Task is a task, that hasn't terminated, as reported by the leading master
+type Task struct {
+	Id          string `json:"id"`
+	FrameworkId string `json:"framework_id"`
+	SlaveId     string `json:"slave_id"`
+	State       string `json:"state"` // ex: TASK_RUNNING
+}
+
+// fetch the state of the leading master
+func (c *mesosClient) state(ctx context.Context) (*masterState, error) {
 	master := func() string {
 		c.masterLock.RLock()
 		defer c.masterLock.RUnlock()
@@ -78,12 +100,12 @@ func (c *mesosClient) EnumerateSlaves(ctx context.Context) ([]string, error) {
 
 	//TODO(jdef) should not assume master uses http (what about https?)
 
-	uri := fmt.Sprintf("http://%s/state.json", c.master)
+	uri := fmt.Sprintf("http://%s/state.json", master)
 	req, err := http.NewRequest("GET", uri, nil)
 	if err != nil {
 		return nil, err
 	}
-	hosts := []string{}
+	state := &masterState{}
 	err = c.httpDo(ctx, req, func(res *http.Response, err error) error {
 		if err != nil {
 			return err
@@ -97,26 +119,55 @@ func (c *mesosClient) EnumerateSlaves(ctx context.Context) ([]string, error) {
 			return err1
 		}
 		log.V(3).Infof("Got mesos state, content length %v", len(blob))
-		type State struct {
-			Slaves []*struct {
-				Id       string `json:"id"`       // ex: 20150106-162714-3815890698-5050-2453-S2
-				Pid      string `json:"pid"`      // ex: slave(1)@10.22.211.18:5051
-				Hostname string `json:"hostname"` // ex: 10.22.211.18, or slave-123.nowhere.com
-			} `json:"slaves"`
+		return json.Unmarshal(blob, state)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// return an array of slave host names
+func (c *mesosClient) EnumerateSlaves(ctx context.Context) ([]string, error) {
+	state, err := c.state(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hosts := []string{}
+	for _, slave := range state.Slaves {
+		if slave.Hostname != "" {
+			hosts = append(hosts, slave.Hostname)
 		}
-		state := &State{}
-		err = json.Unmarshal(blob, state)
-		if err != nil {
-			return err
+	}
+	return hosts, nil
+}
+
+// return the tasks of a framework that the leading master believes haven't
+// terminated, including those it holds as orphans while it waits for the
+// framework to re-register
+func (c *mesosClient) EnumerateTasks(ctx context.Context, frameworkId string) ([]*Task, error) {
+	state, err := c.state(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tasks := []*Task{}
+	for _, f := range state.Frameworks {
+		if f.Id != frameworkId {
+			continue
 		}
-		for _, slave := range state.Slaves {
-			if slave.Hostname != "" {
-				hosts = append(hosts, slave.Hostname)
+		for _, t := range f.Tasks {
+			if t.FrameworkId == "" {
+				t.FrameworkId = f.Id
 			}
+			tasks = append(tasks, t)
 		}
-		return nil
-	})
-	return hosts, err
+	}
+	for _, t := range state.OrphanTasks {
+		if t.FrameworkId == frameworkId {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks, nil
 }
 
 /*
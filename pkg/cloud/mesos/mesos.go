@@ -49,6 +49,22 @@ func newMesosCloud() (*MesosCloud, error) {
 	}
 }
 
+// TaskEnumerator lists the tasks of a framework that the leading master
+// believes haven't terminated
+type TaskEnumerator interface {
+	EnumerateTasks(ctx context.Context, frameworkId string) ([]*Task, error)
+}
+
+// NewTaskEnumerator returns a TaskEnumerator that follows the leading master
+// of the cluster named by the mesos_master flag
+func NewTaskEnumerator() (TaskEnumerator, error) {
+	d, err := detector.New(*mesosMaster)
+	if err != nil {
+		return nil, err
+	}
+	return newMesosClient(d)
+}
+
 // Mesos natively provides minimal cloud-type resources. More robust cloud
 // support requires a combination of Mesos and cloud-specific knowledge, which
 // will likely never be present in this vanilla implementation.
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+
+	"gopkg.in/v2/yaml"
+)
+
+// RestartPolicy determines whether a sidecar daemon is restarted after it exits.
+type RestartPolicy string
+
+const (
+	RestartAlways    = RestartPolicy("Always")    // restart regardless of exit status
+	RestartOnFailure = RestartPolicy("OnFailure") // restart only upon a non-zero exit status
+	RestartNever     = RestartPolicy("Never")     // never restart
+)
+
+// Sidecar declares a per-slave helper daemon that runs alongside the
+// kubelet-executor, for example a log shipper or a DNS cache.
+type Sidecar struct {
+	Name string `json:"name" yaml:"name"`
+	// location of the sidecar executable: either a path on the scheduler host,
+	// in which case the scheduler serves the file, or a URI that the mesos
+	// fetcher is able to download.
+	URI     string            `json:"uri" yaml:"uri"`
+	Args    []string          `json:"args,omitempty" yaml:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	Restart RestartPolicy     `json:"restartPolicy,omitempty" yaml:"restartPolicy,omitempty"`
+}
+
+// IsRemote returns true if the sidecar URI refers to a resource that is not
+// served by the scheduler.
+func (s *Sidecar) IsRemote() bool {
+	u, err := url.Parse(s.URI)
+	return err == nil && u.Scheme != ""
+}
+
+// Executable returns the name of the sidecar executable once it's been
+// fetched into the executor sandbox.
+func (s *Sidecar) Executable() string {
+	p := s.URI
+	if u, err := url.Parse(s.URI); err == nil && u.Path != "" {
+		p = u.Path
+	}
+	return path.Base(p)
+}
+
+// Environ returns the sidecar environment as a list of key=value pairs.
+func (s *Sidecar) Environ() []string {
+	env := make([]string, 0, len(s.Env))
+	for k, v := range s.Env {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// ParseSidecars decodes and validates a YAML (or JSON) list of sidecars.
+func ParseSidecars(data []byte) ([]Sidecar, error) {
+	sidecars := []Sidecar{}
+	if err := yaml.Unmarshal(data, &sidecars); err != nil {
+		return nil, err
+	}
+	names := map[string]struct{}{}
+	for i := range sidecars {
+		s := &sidecars[i]
+		if s.Name == "" {
+			return nil, fmt.Errorf("sidecar %d has no name", i)
+		}
+		if _, found := names[s.Name]; found {
+			return nil, fmt.Errorf("duplicate sidecar name %q", s.Name)
+		}
+		names[s.Name] = struct{}{}
+		if s.URI == "" {
+			return nil, fmt.Errorf("sidecar %q has no uri", s.Name)
+		}
+		switch s.Restart {
+		case "":
+			s.Restart = RestartAlways
+		case RestartAlways, RestartOnFailure, RestartNever:
+		default:
+			return nil, fmt.Errorf("sidecar %q has an invalid restart policy %q", s.Name, s.Restart)
+		}
+	}
+	return sidecars, nil
+}
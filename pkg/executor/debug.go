@@ -0,0 +1,36 @@
+package executor
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// InstallDebugHandlers registers the executor's HTTP endpoints with the given mux.
+func (k *KubernetesExecutor) InstallDebugHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/executor/usage", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, k.usage.latest())
+	})
+	mux.HandleFunc("/executor/state", func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, struct {
+			State       stateType         `json:"state"`
+			Outbox      int               `json:"outbox"`  // number of undelivered updates
+			Dropped     int               `json:"dropped"` // number of updates evicted from a full outbox
+			Transitions []stateTransition `json:"transitions"`
+		}{
+			State:       k.state.get(),
+			Outbox:      k.outbox.Len(),
+			Dropped:     k.outbox.Dropped(),
+			Transitions: k.state.transitions(),
+		})
+	})
+}
+
+func writeJson(w http.ResponseWriter, obj interface{}) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
@@ -20,7 +19,9 @@ import (
 	mesos "github.com/mesos/mesos-go/mesosproto"
 	mutil "github.com/mesos/mesos-go/mesosutil"
 	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/metrics"
 	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/meta"
+	"github.com/mesosphere/kubernetes-mesos/pkg/trace"
 	"gopkg.in/v2/yaml"
 )
 
@@ -29,13 +30,15 @@ const (
 	launchGracePeriod = 5 * time.Minute
 )
 
-type stateType int32
+// reports the status of a pod, by its full name
+type PodStatusFunc func(podFullName string) (api.PodStatus, error)
 
-const (
-	disconnectedState stateType = iota
-	connectedState
-	doneState
-)
+// KubeletPodStatus returns a PodStatusFunc that asks the kubelet.
+func KubeletPodStatus(kl *kubelet.Kubelet) PodStatusFunc {
+	return func(podFullName string) (api.PodStatus, error) {
+		return kl.GetPodStatus(podFullName, "")
+	}
+}
 
 type kuberTask struct {
 	mesosTaskInfo *mesos.TaskInfo
@@ -45,9 +48,9 @@ type kuberTask struct {
 // KubernetesExecutor is an mesos executor that runs pods
 // in a minion machine.
 type KubernetesExecutor struct {
-	kl           *kubelet.Kubelet // the kubelet instance.
+	podStatus    PodStatusFunc // usually asks the kubelet instance.
 	updateChan   chan<- interface{}
-	state        stateType
+	state        *stateMachine
 	tasks        map[string]*kuberTask
 	pods         map[string]*api.BoundPod
 	lock         sync.RWMutex
@@ -55,24 +58,19 @@ type KubernetesExecutor struct {
 	client       *client.Client
 	events       <-chan watch.Event
 	done         chan struct{} // signals shutdown
-	outgoing     chan func() (mesos.Status, error)
+	outbox       *Outbox       // status updates and messages awaiting delivery to the slave
 	dockerClient dockertools.DockerInterface
-}
-
-func (k *KubernetesExecutor) getState() stateType {
-	return stateType(atomic.LoadInt32((*int32)(&k.state)))
+	driver       bindings.ExecutorDriver // most recently (re)registered driver, guarded by lock
+	usage        *usageMonitor
+	tracer       *trace.Tracer // continues the traces of task launches begun by the scheduler, may be nil
 }
 
 func (k *KubernetesExecutor) isConnected() bool {
-	return connectedState == k.getState()
-}
-
-func (k *KubernetesExecutor) swapState(from, to stateType) bool {
-	return atomic.CompareAndSwapInt32((*int32)(&k.state), int32(from), int32(to))
+	return connectedState == k.state.get()
 }
 
 // New creates a new kubernetes executor.
-func New(kl *kubelet.Kubelet, ch chan<- interface{}, ns string, cl *client.Client, w watch.Interface, dc dockertools.DockerInterface) *KubernetesExecutor {
+func New(podStatus PodStatusFunc, ch chan<- interface{}, ns string, cl *client.Client, w watch.Interface, dc dockertools.DockerInterface, outbox *Outbox, tracer *trace.Tracer) *KubernetesExecutor {
 	//TODO(jdef) do something real with these events..
 	events := w.ResultChan()
 	if events != nil {
@@ -84,19 +82,22 @@ func New(kl *kubelet.Kubelet, ch chan<- interface{}, ns string, cl *client.Clien
 		}()
 	}
 	k := &KubernetesExecutor{
-		kl:           kl,
+		podStatus:    podStatus,
 		updateChan:   ch,
-		state:        disconnectedState,
+		state:        newStateMachine(),
 		tasks:        make(map[string]*kuberTask),
 		pods:         make(map[string]*api.BoundPod),
 		sourcename:   ns,
 		client:       cl,
 		events:       events,
 		done:         make(chan struct{}),
-		outgoing:     make(chan func() (mesos.Status, error), 1024),
+		outbox:       outbox,
 		dockerClient: dc,
+		usage:        newUsageMonitor(&cgroupStats{root: defaultCgroupRoot}),
+		tracer:       tracer,
 	}
 	go k.sendLoop()
+	go k.runUsageMonitor()
 	return k
 }
 
@@ -117,10 +118,7 @@ func (k *KubernetesExecutor) Registered(driver bindings.ExecutorDriver,
 	}
 	log.Infof("Executor %v of framework %v registered with slave %v\n",
 		executorInfo, frameworkInfo, slaveInfo)
-	if !k.swapState(disconnectedState, connectedState) {
-		//programming error?
-		panic("already connected?!")
-	}
+	k.connected(driver, registeredEvent)
 }
 
 // Reregistered is called when the executor is successfully re-registered with the slave.
@@ -130,9 +128,18 @@ func (k *KubernetesExecutor) Reregistered(driver bindings.ExecutorDriver, slaveI
 		return
 	}
 	log.Infof("Reregistered with slave %v\n", slaveInfo)
-	if !k.swapState(disconnectedState, connectedState) {
-		//programming error?
-		panic("already connected?!")
+	k.connected(driver, reregisteredEvent)
+}
+
+func (k *KubernetesExecutor) connected(driver bindings.ExecutorDriver, event stateEvent) {
+	func() {
+		k.lock.Lock()
+		defer k.lock.Unlock()
+		k.driver = driver
+	}()
+	if t := k.state.fire(event); t.To == connectedState {
+		// flush status updates that were queued while we were disconnected
+		k.outbox.signal()
 	}
 }
 
@@ -142,10 +149,7 @@ func (k *KubernetesExecutor) Disconnected(driver bindings.ExecutorDriver) {
 		return
 	}
 	log.Infof("Slave is disconnected\n")
-	if !k.swapState(connectedState, disconnectedState) {
-		//programming error?
-		panic("already disconnected?!")
-	}
+	k.state.fire(disconnectedEvent)
 }
 
 // LaunchTask is called when the executor receives a request to launch a task.
@@ -191,12 +195,23 @@ func (k *KubernetesExecutor) LaunchTask(driver bindings.ExecutorDriver, taskInfo
 }
 
 func (k *KubernetesExecutor) getPidInfo(name string) (api.PodStatus, error) {
-	return k.kl.GetPodStatus(name, "")
+	return k.podStatus(name)
 }
 
 // async continuation of LaunchTask
 func (k *KubernetesExecutor) launchTask(driver bindings.ExecutorDriver, taskId string, pod *api.BoundPod) {
 
+	// continue the trace of the launch that the scheduler began, if any
+	var parent *trace.Context
+	if s, found := pod.Annotations[meta.TraceContextKey]; found {
+		var err error
+		if parent, err = trace.Parse(s); err != nil {
+			log.Warningf("ignoring trace context of pod %v: %v", pod.Name, err)
+		}
+	}
+	span := k.tracer.Start("executor-launch", parent)
+	span.Tag("task", taskId)
+
 	//HACK(jdef): cloned binding construction from k8s plugin/pkg/scheduler/scheduler.go
 	binding := &api.Binding{
 		ObjectMeta: api.ObjectMeta{
@@ -214,10 +229,23 @@ func (k *KubernetesExecutor) launchTask(driver bindings.ExecutorDriver, taskId s
 		binding.Annotations[k] = v
 	}
 
-	log.Infof("Binding '%v' to '%v' ...", binding.PodID, binding.Host)
-	ctx := api.WithNamespace(api.NewDefaultContext(), binding.Namespace)
-	err := k.client.Post().Namespace(api.NamespaceValue(ctx)).Resource("bindings").Body(binding).Do().Error()
+	bindTime := time.Now()
+	bindSpan := span.Child("bindings")
+	var err error
+	if boundHost, found := pod.Annotations[meta.BoundHostKey]; found {
+		// the apiserver won't rebind a preempted pod that the scheduler rescheduled
+		log.Infof("Pod '%v' remains bound to '%v', not binding it to '%v'", binding.PodID, boundHost, binding.Host)
+		bindSpan.Tag("boundHost", boundHost)
+	} else {
+		log.Infof("Binding '%v' to '%v' ...", binding.PodID, binding.Host)
+		ctx := api.WithNamespace(api.NewDefaultContext(), binding.Namespace)
+		err = k.client.Post().Namespace(api.NamespaceValue(ctx)).Resource("bindings").Body(binding).Do().Error()
+	}
+	bindSpan.SetError(err)
+	bindSpan.Finish()
 	if err != nil {
+		span.SetError(err)
+		span.Finish()
 		k.sendStatus(driver, newStatus(mutil.NewTaskID(taskId), mesos.TaskState_TASK_FAILED,
 			messages.CreateBindingFailure))
 		return
@@ -239,6 +267,8 @@ func (k *KubernetesExecutor) launchTask(driver bindings.ExecutorDriver, taskId s
 	if !found {
 		log.V(1).Infof("task %v no longer on record, probably killed, aborting launch sequence - reporting lost", taskId)
 		k.reportLostTask(driver, taskId, messages.LaunchTaskFailed)
+		span.Tag("error", messages.LaunchTaskFailed)
+		span.Finish()
 		return
 	}
 
@@ -260,10 +290,12 @@ func (k *KubernetesExecutor) launchTask(driver bindings.ExecutorDriver, taskId s
 		messages.CreateBindingSuccess))
 
 	// Delay reporting 'task running' until container is up.
-	go k._launchTask(driver, taskId, podFullName)
+	go k._launchTask(driver, taskId, podFullName, bindTime, span)
 }
 
-func (k *KubernetesExecutor) _launchTask(driver bindings.ExecutorDriver, taskId, podFullName string) {
+func (k *KubernetesExecutor) _launchTask(driver bindings.ExecutorDriver, taskId, podFullName string, bindTime time.Time, span *trace.Span) {
+	running := span.Child("kubelet")
+	defer span.Finish()
 
 	expired := make(chan struct{})
 	time.AfterFunc(launchGracePeriod, func() { close(expired) })
@@ -312,15 +344,17 @@ waitForRunningPod:
 					goto reportLost
 				}
 
-				running := mesos.TaskState_TASK_RUNNING
+				state := mesos.TaskState_TASK_RUNNING
 				statusUpdate := &mesos.TaskStatus{
 					TaskId:  mutil.NewTaskID(taskId),
-					State:   &running,
+					State:   &state,
 					Message: proto.String(fmt.Sprintf("pod-running:%s", podFullName)),
 					Data:    data,
 				}
 
 				k.sendStatus(driver, statusUpdate)
+				metrics.LaunchLatency.Observe(metrics.InMicroseconds(time.Since(bindTime)))
+				running.Finish()
 
 				// continue to monitor the health of the pod
 				go k.__launchTask(driver, taskId, podFullName)
@@ -333,6 +367,9 @@ waitForRunningPod:
 	defer k.lock.Unlock()
 reportLost:
 	k.reportLostTask(driver, taskId, messages.LaunchTaskFailed)
+	running.Tag("error", messages.LaunchTaskFailed)
+	running.Finish()
+	span.Tag("error", messages.LaunchTaskFailed)
 }
 
 func (k *KubernetesExecutor) __launchTask(driver bindings.ExecutorDriver, taskId, podFullName string) {
@@ -418,6 +455,9 @@ func (k *KubernetesExecutor) removePodTask(driver bindings.ExecutorDriver, tid,
 		return
 	}
 	delete(k.tasks, tid)
+	if state == mesos.TaskState_TASK_LOST {
+		metrics.LostTasks.WithLabelValues(reason).Inc()
+	}
 
 	pid := task.podName
 	if _, found := k.pods[pid]; !found {
@@ -448,6 +488,10 @@ func (k *KubernetesExecutor) FrameworkMessage(driver bindings.ExecutorDriver, me
 	}
 
 	log.Infof("Receives message from framework %v\n", message)
+	if strings.HasPrefix(message, messages.PodUpdatePrefix) {
+		k.updatePod(message[len(messages.PodUpdatePrefix):])
+		return
+	}
 	//TODO(jdef) master reported a lost task, reconcile this! @see scheduler.go:handleTaskLost
 	if strings.HasPrefix("task-lost:", message) && len(message) > 10 {
 		taskId := message[10:]
@@ -458,6 +502,52 @@ func (k *KubernetesExecutor) FrameworkMessage(driver bindings.ExecutorDriver, me
 	}
 }
 
+// apply an update of the mutable state of a pod, pushed by the scheduler, and
+// hand the updated pod to the kubelet which restarts containers as needed.
+func (k *KubernetesExecutor) updatePod(data string) {
+	var update messages.PodUpdate
+	if err := json.Unmarshal([]byte(data), &update); err != nil {
+		log.Errorf("failed to unmarshal pod update: %v", err)
+		return
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	task, found := k.tasks[update.TaskId]
+	if !found || task.podName == "" {
+		log.Warningf("ignoring update of unknown or unlaunched task %v", update.TaskId)
+		return
+	}
+	pod, found := k.pods[task.podName]
+	if !found {
+		log.Warningf("ignoring update of task %v, pod %v not found", update.TaskId, task.podName)
+		return
+	}
+
+	// annotations added by the scheduler upon binding aren't known to the apiserver
+	updated := *pod
+	annotations := map[string]string{}
+	for key, value := range update.Annotations {
+		annotations[key] = value
+	}
+	for key, value := range pod.Annotations {
+		if _, found := annotations[key]; !found && strings.HasPrefix(key, meta.AnnotationPrefix) {
+			annotations[key] = value
+		}
+	}
+	update.Annotations = annotations
+	update.Apply(&updated.ObjectMeta, &updated.Spec)
+	k.pods[task.podName] = &updated
+	log.Infof("updated pod %v of task %v", task.podName, update.TaskId)
+
+	podUpdate := kubelet.PodUpdate{Op: kubelet.SET}
+	for _, p := range k.pods {
+		podUpdate.Pods = append(podUpdate.Pods, *p)
+	}
+	k.updateChan <- podUpdate
+}
+
 // Shutdown is called when the executor receives a shutdown request.
 func (k *KubernetesExecutor) Shutdown(driver bindings.ExecutorDriver) {
 	if k.isDone() {
@@ -466,10 +556,7 @@ func (k *KubernetesExecutor) Shutdown(driver bindings.ExecutorDriver) {
 	close(k.done)
 
 	log.Infoln("Shutdown the executor")
-	defer func() {
-		for !k.swapState(k.getState(), doneState) {
-		}
-	}()
+	defer k.state.fire(shutdownEvent)
 
 	func() {
 		k.lock.Lock()
@@ -519,54 +606,131 @@ func newStatus(taskId *mesos.TaskID, state mesos.TaskState, message string) *mes
 	}
 }
 
+func isTerminal(state mesos.TaskState) bool {
+	switch state {
+	case mesos.TaskState_TASK_FINISHED, mesos.TaskState_TASK_FAILED,
+		mesos.TaskState_TASK_KILLED, mesos.TaskState_TASK_LOST:
+		return true
+	}
+	return false
+}
+
+// queue a status update for delivery to the slave; never blocks. updates are
+// delivered via the most recently registered driver.
 func (k *KubernetesExecutor) sendStatus(driver bindings.ExecutorDriver, status *mesos.TaskStatus) {
-	select {
-	case <-k.done:
-	default:
-		k.outgoing <- func() (mesos.Status, error) { return driver.SendStatusUpdate(status) }
+	if k.isDone() {
+		return
+	}
+	data, err := proto.Marshal(status)
+	if err != nil {
+		log.Errorf("failed to marshal status update for task %v: %v", status.GetTaskId().GetValue(), err)
+		return
 	}
+	k.outbox.push(statusUpdateKind, "task:"+status.GetTaskId().GetValue(), isTerminal(status.GetState()), data)
 }
 
+// queue a framework message for delivery to the scheduler; never blocks.
+// a message supersedes any undelivered message that has the same prefix.
 func (k *KubernetesExecutor) sendFrameworkMessage(driver bindings.ExecutorDriver, msg string) {
-	select {
-	case <-k.done:
-	default:
-		k.outgoing <- func() (mesos.Status, error) { return driver.SendFrameworkMessage(msg) }
+	if k.isDone() {
+		return
+	}
+	key := msg
+	if i := strings.Index(msg, ":"); i >= 0 {
+		key = msg[:i+1]
+	}
+	k.outbox.push(frameworkMessageKind, "message:"+key, false, []byte(msg))
+}
+
+// ReportDaemonHealth forwards the health of the sidecar daemons that run
+// alongside this executor to the scheduler.
+func (k *KubernetesExecutor) ReportDaemonHealth(health []messages.DaemonHealth) {
+	k.lock.RLock()
+	driver := k.driver
+	k.lock.RUnlock()
+
+	if driver == nil || !k.isConnected() {
+		return
+	}
+	if data, err := json.Marshal(health); err != nil {
+		log.Errorf("failed to marshal daemon health: %v", err)
+	} else {
+		k.sendFrameworkMessage(driver, messages.DaemonHealthPrefix+string(data))
 	}
 }
 
+// hand off queued messages to the driver, in order, whenever the executor is
+// connected to its slave.
 func (k *KubernetesExecutor) sendLoop() {
 	defer log.V(1).Info("sender loop exiting")
+	var failed *outboundMessage // most recent message that couldn't be sent
 	for {
 		select {
 		case <-k.done:
 			return
 		default:
-			if !k.isConnected() {
-				select {
-				case <-k.done:
-				case <-time.After(1 * time.Second):
-				}
-				continue
-			}
-			sender, ok := <-k.outgoing
-			if !ok {
-				// programming error
-				panic("someone closed the outgoing channel")
-			}
-			if status, err := sender(); err == nil {
-				continue
-			} else {
-				log.Error(err)
-				if status == mesos.Status_DRIVER_ABORTED {
-					return
-				}
+		}
+		if !k.isConnected() {
+			// woken upon reconnection
+			select {
+			case <-k.done:
+			case <-k.outbox.ready:
+			case <-time.After(1 * time.Second):
 			}
-			// attempt to re-queue the sender
+			continue
+		}
+		msg := k.outbox.peek()
+		if msg == nil {
 			select {
 			case <-k.done:
-			case k.outgoing <- sender:
+			case <-k.outbox.ready:
+			case <-time.After(1 * time.Second):
 			}
+			continue
+		}
+		if msg == failed {
+			metrics.SendRetries.WithLabelValues(msg.Kind.String()).Inc()
 		}
+		status, err := k.send(msg)
+		if err == nil {
+			k.outbox.remove(msg)
+			continue
+		}
+		log.Error(err)
+		metrics.SendFailures.WithLabelValues(msg.Kind.String()).Inc()
+		failed = msg
+		if status == mesos.Status_DRIVER_ABORTED {
+			return
+		}
+		// leave the message queued and try again later
+		select {
+		case <-k.done:
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+func (k *KubernetesExecutor) send(msg *outboundMessage) (mesos.Status, error) {
+	k.lock.RLock()
+	driver := k.driver
+	k.lock.RUnlock()
+	if driver == nil {
+		return mesos.Status_DRIVER_NOT_STARTED, fmt.Errorf("executor driver is not registered")
+	}
+
+	switch msg.Kind {
+	case statusUpdateKind:
+		status := &mesos.TaskStatus{}
+		if err := proto.Unmarshal(msg.Data, status); err != nil {
+			// retrying won't help, discard it
+			log.Errorf("discarding corrupt status update for %v: %v", msg.Key, err)
+			return mesos.Status_DRIVER_RUNNING, nil
+		}
+		return driver.SendStatusUpdate(status)
+	case frameworkMessageKind:
+		return driver.SendFrameworkMessage(string(msg.Data))
+	default:
+		log.Errorf("discarding outbound message of unknown kind %d", msg.Kind)
+		return mesos.Status_DRIVER_RUNNING, nil
 	}
 }
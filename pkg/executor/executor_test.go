@@ -0,0 +1,169 @@
+package executor
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet"
+	bindings "github.com/mesos/mesos-go/executor"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/metrics"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/meta"
+)
+
+// a driver that fails to send the first few framework messages
+type fakeDriver struct {
+	bindings.ExecutorDriver
+	lock     sync.Mutex
+	failures int      // number of sends that fail before the rest succeed
+	sent     []string // framework messages that were sent
+}
+
+func (d *fakeDriver) SendFrameworkMessage(msg string) (mesos.Status, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.failures > 0 {
+		d.failures--
+		return mesos.Status_DRIVER_RUNNING, errors.New("slave unavailable")
+	}
+	d.sent = append(d.sent, msg)
+	return mesos.Status_DRIVER_RUNNING, nil
+}
+
+func (d *fakeDriver) SendStatusUpdate(status *mesos.TaskStatus) (mesos.Status, error) {
+	return mesos.Status_DRIVER_RUNNING, nil
+}
+
+func (d *fakeDriver) sentMessages() []string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return append([]string(nil), d.sent...)
+}
+
+func TestUpdatePod(t *testing.T) {
+	updates := make(chan interface{}, 1)
+	k := &KubernetesExecutor{
+		updateChan: updates,
+		tasks:      map[string]*kuberTask{"task1": {podName: "foo"}},
+		pods: map[string]*api.BoundPod{"foo": {
+			ObjectMeta: api.ObjectMeta{
+				Name:   "foo",
+				Labels: map[string]string{"tier": "web"},
+				Annotations: map[string]string{
+					meta.BindingHostKey:  "host1",
+					meta.TaskIdKey:       "task1",
+					meta.TraceContextKey: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+					"owner":              "alice",
+				},
+			},
+			Spec: api.PodSpec{Containers: []api.Container{{Name: "web", Image: "nginx:1.7"}}},
+		}},
+	}
+
+	data, err := json.Marshal(&messages.PodUpdate{
+		TaskId:      "task1",
+		Labels:      map[string]string{"tier": "frontend"},
+		Annotations: map[string]string{"owner": "bob"},
+		Images:      map[string]string{"web": "nginx:1.8"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.updatePod(string(data))
+
+	var update kubelet.PodUpdate
+	select {
+	case x := <-updates:
+		update = x.(kubelet.PodUpdate)
+	default:
+		t.Fatalf("expected the updated pod to be handed to the kubelet")
+	}
+	if update.Op != kubelet.SET || len(update.Pods) != 1 {
+		t.Fatalf("expected the kubelet to be given the single pod instead of %+v", update)
+	}
+	pod := update.Pods[0]
+	if expected := map[string]string{"tier": "frontend"}; !reflect.DeepEqual(expected, pod.Labels) {
+		t.Fatalf("expected labels %v instead of %v", expected, pod.Labels)
+	}
+	// the annotations of the scheduler survive, the rest are replaced
+	expected := map[string]string{
+		meta.BindingHostKey:  "host1",
+		meta.TaskIdKey:       "task1",
+		meta.TraceContextKey: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"owner":              "bob",
+	}
+	if !reflect.DeepEqual(expected, pod.Annotations) {
+		t.Fatalf("expected annotations %v instead of %v", expected, pod.Annotations)
+	}
+	if image := pod.Spec.Containers[0].Image; image != "nginx:1.8" {
+		t.Fatalf("expected the image to be updated instead of %v", image)
+	}
+
+	// updates of unknown tasks are ignored
+	data, _ = json.Marshal(&messages.PodUpdate{TaskId: "task2"})
+	k.updatePod(string(data))
+	select {
+	case x := <-updates:
+		t.Fatalf("unexpected update %+v", x)
+	default:
+	}
+}
+
+func TestSendLoopMetrics(t *testing.T) {
+	kind := frameworkMessageKind.String()
+	failures := metricValue(t, metrics.SendFailures.WithLabelValues(kind))
+	retries := metricValue(t, metrics.SendRetries.WithLabelValues(kind))
+
+	outbox, _ := NewOutbox("", 10)
+	driver := &fakeDriver{failures: 1}
+	k := &KubernetesExecutor{
+		state:  newStateMachine(),
+		done:   make(chan struct{}),
+		outbox: outbox,
+	}
+	defer close(k.done)
+	k.connected(driver, registeredEvent)
+	go k.sendLoop()
+
+	k.sendFrameworkMessage(driver, "hello:world")
+	deadline := time.Now().Add(10 * time.Second)
+	for len(driver.sentMessages()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the message to be sent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := metricValue(t, metrics.SendFailures.WithLabelValues(kind)) - failures; n != 1 {
+		t.Fatalf("expected 1 send failure instead of %v", n)
+	}
+	if n := metricValue(t, metrics.SendRetries.WithLabelValues(kind)) - retries; n != 1 {
+		t.Fatalf("expected 1 send retry instead of %v", n)
+	}
+}
+
+func TestLostTaskMetrics(t *testing.T) {
+	lost := metricValue(t, metrics.LostTasks.WithLabelValues("gone"))
+	outbox, _ := NewOutbox("", 10)
+	k := &KubernetesExecutor{
+		updateChan: make(chan interface{}, 2),
+		state:      newStateMachine(),
+		tasks:      map[string]*kuberTask{"task1": {podName: "foo"}, "task2": {podName: "bar"}},
+		pods:       map[string]*api.BoundPod{"foo": {}, "bar": {}},
+		done:       make(chan struct{}),
+		outbox:     outbox,
+	}
+	k.reportLostTask(nil, "task1", "gone")
+	k.killPodForTask(nil, "task2", "gone")
+	if n := metricValue(t, metrics.LostTasks.WithLabelValues("gone")) - lost; n != 1 {
+		t.Fatalf("expected 1 lost task instead of %v", n)
+	}
+	if outbox.Len() != 2 {
+		t.Fatalf("expected the status of both tasks to be queued instead of %d", outbox.Len())
+	}
+}
@@ -0,0 +1,10 @@
+package messages
+
+// DaemonHealth summarizes the state of a sidecar daemon supervised by the executor.
+type DaemonHealth struct {
+	Name      string `json:"name"`
+	State     string `json:"state"`
+	Healthy   bool   `json:"healthy"`
+	Restarts  int    `json:"restarts"`
+	LastError string `json:"lastError,omitempty"`
+}
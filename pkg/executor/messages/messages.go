@@ -13,3 +13,16 @@ const (
 	UnmarshalTaskDataFailure = "unmarshal-task-data-failure"
 	TaskLostAck              = "task-lost-ack" // executor acknowledgement of forwarded TASK_LOST framework message
 )
+
+// prefixes of framework messages sent from the executor to the scheduler
+
+const (
+	PodUsagePrefix     = "pod-usage:"     // followed by a json-encoded []PodUsage
+	DaemonHealthPrefix = "daemon-health:" // followed by a json-encoded []DaemonHealth
+)
+
+// prefixes of framework messages sent from the scheduler to the executor
+
+const (
+	PodUpdatePrefix = "pod-update:" // followed by a json-encoded PodUpdate
+)
@@ -0,0 +1,28 @@
+package messages
+
+import (
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+// PodUpdate carries the mutable state of a pod whose task has been launched:
+// labels and annotations are replaced wholesale, container images are
+// replaced by container name.
+type PodUpdate struct {
+	TaskId      string            `json:"taskId"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Images      map[string]string `json:"images,omitempty"` // container name -> image
+}
+
+// Apply the update to the metadata and spec of a pod. the containers of the
+// spec are copied rather than modified in place since they may be shared.
+func (u *PodUpdate) Apply(meta *api.ObjectMeta, spec *api.PodSpec) {
+	meta.Labels = u.Labels
+	meta.Annotations = u.Annotations
+	spec.Containers = append([]api.Container(nil), spec.Containers...)
+	for i := range spec.Containers {
+		if image, found := u.Images[spec.Containers[i].Name]; found {
+			spec.Containers[i].Image = image
+		}
+	}
+}
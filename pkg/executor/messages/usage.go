@@ -0,0 +1,16 @@
+package messages
+
+import (
+	"time"
+)
+
+// PodUsage is a point-in-time sample of the resources consumed by the
+// containers of a pod that the executor launched for a mesos task.
+type PodUsage struct {
+	TaskId    string    `json:"taskId"`
+	PodName   string    `json:"podName"`   // kubelet "full" name of the pod
+	Cpus      float64   `json:"cpus"`      // avg cpu shares consumed since the previous sample
+	CpuTime   uint64    `json:"cpuTime"`   // cumulative cpu time consumed, in nanoseconds
+	Mem       float64   `json:"mem"`       // current memory usage, in MB
+	Timestamp time.Time `json:"timestamp"` // time at which the sample was taken
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	executorSubsystem = "executor"
+)
+
+var (
+	LaunchLatency = prometheus.NewSummary(
+		prometheus.SummaryOpts{
+			Subsystem: executorSubsystem,
+			Name:      "launch_latency_microseconds",
+			Help:      "Latency in microseconds between posting a pod's binding and reporting the pod-task running.",
+		},
+	)
+	LostTasks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: executorSubsystem,
+			Name:      "lost_tasks",
+			Help:      "Number of pod-tasks reported lost, by reason (e.g. containers that disappeared, or a launch that failed).",
+		},
+		[]string{"reason"},
+	)
+	SendFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: executorSubsystem,
+			Name:      "send_failures",
+			Help:      "Number of failed attempts to hand off an outbound message to the slave, by kind (status_update or framework_message).",
+		},
+		[]string{"kind"},
+	)
+	SendRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: executorSubsystem,
+			Name:      "send_retries",
+			Help:      "Number of repeated attempts to hand off an outbound message to the slave, by kind (status_update or framework_message).",
+		},
+		[]string{"kind"},
+	)
+	OutboxLength = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: executorSubsystem,
+			Name:      "outbox_length",
+			Help:      "Number of outbound status updates and messages awaiting delivery to the slave.",
+		},
+	)
+	OutboxEvictions = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Subsystem: executorSubsystem,
+			Name:      "outbox_evictions",
+			Help:      "Number of outbound messages dropped because the outbox was full.",
+		},
+	)
+	DaemonRestarts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: executorSubsystem,
+			Name:      "daemon_restarts",
+			Help:      "Number of restarts of supervised daemons, such as the kube-proxy, by daemon.",
+		},
+		[]string{"daemon"},
+	)
+)
+
+var registerMetrics sync.Once
+
+func Register() {
+	registerMetrics.Do(func() {
+		prometheus.MustRegister(LaunchLatency)
+		prometheus.MustRegister(LostTasks)
+		prometheus.MustRegister(SendFailures)
+		prometheus.MustRegister(SendRetries)
+		prometheus.MustRegister(OutboxLength)
+		prometheus.MustRegister(OutboxEvictions)
+		prometheus.MustRegister(DaemonRestarts)
+	})
+}
+
+func InMicroseconds(d time.Duration) float64 {
+	return float64(d.Nanoseconds() / time.Microsecond.Nanoseconds())
+}
@@ -0,0 +1,313 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	log "github.com/golang/glog"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/metrics"
+)
+
+const (
+	DefaultOutboxSize = 1024
+
+	// the journal is compacted once it holds this many times as many entries
+	// as the queue holds messages
+	outboxCompactionRatio = 4
+)
+
+type outboundKind int
+
+const (
+	statusUpdateKind outboundKind = iota
+	frameworkMessageKind
+)
+
+func (k outboundKind) String() string {
+	switch k {
+	case statusUpdateKind:
+		return "status_update"
+	case frameworkMessageKind:
+		return "framework_message"
+	}
+	return "unknown"
+}
+
+// an update destined for the slave that has not yet been handed off to the driver
+type outboundMessage struct {
+	Seq      uint64       `json:"seq"`
+	Kind     outboundKind `json:"kind"`
+	Key      string       `json:"key"`      // non-terminal messages with the same key supersede one another
+	Terminal bool         `json:"terminal"` // terminal messages are never coalesced
+	Data     []byte       `json:"data"`     // marshalled TaskStatus, or the framework message text
+}
+
+// Outbox is a bounded queue of outbound status updates and framework messages
+// that buffers them while the executor is disconnected from its slave. Pushing
+// never blocks: for each key (task) only the most recent non-terminal message
+// is retained along with any terminal message, and once the queue is full the
+// oldest message is evicted, preferring non-terminal messages. The queue is
+// optionally journaled to a file so that it survives executor restarts.
+type Outbox struct {
+	lock     sync.Mutex
+	path     string // file that the queue is journaled to; persistence is disabled if empty
+	size     int
+	seq      uint64
+	messages []*outboundMessage // ordered by seq
+	ready    chan struct{}      // signalled when a message is pushed
+	dropped  int                // number of evicted messages
+	journal  *os.File           // open for appending, nil if persistence is disabled
+	entries  int                // number of entries in the journal
+}
+
+// an entry of the journal, one per line. replaying the entries in order
+// rebuilds the queue, since coalescing and eviction are deterministic.
+type outboxEntry struct {
+	Push   *outboundMessage `json:"push,omitempty"`
+	Remove uint64           `json:"remove,omitempty"` // seq of a message handed off to the driver
+}
+
+// NewOutbox returns a queue of at most size messages. If path is not empty
+// then messages left over from a previous executor are restored from it.
+func NewOutbox(path string, size int) (*Outbox, error) {
+	if size <= 0 {
+		size = DefaultOutboxSize
+	}
+	o := &Outbox{
+		path:  path,
+		size:  size,
+		ready: make(chan struct{}, 1),
+	}
+	if path == "" {
+		return o, nil
+	}
+	if err := o.restore(); err != nil {
+		return nil, err
+	}
+	if len(o.messages) > 0 {
+		log.Infof("restored %d outbound messages from %v", len(o.messages), path)
+		o.signal()
+	}
+	metrics.OutboxLength.Set(float64(len(o.messages)))
+	if err := o.compact(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// replay the journal left over from a previous executor, if any
+func (o *Outbox) restore() error {
+	f, err := os.Open(o.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	for {
+		var entry outboxEntry
+		err := decoder.Decode(&entry)
+		switch {
+		case err == io.EOF:
+			return nil
+		case err == io.ErrUnexpectedEOF:
+			// the executor died while appending the last entry
+			log.Warningf("ignoring the truncated last entry of outbox %v", o.path)
+			return nil
+		case err != nil:
+			return fmt.Errorf("failed to restore outbox from %v: %v", o.path, err)
+		case entry.Push != nil:
+			if entry.Push.Seq > o.seq {
+				o.seq = entry.Push.Seq
+			}
+			o.add(entry.Push)
+		case entry.Remove != 0:
+			o.removeSeq(entry.Remove)
+		}
+	}
+}
+
+// Len returns the number of queued messages.
+func (o *Outbox) Len() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return len(o.messages)
+}
+
+// Dropped returns the number of messages that have been evicted because the queue was full.
+func (o *Outbox) Dropped() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.dropped
+}
+
+func (o *Outbox) signal() {
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+}
+
+// queue a message; never blocks.
+func (o *Outbox) push(kind outboundKind, key string, terminal bool, data []byte) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.seq++
+	msg := &outboundMessage{
+		Seq:      o.seq,
+		Kind:     kind,
+		Key:      key,
+		Terminal: terminal,
+		Data:     data,
+	}
+	o.add(msg)
+	metrics.OutboxLength.Set(float64(len(o.messages)))
+	o.record(&outboxEntry{Push: msg})
+	o.signal()
+}
+
+// assumes that the caller has acquired the lock
+func (o *Outbox) add(msg *outboundMessage) {
+	if !msg.Terminal {
+		superseded := -1
+		for i, m := range o.messages {
+			if m.Key != msg.Key {
+				continue
+			}
+			if m.Terminal {
+				log.V(1).Infof("discarding outbound message for %v, a terminal message is already queued", msg.Key)
+				return
+			}
+			superseded = i
+		}
+		if superseded >= 0 {
+			// supersede the earlier message, retaining its position in the queue
+			msg.Seq = o.messages[superseded].Seq
+			o.messages[superseded] = msg
+			return
+		}
+	}
+	if len(o.messages) >= o.size {
+		o.evict()
+	}
+	o.messages = append(o.messages, msg)
+}
+
+// drop the oldest non-terminal message, or else the oldest message.
+// assumes that the caller has acquired the lock
+func (o *Outbox) evict() {
+	victim := 0
+	for i, m := range o.messages {
+		if !m.Terminal {
+			victim = i
+			break
+		}
+	}
+	log.Warningf("outbox is full, dropping outbound message for %v", o.messages[victim].Key)
+	o.messages = append(o.messages[:victim], o.messages[victim+1:]...)
+	o.dropped++
+	metrics.OutboxEvictions.Inc()
+}
+
+// returns the oldest queued message, or nil if the queue is empty.
+func (o *Outbox) peek() *outboundMessage {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if len(o.messages) == 0 {
+		return nil
+	}
+	return o.messages[0]
+}
+
+// removes the given message, if it's still queued; a message that has been
+// superseded since it was peeked remains queued in its newer form.
+func (o *Outbox) remove(msg *outboundMessage) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for i, m := range o.messages {
+		if m == msg {
+			o.messages = append(o.messages[:i], o.messages[i+1:]...)
+			metrics.OutboxLength.Set(float64(len(o.messages)))
+			o.record(&outboxEntry{Remove: msg.Seq})
+			return
+		}
+	}
+}
+
+// assumes that the caller has acquired the lock
+func (o *Outbox) removeSeq(seq uint64) {
+	for i, m := range o.messages {
+		if m.Seq == seq {
+			o.messages = append(o.messages[:i], o.messages[i+1:]...)
+			return
+		}
+	}
+}
+
+// append an entry to the journal, compacting it instead once it has grown
+// large relative to the queue. assumes that the caller has acquired the lock
+func (o *Outbox) record(entry *outboxEntry) {
+	if o.journal == nil {
+		return
+	}
+	if o.entries >= outboxCompactionRatio*o.size {
+		err := o.compact()
+		if err == nil {
+			return
+		}
+		log.Errorf("failed to compact outbox: %v", err)
+		if o.journal == nil {
+			return
+		}
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("failed to marshal outbox entry: %v", err)
+		return
+	}
+	if _, err := o.journal.Write(append(data, '\n')); err != nil {
+		log.Errorf("failed to persist outbox: %v", err)
+		return
+	}
+	o.entries++
+}
+
+// rewrite the journal as a push of each queued message, replacing the
+// previous file atomically. assumes that the caller has acquired the lock
+func (o *Outbox) compact() error {
+	tmp, err := ioutil.TempFile(filepath.Dir(o.path), filepath.Base(o.path)+".")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(tmp)
+	for _, msg := range o.messages {
+		if err = encoder.Encode(&outboxEntry{Push: msg}); err != nil {
+			break
+		}
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), o.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if o.journal != nil {
+		o.journal.Close()
+	}
+	o.entries = len(o.messages)
+	o.journal, err = os.OpenFile(o.path, os.O_APPEND|os.O_WRONLY, 0644)
+	return err
+}
@@ -0,0 +1,258 @@
+package executor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// remove and return the contents of all queued messages, in delivery order
+func drain(o *Outbox) (result []string) {
+	for msg := o.peek(); msg != nil; msg = o.peek() {
+		result = append(result, string(msg.Data))
+		o.remove(msg)
+	}
+	return
+}
+
+// returns the current value of a counter or gauge
+func metricValue(t *testing.T, m prometheus.Metric) float64 {
+	pb := &dto.Metric{}
+	if err := m.Write(pb); err != nil {
+		t.Fatal(err)
+	}
+	if pb.Gauge != nil {
+		return pb.GetGauge().GetValue()
+	}
+	return pb.GetCounter().GetValue()
+}
+
+func TestOutboxCoalesce(t *testing.T) {
+	o, err := NewOutbox("", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.push(statusUpdateKind, "task:a", false, []byte("a-starting"))
+	o.push(statusUpdateKind, "task:b", false, []byte("b-starting"))
+	o.push(statusUpdateKind, "task:a", false, []byte("a-running"))
+	o.push(statusUpdateKind, "task:a", true, []byte("a-lost"))
+	o.push(statusUpdateKind, "task:a", false, []byte("a-running-again"))
+	o.push(frameworkMessageKind, "message:pod-usage:", false, []byte("usage-1"))
+	o.push(frameworkMessageKind, "message:pod-usage:", false, []byte("usage-2"))
+
+	expected := []string{"a-running", "b-starting", "a-lost", "usage-2"}
+	if actual := drain(o); fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v instead of %v", expected, actual)
+	}
+}
+
+func TestOutboxSupersededWhileSending(t *testing.T) {
+	o, _ := NewOutbox("", 10)
+	o.push(statusUpdateKind, "task:a", false, []byte("a-starting"))
+	msg := o.peek()
+	o.push(statusUpdateKind, "task:a", false, []byte("a-running"))
+	o.remove(msg)
+
+	if actual := drain(o); len(actual) != 1 || actual[0] != "a-running" {
+		t.Fatalf("expected the newer update to remain queued instead of %v", actual)
+	}
+}
+
+func TestOutboxBounded(t *testing.T) {
+	o, _ := NewOutbox("", 3)
+	o.push(statusUpdateKind, "task:a", true, []byte("a-lost"))
+	o.push(statusUpdateKind, "task:b", false, []byte("b-running"))
+	o.push(statusUpdateKind, "task:c", true, []byte("c-killed"))
+	o.push(statusUpdateKind, "task:d", true, []byte("d-failed"))
+
+	expected := []string{"a-lost", "c-killed", "d-failed"}
+	if actual := drain(o); fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Fatalf("expected the non-terminal update to be evicted: %v instead of %v", expected, actual)
+	}
+	if o.Dropped() != 1 {
+		t.Fatalf("expected 1 dropped message instead of %d", o.Dropped())
+	}
+
+	// once only terminal updates remain the oldest is evicted
+	for _, id := range []string{"e", "f", "g", "h"} {
+		o.push(statusUpdateKind, "task:"+id, true, []byte(id+"-lost"))
+	}
+	expected = []string{"f-lost", "g-lost", "h-lost"}
+	if actual := drain(o); fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v instead of %v", expected, actual)
+	}
+}
+
+func TestOutboxMetrics(t *testing.T) {
+	evictions := metricValue(t, metrics.OutboxEvictions)
+	o, _ := NewOutbox("", 2)
+	o.push(statusUpdateKind, "task:a", false, []byte("a-running"))
+	o.push(statusUpdateKind, "task:b", false, []byte("b-running"))
+	if n := metricValue(t, metrics.OutboxLength); n != 2 {
+		t.Fatalf("expected an outbox length of 2 instead of %v", n)
+	}
+	o.push(statusUpdateKind, "task:c", false, []byte("c-running"))
+	if n := metricValue(t, metrics.OutboxEvictions) - evictions; n != 1 {
+		t.Fatalf("expected 1 eviction instead of %v", n)
+	}
+	if n := metricValue(t, metrics.OutboxLength); n != 2 {
+		t.Fatalf("expected an outbox length of 2 instead of %v", n)
+	}
+	o.remove(o.peek())
+	if n := metricValue(t, metrics.OutboxLength); n != 1 {
+		t.Fatalf("expected an outbox length of 1 instead of %v", n)
+	}
+}
+
+func TestOutboxPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "outbox.json")
+
+	o, err := NewOutbox(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.push(statusUpdateKind, "task:a", false, []byte("a-running"))
+	o.push(statusUpdateKind, "task:b", true, []byte("b-lost"))
+	o.push(statusUpdateKind, "task:c", false, []byte("c-running"))
+	o.remove(o.peek())
+
+	// simulate an executor restart
+	restored, err := NewOutbox(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-restored.ready:
+	default:
+		t.Fatalf("expected a restored outbox to be ready for delivery")
+	}
+	restored.push(statusUpdateKind, "task:c", true, []byte("c-finished"))
+
+	expected := []string{"b-lost", "c-running", "c-finished"}
+	if actual := drain(restored); fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v instead of %v", expected, actual)
+	}
+
+	// a drained outbox is persisted as empty
+	if o, err = NewOutbox(path, 10); err != nil {
+		t.Fatal(err)
+	} else if o.Len() != 0 {
+		t.Fatalf("expected an empty outbox instead of %d messages", o.Len())
+	}
+
+	if err := ioutil.WriteFile(path, []byte("{garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewOutbox(path, 10); err == nil {
+		t.Fatalf("expected an error restoring a corrupt outbox")
+	}
+}
+
+func TestOutboxJournalCompaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "outbox.json")
+
+	o, err := NewOutbox(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		o.push(statusUpdateKind, "task:a", false, []byte(fmt.Sprintf("a-%d", i)))
+		o.push(frameworkMessageKind, "message:pod-usage:", false, []byte(fmt.Sprintf("usage-%d", i)))
+		if i%10 == 0 {
+			o.remove(o.peek())
+		}
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines > outboxCompactionRatio*2 {
+		t.Fatalf("expected the journal to be compacted instead of growing to %d entries", lines)
+	}
+
+	// the executor died while appending an entry
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"push":{"seq":1000,"kind":0,"key":"task:b"`)
+	f.Close()
+
+	restored, err := NewOutbox(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := drain(o)
+	if actual := drain(restored); fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Fatalf("expected %v instead of %v", expected, actual)
+	}
+}
+
+// many tasks report status while the executor is disconnected for a long time:
+// callers must never block and the latest and terminal states must survive.
+func TestOutboxLongDisconnection(t *testing.T) {
+	const tasks = 50
+	const updates = 1000
+
+	o, _ := NewOutbox("", 2*tasks)
+	var wg sync.WaitGroup
+	for i := 0; i < tasks; i++ {
+		wg.Add(1)
+		go func(task string) {
+			defer wg.Done()
+			for j := 0; j < updates; j++ {
+				o.push(statusUpdateKind, task, false, []byte(fmt.Sprintf("%s-%d", task, j)))
+			}
+			o.push(statusUpdateKind, task, true, []byte(task+"-lost"))
+		}(fmt.Sprintf("task:%d", i))
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for status updates to be queued")
+	}
+
+	if o.Dropped() != 0 {
+		t.Fatalf("expected no dropped messages instead of %d", o.Dropped())
+	}
+	delivered := map[string][]string{}
+	for _, data := range drain(o) {
+		task := data[:strings.LastIndex(data, "-")]
+		delivered[task] = append(delivered[task], data)
+	}
+	if len(delivered) != tasks {
+		t.Fatalf("expected updates for %d tasks instead of %d", tasks, len(delivered))
+	}
+	for i := 0; i < tasks; i++ {
+		task := fmt.Sprintf("task:%d", i)
+		expected := []string{fmt.Sprintf("%s-%d", task, updates-1), task + "-lost"}
+		if actual := delivered[task]; fmt.Sprint(actual) != fmt.Sprint(expected) {
+			t.Fatalf("expected %v instead of %v", expected, actual)
+		}
+	}
+}
@@ -1,13 +1,14 @@
 package service
 
 import (
-	"bufio"
 	"fmt"
-	"io"
+	"io/ioutil"
 	"math/rand"
 	"net"
+	"net/http"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -22,12 +23,21 @@ import (
 	log "github.com/golang/glog"
 	bindings "github.com/mesos/mesos-go/executor"
 	"github.com/mesosphere/kubernetes-mesos/pkg/executor"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/config"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/metrics"
+	"github.com/mesosphere/kubernetes-mesos/pkg/trace"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/spf13/pflag"
 )
 
 const (
 	MESOS_CFG_SOURCE = "mesos" // @see ConfigSourceAnnotationKey
+
+	daemonHealthReportInterval = 30 * time.Second
+	sidecarLogMaxSize          = 10 * 1024 * 1024 // bytes
+	sidecarLogMaxBackups       = 5
 )
 
 type KubeletExecutorServer struct {
@@ -37,6 +47,12 @@ type KubeletExecutorServer struct {
 	ProxyExec              string
 	ProxyLogfile           string
 	ProxyBindall           bool
+	ProxyLogMaxSize        int
+	ProxyLogMaxBackups     int
+	SidecarConfig          string
+	OutboxPath             string
+	OutboxSize             int
+	TraceFile              string
 	TotalMaxDeadContainers uint
 }
 
@@ -46,6 +62,9 @@ func NewKubeletExecutorServer() *KubeletExecutorServer {
 		RunProxy:               true,
 		ProxyExec:              "./kube-proxy",
 		ProxyLogfile:           "./proxy-log",
+		ProxyLogMaxSize:        10, // MB
+		ProxyLogMaxBackups:     5,
+		OutboxSize:             executor.DefaultOutboxSize,
 		TotalMaxDeadContainers: 20, // arbitrary
 	}
 	if pwd, err := os.Getwd(); err != nil {
@@ -64,6 +83,12 @@ func (s *KubeletExecutorServer) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&s.ProxyExec, "proxy_exec", s.ProxyExec, "Path to the kube-proxy executable.")
 	fs.StringVar(&s.ProxyLogfile, "proxy_logfile", s.ProxyLogfile, "Path to the kube-proxy log file.")
 	fs.BoolVar(&s.ProxyBindall, "proxy_bindall", s.ProxyBindall, "When true will cause kube-proxy to bind to 0.0.0.0.")
+	fs.IntVar(&s.ProxyLogMaxSize, "proxy_log_max_size", s.ProxyLogMaxSize, "Size in MB beyond which the kube-proxy log file is rotated, 0 disables rotation.")
+	fs.IntVar(&s.ProxyLogMaxBackups, "proxy_log_max_backups", s.ProxyLogMaxBackups, "Number of rotated kube-proxy log files to retain.")
+	fs.StringVar(&s.SidecarConfig, "sidecar_config", s.SidecarConfig, "Path to a YAML or JSON file that declares sidecar daemons to run alongside this kubelet-executor.")
+	fs.StringVar(&s.OutboxPath, "outbox_path", s.OutboxPath, "Path to the file in which undelivered status updates are persisted across executor restarts; defaults to a file in the root directory.")
+	fs.IntVar(&s.OutboxSize, "outbox_size", s.OutboxSize, "Max number of undelivered status updates and messages to buffer while disconnected from the slave.")
+	fs.StringVar(&s.TraceFile, "trace_file", s.TraceFile, "If non-empty, path of a file to which the spans that trace task launches are appended, as Zipkin v2 JSON.")
 	fs.UintVar(&s.TotalMaxDeadContainers, "total_max_dead_containers", s.TotalMaxDeadContainers, "Max number of dead containers that GC allows to linger.")
 }
 
@@ -161,6 +186,10 @@ func (ks *KubeletExecutorServer) createAndInitKubelet(kc *server.KubeletConfig,
 	if err != nil {
 		return nil, nil, err
 	}
+	sidecars, err := ks.loadSidecars()
+	if err != nil {
+		return nil, nil, err
+	}
 	k := &kubeletExecutor{
 		Kubelet:                kubelet,
 		finished:               finished,
@@ -169,6 +198,10 @@ func (ks *KubeletExecutorServer) createAndInitKubelet(kc *server.KubeletConfig,
 		proxyExec:              ks.ProxyExec,
 		proxyLogfile:           ks.ProxyLogfile,
 		proxyBindall:           ks.ProxyBindall,
+		proxyLogMaxSize:        int64(ks.ProxyLogMaxSize) * 1024 * 1024,
+		proxyLogMaxBackups:     ks.ProxyLogMaxBackups,
+		supervisor:             NewSupervisor(),
+		sidecars:               sidecars,
 		address:                ks.Address,
 		etcdServerList:         ks.EtcdServerList,
 		etcdConfigFile:         ks.EtcdConfigFile,
@@ -176,7 +209,27 @@ func (ks *KubeletExecutorServer) createAndInitKubelet(kc *server.KubeletConfig,
 		dockerClient:           kc.DockerClient,
 	}
 
-	exec := executor.New(k.Kubelet, updates, MESOS_CFG_SOURCE, kc.KubeClient, watch, kc.DockerClient)
+	outboxPath := ks.OutboxPath
+	if outboxPath == "" {
+		outboxPath = filepath.Join(ks.RootDirectory, "executor-outbox.json")
+	}
+	outbox, err := executor.NewOutbox(outboxPath, ks.OutboxSize)
+	if err != nil {
+		log.Errorf("discarding undelivered executor updates: %v", err)
+		os.Remove(outboxPath)
+		if outbox, err = executor.NewOutbox(outboxPath, ks.OutboxSize); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var tracer *trace.Tracer
+	if ks.TraceFile != "" {
+		if tracer, err = trace.NewFileTracer("k8sm-executor", ks.TraceFile); err != nil {
+			log.Errorf("task launches will not be traced: %v", err)
+		}
+	}
+
+	exec := executor.New(executor.KubeletPodStatus(k.Kubelet), updates, MESOS_CFG_SOURCE, kc.KubeClient, watch, kc.DockerClient, outbox, tracer)
 	dconfig := bindings.DriverConfig{
 		Executor:         exec,
 		HostnameOverride: ks.HostnameOverride,
@@ -187,6 +240,7 @@ func (ks *KubeletExecutorServer) createAndInitKubelet(kc *server.KubeletConfig,
 	} else {
 		k.driver = driver
 	}
+	k.executor = exec
 
 	log.V(2).Infof("Initialize executor driver...")
 
@@ -204,12 +258,17 @@ type kubeletExecutor struct {
 	*kubelet.Kubelet
 	initialize             sync.Once
 	driver                 bindings.ExecutorDriver
+	executor               *executor.KubernetesExecutor
 	finished               chan struct{} // closed once driver.Run() completes
 	runProxy               bool
 	proxyLogV              int
 	proxyExec              string
 	proxyLogfile           string
 	proxyBindall           bool
+	proxyLogMaxSize        int64
+	proxyLogMaxBackups     int
+	supervisor             *Supervisor
+	sidecars               []config.Sidecar
 	address                util.IP
 	etcdServerList         util.StringList
 	etcdConfigFile         string
@@ -222,10 +281,19 @@ func (kl *kubeletExecutor) ListenAndServe(address net.IP, port uint, enableDebug
 	// so only execute certain initialization procs once
 	kl.initialize.Do(func() {
 		if kl.runProxy {
-			go util.Forever(kl.runProxyService, 5*time.Second)
+			if err := kl.supervisor.Start(kl.proxyDaemonConfig()); err != nil {
+				log.Errorf("failed to start proxy: %v", err)
+			}
 		}
+		for i := range kl.sidecars {
+			if err := kl.supervisor.Start(sidecarDaemonConfig(&kl.sidecars[i])); err != nil {
+				log.Errorf("failed to start sidecar %v: %v", kl.sidecars[i].Name, err)
+			}
+		}
+		go kl.reportDaemonHealth()
 		go func() {
 			defer close(kl.finished)
+			defer kl.supervisor.Stop()
 			if _, err := kl.driver.Run(); err != nil {
 				log.Fatalf("failed to start executor driver: %v", err)
 			}
@@ -236,17 +304,32 @@ func (kl *kubeletExecutor) ListenAndServe(address net.IP, port uint, enableDebug
 		// @see reconcileTasks
 	})
 	log.Infof("Starting kubelet server...")
-	kubelet.ListenAndServeKubeletServer(kl, address, port, enableDebuggingHandlers)
+
+	// cloned from kubelet.ListenAndServeKubeletServer so that we can install
+	// executor-specific handlers alongside those of the kubelet
+	handler := kubelet.NewServer(kl, enableDebuggingHandlers)
+	mux := http.NewServeMux()
+	mux.Handle("/", &handler)
+	kl.executor.InstallDebugHandlers(mux)
+	kl.supervisor.InstallHandlers(mux)
+	metrics.Register()
+	mux.Handle("/metrics", prometheus.Handler())
+
+	s := &http.Server{
+		Addr:           net.JoinHostPort(address.String(), strconv.FormatUint(uint64(port), 10)),
+		Handler:        mux,
+		ReadTimeout:    5 * time.Minute,
+		WriteTimeout:   5 * time.Minute,
+		MaxHeaderBytes: 1 << 20,
+	}
+	log.Fatal(s.ListenAndServe())
 }
 
-// this function blocks as long as the proxy service is running; intended to be
-// executed asynchronously.
-func (kl *kubeletExecutor) runProxyService() {
+// returns the configuration of the supervised kube-proxy daemon
+func (kl *kubeletExecutor) proxyDaemonConfig() DaemonConfig {
 	// TODO(jdef): would be nice if we could run the proxy via an in-memory
 	// kubelet config source (in case it crashes, kubelet would restart it);
 	// not sure that k8s supports host-networking space for pods
-	log.Infof("Starting proxy process...")
-
 	bindAddress := "0.0.0.0"
 	if !kl.proxyBindall {
 		bindAddress = kl.address.String()
@@ -262,52 +345,65 @@ func (kl *kubeletExecutor) runProxyService() {
 	} else if kl.etcdConfigFile != "" {
 		args = append(args, "--etcd_config="+kl.etcdConfigFile)
 	}
-
-	log.Infof("Spawning process executable %s with args '%+v'", kl.proxyExec, args)
-
-	cmd := exec.Command(kl.proxyExec, args...)
-	_, err := cmd.StdoutPipe()
-	if err != nil {
-		log.Fatal(err)
+	return DaemonConfig{
+		Name:       "kube-proxy",
+		Exec:       kl.proxyExec,
+		Args:       args,
+		Logfile:    kl.proxyLogfile,
+		MaxLogSize: kl.proxyLogMaxSize,
+		MaxLogs:    kl.proxyLogMaxBackups,
 	}
+}
 
-	proxylogs, err := cmd.StderrPipe()
-	if err != nil {
-		log.Fatal(err)
+func (ks *KubeletExecutorServer) loadSidecars() ([]config.Sidecar, error) {
+	if ks.SidecarConfig == "" {
+		return nil, nil
 	}
-
-	//TODO(jdef) append instead of truncate? what if the disk is full?
-	logfile, err := os.Create(kl.proxyLogfile)
+	data, err := ioutil.ReadFile(ks.SidecarConfig)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	defer logfile.Close()
-
-	go func() {
-		defer func() {
-			log.Infof("killing proxy process..")
-			if err = cmd.Process.Kill(); err != nil {
-				log.Errorf("failed to kill proxy process: %v", err)
-			}
-		}()
+	return config.ParseSidecars(data)
+}
 
-		writer := bufio.NewWriter(logfile)
-		defer writer.Flush()
+// returns the configuration of a supervised sidecar daemon; the sidecar
+// executable is expected to have been fetched into the sandbox by mesos.
+func sidecarDaemonConfig(sidecar *config.Sidecar) DaemonConfig {
+	return DaemonConfig{
+		Name:       sidecar.Name,
+		Exec:       "./" + sidecar.Executable(),
+		Args:       sidecar.Args,
+		Env:        sidecar.Environ(),
+		Logfile:    fmt.Sprintf("./%s-log", sidecar.Name),
+		MaxLogSize: sidecarLogMaxSize,
+		MaxLogs:    sidecarLogMaxBackups,
+		Restart:    sidecar.Restart,
+	}
+}
 
-		written, err := io.Copy(writer, proxylogs)
-		if err != nil {
-			log.Errorf("error writing data to proxy log: %v", err)
+// periodically report the health of supervised daemons to the scheduler,
+// until the executor driver terminates.
+func (kl *kubeletExecutor) reportDaemonHealth() {
+	for {
+		select {
+		case <-kl.finished:
+			return
+		case <-time.After(daemonHealthReportInterval):
+		}
+		status := kl.supervisor.Status()
+		health := make([]messages.DaemonHealth, 0, len(status))
+		for _, st := range status {
+			health = append(health, messages.DaemonHealth{
+				Name:      st.Name,
+				State:     string(st.State),
+				Healthy:   st.Healthy,
+				Restarts:  st.Restarts,
+				LastError: st.LastError,
+			})
+		}
+		if len(health) > 0 {
+			kl.executor.ReportDaemonHealth(health)
 		}
-
-		log.Infof("wrote %d bytes to proxy log", written)
-	}()
-
-	// if the proxy fails to start then we exit the executor, otherwise
-	// wait for the proxy process to end (and release resources after).
-	if err := cmd.Start(); err != nil {
-		log.Fatal(err)
-	} else if err := cmd.Wait(); err != nil {
-		log.Error(err)
 	}
 }
 
@@ -0,0 +1,353 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/config"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/metrics"
+	"github.com/mesosphere/kubernetes-mesos/pkg/rotate"
+)
+
+const (
+	defaultDaemonMinBackoff      = 1 * time.Second
+	defaultDaemonMaxBackoff      = 2 * time.Minute
+	defaultDaemonHealthInterval  = 30 * time.Second
+	defaultDaemonHealthThreshold = 3 // consecutive failed health checks before a daemon is restarted
+)
+
+type DaemonState string
+
+const (
+	DaemonStarting = DaemonState("starting")
+	DaemonRunning  = DaemonState("running")
+	DaemonBackoff  = DaemonState("backoff")
+	DaemonStopped  = DaemonState("stopped")
+)
+
+// DaemonConfig describes a long-running child process of the executor.
+type DaemonConfig struct {
+	Name       string
+	Exec       string
+	Args       []string
+	Env        []string // appended to the environment of the executor
+	Logfile    string   // receives the stdout and stderr of the daemon
+	MaxLogSize int64    // size in bytes beyond which the log is rotated; rotation is disabled if <= 0
+	MaxLogs    int      // number of rotated logs to retain
+
+	MinBackoff time.Duration // initial delay between restarts
+	MaxBackoff time.Duration // max delay between restarts; a daemon that runs this long resets its backoff
+
+	// optional; if nil the daemon is healthy for as long as its process is alive
+	HealthCheck     func() error
+	HealthInterval  time.Duration
+	HealthThreshold int                  // consecutive health check failures that trigger a restart
+	Restart         config.RestartPolicy // defaults to config.RestartAlways
+}
+
+// DaemonStatus is a snapshot of the state of a supervised daemon.
+type DaemonStatus struct {
+	Name            string      `json:"name"`
+	State           DaemonState `json:"state"`
+	Pid             int         `json:"pid,omitempty"`
+	Restarts        int         `json:"restarts"`
+	Healthy         bool        `json:"healthy"`
+	LastStart       time.Time   `json:"lastStart,omitempty"`
+	LastExit        time.Time   `json:"lastExit,omitempty"`
+	LastError       string      `json:"lastError,omitempty"`
+	LastHealthCheck time.Time   `json:"lastHealthCheck,omitempty"`
+}
+
+type daemon struct {
+	config  DaemonConfig
+	lock    sync.RWMutex
+	status  DaemonStatus
+	process *os.Process
+	failed  int // consecutive failed health checks
+}
+
+// Supervisor runs a set of daemons, restarting them with exponential backoff
+// whenever they exit or fail their health checks.
+type Supervisor struct {
+	lock    sync.RWMutex
+	daemons map[string]*daemon
+	done    chan struct{}
+	stopped sync.Once
+}
+
+func NewSupervisor() *Supervisor {
+	return &Supervisor{
+		daemons: make(map[string]*daemon),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start begins supervision of the configured daemon and returns immediately.
+func (s *Supervisor) Start(dc DaemonConfig) error {
+	if dc.Name == "" || dc.Exec == "" {
+		return fmt.Errorf("daemon name and executable are required")
+	}
+	if dc.MinBackoff <= 0 {
+		dc.MinBackoff = defaultDaemonMinBackoff
+	}
+	if dc.MaxBackoff < dc.MinBackoff {
+		dc.MaxBackoff = defaultDaemonMaxBackoff
+		if dc.MaxBackoff < dc.MinBackoff {
+			dc.MaxBackoff = dc.MinBackoff
+		}
+	}
+	if dc.HealthInterval <= 0 {
+		dc.HealthInterval = defaultDaemonHealthInterval
+	}
+	if dc.HealthThreshold <= 0 {
+		dc.HealthThreshold = defaultDaemonHealthThreshold
+	}
+	if dc.Restart == "" {
+		dc.Restart = config.RestartAlways
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, found := s.daemons[dc.Name]; found {
+		return fmt.Errorf("daemon %q is already supervised", dc.Name)
+	}
+	d := &daemon{
+		config: dc,
+		status: DaemonStatus{Name: dc.Name, State: DaemonStarting},
+	}
+	s.daemons[dc.Name] = d
+	go d.supervise(s.done)
+	go d.monitorHealth(s.done)
+	return nil
+}
+
+// Stop terminates all supervised daemons; they will not be restarted.
+func (s *Supervisor) Stop() {
+	s.stopped.Do(func() {
+		close(s.done)
+		s.lock.RLock()
+		defer s.lock.RUnlock()
+		for _, d := range s.daemons {
+			d.kill()
+		}
+	})
+}
+
+// Status returns a snapshot of the status of all supervised daemons, ordered by name.
+func (s *Supervisor) Status() []DaemonStatus {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	result := make([]DaemonStatus, 0, len(s.daemons))
+	for _, d := range s.daemons {
+		result = append(result, d.getStatus())
+	}
+	sort.Sort(byDaemonName(result))
+	return result
+}
+
+// InstallHandlers registers the supervisor status endpoint with the given mux.
+func (s *Supervisor) InstallHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/executor/daemons", func(w http.ResponseWriter, r *http.Request) {
+		data, err := json.Marshal(s.Status())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+}
+
+type byDaemonName []DaemonStatus
+
+func (s byDaemonName) Len() int           { return len(s) }
+func (s byDaemonName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s byDaemonName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (d *daemon) getStatus() DaemonStatus {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.status
+}
+
+func (d *daemon) kill() {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if d.process != nil {
+		log.Infof("killing %s process %d", d.config.Name, d.process.Pid)
+		if err := d.process.Kill(); err != nil {
+			log.Errorf("failed to kill %s process: %v", d.config.Name, err)
+		}
+	}
+}
+
+// restart the daemon until the supervisor is stopped; intended to be executed
+// asynchronously.
+func (d *daemon) supervise(done <-chan struct{}) {
+	backoff := d.config.MinBackoff
+	for {
+		select {
+		case <-done:
+			d.setState(DaemonStopped)
+			return
+		default:
+		}
+
+		started := time.Now()
+		err := d.run(done)
+		if d.config.Restart == config.RestartNever || (err == nil && d.config.Restart == config.RestartOnFailure) {
+			log.Infof("%s exited, will not restart per policy %v", d.config.Name, d.config.Restart)
+			d.setState(DaemonStopped)
+			return
+		}
+		if time.Since(started) >= d.config.MaxBackoff {
+			// ran long enough to be considered stable
+			backoff = d.config.MinBackoff
+		}
+
+		d.lock.Lock()
+		d.status.State = DaemonBackoff
+		d.status.Restarts++
+		d.lock.Unlock()
+		metrics.DaemonRestarts.WithLabelValues(d.config.Name).Inc()
+
+		log.Infof("restarting %s in %v", d.config.Name, backoff)
+		select {
+		case <-done:
+			d.setState(DaemonStopped)
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > d.config.MaxBackoff {
+			backoff = d.config.MaxBackoff
+		}
+	}
+}
+
+func (d *daemon) setState(state DaemonState) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.status.State = state
+}
+
+// spawn the daemon process and block until it exits.
+func (d *daemon) run(done <-chan struct{}) (err error) {
+	defer func() {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		d.process = nil
+		d.status.Pid = 0
+		d.status.Healthy = false
+		d.status.LastExit = time.Now()
+		if err != nil {
+			d.status.LastError = err.Error()
+			log.Errorf("%s exited: %v", d.config.Name, err)
+		} else {
+			d.status.LastError = ""
+		}
+	}()
+
+	var logfile io.WriteCloser
+	if d.config.Logfile != "" {
+		if logfile, err = rotate.Open(d.config.Logfile, d.config.MaxLogSize, d.config.MaxLogs); err != nil {
+			return err
+		}
+		defer logfile.Close()
+	}
+
+	log.Infof("Spawning process executable %s with args '%+v'", d.config.Exec, d.config.Args)
+	cmd := exec.Command(d.config.Exec, d.config.Args...)
+	if len(d.config.Env) > 0 {
+		cmd.Env = append(os.Environ(), d.config.Env...)
+	}
+	if logfile != nil {
+		cmd.Stdout = logfile
+		cmd.Stderr = logfile
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+
+	func() {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		d.process = cmd.Process
+		d.failed = 0
+		d.status.State = DaemonRunning
+		d.status.Pid = cmd.Process.Pid
+		d.status.Healthy = true
+		d.status.LastStart = time.Now()
+	}()
+
+	// the supervisor may have been stopped while we were starting up
+	select {
+	case <-done:
+		d.kill()
+	default:
+	}
+	return cmd.Wait()
+}
+
+// periodically check the health of the daemon, killing (and so restarting) it
+// after too many consecutive failures.
+func (d *daemon) monitorHealth(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(d.config.HealthInterval):
+			d.checkHealth()
+		}
+	}
+}
+
+func (d *daemon) checkHealth() {
+	d.lock.RLock()
+	process := d.process
+	d.lock.RUnlock()
+	if process == nil {
+		return
+	}
+
+	var err error
+	if d.config.HealthCheck != nil {
+		err = d.config.HealthCheck()
+	} else {
+		err = process.Signal(syscall.Signal(0))
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.process != process {
+		// restarted while we were checking, the result is stale
+		return
+	}
+	d.status.LastHealthCheck = time.Now()
+	if err == nil {
+		d.failed = 0
+		d.status.Healthy = true
+		return
+	}
+
+	d.failed++
+	d.status.Healthy = false
+	d.status.LastError = fmt.Sprintf("health check failed: %v", err)
+	log.Warningf("%s failed health check (%d/%d): %v", d.config.Name, d.failed, d.config.HealthThreshold, err)
+	if d.failed >= d.config.HealthThreshold {
+		log.Warningf("killing unhealthy %s process %d", d.config.Name, process.Pid)
+		if err := process.Kill(); err != nil {
+			log.Errorf("failed to kill %s process: %v", d.config.Name, err)
+		}
+	}
+}
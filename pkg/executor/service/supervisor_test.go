@@ -0,0 +1,100 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/config"
+)
+
+func awaitStatus(t *testing.T, s *Supervisor, f func(DaemonStatus) bool) DaemonStatus {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if st := s.Status(); len(st) == 1 && f(st[0]) {
+			return st[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for daemon status, last seen %+v", s.Status())
+	return DaemonStatus{}
+}
+
+func TestSupervisorRestartsFailedDaemon(t *testing.T) {
+	s := NewSupervisor()
+	defer s.Stop()
+
+	err := s.Start(DaemonConfig{
+		Name:       "fails",
+		Exec:       "/bin/sh",
+		Args:       []string{"-c", "exit 1"},
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := awaitStatus(t, s, func(st DaemonStatus) bool { return st.Restarts >= 3 })
+	if st.LastError == "" {
+		t.Fatalf("expected an exit error to be recorded: %+v", st)
+	}
+	if err := s.Start(DaemonConfig{Name: "fails", Exec: "/bin/true"}); err == nil {
+		t.Fatalf("expected an error when supervising a daemon twice")
+	}
+}
+
+func TestSupervisorMissingExecutable(t *testing.T) {
+	s := NewSupervisor()
+	defer s.Stop()
+
+	err := s.Start(DaemonConfig{
+		Name:       "missing",
+		Exec:       "/does/not/exist",
+		MinBackoff: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a failed start must not take down the supervisor, it's just retried
+	awaitStatus(t, s, func(st DaemonStatus) bool { return st.Restarts >= 2 && st.LastError != "" })
+}
+
+func TestSupervisorCompletedDaemon(t *testing.T) {
+	s := NewSupervisor()
+	defer s.Stop()
+
+	err := s.Start(DaemonConfig{
+		Name:    "once",
+		Exec:    "/bin/sh",
+		Args:    []string{"-c", "exit 0"},
+		Restart: config.RestartOnFailure,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := awaitStatus(t, s, func(st DaemonStatus) bool { return st.State == DaemonStopped })
+	if st.Restarts != 0 {
+		t.Fatalf("expected no restarts of a completed daemon: %+v", st)
+	}
+}
+
+func TestSupervisorHealthCheck(t *testing.T) {
+	s := NewSupervisor()
+
+	err := s.Start(DaemonConfig{
+		Name:            "unhealthy",
+		Exec:            "/bin/sh",
+		Args:            []string{"-c", "sleep 60"},
+		MinBackoff:      10 * time.Millisecond,
+		HealthCheck:     func() error { return fmt.Errorf("sick") },
+		HealthInterval:  10 * time.Millisecond,
+		HealthThreshold: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	awaitStatus(t, s, func(st DaemonStatus) bool { return st.Restarts >= 1 })
+
+	s.Stop()
+	awaitStatus(t, s, func(st DaemonStatus) bool { return st.State == DaemonStopped })
+}
@@ -0,0 +1,124 @@
+package executor
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+const maxStateHistory = 100 // number of state transitions to remember
+
+type stateType int32
+
+const (
+	disconnectedState stateType = iota
+	connectedState
+	doneState
+)
+
+func (s stateType) String() string {
+	switch s {
+	case disconnectedState:
+		return "disconnected"
+	case connectedState:
+		return "connected"
+	case doneState:
+		return "done"
+	}
+	return "unknown"
+}
+
+func (s stateType) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// callbacks of the executor driver that affect the connection state of the executor
+type stateEvent string
+
+const (
+	registeredEvent   = stateEvent("registered")
+	reregisteredEvent = stateEvent("reregistered")
+	disconnectedEvent = stateEvent("disconnected")
+	shutdownEvent     = stateEvent("shutdown")
+)
+
+// the connection state that results from an event, indexed by current state.
+// events that are missing from the table are unexpected in that state and
+// leave it unchanged.
+var stateTransitions = map[stateType]map[stateEvent]stateType{
+	disconnectedState: {
+		registeredEvent:   connectedState,
+		reregisteredEvent: connectedState,
+		shutdownEvent:     doneState,
+	},
+	connectedState: {
+		// a slave that restarts may register us again without first
+		// reporting a disconnect
+		registeredEvent:   connectedState,
+		reregisteredEvent: connectedState,
+		disconnectedEvent: disconnectedState,
+		shutdownEvent:     doneState,
+	},
+	doneState: {},
+}
+
+type stateTransition struct {
+	Event     stateEvent `json:"event"`
+	From      stateType  `json:"from"`
+	To        stateType  `json:"to"`
+	Expected  bool       `json:"expected"` // false if the event was unexpected in the from state
+	Timestamp time.Time  `json:"timestamp"`
+}
+
+// tracks the connection state of the executor along with a bounded history
+// of the events that it has observed.
+type stateMachine struct {
+	lock    sync.RWMutex
+	state   stateType
+	history []stateTransition // oldest first
+}
+
+func newStateMachine() *stateMachine {
+	return &stateMachine{state: disconnectedState}
+}
+
+func (m *stateMachine) get() stateType {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.state
+}
+
+// apply the event to the current state and return the resulting transition.
+// unexpected events are logged and recorded but never fatal.
+func (m *stateMachine) fire(event stateEvent) stateTransition {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	t := stateTransition{
+		Event:     event,
+		From:      m.state,
+		Timestamp: time.Now(),
+	}
+	t.To, t.Expected = stateTransitions[m.state][event]
+	if !t.Expected {
+		t.To = m.state
+		log.Warningf("ignoring unexpected %v event in %v state", event, m.state)
+	} else {
+		log.V(1).Infof("executor state %v -> %v upon %v event", t.From, t.To, event)
+	}
+	m.state = t.To
+
+	if len(m.history) >= maxStateHistory {
+		m.history = append(m.history[:0], m.history[1:]...)
+	}
+	m.history = append(m.history, t)
+	return t
+}
+
+// return a copy of the transition history, oldest first
+func (m *stateMachine) transitions() []stateTransition {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return append([]stateTransition(nil), m.history...)
+}
@@ -0,0 +1,108 @@
+package executor
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var allStateEvents = []stateEvent{registeredEvent, reregisteredEvent, disconnectedEvent, shutdownEvent}
+
+// returns every sequence of events of the given length
+func eventSequences(length int) [][]stateEvent {
+	if length == 0 {
+		return [][]stateEvent{{}}
+	}
+	result := [][]stateEvent{}
+	for _, prefix := range eventSequences(length - 1) {
+		for _, e := range allStateEvents {
+			seq := append(append([]stateEvent{}, prefix...), e)
+			result = append(result, seq)
+		}
+	}
+	return result
+}
+
+// the state that the executor should end up in after observing the events:
+// nothing matters after a shutdown, otherwise the most recent (re)registration
+// or disconnection wins.
+func expectedState(events []stateEvent) stateType {
+	state := disconnectedState
+	for _, e := range events {
+		switch e {
+		case shutdownEvent:
+			return doneState
+		case registeredEvent, reregisteredEvent:
+			state = connectedState
+		case disconnectedEvent:
+			state = disconnectedState
+		}
+	}
+	return state
+}
+
+func TestStateMachineCallbackOrderings(t *testing.T) {
+	for length := 1; length <= 5; length++ {
+		for _, events := range eventSequences(length) {
+			m := newStateMachine()
+			for i, e := range events {
+				from := m.get()
+				tr := m.fire(e)
+				if tr.From != from || tr.To != m.get() || tr.Event != e {
+					t.Fatalf("%v: unexpected transition %+v at event %d", events, tr, i)
+				}
+				expected := expectedState(events[:i+1])
+				if tr.To != expected {
+					t.Fatalf("%v: expected state %v instead of %v", events, expected, tr.To)
+				}
+				unexpected := from == doneState || (from == disconnectedState && e == disconnectedEvent)
+				if tr.Expected == unexpected {
+					t.Fatalf("%v: event %v in state %v should have expected=%v", events, e, from, !unexpected)
+				}
+			}
+			if h := m.transitions(); len(h) != len(events) {
+				t.Fatalf("%v: expected %d transitions in history instead of %d", events, len(events), len(h))
+			}
+		}
+	}
+}
+
+func TestStateMachineHistoryBounded(t *testing.T) {
+	m := newStateMachine()
+	for i := 0; i < maxStateHistory+10; i++ {
+		if i%2 == 0 {
+			m.fire(registeredEvent)
+		} else {
+			m.fire(disconnectedEvent)
+		}
+	}
+	m.fire(shutdownEvent)
+
+	h := m.transitions()
+	if len(h) != maxStateHistory {
+		t.Fatalf("expected %d transitions instead of %d", maxStateHistory, len(h))
+	}
+	if last := h[len(h)-1]; last.Event != shutdownEvent || last.To != doneState {
+		t.Fatalf("expected the most recent transition to be a shutdown instead of %+v", last)
+	}
+	for i := 1; i < len(h); i++ {
+		if h[i].From != h[i-1].To {
+			t.Fatalf("history is not contiguous at %d: %+v then %+v", i, h[i-1], h[i])
+		}
+	}
+}
+
+func TestStateTransitionJson(t *testing.T) {
+	m := newStateMachine()
+	m.fire(reregisteredEvent)
+	data, err := json.Marshal(m.transitions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(data)
+	for _, expected := range []string{`"event":"reregistered"`, `"from":"disconnected"`, `"to":"connected"`, `"expected":true`} {
+		if !strings.Contains(s, expected) {
+			t.Fatalf("expected %s in %s", expected, s)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet/dockertools"
+	log "github.com/golang/glog"
+	bindings "github.com/mesos/mesos-go/executor"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
+)
+
+const (
+	usageReportInterval = 30 * time.Second
+	defaultCgroupRoot   = "/sys/fs/cgroup"
+)
+
+// source of per-container resource accounting data
+type containerStats interface {
+	// cumulative cpu time consumed by the container, in nanoseconds
+	cpuTime(containerId string) (uint64, error)
+	// current memory usage of the container, in bytes
+	memUsage(containerId string) (uint64, error)
+}
+
+// reads docker container accounting data straight from the cgroup filesystem;
+// this is the same data that the kubelet (via cadvisor) would otherwise report.
+type cgroupStats struct {
+	root string // mount point of the cgroup hierarchies, usually /sys/fs/cgroup
+}
+
+// returns the path of the cgroup file for the given container, trying both
+// the cgroupfs (docker/<id>) and systemd (system.slice/docker-<id>.scope) layouts.
+func (c *cgroupStats) path(subsystem, containerId, file string) (string, error) {
+	candidates := []string{
+		filepath.Join(c.root, subsystem, "docker", containerId, file),
+		filepath.Join(c.root, subsystem, "system.slice", "docker-"+containerId+".scope", file),
+	}
+	for _, p := range candidates {
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no %s cgroup found for container %v", subsystem, containerId)
+}
+
+func (c *cgroupStats) readUint(subsystem, containerId, file string) (uint64, error) {
+	p, err := c.path(subsystem, containerId, file)
+	if err != nil {
+		return 0, err
+	}
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+func (c *cgroupStats) cpuTime(containerId string) (uint64, error) {
+	return c.readUint("cpuacct", containerId, "cpuacct.usage")
+}
+
+func (c *cgroupStats) memUsage(containerId string) (uint64, error) {
+	return c.readUint("memory", containerId, "memory.usage_in_bytes")
+}
+
+// samples the resource usage of running pods and remembers the most recent
+// sample of each, so that cpu rates may be computed between samples.
+type usageMonitor struct {
+	stats containerStats
+	lock  sync.RWMutex
+	last  map[string]*messages.PodUsage // taskId => most recent sample
+}
+
+func newUsageMonitor(stats containerStats) *usageMonitor {
+	return &usageMonitor{
+		stats: stats,
+		last:  make(map[string]*messages.PodUsage),
+	}
+}
+
+// sample the usage of each pod; pods maps taskId => podFullName, containers
+// resolves a podFullName to the docker IDs of the containers of that pod.
+// samples of tasks not listed in pods are forgotten.
+func (m *usageMonitor) sample(pods map[string]string, containers func(podFullName string) []string) []messages.PodUsage {
+	now := time.Now()
+	samples := []messages.PodUsage{}
+	for taskId, podFullName := range pods {
+		ids := containers(podFullName)
+		if len(ids) == 0 {
+			continue
+		}
+		u := messages.PodUsage{
+			TaskId:    taskId,
+			PodName:   podFullName,
+			Timestamp: now,
+		}
+		for _, id := range ids {
+			if ns, err := m.stats.cpuTime(id); err != nil {
+				log.V(2).Infof("failed to read cpu usage of container %v: %v", id, err)
+			} else {
+				u.CpuTime += ns
+			}
+			if b, err := m.stats.memUsage(id); err != nil {
+				log.V(2).Infof("failed to read memory usage of container %v: %v", id, err)
+			} else {
+				u.Mem += float64(b) / (1024 * 1024)
+			}
+		}
+		samples = append(samples, u)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	last := make(map[string]*messages.PodUsage, len(samples))
+	for i := range samples {
+		u := &samples[i]
+		if prev, found := m.last[u.TaskId]; found && u.CpuTime >= prev.CpuTime {
+			if elapsed := u.Timestamp.Sub(prev.Timestamp); elapsed > 0 {
+				u.Cpus = float64(u.CpuTime-prev.CpuTime) / float64(elapsed.Nanoseconds())
+			}
+		}
+		last[u.TaskId] = u
+	}
+	m.last = last
+	return samples
+}
+
+// return a copy of the most recent usage samples
+func (m *usageMonitor) latest() []messages.PodUsage {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	result := make([]messages.PodUsage, 0, len(m.last))
+	for _, u := range m.last {
+		result = append(result, *u)
+	}
+	return result
+}
+
+// periodically samples pod resource usage and reports it to the scheduler
+// via framework messages; runs until the executor is shut down.
+func (k *KubernetesExecutor) runUsageMonitor() {
+	for {
+		select {
+		case <-k.done:
+			return
+		case <-time.After(usageReportInterval):
+			k.reportUsage()
+		}
+	}
+}
+
+func (k *KubernetesExecutor) reportUsage() {
+	pods := map[string]string{}
+	driver := func() bindings.ExecutorDriver {
+		k.lock.RLock()
+		defer k.lock.RUnlock()
+		for taskId, task := range k.tasks {
+			if task.podName != "" {
+				pods[taskId] = task.podName
+			}
+		}
+		return k.driver
+	}()
+
+	containers, err := dockertools.GetKubeletDockerContainers(k.dockerClient, false)
+	if err != nil {
+		log.Warningf("failed to list kubelet docker containers: %v", err)
+		return
+	}
+	samples := k.usage.sample(pods, func(podFullName string) (ids []string) {
+		for _, c := range containers.FindContainersByPodFullName(podFullName) {
+			ids = append(ids, c.ID)
+		}
+		return
+	})
+
+	if len(samples) == 0 || driver == nil || !k.isConnected() {
+		return
+	}
+	if data, err := json.Marshal(samples); err != nil {
+		log.Errorf("failed to marshal pod usage: %v", err)
+	} else {
+		k.sendFrameworkMessage(driver, messages.PodUsagePrefix+string(data))
+	}
+}
@@ -0,0 +1,85 @@
+package executor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type fakeStats struct {
+	cpu map[string]uint64
+	mem map[string]uint64
+}
+
+func (f *fakeStats) cpuTime(id string) (uint64, error) {
+	return f.cpu[id], nil
+}
+
+func (f *fakeStats) memUsage(id string) (uint64, error) {
+	return f.mem[id], nil
+}
+
+func TestCgroupStats(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	write := func(path, data string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(root, "cpuacct", "docker", "abc", "cpuacct.usage"), "12345\n")
+	write(filepath.Join(root, "memory", "system.slice", "docker-abc.scope", "memory.usage_in_bytes"), "2097152\n")
+
+	stats := &cgroupStats{root: root}
+	if ns, err := stats.cpuTime("abc"); err != nil || ns != 12345 {
+		t.Fatalf("expected cpu time 12345, got %d (%v)", ns, err)
+	}
+	if b, err := stats.memUsage("abc"); err != nil || b != 2097152 {
+		t.Fatalf("expected mem usage 2097152, got %d (%v)", b, err)
+	}
+	if _, err := stats.cpuTime("xyz"); err == nil {
+		t.Fatalf("expected error for unknown container")
+	}
+}
+
+func TestUsageMonitorSample(t *testing.T) {
+	stats := &fakeStats{
+		cpu: map[string]uint64{"c1": 1000, "c2": 2000},
+		mem: map[string]uint64{"c1": 1024 * 1024, "c2": 3 * 1024 * 1024},
+	}
+	m := newUsageMonitor(stats)
+	pods := map[string]string{"task1": "pod1"}
+	containers := func(string) []string { return []string{"c1", "c2"} }
+
+	samples := m.sample(pods, containers)
+	if len(samples) != 1 {
+		t.Fatalf("expected 1 sample, got %d", len(samples))
+	}
+	if u := samples[0]; u.CpuTime != 3000 || u.Mem != 4 || u.Cpus != 0 {
+		t.Fatalf("unexpected first sample %+v", u)
+	}
+
+	// fake the passage of time for the rate calculation
+	m.last["task1"].Timestamp = m.last["task1"].Timestamp.Add(-1 * time.Second)
+	stats.cpu["c1"] += uint64(time.Second / 2)
+
+	samples = m.sample(pods, containers)
+	if u := samples[0]; u.Cpus < 0.4 || u.Cpus > 0.6 {
+		t.Fatalf("expected ~0.5 cpus, got %+v", u)
+	}
+
+	// forget tasks that are no longer running
+	m.sample(map[string]string{}, containers)
+	if len(m.latest()) != 0 {
+		t.Fatalf("expected samples of finished tasks to be dropped")
+	}
+}
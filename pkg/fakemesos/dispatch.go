@@ -0,0 +1,75 @@
+package fakemesos
+
+import (
+	"sync"
+)
+
+// invokes callbacks, one at a time and in order, from a dedicated goroutine.
+// mesos drivers never invoke a framework from within one of the driver calls
+// that the framework makes, and frameworks rely on that: the scheduler, for
+// example, calls LaunchTasks while holding the same lock that StatusUpdate
+// acquires.
+type dispatcher struct {
+	lock   sync.Mutex
+	cond   *sync.Cond
+	queue  []func()
+	busy   bool // true while a callback is running
+	closed bool
+}
+
+func newDispatcher() *dispatcher {
+	d := &dispatcher{}
+	d.cond = sync.NewCond(&d.lock)
+	go d.run()
+	return d
+}
+
+func (d *dispatcher) run() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for {
+		for len(d.queue) == 0 && !d.closed {
+			d.cond.Wait()
+		}
+		if len(d.queue) == 0 {
+			return
+		}
+		f := d.queue[0]
+		d.queue = d.queue[1:]
+		d.busy = true
+		d.lock.Unlock()
+		f()
+		d.lock.Lock()
+		d.busy = false
+		d.cond.Broadcast()
+	}
+}
+
+// queues the callback; callbacks dispatched after close are dropped
+func (d *dispatcher) dispatch(f func()) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.closed {
+		return
+	}
+	d.queue = append(d.queue, f)
+	d.cond.Broadcast()
+}
+
+// blocks until every queued callback, including those queued by callbacks
+// while flushing, has returned. must not be called from a callback.
+func (d *dispatcher) flush() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for len(d.queue) > 0 || d.busy {
+		d.cond.Wait()
+	}
+}
+
+// stops the dispatcher once the queued callbacks have run
+func (d *dispatcher) close() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.closed = true
+	d.cond.Broadcast()
+}
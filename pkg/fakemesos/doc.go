@@ -0,0 +1,8 @@
+/*
+Package fakemesos simulates a mesos master, and the slaves attached to it,
+in memory. It implements the scheduler and executor drivers so that mesos
+frameworks, such as the kubernetes scheduler and executor, can be exercised
+end-to-end from tests: slaves with configurable resources and attributes,
+offer cycles, rescinded offers, lost slaves and task status updates.
+*/
+package fakemesos
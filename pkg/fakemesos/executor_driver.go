@@ -0,0 +1,125 @@
+package fakemesos
+
+import (
+	"fmt"
+
+	execbindings "github.com/mesos/mesos-go/executor"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+// ExecutorDriver connects an executor, created by the executor factory of a
+// slave, to a fake master. It implements bindings.ExecutorDriver.
+type ExecutorDriver struct {
+	master   *Master
+	slaveId  string
+	info     *mesos.ExecutorInfo
+	executor execbindings.Executor
+	status   mesos.Status // guarded by the master lock
+	done     chan struct{}
+}
+
+// executors are started by the master when their first task is launched
+func (e *ExecutorDriver) Start() (mesos.Status, error) {
+	e.master.lock.Lock()
+	defer e.master.lock.Unlock()
+	return e.status, nil
+}
+
+// the tasks of the executor that haven't terminated are lost
+func (e *ExecutorDriver) Stop() (mesos.Status, error) {
+	return e.exit(mesos.Status_DRIVER_STOPPED)
+}
+
+func (e *ExecutorDriver) Abort() (mesos.Status, error) {
+	return e.exit(mesos.Status_DRIVER_ABORTED)
+}
+
+func (e *ExecutorDriver) Join() (mesos.Status, error) {
+	<-e.done
+	e.master.lock.Lock()
+	defer e.master.lock.Unlock()
+	return e.status, nil
+}
+
+func (e *ExecutorDriver) Run() (mesos.Status, error) {
+	return e.Join()
+}
+
+func (e *ExecutorDriver) exit(status mesos.Status) (mesos.Status, error) {
+	m := e.master
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if e.status != mesos.Status_DRIVER_RUNNING {
+		return e.status, notRunningErr
+	}
+	e.terminate(status)
+	s, found := m.slaves[e.slaveId]
+	if !found || s.executors[e.info.GetExecutorId().GetValue()] != e {
+		return e.status, nil
+	}
+	delete(s.executors, e.info.GetExecutorId().GetValue())
+	for _, id := range m.sortedTaskIds() {
+		if t := m.tasks[id]; executorIdOf(t) == e.info.GetExecutorId().GetValue() && t.slaveId == e.slaveId && !isTerminal(t.state) {
+			m.updateTask(t, mesos.TaskState_TASK_LOST, "executor terminated")
+		}
+	}
+	if d := m.driver; d != nil {
+		executorId, slaveId := e.info.ExecutorId, s.info.Id
+		m.dispatcher.dispatch(func() { d.sched.ExecutorLost(d, executorId, slaveId, 0) })
+	}
+	return e.status, nil
+}
+
+// assumes that the caller holds the master lock
+func (e *ExecutorDriver) terminate(status mesos.Status) {
+	if e.status == mesos.Status_DRIVER_RUNNING {
+		e.status = status
+		close(e.done)
+	}
+}
+
+func executorIdOf(t *task) string {
+	if t.info.Executor == nil {
+		return ""
+	}
+	return t.info.Executor.GetExecutorId().GetValue()
+}
+
+// forwards the status of one of the executor's tasks to the framework
+func (e *ExecutorDriver) SendStatusUpdate(status *mesos.TaskStatus) (mesos.Status, error) {
+	m := e.master
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if e.status != mesos.Status_DRIVER_RUNNING {
+		return e.status, notRunningErr
+	}
+	t, found := m.tasks[status.GetTaskId().GetValue()]
+	if !found || t.slaveId != e.slaveId || executorIdOf(t) != e.info.GetExecutorId().GetValue() {
+		return e.status, fmt.Errorf("task %v does not belong to executor %v", status.GetTaskId().GetValue(), e.info.GetExecutorId().GetValue())
+	}
+	if status.SlaveId == nil {
+		status.SlaveId = t.info.SlaveId
+	}
+	if status.ExecutorId == nil {
+		status.ExecutorId = e.info.ExecutorId
+	}
+	m.forwardStatus(t, status)
+	return e.status, nil
+}
+
+func (e *ExecutorDriver) SendFrameworkMessage(data string) (mesos.Status, error) {
+	m := e.master
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if e.status != mesos.Status_DRIVER_RUNNING {
+		return e.status, notRunningErr
+	}
+	if d := m.driver; d != nil {
+		executorId, slaveId := e.info.ExecutorId, m.slaves[e.slaveId].info.Id
+		m.dispatcher.dispatch(func() { d.sched.FrameworkMessage(d, executorId, slaveId, data) })
+	}
+	return e.status, nil
+}
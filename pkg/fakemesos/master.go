@@ -0,0 +1,412 @@
+package fakemesos
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/gogo/protobuf/proto"
+	execbindings "github.com/mesos/mesos-go/executor"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	mutil "github.com/mesos/mesos-go/mesosutil"
+)
+
+// inclusive range of host ports
+type PortRange struct {
+	Begin uint64 `json:"begin"`
+	End   uint64 `json:"end"`
+}
+
+type SlaveConfig struct {
+	Hostname string
+	Cpus     float64
+	Mem      float64 // MB
+	Ports    []PortRange
+
+	// attributes whose values parse as numbers are SCALAR, all others TEXT
+	Attributes map[string]string
+
+	// creates the executor of tasks that specify an executor. if nil, such
+	// tasks are reported as running as soon as they're launched.
+	Executor func(*mesos.ExecutorInfo) execbindings.Executor
+}
+
+// a message sent by the framework to an executor
+type FrameworkMessage struct {
+	ExecutorId string
+	SlaveId    string
+	Data       string
+}
+
+type slave struct {
+	info      *mesos.SlaveInfo
+	config    SlaveConfig
+	available resources // neither offered nor allocated to tasks
+	executors map[string]*ExecutorDriver
+}
+
+type offer struct {
+	details *mesos.Offer
+	res     resources
+}
+
+type task struct {
+	info    *mesos.TaskInfo
+	state   mesos.TaskState
+	res     resources
+	slaveId string
+}
+
+// Master simulates a mesos master, and its slaves, for a single framework.
+// Offers are only made when the test asks for an offer cycle, and all of the
+// unallocated resources of a slave are offered at once. Offer filters are
+// ignored. Callbacks to the scheduler and the executors are invoked, in
+// order, from a single goroutine; use Flush to wait for them.
+type Master struct {
+	lock       sync.Mutex
+	info       *mesos.MasterInfo
+	dispatcher *dispatcher
+	driver     *SchedulerDriver // the driver of the registered framework
+	slaves     map[string]*slave
+	slaveIds   []string // in order of registration
+	offers     map[string]*offer
+	tasks      map[string]*task
+	messages   []FrameworkMessage
+	nextId     int
+}
+
+func NewMaster() *Master {
+	return &Master{
+		info: &mesos.MasterInfo{
+			Id:       proto.String("fakemesos"),
+			Ip:       proto.Uint32(0x7f000001),
+			Port:     proto.Uint32(5050),
+			Hostname: proto.String("localhost"),
+		},
+		dispatcher: newDispatcher(),
+		slaves:     map[string]*slave{},
+		offers:     map[string]*offer{},
+		tasks:      map[string]*task{},
+	}
+}
+
+// waits until all pending callbacks have returned
+func (m *Master) Flush() {
+	m.dispatcher.flush()
+}
+
+// releases the callback goroutine; pending callbacks still run
+func (m *Master) Close() {
+	m.dispatcher.close()
+}
+
+// assumes that the caller holds the lock
+func (m *Master) newId(prefix string) string {
+	m.nextId++
+	return fmt.Sprintf("%s-%04d", prefix, m.nextId)
+}
+
+// registers a slave and returns its id
+func (m *Master) AddSlave(config SlaveConfig) string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	id := m.newId("slave")
+	total := resources{cpus: config.Cpus, mem: config.Mem}
+	for _, r := range config.Ports {
+		for p := r.Begin; p <= r.End; p++ {
+			total.ports = append(total.ports, p)
+		}
+	}
+	sort.Sort(uint64s(total.ports))
+
+	attributes := []*mesos.Attribute{}
+	names := []string{}
+	for name := range config.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := config.Attributes[name]
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			attributes = append(attributes, &mesos.Attribute{
+				Name:   proto.String(name),
+				Type:   mesos.Value_SCALAR.Enum(),
+				Scalar: &mesos.Value_Scalar{Value: proto.Float64(f)},
+			})
+		} else {
+			attributes = append(attributes, &mesos.Attribute{
+				Name: proto.String(name),
+				Type: mesos.Value_TEXT.Enum(),
+				Text: &mesos.Value_Text{Value: proto.String(value)},
+			})
+		}
+	}
+
+	hostname := config.Hostname
+	if hostname == "" {
+		hostname = id
+	}
+	m.slaves[id] = &slave{
+		info: &mesos.SlaveInfo{
+			Id:         mutil.NewSlaveID(id),
+			Hostname:   proto.String(hostname),
+			Resources:  total.proto(),
+			Attributes: attributes,
+		},
+		config:    config,
+		available: total,
+		executors: map[string]*ExecutorDriver{},
+	}
+	m.slaveIds = append(m.slaveIds, id)
+	return id
+}
+
+// offers the unallocated resources of every slave that doesn't have an
+// outstanding offer to the registered framework, returning the number of
+// offers that were made.
+func (m *Master) OfferCycle() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	d := m.driver
+	if d == nil || d.status != mesos.Status_DRIVER_RUNNING {
+		return 0
+	}
+	offered := map[string]bool{}
+	for _, o := range m.offers {
+		offered[o.details.GetSlaveId().GetValue()] = true
+	}
+	list := []*mesos.Offer{}
+	for _, id := range m.slaveIds {
+		s := m.slaves[id]
+		if offered[id] || s.available.empty() {
+			continue
+		}
+		o := &offer{
+			details: &mesos.Offer{
+				Id:          mutil.NewOfferID(m.newId("offer")),
+				FrameworkId: d.framework.Id,
+				SlaveId:     s.info.Id,
+				Hostname:    s.info.Hostname,
+				Resources:   s.available.proto(),
+				Attributes:  s.info.Attributes,
+			},
+			res: s.available,
+		}
+		s.available = resources{}
+		m.offers[o.details.GetId().GetValue()] = o
+		list = append(list, o.details)
+	}
+	if len(list) > 0 {
+		m.dispatcher.dispatch(func() { d.sched.ResourceOffers(d, list) })
+	}
+	return len(list)
+}
+
+// rescinds an outstanding offer, returning false if there's no such offer
+func (m *Master) Rescind(offerId string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, found := m.offers[offerId]; !found {
+		return false
+	}
+	m.returnOffer(offerId)
+	if d := m.driver; d != nil {
+		m.dispatcher.dispatch(func() { d.sched.OfferRescinded(d, mutil.NewOfferID(offerId)) })
+	}
+	return true
+}
+
+// removes a slave: its offers are rescinded, its tasks are lost and then the
+// framework is told that the slave is lost. returns false if there's no such
+// slave.
+func (m *Master) LoseSlave(slaveId string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	s, found := m.slaves[slaveId]
+	if !found {
+		return false
+	}
+	d := m.driver
+	for _, offerId := range m.sortedOfferIds() {
+		if m.offers[offerId].details.GetSlaveId().GetValue() != slaveId {
+			continue
+		}
+		delete(m.offers, offerId)
+		if d != nil {
+			id := mutil.NewOfferID(offerId)
+			m.dispatcher.dispatch(func() { d.sched.OfferRescinded(d, id) })
+		}
+	}
+	for _, taskId := range m.sortedTaskIds() {
+		if t := m.tasks[taskId]; t.slaveId == slaveId && !isTerminal(t.state) {
+			m.updateTask(t, mesos.TaskState_TASK_LOST, "slave lost")
+		}
+	}
+	for _, e := range s.executors {
+		e.terminate(mesos.Status_DRIVER_ABORTED)
+	}
+	delete(m.slaves, slaveId)
+	for i, id := range m.slaveIds {
+		if id == slaveId {
+			m.slaveIds = append(m.slaveIds[:i], m.slaveIds[i+1:]...)
+			break
+		}
+	}
+	if d != nil {
+		m.dispatcher.dispatch(func() { d.sched.SlaveLost(d, s.info.Id) })
+	}
+	return true
+}
+
+// sends a status update, that didn't originate from an executor, for a
+// known task to the framework. terminal states release the task's resources.
+func (m *Master) SendStatus(taskId string, state mesos.TaskState, message string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	t, found := m.tasks[taskId]
+	if !found {
+		return fmt.Errorf("unknown task %v", taskId)
+	}
+	m.updateTask(t, state, message)
+	return nil
+}
+
+// returns the ids of the outstanding offers
+func (m *Master) Offers() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.sortedOfferIds()
+}
+
+// returns the last known state of every task that was launched
+func (m *Master) Tasks() map[string]mesos.TaskState {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	result := map[string]mesos.TaskState{}
+	for id, t := range m.tasks {
+		result[id] = t.state
+	}
+	return result
+}
+
+// returns the task info with which the task was launched
+func (m *Master) TaskInfo(taskId string) (*mesos.TaskInfo, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if t, found := m.tasks[taskId]; found {
+		return t.info, true
+	}
+	return nil, false
+}
+
+// returns the messages that the framework sent to its executors
+func (m *Master) Messages() []FrameworkMessage {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]FrameworkMessage(nil), m.messages...)
+}
+
+// returns the resources of a slave that are neither offered nor allocated
+func (m *Master) Available(slaveId string) ([]*mesos.Resource, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if s, found := m.slaves[slaveId]; found {
+		return s.available.proto(), true
+	}
+	return nil, false
+}
+
+// assumes that the caller holds the lock
+func (m *Master) sortedOfferIds() []string {
+	ids := make([]string, 0, len(m.offers))
+	for id := range m.offers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// assumes that the caller holds the lock
+func (m *Master) sortedTaskIds() []string {
+	ids := make([]string, 0, len(m.tasks))
+	for id := range m.tasks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// removes an offer and returns its resources to the slave. assumes that the
+// caller holds the lock.
+func (m *Master) returnOffer(offerId string) {
+	o := m.offers[offerId]
+	delete(m.offers, offerId)
+	if s, found := m.slaves[o.details.GetSlaveId().GetValue()]; found {
+		s.available = s.available.add(o.res)
+	}
+}
+
+// records the new state of a task, releasing its resources if the state is
+// terminal, and sends a status update to the framework. assumes that the
+// caller holds the lock.
+func (m *Master) updateTask(t *task, state mesos.TaskState, message string) {
+	status := &mesos.TaskStatus{
+		TaskId:  t.info.TaskId,
+		State:   state.Enum(),
+		SlaveId: t.info.SlaveId,
+	}
+	if message != "" {
+		status.Message = proto.String(message)
+	}
+	if t.info.Executor != nil {
+		status.ExecutorId = t.info.Executor.ExecutorId
+	}
+	m.forwardStatus(t, status)
+}
+
+// assumes that the caller holds the lock
+func (m *Master) forwardStatus(t *task, status *mesos.TaskStatus) {
+	if !isTerminal(t.state) {
+		t.state = status.GetState()
+		if isTerminal(t.state) {
+			if s, found := m.slaves[t.slaveId]; found {
+				s.available = s.available.add(t.res)
+			}
+		}
+	}
+	if d := m.driver; d != nil {
+		m.dispatcher.dispatch(func() { d.sched.StatusUpdate(d, status) })
+	}
+}
+
+// sends TASK_LOST for a task that the master doesn't know about. assumes
+// that the caller holds the lock.
+func (m *Master) lostTask(info *mesos.TaskInfo, message string) {
+	status := &mesos.TaskStatus{
+		TaskId:  info.TaskId,
+		State:   mesos.TaskState_TASK_LOST.Enum(),
+		SlaveId: info.SlaveId,
+		Message: proto.String(message),
+	}
+	if d := m.driver; d != nil {
+		m.dispatcher.dispatch(func() { d.sched.StatusUpdate(d, status) })
+	}
+}
+
+func isTerminal(state mesos.TaskState) bool {
+	switch state {
+	case mesos.TaskState_TASK_FINISHED, mesos.TaskState_TASK_FAILED,
+		mesos.TaskState_TASK_KILLED, mesos.TaskState_TASK_LOST:
+		return true
+	}
+	return false
+}
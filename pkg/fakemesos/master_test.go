@@ -0,0 +1,288 @@
+package fakemesos
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	execbindings "github.com/mesos/mesos-go/executor"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	mutil "github.com/mesos/mesos-go/mesosutil"
+	schedbindings "github.com/mesos/mesos-go/scheduler"
+	"github.com/stretchr/testify/assert"
+)
+
+// records the callbacks that it receives, which are invoked sequentially
+type recordingScheduler struct {
+	events   []string
+	offers   []*mesos.Offer
+	statuses map[string]mesos.TaskState
+}
+
+func newRecordingScheduler() *recordingScheduler {
+	return &recordingScheduler{statuses: map[string]mesos.TaskState{}}
+}
+
+func (r *recordingScheduler) record(format string, args ...interface{}) {
+	r.events = append(r.events, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingScheduler) Registered(driver schedbindings.SchedulerDriver, id *mesos.FrameworkID, info *mesos.MasterInfo) {
+	r.record("registered %v", id.GetValue())
+}
+
+func (r *recordingScheduler) Reregistered(driver schedbindings.SchedulerDriver, info *mesos.MasterInfo) {
+	r.record("reregistered")
+}
+
+func (r *recordingScheduler) Disconnected(driver schedbindings.SchedulerDriver) {
+	r.record("disconnected")
+}
+
+func (r *recordingScheduler) ResourceOffers(driver schedbindings.SchedulerDriver, offers []*mesos.Offer) {
+	r.offers = append(r.offers, offers...)
+	r.record("offers %d", len(offers))
+}
+
+func (r *recordingScheduler) OfferRescinded(driver schedbindings.SchedulerDriver, id *mesos.OfferID) {
+	r.record("rescinded %v", id.GetValue())
+}
+
+func (r *recordingScheduler) StatusUpdate(driver schedbindings.SchedulerDriver, status *mesos.TaskStatus) {
+	r.statuses[status.GetTaskId().GetValue()] = status.GetState()
+	r.record("status %v %v", status.GetTaskId().GetValue(), status.GetState())
+}
+
+func (r *recordingScheduler) FrameworkMessage(driver schedbindings.SchedulerDriver, eid *mesos.ExecutorID, sid *mesos.SlaveID, data string) {
+	r.record("message %v", data)
+}
+
+func (r *recordingScheduler) SlaveLost(driver schedbindings.SchedulerDriver, id *mesos.SlaveID) {
+	r.record("slave lost %v", id.GetValue())
+}
+
+func (r *recordingScheduler) ExecutorLost(driver schedbindings.SchedulerDriver, eid *mesos.ExecutorID, sid *mesos.SlaveID, status int) {
+	r.record("executor lost %v", eid.GetValue())
+}
+
+func (r *recordingScheduler) Error(driver schedbindings.SchedulerDriver, message string) {
+	r.record("error %v", message)
+}
+
+// runs tasks until they're killed, and echoes framework messages
+type echoExecutor struct{}
+
+func (e *echoExecutor) Registered(driver execbindings.ExecutorDriver, info *mesos.ExecutorInfo, framework *mesos.FrameworkInfo, slave *mesos.SlaveInfo) {
+}
+func (e *echoExecutor) Reregistered(driver execbindings.ExecutorDriver, slave *mesos.SlaveInfo) {}
+func (e *echoExecutor) Disconnected(driver execbindings.ExecutorDriver)                         {}
+
+func (e *echoExecutor) LaunchTask(driver execbindings.ExecutorDriver, task *mesos.TaskInfo) {
+	driver.SendStatusUpdate(&mesos.TaskStatus{TaskId: task.TaskId, State: mesos.TaskState_TASK_RUNNING.Enum()})
+}
+
+func (e *echoExecutor) KillTask(driver execbindings.ExecutorDriver, id *mesos.TaskID) {
+	driver.SendStatusUpdate(&mesos.TaskStatus{TaskId: id, State: mesos.TaskState_TASK_KILLED.Enum()})
+}
+
+func (e *echoExecutor) FrameworkMessage(driver execbindings.ExecutorDriver, message string) {
+	driver.SendFrameworkMessage("echo " + message)
+}
+
+func (e *echoExecutor) Shutdown(driver execbindings.ExecutorDriver)              {}
+func (e *echoExecutor) Error(driver execbindings.ExecutorDriver, message string) {}
+
+func newTask(id string, offer *mesos.Offer, cpus, mem float64, ports ...uint64) *mesos.TaskInfo {
+	resources := []*mesos.Resource{
+		mutil.NewScalarResource("cpus", cpus),
+		mutil.NewScalarResource("mem", mem),
+	}
+	for _, p := range ports {
+		resources = append(resources, mutil.NewRangesResource("ports", []*mesos.Value_Range{mutil.NewValueRange(p, p)}))
+	}
+	return &mesos.TaskInfo{
+		Name:      proto.String(id),
+		TaskId:    mutil.NewTaskID(id),
+		SlaveId:   offer.SlaveId,
+		Resources: resources,
+	}
+}
+
+func startFramework(t *testing.T, m *Master) (*recordingScheduler, schedbindings.SchedulerDriver) {
+	sched := newRecordingScheduler()
+	var driver schedbindings.SchedulerDriver = m.NewSchedulerDriver(sched, &mesos.FrameworkInfo{Name: proto.String("test")})
+	_, err := driver.Start()
+	assert.NoError(t, err)
+	return sched, driver
+}
+
+func TestOfferCycle(t *testing.T) {
+	assert := assert.New(t)
+	m := NewMaster()
+	defer m.Close()
+	s1 := m.AddSlave(SlaveConfig{
+		Hostname:   "h1",
+		Cpus:       2,
+		Mem:        1024,
+		Ports:      []PortRange{{31000, 31001}, {31005, 31005}},
+		Attributes: map[string]string{"rack": "r1", "zone": "2"},
+	})
+	m.AddSlave(SlaveConfig{Hostname: "h2", Cpus: 1, Mem: 512})
+
+	assert.Equal(0, m.OfferCycle()) // no framework yet
+	sched, driver := startFramework(t, m)
+	assert.Equal(2, m.OfferCycle())
+	assert.Equal(0, m.OfferCycle()) // the slaves have outstanding offers
+	m.Flush()
+
+	assert.Len(sched.events, 2)
+	assert.Len(sched.offers, 2)
+	offer := sched.offers[0]
+	assert.Equal(s1, offer.GetSlaveId().GetValue())
+	assert.Equal("h1", offer.GetHostname())
+	assert.Equal(resources{cpus: 2, mem: 1024, ports: []uint64{31000, 31001, 31005}}, resourcesOf(offer.Resources))
+	assert.Len(offer.Resources[2].GetRanges().GetRange(), 2)
+	assert.Equal(mesos.Value_TEXT, offer.Attributes[0].GetType())
+	assert.Equal(mesos.Value_SCALAR, offer.Attributes[1].GetType())
+
+	_, err := driver.DeclineOffer(offer.Id, nil)
+	assert.NoError(err)
+	assert.Equal(1, m.OfferCycle())
+	assert.Len(m.Offers(), 2)
+}
+
+func TestLaunchAndKillTasks(t *testing.T) {
+	assert := assert.New(t)
+	m := NewMaster()
+	defer m.Close()
+	slaveId := m.AddSlave(SlaveConfig{Cpus: 2, Mem: 1024, Ports: []PortRange{{31000, 31010}}})
+	sched, driver := startFramework(t, m)
+	m.OfferCycle()
+	m.Flush()
+	offer := sched.offers[0]
+
+	_, err := driver.LaunchTasks([]*mesos.OfferID{offer.Id}, []*mesos.TaskInfo{
+		newTask("t1", offer, 1, 512, 31000),
+		newTask("t2", offer, 1, 1024),         // too much memory
+		newTask("t3", offer, 0.5, 256, 32000), // unavailable port
+	}, nil)
+	assert.NoError(err)
+	m.Flush()
+	assert.Equal(map[string]mesos.TaskState{
+		"t1": mesos.TaskState_TASK_RUNNING,
+		"t2": mesos.TaskState_TASK_LOST,
+		"t3": mesos.TaskState_TASK_LOST,
+	}, sched.statuses)
+	assert.Empty(m.Offers())
+
+	available, _ := m.Available(slaveId)
+	r := resourcesOf(available)
+	assert.Equal(1.0, r.cpus)
+	assert.Equal(512.0, r.mem)
+	assert.False(r.contains(31000))
+
+	// the offer was consumed
+	_, err = driver.LaunchTasks([]*mesos.OfferID{offer.Id}, []*mesos.TaskInfo{newTask("t4", offer, 1, 1)}, nil)
+	assert.NoError(err)
+	_, err = driver.KillTask(mutil.NewTaskID("t1"))
+	assert.NoError(err)
+	m.Flush()
+	assert.Equal(mesos.TaskState_TASK_LOST, sched.statuses["t4"])
+	assert.Equal(mesos.TaskState_TASK_KILLED, sched.statuses["t1"])
+
+	available, _ = m.Available(slaveId)
+	r = resourcesOf(available)
+	assert.Equal(2.0, r.cpus)
+	assert.Equal(1024.0, r.mem)
+	assert.Len(r.ports, 11)
+
+	// implicit reconciliation reports every known task
+	sched.events = nil
+	_, err = driver.ReconcileTasks(nil)
+	assert.NoError(err)
+	m.Flush()
+	assert.Equal([]string{"status t1 TASK_KILLED"}, sched.events)
+}
+
+func TestRescindAndLoseSlave(t *testing.T) {
+	assert := assert.New(t)
+	m := NewMaster()
+	defer m.Close()
+	s1 := m.AddSlave(SlaveConfig{Cpus: 2, Mem: 1024})
+	sched, driver := startFramework(t, m)
+	m.OfferCycle()
+	m.Flush()
+	offer := sched.offers[0]
+
+	assert.True(m.Rescind(offer.GetId().GetValue()))
+	assert.False(m.Rescind(offer.GetId().GetValue()))
+	driver.LaunchTasks([]*mesos.OfferID{offer.Id}, []*mesos.TaskInfo{newTask("t1", offer, 1, 512)}, nil)
+	m.Flush()
+	assert.Equal(mesos.TaskState_TASK_LOST, sched.statuses["t1"])
+
+	m.OfferCycle()
+	m.Flush()
+	offer = sched.offers[1]
+	driver.LaunchTasks([]*mesos.OfferID{offer.Id}, []*mesos.TaskInfo{newTask("t2", offer, 1, 512)}, nil)
+	m.OfferCycle()
+	m.Flush()
+
+	sched.events = nil
+	assert.True(m.LoseSlave(s1))
+	m.Flush()
+	assert.Equal([]string{
+		"rescinded " + sched.offers[2].GetId().GetValue(),
+		"status t2 TASK_LOST",
+		"slave lost " + s1,
+	}, sched.events)
+	assert.Equal(0, m.OfferCycle())
+	assert.Error(m.SendStatus("t3", mesos.TaskState_TASK_FAILED, ""))
+}
+
+func TestExecutor(t *testing.T) {
+	assert := assert.New(t)
+	m := NewMaster()
+	defer m.Close()
+	slaveId := m.AddSlave(SlaveConfig{
+		Cpus: 2,
+		Mem:  1024,
+		Executor: func(*mesos.ExecutorInfo) execbindings.Executor {
+			return &echoExecutor{}
+		},
+	})
+	sched, driver := startFramework(t, m)
+	m.OfferCycle()
+	m.Flush()
+	offer := sched.offers[0]
+
+	executor := &mesos.ExecutorInfo{ExecutorId: mutil.NewExecutorID("e1")}
+	task := newTask("t1", offer, 1, 512)
+	task.Executor = executor
+	driver.LaunchTasks([]*mesos.OfferID{offer.Id}, []*mesos.TaskInfo{task}, nil)
+	m.Flush()
+	assert.Equal(mesos.TaskState_TASK_RUNNING, sched.statuses["t1"])
+
+	driver.SendFrameworkMessage(executor.ExecutorId, mutil.NewSlaveID(slaveId), "hello")
+	m.Flush()
+	assert.Equal("message echo hello", sched.events[len(sched.events)-1])
+	assert.Equal([]FrameworkMessage{{ExecutorId: "e1", SlaveId: slaveId, Data: "hello"}}, m.Messages())
+
+	driver.KillTask(task.TaskId)
+	m.Flush()
+	assert.Equal(mesos.TaskState_TASK_KILLED, sched.statuses["t1"])
+
+	// stopping the framework kills the remaining tasks
+	task = newTask("t2", offer, 1, 512)
+	task.Executor = executor
+	m.OfferCycle()
+	m.Flush()
+	offer = sched.offers[1]
+	driver.LaunchTasks([]*mesos.OfferID{offer.Id}, []*mesos.TaskInfo{task}, nil)
+	m.Flush()
+	assert.Equal(mesos.TaskState_TASK_RUNNING, m.Tasks()["t2"])
+	_, err := driver.Stop(false)
+	assert.NoError(err)
+	status, _ := driver.Join()
+	assert.Equal(mesos.Status_DRIVER_STOPPED, status)
+	assert.Equal(mesos.TaskState_TASK_KILLED, m.Tasks()["t2"])
+}
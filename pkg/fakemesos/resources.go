@@ -0,0 +1,114 @@
+package fakemesos
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gogo/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	mutil "github.com/mesos/mesos-go/mesosutil"
+)
+
+// the cpus, memory and host ports of a slave. roles aren't modelled: all
+// resources belong to the default role.
+type resources struct {
+	cpus  float64
+	mem   float64
+	ports []uint64 // sorted
+}
+
+// sums the cpus, mem and ports resources in the list, ignoring all others
+func resourcesOf(list []*mesos.Resource) resources {
+	r := resources{}
+	for _, resource := range list {
+		switch resource.GetName() {
+		case "cpus":
+			r.cpus += resource.GetScalar().GetValue()
+		case "mem":
+			r.mem += resource.GetScalar().GetValue()
+		case "ports":
+			for _, rng := range resource.GetRanges().GetRange() {
+				for p := rng.GetBegin(); p <= rng.GetEnd(); p++ {
+					r.ports = append(r.ports, p)
+				}
+			}
+		}
+	}
+	sort.Sort(uint64s(r.ports))
+	return r
+}
+
+func (r resources) contains(port uint64) bool {
+	i := sort.Search(len(r.ports), func(i int) bool { return r.ports[i] >= port })
+	return i < len(r.ports) && r.ports[i] == port
+}
+
+// returns an error if the resources don't cover the demand
+func (r resources) covers(demand resources) error {
+	if r.cpus < demand.cpus {
+		return fmt.Errorf("insufficient cpus: %v available, %v requested", r.cpus, demand.cpus)
+	}
+	if r.mem < demand.mem {
+		return fmt.Errorf("insufficient mem: %v available, %v requested", r.mem, demand.mem)
+	}
+	for _, p := range demand.ports {
+		if !r.contains(p) {
+			return fmt.Errorf("port %d is not available", p)
+		}
+	}
+	return nil
+}
+
+func (r resources) add(other resources) resources {
+	ports := append(append([]uint64(nil), r.ports...), other.ports...)
+	sort.Sort(uint64s(ports))
+	return resources{cpus: r.cpus + other.cpus, mem: r.mem + other.mem, ports: ports}
+}
+
+func (r resources) subtract(other resources) resources {
+	ports := []uint64{}
+	for _, p := range r.ports {
+		if !other.contains(p) {
+			ports = append(ports, p)
+		}
+	}
+	return resources{cpus: r.cpus - other.cpus, mem: r.mem - other.mem, ports: ports}
+}
+
+func (r resources) empty() bool {
+	return r.cpus <= 0 && r.mem <= 0 && len(r.ports) == 0
+}
+
+// converts the resources into mesos resources, collapsing ports into ranges
+func (r resources) proto() []*mesos.Resource {
+	list := []*mesos.Resource{}
+	if r.cpus > 0 {
+		list = append(list, mutil.NewScalarResource("cpus", r.cpus))
+	}
+	if r.mem > 0 {
+		list = append(list, mutil.NewScalarResource("mem", r.mem))
+	}
+	if len(r.ports) > 0 {
+		ranges := []*mesos.Value_Range{}
+		begin := r.ports[0]
+		for i := 1; i <= len(r.ports); i++ {
+			if i == len(r.ports) || r.ports[i] != r.ports[i-1]+1 {
+				ranges = append(ranges, mutil.NewValueRange(begin, r.ports[i-1]))
+				if i < len(r.ports) {
+					begin = r.ports[i]
+				}
+			}
+		}
+		list = append(list, mutil.NewRangesResource("ports", ranges))
+	}
+	for _, resource := range list {
+		resource.Role = proto.String("*")
+	}
+	return list
+}
+
+type uint64s []uint64
+
+func (s uint64s) Len() int           { return len(s) }
+func (s uint64s) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
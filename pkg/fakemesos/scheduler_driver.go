@@ -0,0 +1,377 @@
+package fakemesos
+
+import (
+	"errors"
+	"fmt"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	mutil "github.com/mesos/mesos-go/mesosutil"
+	schedbindings "github.com/mesos/mesos-go/scheduler"
+)
+
+var notRunningErr = errors.New("driver is not running")
+
+// SchedulerDriver connects a framework scheduler to a fake master. It
+// implements bindings.SchedulerDriver.
+type SchedulerDriver struct {
+	master    *Master
+	sched     schedbindings.Scheduler
+	framework *mesos.FrameworkInfo
+	status    mesos.Status // guarded by the master lock
+	done      chan struct{}
+}
+
+// returns a driver for the scheduler. frameworks that specify an id in their
+// framework info fail over the previously registered framework, adopting its
+// tasks.
+func (m *Master) NewSchedulerDriver(sched schedbindings.Scheduler, framework *mesos.FrameworkInfo) *SchedulerDriver {
+	return &SchedulerDriver{
+		master:    m,
+		sched:     sched,
+		framework: framework,
+		status:    mesos.Status_DRIVER_NOT_STARTED,
+		done:      make(chan struct{}),
+	}
+}
+
+// assumes that the caller holds the master lock
+func (d *SchedulerDriver) active() bool {
+	return d.status == mesos.Status_DRIVER_RUNNING && d.master.driver == d
+}
+
+func (d *SchedulerDriver) Start() (mesos.Status, error) {
+	m := d.master
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if d.status != mesos.Status_DRIVER_NOT_STARTED {
+		return d.status, fmt.Errorf("driver has already been started")
+	}
+	if d.framework.Id == nil {
+		d.framework.Id = mutil.NewFrameworkID(m.newId("framework"))
+	} else if old := m.driver; old != nil && old.framework.GetId().GetValue() == d.framework.GetId().GetValue() {
+		old.terminate(mesos.Status_DRIVER_ABORTED)
+	}
+	if old := m.driver; old != nil && old.framework.GetId().GetValue() != d.framework.GetId().GetValue() {
+		m.removeFramework()
+	}
+	m.driver = d
+	d.status = mesos.Status_DRIVER_RUNNING
+
+	id := d.framework.Id
+	m.dispatcher.dispatch(func() { d.sched.Registered(d, id, m.info) })
+	return d.status, nil
+}
+
+// assumes that the caller holds the master lock
+func (d *SchedulerDriver) terminate(status mesos.Status) {
+	if d.status == mesos.Status_DRIVER_RUNNING || d.status == mesos.Status_DRIVER_NOT_STARTED {
+		d.status = status
+		close(d.done)
+	}
+}
+
+// kills the tasks and shuts down the executors of the registered framework,
+// and rescinds its offers. assumes that the caller holds the lock.
+func (m *Master) removeFramework() {
+	for _, id := range m.sortedOfferIds() {
+		m.returnOffer(id)
+	}
+	for _, id := range m.sortedTaskIds() {
+		t := m.tasks[id]
+		if !isTerminal(t.state) {
+			t.state = mesos.TaskState_TASK_KILLED
+			if s, found := m.slaves[t.slaveId]; found {
+				s.available = s.available.add(t.res)
+			}
+		}
+	}
+	for _, s := range m.slaves {
+		for _, e := range s.executors {
+			e := e
+			m.dispatcher.dispatch(func() { e.executor.Shutdown(e) })
+			e.terminate(mesos.Status_DRIVER_STOPPED)
+		}
+		s.executors = map[string]*ExecutorDriver{}
+	}
+	m.driver = nil
+}
+
+// unless failing over, the framework is removed from the master, which
+// kills its tasks.
+func (d *SchedulerDriver) Stop(failover bool) (mesos.Status, error) {
+	m := d.master
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if d.status != mesos.Status_DRIVER_RUNNING {
+		return d.status, notRunningErr
+	}
+	if m.driver == d {
+		if failover {
+			for _, id := range m.sortedOfferIds() {
+				m.returnOffer(id)
+			}
+		} else {
+			m.removeFramework()
+		}
+	}
+	d.terminate(mesos.Status_DRIVER_STOPPED)
+	return d.status, nil
+}
+
+// stops the driver without removing the framework, as if failing over
+func (d *SchedulerDriver) Abort() (mesos.Status, error) {
+	m := d.master
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if d.status != mesos.Status_DRIVER_RUNNING {
+		return d.status, notRunningErr
+	}
+	d.terminate(mesos.Status_DRIVER_ABORTED)
+	return d.status, nil
+}
+
+func (d *SchedulerDriver) Join() (mesos.Status, error) {
+	<-d.done
+	d.master.lock.Lock()
+	defer d.master.lock.Unlock()
+	return d.status, nil
+}
+
+func (d *SchedulerDriver) Run() (mesos.Status, error) {
+	if status, err := d.Start(); err != nil {
+		return status, err
+	}
+	return d.Join()
+}
+
+// resource requests are ignored
+func (d *SchedulerDriver) RequestResources(requests []*mesos.Request) (mesos.Status, error) {
+	m := d.master
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !d.active() {
+		return d.status, notRunningErr
+	}
+	return d.status, nil
+}
+
+// launches tasks using the resources of the offers, which must belong to the
+// same slave. the remaining resources of the offers return to the slave.
+// tasks that don't fit are lost.
+func (d *SchedulerDriver) LaunchTasks(offerIds []*mesos.OfferID, tasks []*mesos.TaskInfo, filters *mesos.Filters) (mesos.Status, error) {
+	m := d.master
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !d.active() {
+		return d.status, notRunningErr
+	}
+
+	var (
+		pool    resources
+		slaveId string
+		invalid string
+	)
+	for _, id := range offerIds {
+		o, found := m.offers[id.GetValue()]
+		if !found {
+			invalid = fmt.Sprintf("unknown offer %v", id.GetValue())
+			continue
+		}
+		if sid := o.details.GetSlaveId().GetValue(); slaveId == "" {
+			slaveId = sid
+		} else if sid != slaveId {
+			invalid = "offers belong to different slaves"
+		}
+	}
+	if len(offerIds) == 0 {
+		invalid = "no offers"
+	}
+	for _, id := range offerIds {
+		if o, found := m.offers[id.GetValue()]; found {
+			pool = pool.add(o.res)
+			delete(m.offers, id.GetValue())
+		}
+	}
+	s, found := m.slaves[slaveId]
+	if !found && invalid == "" {
+		invalid = fmt.Sprintf("unknown slave %v", slaveId)
+	}
+	if invalid != "" {
+		if found {
+			s.available = s.available.add(pool)
+		}
+		for _, info := range tasks {
+			m.lostTask(info, invalid)
+		}
+		return d.status, nil
+	}
+
+	for _, info := range tasks {
+		demand := resourcesOf(info.Resources)
+		if _, exists := m.tasks[info.GetTaskId().GetValue()]; exists {
+			m.lostTask(info, "duplicate task id")
+			continue
+		}
+		if info.GetSlaveId().GetValue() != slaveId {
+			m.lostTask(info, "task slave id does not match the offers")
+			continue
+		}
+		if err := pool.covers(demand); err != nil {
+			m.lostTask(info, err.Error())
+			continue
+		}
+		pool = pool.subtract(demand)
+		t := &task{
+			info:    info,
+			state:   mesos.TaskState_TASK_STAGING,
+			res:     demand,
+			slaveId: slaveId,
+		}
+		m.tasks[info.GetTaskId().GetValue()] = t
+		m.launch(s, t)
+	}
+	s.available = s.available.add(pool)
+	return d.status, nil
+}
+
+// hands the task to its executor, starting the executor if necessary. tasks
+// without an executor run as soon as they're launched. assumes that the
+// caller holds the lock.
+func (m *Master) launch(s *slave, t *task) {
+	if t.info.Executor == nil || s.config.Executor == nil {
+		m.updateTask(t, mesos.TaskState_TASK_RUNNING, "")
+		return
+	}
+	executorId := t.info.Executor.GetExecutorId().GetValue()
+	e, found := s.executors[executorId]
+	if !found {
+		e = &ExecutorDriver{
+			master:   m,
+			slaveId:  s.info.GetId().GetValue(),
+			info:     t.info.Executor,
+			executor: s.config.Executor(t.info.Executor),
+			status:   mesos.Status_DRIVER_RUNNING,
+			done:     make(chan struct{}),
+		}
+		s.executors[executorId] = e
+		framework, slaveInfo := m.driver.framework, s.info
+		m.dispatcher.dispatch(func() { e.executor.Registered(e, e.info, framework, slaveInfo) })
+	}
+	info := t.info
+	m.dispatcher.dispatch(func() { e.executor.LaunchTask(e, info) })
+}
+
+// asks the executor of the task to kill it. tasks without an executor are
+// killed immediately, unknown tasks are reported as lost.
+func (d *SchedulerDriver) KillTask(taskId *mesos.TaskID) (mesos.Status, error) {
+	m := d.master
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !d.active() {
+		return d.status, notRunningErr
+	}
+	t, found := m.tasks[taskId.GetValue()]
+	if !found {
+		m.lostTask(&mesos.TaskInfo{TaskId: taskId}, "unknown task")
+		return d.status, nil
+	}
+	if isTerminal(t.state) {
+		return d.status, nil
+	}
+	if e := m.executorOf(t); e != nil {
+		m.dispatcher.dispatch(func() { e.executor.KillTask(e, taskId) })
+	} else {
+		m.updateTask(t, mesos.TaskState_TASK_KILLED, "killed")
+	}
+	return d.status, nil
+}
+
+// assumes that the caller holds the lock
+func (m *Master) executorOf(t *task) *ExecutorDriver {
+	s, found := m.slaves[t.slaveId]
+	if !found || t.info.Executor == nil {
+		return nil
+	}
+	return s.executors[t.info.Executor.GetExecutorId().GetValue()]
+}
+
+func (d *SchedulerDriver) DeclineOffer(offerId *mesos.OfferID, filters *mesos.Filters) (mesos.Status, error) {
+	m := d.master
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !d.active() {
+		return d.status, notRunningErr
+	}
+	if _, found := m.offers[offerId.GetValue()]; found {
+		m.returnOffer(offerId.GetValue())
+	}
+	return d.status, nil
+}
+
+// filters are ignored, so there's nothing to revive
+func (d *SchedulerDriver) ReviveOffers() (mesos.Status, error) {
+	m := d.master
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !d.active() {
+		return d.status, notRunningErr
+	}
+	return d.status, nil
+}
+
+// messages are recorded, and delivered if the executor is running
+func (d *SchedulerDriver) SendFrameworkMessage(executorId *mesos.ExecutorID, slaveId *mesos.SlaveID, data string) (mesos.Status, error) {
+	m := d.master
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !d.active() {
+		return d.status, notRunningErr
+	}
+	m.messages = append(m.messages, FrameworkMessage{
+		ExecutorId: executorId.GetValue(),
+		SlaveId:    slaveId.GetValue(),
+		Data:       data,
+	})
+	if s, found := m.slaves[slaveId.GetValue()]; found {
+		if e, found := s.executors[executorId.GetValue()]; found {
+			m.dispatcher.dispatch(func() { e.executor.FrameworkMessage(e, data) })
+		}
+	}
+	return d.status, nil
+}
+
+// sends the latest state of each of the tasks, or of all tasks if the list is
+// empty. unknown tasks are lost.
+func (d *SchedulerDriver) ReconcileTasks(statuses []*mesos.TaskStatus) (mesos.Status, error) {
+	m := d.master
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !d.active() {
+		return d.status, notRunningErr
+	}
+	ids := []string{}
+	if len(statuses) == 0 {
+		ids = m.sortedTaskIds()
+	}
+	for _, status := range statuses {
+		ids = append(ids, status.GetTaskId().GetValue())
+	}
+	for _, id := range ids {
+		if t, found := m.tasks[id]; found {
+			m.updateTask(t, t.state, "reconciliation")
+		} else {
+			m.lostTask(&mesos.TaskInfo{TaskId: mutil.NewTaskID(id)}, "unknown task")
+		}
+	}
+	return d.status, nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
 	log "github.com/golang/glog"
 	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
 	"github.com/mesosphere/kubernetes-mesos/pkg/offers/metrics"
 	"github.com/mesosphere/kubernetes-mesos/pkg/queue"
 )
@@ -43,6 +44,19 @@ type Registry interface {
 	// invalidate one or all (when offerId="") offers; offers are not declined,
 	// but are simply flagged as expired in the offer history
 	Invalidate(offerId string)
+
+	// returns a snapshot of every offer in storage, both live and lingering
+	List() []Snapshot
+}
+
+// describes an offer in storage at a moment in time
+type Snapshot struct {
+	Id        string
+	Hostname  string
+	Lingering bool         // true if the offer has expired, or was rescinded
+	Acquired  bool         // true if the offer is claimed by a task
+	Deadline  time.Time    // when a live offer expires, or a lingering offer is forgotten
+	Details   *mesos.Offer // nil if the offer is lingering
 }
 
 // callback that is invoked during a walk through a series of live offers,
@@ -54,6 +68,7 @@ type RegistryConfig struct {
 	TTL           time.Duration // determines a perishable offer's expiration deadline: now+ttl
 	LingerTTL     time.Duration // if zero, offers will not linger in the FIFO past their expiration deadline
 	ListenerDelay time.Duration // specifies the sleep time between offer listener notifications
+	Clock         clock.Clock   // measures offer expiration and linger periods; if nil, the real clock is used
 }
 
 type offerStorage struct {
@@ -67,11 +82,13 @@ type liveOffer struct {
 	*mesos.Offer
 	expiration time.Time
 	acquired   int32 // 1 = acquired, 0 = free
+	clock      clock.Clock
 }
 
 type expiredOffer struct {
 	offerSpec
 	deadline time.Time
+	clock    clock.Clock
 }
 
 // subset of mesos.OfferInfo useful for recordkeeping
@@ -127,11 +144,11 @@ func (e *expiredOffer) age(s *offerStorage) {
 
 // return the time left to linger
 func (e *expiredOffer) GetDelay() time.Duration {
-	return e.deadline.Sub(time.Now())
+	return e.deadline.Sub(e.clock.Now())
 }
 
 func (to *liveOffer) HasExpired() bool {
-	return time.Now().After(to.expiration)
+	return to.clock.Now().After(to.expiration)
 }
 
 func (to *liveOffer) Details() *mesos.Offer {
@@ -165,11 +182,14 @@ func (to *liveOffer) host() string {
 
 // return the time remaining before the offer expires
 func (to *liveOffer) GetDelay() time.Duration {
-	return to.expiration.Sub(time.Now())
+	return to.expiration.Sub(to.clock.Now())
 }
 
 func CreateRegistry(c RegistryConfig) Registry {
 	metrics.Register()
+	if c.Clock == nil {
+		c.Clock = clock.RealClock{}
+	}
 	return &offerStorage{
 		RegistryConfig: c,
 		offers: cache.NewFIFO(cache.KeyFunc(func(v interface{}) (string, error) {
@@ -179,18 +199,19 @@ func CreateRegistry(c RegistryConfig) Registry {
 				return perishable.uid(), nil
 			}
 		})),
-		listeners: queue.NewDelayFIFO(),
-		delayed:   queue.NewDelayQueue(),
+		listeners: queue.NewFairDelayFIFOWithClock(nil, c.Clock),
+		delayed:   queue.NewDelayQueueWithClock(c.Clock),
 	}
 }
 
 func (s *offerStorage) Add(offers []*mesos.Offer) {
-	now := time.Now()
+	now := s.Clock.Now()
 	for _, offer := range offers {
 		timed := &liveOffer{
 			Offer:      offer,
 			expiration: now.Add(s.TTL),
 			acquired:   0,
+			clock:      s.Clock,
 		}
 		log.V(3).Infof("Receiving offer %v", timed.uid())
 		s.offers.Add(timed)
@@ -222,7 +243,8 @@ func (s *offerStorage) Delete(offerId string) {
 				// TODO(jdef): not sure what a good value is here. the goal is to provide a
 				// launchTasks (driver) operation enough time to complete so that we don't end
 				// up declining an offer that we're actually attempting to use.
-				time.AfterFunc(deferredDeclineTtlFactor*s.TTL, func() {
+				go func() {
+					<-s.Clock.After(deferredDeclineTtlFactor * s.TTL)
 					// at this point the offer is in one of five states:
 					// a) permanently deleted: expired due to timeout
 					// b) permanently deleted: expired due to having been rescinded
@@ -239,7 +261,7 @@ func (s *offerStorage) Delete(offerId string) {
 							metrics.OffersDeclined.WithLabelValues(offer.host()).Inc()
 						}
 					}
-				})
+				}()
 			}
 		}
 		s.expireOffer(offer)
@@ -305,7 +327,7 @@ func (s *offerStorage) expireOffer(offer Perishable) {
 		log.V(3).Infof("Expiring offer %v", offerId)
 		if s.LingerTTL > 0 {
 			log.V(3).Infof("offer will linger: %v", offerId)
-			expired := &expiredOffer{offerSpec{id: offerId, hostname: offer.host()}, time.Now().Add(s.LingerTTL)}
+			expired := &expiredOffer{offerSpec{id: offerId, hostname: offer.host()}, s.Clock.Now().Add(s.LingerTTL), s.Clock}
 			s.offers.Update(expired)
 			s.delayed.Add(expired)
 		} else {
@@ -315,6 +337,36 @@ func (s *offerStorage) expireOffer(offer Perishable) {
 	} // else, it's still lingering...
 }
 
+func (s *offerStorage) List() []Snapshot {
+	result := []Snapshot{}
+	for _, v := range s.offers.List() {
+		switch offer := v.(type) {
+		case *liveOffer:
+			snapshot := Snapshot{
+				Id:        offer.uid(),
+				Hostname:  offer.host(),
+				Lingering: offer.HasExpired(),
+				Acquired:  atomic.LoadInt32(&offer.acquired) == 1,
+				Deadline:  offer.expiration,
+			}
+			if !snapshot.Lingering {
+				snapshot.Details = offer.Offer
+			}
+			result = append(result, snapshot)
+		case *expiredOffer:
+			result = append(result, Snapshot{
+				Id:        offer.uid(),
+				Hostname:  offer.host(),
+				Lingering: true,
+				Deadline:  offer.deadline,
+			})
+		default:
+			log.Errorf("Expected perishable offer, not %v", v)
+		}
+	}
+	return result
+}
+
 func (s *offerStorage) Get(id string) (Perishable, bool) {
 	if obj, ok, _ := s.offers.GetByKey(id); !ok {
 		return nil, false
@@ -355,7 +407,7 @@ func (s *offerStorage) Listen(id string, f Filter) <-chan struct{} {
 		id:       id,
 		accepts:  f,
 		notify:   ch,
-		deadline: time.Now().Add(s.ListenerDelay),
+		deadline: s.Clock.Now().Add(s.ListenerDelay),
 	}
 	log.V(3).Infof("Registering offer listener %s", listen.id)
 	s.listeners.Offer(listen, queue.ReplaceExisting)
@@ -396,7 +448,7 @@ func (s *offerStorage) notifyListeners(ids func() (util.StringSet, uint64)) {
 	offerIds, version := ids()
 	if listener.sawVersion == version {
 		// no changes to offer list, avoid growing older - just wait for new offers to arrive
-		listener.deadline = time.Now().Add(s.ListenerDelay)
+		listener.deadline = s.Clock.Now().Add(s.ListenerDelay)
 		s.listeners.Offer(listener, queue.KeepExisting)
 		return
 	}
@@ -416,7 +468,7 @@ func (s *offerStorage) notifyListeners(ids func() (util.StringSet, uint64)) {
 	// no interesting offers found, re-queue the listener
 	listener.age++
 	if listener.age < offerListenerMaxAge {
-		listener.deadline = time.Now().Add(s.ListenerDelay)
+		listener.deadline = s.Clock.Now().Add(s.ListenerDelay)
 		s.listeners.Offer(listener, queue.KeepExisting)
 	} else {
 		// garbage collection is as simple as not re-adding the listener to the queue
@@ -439,7 +491,8 @@ func (s *offerStorage) Init() {
 			}
 			return result
 		},
-		ttl: offerIdCacheTTL,
+		ttl:   offerIdCacheTTL,
+		clock: s.Clock,
 	}
 
 	go util.Forever(func() { s.notifyListeners(idCache.Strings) }, notifyListenersDelay)
@@ -451,11 +504,12 @@ type stringsCache struct {
 	ttl       time.Duration
 	refill    func() util.StringSet
 	version   uint64
+	clock     clock.Clock
 }
 
 // not thread-safe
 func (c *stringsCache) Strings() (util.StringSet, uint64) {
-	now := time.Now()
+	now := c.clock.Now()
 	if c.expiresAt.Before(now) {
 		old := c.cached
 		c.cached = c.refill()
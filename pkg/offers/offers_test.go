@@ -5,16 +5,18 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gogo/protobuf/proto"
 	mesos "github.com/mesos/mesos-go/mesosproto"
 	util "github.com/mesos/mesos-go/mesosutil"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
 )
 
 func TestTimedOffer(t *testing.T) {
 	t.Parallel()
 
 	ttl := 2 * time.Second
-	now := time.Now()
-	o := &liveOffer{nil, now.Add(ttl), 0}
+	fake := clock.NewFake(time.Now())
+	o := &liveOffer{nil, fake.Now().Add(ttl), 0, fake}
 
 	if o.HasExpired() {
 		t.Errorf("offer ttl was %v and should not have expired yet", ttl)
@@ -34,7 +36,11 @@ func TestTimedOffer(t *testing.T) {
 		t.Fatal("4th acquisition of offer failed")
 	}
 	o.Release()
-	time.Sleep(ttl)
+	fake.Step(ttl)
+	if o.HasExpired() {
+		t.Fatal("offer expired before its ttl passed")
+	}
+	fake.Step(time.Millisecond)
 	if !o.HasExpired() {
 		t.Fatal("offer not expired after ttl passed")
 	}
@@ -85,7 +91,7 @@ func TestWalk(t *testing.T) {
 	// single offer
 	ttl := 2 * time.Second
 	now := time.Now()
-	o := &liveOffer{&mesos.Offer{Id: util.NewOfferID("foo")}, now.Add(ttl), 0}
+	o := &liveOffer{&mesos.Offer{Id: util.NewOfferID("foo")}, now.Add(ttl), 0, clock.RealClock{}}
 
 	impl.offers.Add(o)
 	err = storage.Walk(walker1)
@@ -138,3 +144,73 @@ func TestWalk(t *testing.T) {
 		t.Fatalf("walk count %d", walked)
 	}
 }
+
+func TestExpiredOffersAreDeclined(t *testing.T) {
+	t.Parallel()
+	fake := clock.NewFake(time.Now())
+	declined := make(chan string, 1)
+	storage := CreateRegistry(RegistryConfig{
+		DeclineOffer: func(offerId string) error {
+			declined <- offerId
+			return nil
+		},
+		TTL:       5 * time.Second,
+		LingerTTL: 10 * time.Second,
+		Clock:     fake,
+	})
+	storage.Init()
+	storage.Add([]*mesos.Offer{{Id: util.NewOfferID("foo")}})
+
+	// wait for the offer to be aged
+	fake.BlockUntil(1)
+	if o, ok := storage.Get("foo"); !ok || o.HasExpired() {
+		t.Fatalf("expected a live offer instead of %v", o)
+	}
+
+	fake.Step(5*time.Second + time.Millisecond)
+	select {
+	case id := <-declined:
+		if id != "foo" {
+			t.Fatalf("declined unexpected offer %v", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the expired offer to be declined")
+	}
+}
+
+func TestList(t *testing.T) {
+	t.Parallel()
+	fake := clock.NewFake(time.Now())
+	storage := CreateRegistry(RegistryConfig{
+		DeclineOffer: func(offerId string) error {
+			return nil
+		},
+		TTL:       5 * time.Second,
+		LingerTTL: 10 * time.Second,
+		Clock:     fake,
+	})
+	storage.Add([]*mesos.Offer{
+		{Id: util.NewOfferID("foo"), Hostname: proto.String("h1")},
+		{Id: util.NewOfferID("bar"), Hostname: proto.String("h2")},
+	})
+	if o, ok := storage.Get("foo"); !ok || !o.Acquire() {
+		t.Fatal("failed to acquire offer foo")
+	}
+	storage.Invalidate("bar")
+
+	snapshots := map[string]Snapshot{}
+	for _, s := range storage.List() {
+		snapshots[s.Id] = s
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("expected 2 offers instead of %+v", snapshots)
+	}
+	foo := snapshots["foo"]
+	if foo.Lingering || !foo.Acquired || foo.Hostname != "h1" || foo.Details == nil || !foo.Deadline.Equal(fake.Now().Add(5*time.Second)) {
+		t.Fatalf("unexpected snapshot of a live offer: %+v", foo)
+	}
+	bar := snapshots["bar"]
+	if !bar.Lingering || bar.Hostname != "h2" || bar.Details != nil || !bar.Deadline.Equal(fake.Now().Add(10*time.Second)) {
+		t.Fatalf("unexpected snapshot of a lingering offer: %+v", bar)
+	}
+}
@@ -6,13 +6,20 @@ import (
 	"time"
 
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
 )
 
+// DefaultPriorityAging is the period of waiting that's worth one rank of
+// priority, unless a DelayFIFO is configured otherwise.
+const DefaultPriorityAging = 1 * time.Minute
+
 type qitem struct {
 	value    interface{}
 	priority Priority
 	index    int
 	readd    func(item *qitem) // re-add the value of the item to the queue
+	ready    bool              // true if the item is in a ready queue of a DelayFIFO
+	group    string            // the ready queue of a DelayFIFO that the item belongs to
 }
 
 // A priorityQueue implements heap.Interface and holds qitems.
@@ -46,22 +53,57 @@ func (pq *priorityQueue) Pop() interface{} {
 	return item
 }
 
+// A readyQueue holds qitems whose deadlines have passed, ordered by their
+// rank-adjusted deadlines: an item of higher rank is popped before an item of
+// lower rank, unless the latter has been waiting for longer than an aging
+// period per rank of difference.
+type readyQueue struct {
+	priorityQueue
+	aging time.Duration
+}
+
+func (rq *readyQueue) Less(i, j int) bool {
+	return agedBefore(rq.priorityQueue[i].priority, rq.priorityQueue[j].priority, rq.aging)
+}
+
+// returns true if the head of rq should be popped before the head of other
+func (rq *readyQueue) precedes(other *readyQueue) bool {
+	return agedBefore(rq.priorityQueue[0].priority, other.priorityQueue[0].priority, rq.aging)
+}
+
+func agedBefore(pi, pj Priority, aging time.Duration) bool {
+	ai, aj := pi.aged(aging), pj.aged(aging)
+	if ai.Equal(aj) {
+		return pi.rank > pj.rank
+	}
+	return ai.Before(aj)
+}
+
+// returns the share of some resource that is consumed by each group of items;
+// see DelayFIFO.
+type ShareFunc func() map[string]float64
+
 // concurrency-safe, deadline-oriented queue that returns items after their
 // delay period has expired.
 type DelayQueue struct {
 	queue priorityQueue
 	lock  sync.RWMutex
 	cond  sync.Cond
+	clock clock.Clock // determines when deadlines have passed
 }
 
 func NewDelayQueue() *DelayQueue {
-	q := &DelayQueue{}
+	return NewDelayQueueWithClock(clock.RealClock{})
+}
+
+func NewDelayQueueWithClock(c clock.Clock) *DelayQueue {
+	q := &DelayQueue{clock: c}
 	q.cond.L = &q.lock
 	return q
 }
 
 func (q *DelayQueue) Add(d Delayed) {
-	deadline := extractFromDelayed(d)
+	deadline := extractFromDelayed(d, q.clock.Now())
 
 	q.lock.Lock()
 	defer q.lock.Unlock()
@@ -133,7 +175,7 @@ func (q *DelayQueue) pop(next func() *qitem, cancel <-chan struct{}) interface{}
 			return nil
 		}
 		x := item.value
-		waitingPeriod := item.priority.ts.Sub(time.Now())
+		waitingPeriod := item.priority.ts.Sub(q.clock.Now())
 		if waitingPeriod >= 0 {
 			// listen for calls to Add() while we're waiting for the deadline
 			if ch == nil {
@@ -153,7 +195,7 @@ func (q *DelayQueue) pop(next func() *qitem, cancel <-chan struct{}) interface{}
 				// we may no longer have the earliest deadline, re-try
 				item.readd(item)
 				continue
-			case <-time.After(waitingPeriod):
+			case <-q.clock.After(waitingPeriod):
 				// noop
 			case <-item.priority.notify:
 				// noop
@@ -166,11 +208,23 @@ func (q *DelayQueue) pop(next func() *qitem, cancel <-chan struct{}) interface{}
 // If multiple adds/updates of a single item happen while an item is in the
 // queue before it has been processed, it will only be processed once, and
 // when it is processed, the most recent version will be processed. Items are
-// popped in order of their priority, currently controlled by a delay or
-// deadline assigned to each item in the queue.
+// popped in order of their deadlines; once the deadlines of multiple items
+// have passed, items that implement Prioritized are popped in order of their
+// priority, subject to aging so that items of low priority aren't starved.
+//
+// Items that implement Grouped are kept in a ready queue per group once their
+// deadlines have passed, and the next item is popped from the group with the
+// smallest share as reported by the ShareFunc of the queue. Groups of equal
+// share are ordered by the priority of the items at their heads.
 type DelayFIFO struct {
 	// internal deadline-based priority queue
 	delegate *DelayQueue
+	// items whose deadlines have passed by group, guarded by the lock of the delegate
+	ready map[string]*readyQueue
+	// period of waiting that's worth one rank of priority
+	aging time.Duration
+	// reports the share of each group, may be nil
+	shares ShareFunc
 	// We depend on the property that items in the set are in the queue and vice versa.
 	items          map[string]*qitem
 	deadlinePolicy DeadlinePolicy
@@ -203,7 +257,7 @@ func (q *DelayFIFO) cond() *sync.Cond {
 // Add inserts an item, and puts it in the queue. The item is only enqueued
 // if it doesn't already exist in the set.
 func (q *DelayFIFO) Add(d UniqueDelayed, rp ReplacementPolicy) {
-	deadline := extractFromDelayed(d)
+	deadline := extractFromDelayed(d, q.delegate.clock.Now())
 	id := d.GetUID()
 	var adder func(*qitem)
 	adder = func(*qitem) {
@@ -221,6 +275,17 @@ func (q *DelayFIFO) Offer(d UniqueDeadlined, rp ReplacementPolicy) bool {
 	return false
 }
 
+// SetAging changes the period of waiting that's worth one rank of priority.
+func (q *DelayFIFO) SetAging(aging time.Duration) {
+	q.lock()
+	defer q.unlock()
+	q.aging = aging
+	for _, rq := range q.ready {
+		rq.aging = aging
+		heap.Init(rq)
+	}
+}
+
 func (q *DelayFIFO) add(id string, deadline Priority, value interface{}, rp ReplacementPolicy, adder func(*qitem)) {
 	q.lock()
 	defer q.unlock()
@@ -229,6 +294,7 @@ func (q *DelayFIFO) add(id string, deadline Priority, value interface{}, rp Repl
 			value:    value,
 			priority: deadline,
 			readd:    adder,
+			group:    extractGroup(value),
 		}
 		heap.Push(q.queue(), item)
 		q.items[id] = item
@@ -236,11 +302,71 @@ func (q *DelayFIFO) add(id string, deadline Priority, value interface{}, rp Repl
 		// this is an update of an existing item
 		item.value = rp.replacementValue(item.value, value)
 		item.priority = q.deadlinePolicy.nextDeadline(item.priority, deadline)
-		heap.Fix(q.queue(), item.index)
+		item.priority.rank = deadline.rank
+		if item.ready {
+			// the deadline may have changed, let pop() re-evaluate readiness
+			heap.Remove(q.ready[item.group], item.index)
+			item.ready = false
+			item.group = extractGroup(value)
+			heap.Push(q.queue(), item)
+		} else {
+			heap.Fix(q.queue(), item.index)
+		}
 	}
 	q.cond().Broadcast()
 }
 
+// move items whose deadlines have passed from the delay queue to the ready
+// queue, discarding items that have been deleted or replaced. assumes that
+// the caller has acquired the lock.
+func (q *DelayFIFO) promote(now time.Time) {
+	pq := q.queue()
+	for pq.Len() > 0 {
+		item := (*pq)[0]
+		if item.priority.ts.After(now) {
+			return
+		}
+		heap.Pop(pq)
+		if !q.contains(item) {
+			continue
+		}
+		rq, found := q.ready[item.group]
+		if !found {
+			rq = &readyQueue{aging: q.aging}
+			q.ready[item.group] = rq
+		}
+		item.ready = true
+		heap.Push(rq, item)
+	}
+}
+
+// returns the ready queue of the group with the smallest share, or nil if no
+// items are ready. assumes that the caller has acquired the lock.
+func (q *DelayFIFO) nextReady(shares map[string]float64) *readyQueue {
+	var (
+		next  *readyQueue
+		share float64
+	)
+	for group, rq := range q.ready {
+		if rq.Len() == 0 {
+			delete(q.ready, group)
+			continue
+		}
+		s := shares[group]
+		if next == nil || s < share || (s == share && rq.precedes(next)) {
+			next, share = rq, s
+		}
+	}
+	return next
+}
+
+// returns true if the item is the most recent queued version of its value.
+// assumes that the caller has acquired the lock.
+func (q *DelayFIFO) contains(item *qitem) bool {
+	current, ok := q.items[item.value.(UniqueID).GetUID()]
+	return ok && current == item
+}
+
 // Delete removes an item. It doesn't add it to the queue, because
 // this implementation assumes the consumer only cares about the objects,
 // not their priority order.
@@ -291,7 +417,7 @@ func (q *DelayFIFO) Await(timeout time.Duration) UniqueID {
 	go func() { ch <- q.pop(cancel) }()
 	var x interface{}
 	select {
-	case <-time.After(timeout):
+	case <-q.delegate.clock.After(timeout):
 		close(cancel)
 		x = <-ch
 	case x = <-ch:
@@ -303,6 +429,33 @@ func (q *DelayFIFO) Await(timeout time.Duration) UniqueID {
 	return nil
 }
 
+// TryPop returns the next item whose deadline has passed, as measured by the
+// clock of the queue, or else nil; it never blocks.
+func (q *DelayFIFO) TryPop() UniqueID {
+	// the share func may acquire locks of its own, don't hold ours
+	var shares map[string]float64
+	if q.shares != nil {
+		shares = q.shares()
+	}
+	q.lock()
+	defer q.unlock()
+	q.promote(q.delegate.clock.Now())
+	for {
+		rq := q.nextReady(shares)
+		if rq == nil {
+			return nil
+		}
+		item := heap.Pop(rq).(*qitem)
+		item.ready = false
+		if !q.contains(item) {
+			// item was deleted, keep looking
+			continue
+		}
+		delete(q.items, item.value.(UniqueID).GetUID())
+		return item.value.(UniqueID)
+	}
+}
+
 // Variant of DelayQueue.Pop() for UniqueDelayed items
 func (q *DelayFIFO) Pop() UniqueID {
 	return q.pop(nil).(UniqueID)
@@ -311,10 +464,20 @@ func (q *DelayFIFO) Pop() UniqueID {
 // variant of DelayQueue.Pop that implements optional cancellation
 func (q *DelayFIFO) pop(cancel chan struct{}) interface{} {
 	next := func() *qitem {
+		// the share func may acquire locks of its own, don't hold ours
+		var shares map[string]float64
+		if q.shares != nil {
+			shares = q.shares()
+		}
 		q.lock()
 		defer q.unlock()
 		for {
-			for q.queue().Len() == 0 {
+			q.promote(q.delegate.clock.Now())
+			var pq heap.Interface = q.queue()
+			if rq := q.nextReady(shares); rq != nil {
+				pq = rq
+			}
+			if pq.Len() == 0 {
 				signal := make(chan struct{})
 				go func() {
 					defer close(signal)
@@ -332,16 +495,15 @@ func (q *DelayFIFO) pop(cancel chan struct{}) interface{} {
 					// we have the lock, re-check
 					// the queue for data...
 				}
+				continue
 			}
-			x := heap.Pop(q.queue())
-			item := x.(*qitem)
-			unique := item.value.(UniqueID)
-			uid := unique.GetUID()
-			if _, ok := q.items[uid]; !ok {
+			item := heap.Pop(pq).(*qitem)
+			item.ready = false
+			if !q.contains(item) {
 				// item was deleted, keep looking
 				continue
 			}
-			delete(q.items, uid)
+			delete(q.items, item.value.(UniqueID).GetUID())
 			return item
 		}
 	}
@@ -349,8 +511,23 @@ func (q *DelayFIFO) pop(cancel chan struct{}) interface{} {
 }
 
 func NewDelayFIFO() *DelayFIFO {
+	return NewFairDelayFIFO(nil)
+}
+
+// NewFairDelayFIFO returns a DelayFIFO that pops ready items from the group
+// with the smallest share, as reported by the given func.
+func NewFairDelayFIFO(shares ShareFunc) *DelayFIFO {
+	return NewFairDelayFIFOWithClock(shares, clock.RealClock{})
+}
+
+// NewFairDelayFIFOWithClock returns a fair DelayFIFO whose deadlines, and
+// Await timeouts, are measured by the given clock.
+func NewFairDelayFIFOWithClock(shares ShareFunc, c clock.Clock) *DelayFIFO {
 	f := &DelayFIFO{
-		delegate: NewDelayQueue(),
+		delegate: NewDelayQueueWithClock(c),
+		ready:    map[string]*readyQueue{},
+		aging:    DefaultPriorityAging,
+		shares:   shares,
 		items:    map[string]*qitem{},
 	}
 	return f
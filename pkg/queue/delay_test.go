@@ -1,9 +1,14 @@
 package queue
 
 import (
+	"fmt"
+	"reflect"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
 )
 
 const (
@@ -90,19 +95,25 @@ func (j *testjob) GetDelay() time.Duration {
 func TestDQ_sanity_check(t *testing.T) {
 	t.Parallel()
 
-	dq := NewDelayQueue()
+	fake := clock.NewFake(time.Now())
+	dq := NewDelayQueueWithClock(fake)
 	delay := 2 * time.Second
 	dq.Add(&testjob{d: delay})
 
-	before := time.Now()
-	x := dq.Pop()
+	ch := make(chan interface{}, 1)
+	go func() { ch <- dq.Pop() }()
 
-	now := time.Now()
-	waitPeriod := now.Sub(before)
-
-	if waitPeriod+tolerance < delay {
-		t.Fatalf("delay too short: %v, expected: %v", waitPeriod, delay)
+	// Pop waits for the deadline of the job
+	fake.BlockUntil(1)
+	fake.Step(delay - time.Millisecond)
+	select {
+	case x := <-ch:
+		t.Fatalf("popped %v before its deadline", x)
+	default:
 	}
+
+	fake.Step(time.Millisecond)
+	x := <-ch
 	if x == nil {
 		t.Fatalf("x is nil")
 	}
@@ -263,3 +274,211 @@ func TestDQ_negative_delay(t *testing.T) {
 		t.Fatalf("d != delay")
 	}
 }
+
+type testpod struct {
+	uid      string
+	deadline time.Time
+	rank     int
+	group    string
+}
+
+func (p *testpod) GetUID() string {
+	return p.uid
+}
+
+func (p *testpod) Deadline() (time.Time, bool) {
+	return p.deadline, true
+}
+
+func (p *testpod) GetPriority() int {
+	return p.rank
+}
+
+func (p *testpod) GetGroup() string {
+	return p.group
+}
+
+func popAll(t *testing.T, q *DelayFIFO, n int) (uids []string) {
+	for i := 0; i < n; i++ {
+		x := q.Await(2 * time.Second)
+		if x == nil {
+			t.Fatalf("timed out waiting for item %d", i)
+		}
+		uids = append(uids, x.GetUID())
+	}
+	return
+}
+
+func TestDFIFO_priority_order(t *testing.T) {
+	t.Parallel()
+
+	q := NewDelayFIFO()
+	deadline := time.Now()
+	q.Offer(&testpod{uid: "low", deadline: deadline, rank: 0}, KeepExisting)
+	q.Offer(&testpod{uid: "critical", deadline: deadline, rank: 3}, KeepExisting)
+	q.Offer(&testpod{uid: "normal", deadline: deadline, rank: 1}, KeepExisting)
+	q.Offer(&testpod{uid: "high", deadline: deadline.Add(-time.Second), rank: 2}, KeepExisting)
+
+	// within the aging period rank trumps deadline
+	q.Offer(&testpod{uid: "older-low", deadline: deadline.Add(-10 * time.Second), rank: 0}, KeepExisting)
+
+	expected := []string{"critical", "high", "normal", "older-low", "low"}
+	if actual := popAll(t, q, len(expected)); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %v instead of %v", expected, actual)
+	}
+}
+
+func TestDFIFO_priority_aging(t *testing.T) {
+	t.Parallel()
+
+	q := NewDelayFIFO()
+	q.SetAging(100 * time.Millisecond)
+	now := time.Now()
+	q.Offer(&testpod{uid: "high", deadline: now, rank: 2}, KeepExisting)
+	q.Offer(&testpod{uid: "starving", deadline: now.Add(-time.Second), rank: 0}, KeepExisting)
+	q.Offer(&testpod{uid: "low", deadline: now.Add(-150 * time.Millisecond), rank: 0}, KeepExisting)
+
+	expected := []string{"starving", "high", "low"}
+	if actual := popAll(t, q, len(expected)); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %v instead of %v", expected, actual)
+	}
+}
+
+func TestDFIFO_priority_respects_deadline(t *testing.T) {
+	t.Parallel()
+
+	fake := clock.NewFake(time.Now())
+	q := NewFairDelayFIFOWithClock(nil, fake)
+	now := fake.Now()
+	q.Offer(&testpod{uid: "high", deadline: now.Add(time.Second), rank: 3}, KeepExisting)
+	q.Offer(&testpod{uid: "low", deadline: now, rank: 0}, KeepExisting)
+
+	// the clock doesn't move, so a ready item must be popped without waiting
+	if x := q.Await(2 * time.Second); x == nil || x.GetUID() != "low" {
+		t.Fatalf("expected low instead of %v", x)
+	}
+
+	ch := make(chan UniqueID, 1)
+	go func() { ch <- q.Await(2 * time.Second) }()
+
+	// the timeouts of both calls to Await, and the deadline of high
+	fake.BlockUntil(3)
+	select {
+	case x := <-ch:
+		t.Fatalf("popped %v before its deadline", x)
+	default:
+	}
+
+	fake.Step(time.Second)
+	if x := <-ch; x == nil || x.GetUID() != "high" {
+		t.Fatalf("expected high instead of %v", x)
+	}
+}
+
+func TestDFIFO_try_pop(t *testing.T) {
+	t.Parallel()
+
+	fake := clock.NewFake(time.Now())
+	q := NewFairDelayFIFOWithClock(nil, fake)
+	now := fake.Now()
+	q.Offer(&testpod{uid: "later", deadline: now.Add(time.Second)}, KeepExisting)
+	q.Offer(&testpod{uid: "now", deadline: now}, KeepExisting)
+	q.Offer(&testpod{uid: "deleted", deadline: now}, KeepExisting)
+	q.Delete("deleted")
+
+	if x := q.TryPop(); x == nil || x.GetUID() != "now" {
+		t.Fatalf("expected now instead of %v", x)
+	}
+	if x := q.TryPop(); x != nil {
+		t.Fatalf("popped %v before its deadline", x)
+	}
+	fake.Step(time.Second)
+	if x := q.TryPop(); x == nil || x.GetUID() != "later" {
+		t.Fatalf("expected later instead of %v", x)
+	}
+	if x := q.TryPop(); x != nil {
+		t.Fatalf("expected an empty queue instead of %v", x)
+	}
+}
+
+func TestDFIFO_priority_update(t *testing.T) {
+	t.Parallel()
+
+	q := NewDelayFIFO()
+	deadline := time.Now()
+	q.Offer(&testpod{uid: "a", deadline: deadline, rank: 0}, KeepExisting)
+	q.Offer(&testpod{uid: "b", deadline: deadline, rank: 1}, KeepExisting)
+
+	// promote both items into the ready queue
+	q.lock()
+	q.promote(time.Now())
+	q.unlock()
+
+	q.Offer(&testpod{uid: "a", deadline: deadline, rank: 2}, ReplaceExisting)
+
+	expected := []string{"a", "b"}
+	if actual := popAll(t, q, len(expected)); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %v instead of %v", expected, actual)
+	}
+}
+
+func TestDFIFO_readd_after_delete(t *testing.T) {
+	t.Parallel()
+
+	q := NewDelayFIFO()
+	deadline := time.Now()
+	q.Offer(&testpod{uid: "a", deadline: deadline, rank: 0}, KeepExisting)
+	q.Delete("a")
+	q.Offer(&testpod{uid: "a", deadline: deadline, rank: 5}, KeepExisting)
+
+	x := q.Await(time.Second)
+	if x == nil || x.(*testpod).rank != 5 {
+		t.Fatalf("expected the most recent version of the item instead of %+v", x)
+	}
+	if x = q.Await(500 * time.Millisecond); x != nil {
+		t.Fatalf("expected an empty queue instead of %+v", x)
+	}
+}
+
+func TestDFIFO_fair_share(t *testing.T) {
+	t.Parallel()
+
+	// each popped item consumes an equal share of the cluster, group b has
+	// twice the weight of group a
+	var lock sync.Mutex
+	popped := map[string]float64{"a": 0, "b": 0}
+	weights := map[string]float64{"a": 1, "b": 2}
+	q := NewFairDelayFIFO(func() map[string]float64 {
+		lock.Lock()
+		defer lock.Unlock()
+		shares := map[string]float64{}
+		for g, n := range popped {
+			shares[g] = n / weights[g]
+		}
+		return shares
+	})
+
+	deadline := time.Now()
+	for i := 0; i < 6; i++ {
+		q.Offer(&testpod{uid: fmt.Sprintf("a%d", i), group: "a", deadline: deadline.Add(-time.Duration(10-i) * time.Second)}, KeepExisting)
+		q.Offer(&testpod{uid: fmt.Sprintf("b%d", i), group: "b", deadline: deadline.Add(-time.Duration(i) * time.Millisecond)}, KeepExisting)
+	}
+
+	// group a has the oldest items but shouldn't monopolize the queue
+	actual := []string{}
+	for i := 0; i < 9; i++ {
+		x := q.Await(2 * time.Second)
+		if x == nil {
+			t.Fatalf("timed out waiting for item %d", i)
+		}
+		p := x.(*testpod)
+		lock.Lock()
+		popped[p.group]++
+		lock.Unlock()
+		actual = append(actual, p.uid)
+	}
+	expected := []string{"a0", "b5", "b4", "a1", "b3", "b2", "a2", "b1", "b0"}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %v instead of %v", expected, actual)
+	}
+}
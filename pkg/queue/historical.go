@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
 )
 
 type entry struct {
@@ -75,6 +76,7 @@ type HistoricalFIFO struct {
 	carrier   pigeon // may be dead, but never nil
 	gcc       int
 	lingerTTL time.Duration
+	clock     clock.Clock // determines when deleted items have lingered long enough
 }
 
 // panics if obj doesn't implement UniqueCopyable; otherwise returns the same, typecast object
@@ -135,7 +137,7 @@ func (f *HistoricalFIFO) Delete(v interface{}) error {
 	if exists && !item.Is(DELETE_EVENT) {
 		e := item.(*entry)
 		e.event = DELETE_EVENT
-		deleteEvent = &deletedEntry{e, time.Now().Add(f.lingerTTL)}
+		deleteEvent = &deletedEntry{e, f.clock.Now().Add(f.lingerTTL)}
 		f.items[id] = deleteEvent
 	}
 	return nil
@@ -205,7 +207,7 @@ func (q *HistoricalFIFO) Await(timeout time.Duration) interface{} {
 	ch := make(chan interface{}, 1)
 	go func() { ch <- q.pop(cancel) }()
 	select {
-	case <-time.After(timeout):
+	case <-q.clock.After(timeout):
 		close(cancel)
 		return <-ch
 	case x := <-ch:
@@ -276,7 +278,7 @@ func (f *HistoricalFIFO) Replace(objs []interface{}) error {
 	defer f.lock.Unlock()
 
 	f.queue = f.queue[:0]
-	now := time.Now()
+	now := f.clock.Now()
 	for id, v := range f.items {
 		if _, exists := idToObj[id]; !exists && !v.Is(DELETE_EVENT) {
 			// a non-deleted entry in the items list that doesn't show up in the
@@ -303,7 +305,7 @@ func (f *HistoricalFIFO) Replace(objs []interface{}) error {
 // garbage collect DELETEd items whose TTL has expired; the IDs of such items are removed
 // from the queue. This impl assumes that caller has acquired state lock.
 func (f *HistoricalFIFO) gc() {
-	now := time.Now()
+	now := f.clock.Now()
 	deleted := make(map[string]struct{})
 	for id, v := range f.items {
 		if v.Is(DELETE_EVENT) {
@@ -327,7 +329,7 @@ func (f *HistoricalFIFO) gc() {
 // Assumes that the caller has acquired the state lock.
 func (f *HistoricalFIFO) merge(id string, obj UniqueCopyable) (notifications []Entry) {
 	item, exists := f.items[id]
-	now := time.Now()
+	now := f.clock.Now()
 	if !exists {
 		e := &entry{obj.Copy().(UniqueCopyable), ADD_EVENT}
 		f.items[id] = e
@@ -365,6 +367,12 @@ func (f *HistoricalFIFO) merge(id string, obj UniqueCopyable) (notifications []E
 // process. If a non-nil Mux is provided, then modifications to the
 // the FIFO are delivered on a channel specific to this fifo.
 func NewHistorical(ch chan<- Entry) FIFO {
+	return NewHistoricalWithClock(ch, clock.RealClock{})
+}
+
+// NewHistoricalWithClock returns a historical FIFO that measures how long
+// deleted items linger, and Await timeouts, by the given clock.
+func NewHistoricalWithClock(ch chan<- Entry, c clock.Clock) FIFO {
 	carrier := dead
 	if ch != nil {
 		carrier = func(msg Entry) {
@@ -378,6 +386,7 @@ func NewHistorical(ch chan<- Entry) FIFO {
 		queue:     []string{},
 		carrier:   carrier,
 		lingerTTL: 5 * time.Minute, // TODO(jdef): extract constant
+		clock:     c,
 	}
 	f.cond.L = &f.lock
 	return f
@@ -76,6 +76,20 @@ type Breakout interface {
 	Breaker() BreakChan
 }
 
+// an optional interface to be implemented by queued objects; once their
+// deadlines have passed objects of higher priority are popped first.
+type Prioritized interface {
+	// return the priority of the object, higher values are more urgent
+	GetPriority() int
+}
+
+// an optional interface to be implemented by queued objects; once their
+// deadlines have passed objects are popped fairly across groups.
+type Grouped interface {
+	// return the name of the group that the object belongs to
+	GetGroup() string
+}
+
 type UniqueDelayed interface {
 	UniqueID
 	Delayed
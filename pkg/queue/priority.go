@@ -7,14 +7,35 @@ import (
 type Priority struct {
 	ts     time.Time // timestamp
 	notify BreakChan // notification channel
+	rank   int       // items of higher rank are popped first once their deadlines have passed
 }
 
 func (p Priority) Equal(other Priority) bool {
-	return p.ts.Equal(other.ts) && p.notify == other.notify
+	return p.ts.Equal(other.ts) && p.notify == other.notify && p.rank == other.rank
 }
 
-func extractFromDelayed(d Delayed) Priority {
-	deadline := time.Now().Add(d.GetDelay())
+// returns the deadline of the item, adjusted by its rank such that each rank is
+// worth an additional aging period of time spent waiting in the queue.
+func (p Priority) aged(aging time.Duration) time.Time {
+	return p.ts.Add(-time.Duration(p.rank) * aging)
+}
+
+func extractRank(x interface{}) int {
+	if p, ok := x.(Prioritized); ok {
+		return p.GetPriority()
+	}
+	return 0
+}
+
+func extractGroup(x interface{}) string {
+	if g, ok := x.(Grouped); ok {
+		return g.GetGroup()
+	}
+	return ""
+}
+
+func extractFromDelayed(d Delayed, now time.Time) Priority {
+	deadline := now.Add(d.GetDelay())
 	breaker := BreakChan(nil)
 	if breakout, good := d.(Breakout); good {
 		breaker = breakout.Breaker()
@@ -22,6 +43,7 @@ func extractFromDelayed(d Delayed) Priority {
 	return Priority{
 		ts:     deadline,
 		notify: breaker,
+		rank:   extractRank(d),
 	}
 }
 
@@ -34,6 +56,7 @@ func extractFromDeadlined(d Deadlined) (Priority, bool) {
 		return Priority{
 			ts:     ts,
 			notify: breaker,
+			rank:   extractRank(d),
 		}, true
 	}
 	return Priority{}, false
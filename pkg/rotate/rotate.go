@@ -0,0 +1,105 @@
+// Package rotate provides log files that are rotated by size.
+package rotate
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// File is an io.WriteCloser that appends to a log file, rotating it once it
+// grows beyond maxSize bytes. Rotated files are named path.1 (most recent)
+// through path.N, and at most maxBackups of them are retained.
+type File struct {
+	lock       sync.Mutex
+	path       string
+	maxSize    int64 // rotation is disabled when <= 0
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// Open appends to the file at path, creating it if necessary. Rotation is
+// disabled if maxSize <= 0.
+func Open(path string, maxSize int64, maxBackups int) (*File, error) {
+	r := &File{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// assumes that the caller has acquired the lock
+func (r *File) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file = f
+	r.size = info.Size()
+	return nil
+}
+
+func (r *File) backup(n int) string {
+	return fmt.Sprintf("%s.%d", r.path, n)
+}
+
+// assumes that the caller has acquired the lock
+func (r *File) rotate() error {
+	if r.file != nil {
+		if err := r.file.Close(); err != nil {
+			return err
+		}
+		r.file = nil
+	}
+	if r.maxBackups > 0 {
+		os.Remove(r.backup(r.maxBackups))
+		for n := r.maxBackups - 1; n > 0; n-- {
+			if err := os.Rename(r.backup(n), r.backup(n+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(r.path, r.backup(1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return r.open()
+}
+
+func (r *File) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file == nil {
+		return 0, fmt.Errorf("log file %v is closed", r.path)
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *File) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -0,0 +1,55 @@
+package rotate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log")
+	r, err := Open(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := r.Write([]byte(fmt.Sprintf("line%05d\n", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.Close()
+
+	for name, expected := range map[string]string{
+		path:        "line00003\n",
+		path + ".1": "line00002\n",
+		path + ".2": "line00001\n",
+	} {
+		if data, err := ioutil.ReadFile(name); err != nil {
+			t.Fatal(err)
+		} else if string(data) != expected {
+			t.Fatalf("expected %q in %v, got %q", expected, name, string(data))
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected only 2 backups to be retained")
+	}
+
+	// reopening appends instead of truncating
+	r, err = Open(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("more\n"))
+	r.Close()
+	if data, _ := ioutil.ReadFile(path); string(data) != "line00003\nmore\n" {
+		t.Fatalf("expected log to be appended, got %q", string(data))
+	}
+}
@@ -0,0 +1,117 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
+	log "github.com/golang/glog"
+	annotation "github.com/mesosphere/kubernetes-mesos/pkg/scheduler/meta"
+)
+
+// a rule that relates a pod to the tasks already launched on a slave: with
+// affinity the pod should land on a slave running a task whose labels match
+// the selector, with anti-affinity it should avoid such slaves. terms of zero
+// weight are hard constraints, others are soft preferences.
+type affinityTerm struct {
+	selector labels.Selector
+	weight   int
+	anti     bool
+}
+
+type affinityRules []affinityTerm
+
+// parses semicolon separated terms, each of the form "selector" for a hard
+// constraint or "weight:selector" for a soft preference.
+func parseAffinityTerms(spec string, anti bool) (affinityRules, error) {
+	rules := affinityRules{}
+	for _, term := range strings.Split(spec, ";") {
+		if term = strings.TrimSpace(term); term == "" {
+			continue
+		}
+		weight := 0
+		if i := strings.Index(term, ":"); i >= 0 {
+			w, err := strconv.Atoi(strings.TrimSpace(term[:i]))
+			if err != nil || w <= 0 {
+				return nil, fmt.Errorf("expected a positive weight instead of %q", term[:i])
+			}
+			weight, term = w, strings.TrimSpace(term[i+1:])
+		}
+		selector, err := labels.ParseSelector(term)
+		if err != nil {
+			return nil, err
+		}
+		if selector.Empty() {
+			return nil, fmt.Errorf("empty selector in term %q", term)
+		}
+		rules = append(rules, affinityTerm{selector: selector, weight: weight, anti: anti})
+	}
+	return rules, nil
+}
+
+// returns the affinity and anti-affinity rules declared by the annotations of
+// the pod. invalid annotations are logged and ignored.
+func affinityOf(pod *api.Pod) affinityRules {
+	rules := affinityRules{}
+	for key, anti := range map[string]bool{annotation.AffinityKey: false, annotation.AntiAffinityKey: true} {
+		if spec, found := pod.Annotations[key]; found {
+			if terms, err := parseAffinityTerms(spec, anti); err != nil {
+				log.Warningf("ignoring invalid %v annotation of pod %v/%v: %v", key, pod.Namespace, pod.Name, err)
+			} else {
+				rules = append(rules, terms...)
+			}
+		}
+	}
+	return rules
+}
+
+// returns true if the rules include soft preferences, in which case it's
+// worth looking beyond the first acceptable slave.
+func (rules affinityRules) preferential() bool {
+	for _, t := range rules {
+		if t.weight > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluates the rules against the labels of the tasks on a slave, returning
+// false if a hard constraint is violated and otherwise the sum of the weights
+// of the satisfied soft preferences, less those of the violated ones.
+func (rules affinityRules) evaluate(colocated []labels.Set) (score int, ok bool) {
+	for _, t := range rules {
+		matched := false
+		for _, l := range colocated {
+			if t.selector.Matches(l) {
+				matched = true
+				break
+			}
+		}
+		satisfied := matched != t.anti
+		switch {
+		case t.weight == 0 && !satisfied:
+			return 0, false
+		case t.weight > 0 && satisfied:
+			score += t.weight
+		case t.weight > 0:
+			score -= t.weight
+		}
+	}
+	return score, true
+}
+
+// returns the labels of the pods whose tasks have been launched on the slave
+func colocatedLabels(slaves SlaveIndex, slaveId string) []labels.Set {
+	slave, ok := slaves.slaveFor(slaveId)
+	if !ok {
+		return nil
+	}
+	result := make([]labels.Set, 0, len(slave.Tasks))
+	for _, l := range slave.Tasks {
+		result = append(result, l)
+	}
+	return result
+}
@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
+	annotation "github.com/mesosphere/kubernetes-mesos/pkg/scheduler/meta"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAffinityTerms(t *testing.T) {
+	assert := assert.New(t)
+
+	rules, err := parseAffinityTerms("app=db; 5:tier=cache", false)
+	assert.NoError(err)
+	assert.Equal(2, len(rules))
+	assert.Equal(0, rules[0].weight)
+	assert.Equal(5, rules[1].weight)
+	assert.True(rules.preferential())
+
+	rules, err = parseAffinityTerms("app=db", true)
+	assert.NoError(err)
+	assert.True(rules[0].anti)
+	assert.False(rules.preferential())
+
+	_, err = parseAffinityTerms("0:app=db", false)
+	assert.Error(err)
+	_, err = parseAffinityTerms("heavy:app=db", false)
+	assert.Error(err)
+	_, err = parseAffinityTerms("3:", false)
+	assert.Error(err)
+}
+
+func TestAffinityOf(t *testing.T) {
+	assert := assert.New(t)
+
+	pod := &api.Pod{ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: api.NamespaceDefault}}
+	assert.Empty(affinityOf(pod))
+
+	pod.Annotations = map[string]string{
+		annotation.AffinityKey:     "app=db",
+		annotation.AntiAffinityKey: "0:app=web",
+	}
+	rules := affinityOf(pod)
+	assert.Equal(1, len(rules))
+	assert.False(rules[0].anti)
+}
+
+func TestEvaluateAffinity(t *testing.T) {
+	assert := assert.New(t)
+
+	db := labels.Set{"app": "db"}
+	web := labels.Set{"app": "web"}
+
+	affinity, _ := parseAffinityTerms("app=db", false)
+	_, ok := affinity.evaluate(nil)
+	assert.False(ok)
+	_, ok = affinity.evaluate([]labels.Set{web, db})
+	assert.True(ok)
+
+	anti, _ := parseAffinityTerms("app=db", true)
+	_, ok = anti.evaluate([]labels.Set{db})
+	assert.False(ok)
+	_, ok = anti.evaluate([]labels.Set{web})
+	assert.True(ok)
+
+	// soft preferences never reject a slave, they rank it
+	soft, _ := parseAffinityTerms("2:app=db", false)
+	softAnti, _ := parseAffinityTerms("3:app=web", true)
+	rules := append(soft, softAnti...)
+
+	score, ok := rules.evaluate([]labels.Set{db})
+	assert.True(ok)
+	assert.Equal(5, score)
+	score, _ = rules.evaluate([]labels.Set{web})
+	assert.Equal(-5, score)
+	score, _ = rules.evaluate(nil)
+	assert.Equal(1, score)
+}
@@ -0,0 +1,535 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/api/v1"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+)
+
+// the versioned JSON API of the scheduler, for dashboards and CLI tools:
+//
+//   GET  /api/v1/tasks[?state=pending|running|finished&namespace=ns&slave=id]
+//   GET  /api/v1/tasks/{taskId}
+//   POST /api/v1/tasks/{taskId}/kill
+//   GET  /api/v1/orphans
+//   POST /api/v1/orphans/kill[?task=id...]
+//   GET  /api/v1/offers[?state=live|lingering&slave=id]
+//   GET  /api/v1/offers/{offerId}
+//   GET  /api/v1/slaves
+//   GET  /api/v1/slaves/{slaveId}
+//   POST /api/v1/slaves/{slaveId}/drain
+//   POST /api/v1/slaves/{slaveId}/undrain
+//   GET  /api/v1/queue[?namespace=ns]
+//   GET  /api/v1/pods/{namespace}/{name}/explain
+//   POST /api/v1/reconcile
+//
+// slaves may be filtered by id or by hostname. only orphaned tasks may be
+// killed, other tasks are killed by deleting their pods; see orphanDetector.
+type apiServer struct {
+	q       *queuer
+	sched   SchedulerInterface
+	orphans *orphanDetector
+}
+
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+func apiNotFound(kind, id string) error {
+	return &apiError{http.StatusNotFound, fmt.Sprintf("%v %v not found", kind, id)}
+}
+
+// serves the versioned JSON API, see apiServer
+func (q *queuer) installAPIHandlers(sched SchedulerInterface, orphans *orphanDetector) {
+	http.Handle(v1.PathPrefix, &apiServer{q: q, sched: sched, orphans: orphans})
+}
+
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, v1.PathPrefix), "/"), "/")
+	var (
+		result interface{}
+		err    error
+	)
+	switch r.Method {
+	case "GET":
+		result, err = s.get(parts, r.URL.Query())
+	case "POST":
+		result, err = s.post(parts, r.URL.Query())
+	default:
+		err = &apiError{http.StatusMethodNotAllowed, fmt.Sprintf("unsupported method %v", r.Method)}
+	}
+	switch err := err.(type) {
+	case nil:
+		writeJson(w, result)
+	case *apiError:
+		http.Error(w, err.Error(), err.status)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+func (s *apiServer) get(parts []string, query url.Values) (interface{}, error) {
+	switch {
+	case parts[0] == "tasks" && len(parts) == 1:
+		return s.listTasks(query)
+	case parts[0] == "tasks" && len(parts) == 2:
+		return s.getTask(parts[1])
+	case parts[0] == "orphans" && len(parts) == 1:
+		return s.listOrphans()
+	case parts[0] == "offers" && len(parts) == 1:
+		return s.listOffers(query)
+	case parts[0] == "offers" && len(parts) == 2:
+		return s.getOffer(parts[1])
+	case parts[0] == "slaves" && len(parts) == 1:
+		return s.listSlaves(), nil
+	case parts[0] == "slaves" && len(parts) == 2:
+		return s.getSlave(parts[1])
+	case parts[0] == "queue" && len(parts) == 1:
+		return s.q.list(query.Get("namespace")), nil
+	case parts[0] == "pods" && len(parts) == 4 && parts[1] != "" && parts[2] != "" && parts[3] == "explain":
+		return s.q.explain(s.sched, parts[1], parts[2])
+	}
+	return nil, &apiError{http.StatusNotFound, "no such resource"}
+}
+
+func (s *apiServer) post(parts []string, query url.Values) (interface{}, error) {
+	switch {
+	case parts[0] == "tasks" && len(parts) == 3 && parts[2] == "kill":
+		return s.killOrphan(parts[1])
+	case parts[0] == "orphans" && len(parts) == 2 && parts[1] == "kill":
+		return s.killOrphans(query["task"])
+	case parts[0] == "slaves" && len(parts) == 3 && parts[2] == "drain":
+		return s.drainSlave(parts[1], true)
+	case parts[0] == "slaves" && len(parts) == 3 && parts[2] == "undrain":
+		return s.drainSlave(parts[1], false)
+	case parts[0] == "reconcile" && len(parts) == 1:
+		return s.reconcile()
+	}
+	return nil, &apiError{http.StatusNotFound, "no such action"}
+}
+
+func writeJson(w http.ResponseWriter, obj interface{}) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		log.Warningf("failed to write API response: %v", err)
+	}
+}
+
+// returns true if the slave matches the filter, an id or a hostname
+func slaveMatches(filter, slaveId, hostname string) bool {
+	return filter == "" || filter == slaveId || filter == hostname
+}
+
+func (s *apiServer) listTasks(query url.Values) (*v1.TaskList, error) {
+	states := []podtask.StateType{podtask.StatePending, podtask.StateRunning, podtask.StateFinished}
+	if name := query.Get("state"); name != "" {
+		state, err := podtask.ParseState(name)
+		if err != nil {
+			return nil, err
+		}
+		states = []podtask.StateType{state}
+	}
+	namespace, slave := query.Get("namespace"), query.Get("slave")
+
+	s.sched.RLocker().Lock()
+	defer s.sched.RLocker().Unlock()
+
+	list := &v1.TaskList{Items: []v1.Task{}}
+	for _, state := range states {
+		for _, task := range s.sched.listTasks(state) {
+			t := newAPITask(s.sched, task)
+			if (namespace == "" || namespace == t.Namespace) && slaveMatches(slave, t.SlaveId, t.Hostname) {
+				list.Items = append(list.Items, t)
+			}
+		}
+	}
+	sort.Sort(apiTasks(list.Items))
+	return list, nil
+}
+
+func (s *apiServer) getTask(taskId string) (*v1.Task, error) {
+	s.sched.RLocker().Lock()
+	defer s.sched.RLocker().Unlock()
+
+	task, state := s.sched.getTask(taskId)
+	if state == podtask.StateUnknown {
+		return nil, apiNotFound("task", taskId)
+	}
+	t := newAPITask(s.sched, task)
+	return &t, nil
+}
+
+// assumes that the caller holds the scheduler lock, at least for reading
+func newAPITask(slaves SlaveIndex, task *podtask.T) v1.Task {
+	t := v1.Task{
+		Id:       task.ID,
+		State:    task.State.String(),
+		Flags:    []string{},
+		Priority: task.Priority,
+		Created:  task.CreateTime,
+	}
+	if task.Pod != nil {
+		t.Pod = task.Pod.Namespace + "/" + task.Pod.Name
+		t.Namespace = task.Pod.Namespace
+	}
+	for flag := range task.Flags {
+		t.Flags = append(t.Flags, string(flag))
+	}
+	sort.Strings(t.Flags)
+	if task.Offer != nil {
+		if details := task.Offer.Details(); details != nil {
+			t.OfferId = details.GetId().GetValue()
+		}
+	}
+	if task.TaskInfo != nil && task.TaskInfo.SlaveId != nil {
+		t.SlaveId = task.TaskInfo.SlaveId.GetValue()
+		if slave, found := slaves.slaveFor(t.SlaveId); found {
+			t.Hostname = slave.HostName
+		}
+	}
+	for _, m := range task.Ports {
+		port := v1.PortMapping{HostPort: m.OfferPort}
+		if task.Pod != nil && m.ContainerIdx < len(task.Pod.Spec.Containers) {
+			c := &task.Pod.Spec.Containers[m.ContainerIdx]
+			port.Container = c.Name
+			if m.PortIdx < len(c.Ports) {
+				port.ContainerPort = c.Ports[m.PortIdx].ContainerPort
+			}
+		}
+		t.Ports = append(t.Ports, port)
+	}
+	if launched := task.LaunchTime(); !launched.IsZero() {
+		t.Launched = &launched
+	}
+	if bound := task.BindTime(); !bound.IsZero() {
+		t.Bound = &bound
+	}
+	if !task.UpdatedTime.IsZero() {
+		updated := task.UpdatedTime
+		t.Updated = &updated
+	}
+	return t
+}
+
+func (s *apiServer) listOrphans() (*v1.OrphanList, error) {
+	orphans, err := s.orphans.detect()
+	if err != nil {
+		return nil, err
+	}
+	return &v1.OrphanList{Items: orphans}, nil
+}
+
+// kills a task, but only if it's orphaned
+func (s *apiServer) killOrphan(taskId string) (*v1.Status, error) {
+	orphans, err := s.orphans.detect()
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range orphans {
+		if o.Task.Id == taskId {
+			if err := s.orphans.kill(o, orphanTriggerAPI); err != nil {
+				return nil, err
+			}
+			return &v1.Status{Message: fmt.Sprintf("killed orphaned task %v: %v", taskId, o.Reason), Tasks: []string{taskId}}, nil
+		}
+	}
+	if _, err := s.getTask(taskId); err != nil {
+		return nil, err
+	}
+	return nil, &apiError{http.StatusConflict, fmt.Sprintf("task %v is not orphaned, delete its pod instead", taskId)}
+}
+
+// kills all orphaned tasks whose pods are confirmed absent, or only the given
+// orphans, from a single pass of the detector. nothing is killed if any of the
+// given tasks isn't orphaned.
+func (s *apiServer) killOrphans(taskIds []string) (*v1.Status, error) {
+	orphans, err := s.orphans.detect()
+	if err != nil {
+		return nil, err
+	}
+	all, wanted := len(taskIds) == 0, map[string]bool{}
+	for _, id := range taskIds {
+		wanted[id] = true
+	}
+	targets := []v1.Orphan{}
+	for _, o := range orphans {
+		if (all && podConfirmedAbsent(o)) || wanted[o.Task.Id] {
+			targets = append(targets, o)
+			delete(wanted, o.Task.Id)
+		}
+	}
+	for id := range wanted {
+		return nil, &apiError{http.StatusConflict, fmt.Sprintf("task %v is not orphaned", id)}
+	}
+
+	killed := []string{}
+	for _, o := range targets {
+		if err := s.orphans.kill(o, orphanTriggerAPI); err != nil {
+			return nil, &apiError{http.StatusInternalServerError, fmt.Sprintf("killed %d of %d orphaned tasks %v: %v", len(killed), len(targets), killed, err)}
+		}
+		killed = append(killed, o.Task.Id)
+	}
+	return &v1.Status{Message: fmt.Sprintf("killed %d orphaned tasks", len(killed)), Tasks: killed}, nil
+}
+
+// flags a slave as draining, or not. the running tasks of a draining slave
+// are killed, and their pods are scheduled once again on other slaves.
+func (s *apiServer) drainSlave(slaveId string, drain bool) (*v1.Status, error) {
+	s.sched.Lock()
+	defer s.sched.Unlock()
+
+	var (
+		id    string
+		slave *Slave
+	)
+	for _, sid := range s.sched.listSlaves() {
+		if sl, found := s.sched.slaveFor(sid); found && slaveMatches(slaveId, sid, sl.HostName) {
+			id, slave = sid, sl
+			break
+		}
+	}
+	if slave == nil {
+		return nil, apiNotFound("slave", slaveId)
+	}
+	slave.Draining = drain
+	if !drain {
+		log.Infof("slave %v (%v) is no longer draining", id, slave.HostName)
+		return &v1.Status{Message: fmt.Sprintf("slave %v is no longer draining", id)}, nil
+	}
+
+	log.Infof("draining slave %v (%v)", id, slave.HostName)
+	status := &v1.Status{}
+	taskIds := make([]string, 0, len(slave.Tasks))
+	for taskId := range slave.Tasks {
+		taskIds = append(taskIds, taskId)
+	}
+	sort.Strings(taskIds)
+	for _, taskId := range taskIds {
+		task, _ := s.sched.getTask(taskId)
+		if task == nil || task.Has(podtask.Deleted) || task.Has(podtask.Preempted) || task.Has(podtask.Drained) {
+			continue
+		}
+		if err := s.sched.killTask(taskId, killReasonDrained); err != nil {
+			log.Errorf("failed to kill task %v while draining slave %v: %v", taskId, id, err)
+			continue
+		}
+		task.Set(podtask.Drained)
+		status.Tasks = append(status.Tasks, taskId)
+	}
+	status.Message = fmt.Sprintf("draining slave %v, killed %d of %d tasks", id, len(status.Tasks), len(taskIds))
+	return status, nil
+}
+
+func (s *apiServer) reconcile() (*v1.Status, error) {
+	s.sched.Lock()
+	defer s.sched.Unlock()
+
+	switch err := s.sched.reconcileTasks(); err {
+	case nil:
+		return &v1.Status{Message: "task reconciliation started"}, nil
+	case notRegisteredErr:
+		return nil, &apiError{http.StatusServiceUnavailable, err.Error()}
+	case reconcilingErr:
+		return nil, &apiError{http.StatusConflict, err.Error()}
+	default:
+		return nil, err
+	}
+}
+
+func (s *apiServer) listOffers(query url.Values) (*v1.OfferList, error) {
+	state, slave := query.Get("state"), query.Get("slave")
+	if state != "" && state != "live" && state != "lingering" {
+		return nil, fmt.Errorf("unknown offer state %q", state)
+	}
+	list := &v1.OfferList{Items: []v1.Offer{}}
+	for _, o := range s.allOffers() {
+		if (state == "" || state == o.State) && slaveMatches(slave, o.SlaveId, o.Hostname) {
+			list.Items = append(list.Items, o)
+		}
+	}
+	return list, nil
+}
+
+func (s *apiServer) getOffer(offerId string) (*v1.Offer, error) {
+	for _, o := range s.allOffers() {
+		if o.Id == offerId {
+			return &o, nil
+		}
+	}
+	return nil, apiNotFound("offer", offerId)
+}
+
+// returns the live and lingering offers of the registry, ordered by id
+func (s *apiServer) allOffers() []v1.Offer {
+	result := []v1.Offer{}
+	for _, snap := range s.sched.offers().List() {
+		o := v1.Offer{
+			Id:       snap.Id,
+			Hostname: snap.Hostname,
+			State:    "live",
+			Acquired: snap.Acquired,
+			Deadline: snap.Deadline,
+		}
+		if snap.Lingering {
+			o.State = "lingering"
+		}
+		if snap.Details != nil {
+			o.SlaveId = snap.Details.GetSlaveId().GetValue()
+			roles := map[string]bool{}
+			for _, r := range snap.Details.GetResources() {
+				roles[r.GetRole()] = true
+				switch r.GetName() {
+				case "cpus":
+					o.Cpus += r.GetScalar().GetValue()
+				case "mem":
+					o.Mem += r.GetScalar().GetValue()
+				case "ports":
+					for _, pr := range r.GetRanges().GetRange() {
+						o.Ports = append(o.Ports, v1.PortRange{Begin: pr.GetBegin(), End: pr.GetEnd()})
+					}
+				}
+			}
+			for role := range roles {
+				o.Roles = append(o.Roles, role)
+			}
+			sort.Strings(o.Roles)
+		}
+		result = append(result, o)
+	}
+	sort.Sort(apiOffers(result))
+	return result
+}
+
+func (s *apiServer) listSlaves() *v1.SlaveList {
+	s.sched.RLocker().Lock()
+	defer s.sched.RLocker().Unlock()
+
+	list := &v1.SlaveList{Items: []v1.Slave{}}
+	for _, id := range s.sched.listSlaves() {
+		if slave, found := s.sched.slaveFor(id); found {
+			list.Items = append(list.Items, newAPISlave(id, slave))
+		}
+	}
+	return list
+}
+
+func (s *apiServer) getSlave(slaveId string) (*v1.Slave, error) {
+	s.sched.RLocker().Lock()
+	defer s.sched.RLocker().Unlock()
+
+	for _, id := range s.sched.listSlaves() {
+		if slave, found := s.sched.slaveFor(id); found && slaveMatches(slaveId, id, slave.HostName) {
+			result := newAPISlave(id, slave)
+			return &result, nil
+		}
+	}
+	return nil, apiNotFound("slave", slaveId)
+}
+
+// assumes that the caller holds the scheduler lock, at least for reading
+func newAPISlave(id string, slave *Slave) v1.Slave {
+	s := v1.Slave{
+		Id:       id,
+		Hostname: slave.HostName,
+		Draining: slave.Draining,
+		Offers:   []string{},
+		Tasks:    []string{},
+		Daemons:  slave.Daemons,
+	}
+	for _, a := range slave.Attributes {
+		if value, found := attributeValue(slave.HostName, slave.Attributes, a.GetName()); found {
+			if s.Attributes == nil {
+				s.Attributes = map[string]string{}
+			}
+			s.Attributes[a.GetName()] = value
+		}
+	}
+	for offerId := range slave.Offers {
+		s.Offers = append(s.Offers, offerId)
+	}
+	sort.Strings(s.Offers)
+	for taskId := range slave.Tasks {
+		s.Tasks = append(s.Tasks, taskId)
+	}
+	sort.Strings(s.Tasks)
+	return s
+}
+
+// returns the pods of the scheduling queue, optionally filtered by namespace,
+// in order of their deadlines
+func (q *queuer) list(namespace string) *v1.QueuedPodList {
+	list := &v1.QueuedPodList{Items: []v1.QueuedPod{}}
+	for _, x := range q.podQueue.List() {
+		pod, ok := x.(*Pod)
+		if !ok || (namespace != "" && pod.Namespace != namespace) {
+			continue
+		}
+		p := v1.QueuedPod{
+			Pod:       pod.Namespace + "/" + pod.Name,
+			Namespace: pod.Namespace,
+			Priority:  string(pod.priority),
+		}
+		if deadline, ok := pod.Deadline(); ok {
+			p.Deadline = &deadline
+		}
+		if delay := pod.GetDelay(); delay > 0 {
+			p.Delay = delay.String()
+		}
+		list.Items = append(list.Items, p)
+	}
+	sort.Sort(apiQueuedPods(list.Items))
+	return list
+}
+
+type apiTasks []v1.Task
+
+func (s apiTasks) Len() int           { return len(s) }
+func (s apiTasks) Less(i, j int) bool { return s[i].Id < s[j].Id }
+func (s apiTasks) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type apiOrphans []v1.Orphan
+
+func (s apiOrphans) Len() int           { return len(s) }
+func (s apiOrphans) Less(i, j int) bool { return s[i].Task.Id < s[j].Task.Id }
+func (s apiOrphans) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type apiOffers []v1.Offer
+
+func (s apiOffers) Len() int           { return len(s) }
+func (s apiOffers) Less(i, j int) bool { return s[i].Id < s[j].Id }
+func (s apiOffers) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// pods with deadlines first, earliest first, then by name
+type apiQueuedPods []v1.QueuedPod
+
+func (s apiQueuedPods) Len() int { return len(s) }
+func (s apiQueuedPods) Less(i, j int) bool {
+	di, dj := s[i].Deadline, s[j].Deadline
+	switch {
+	case di != nil && dj != nil && !di.Equal(*dj):
+		return di.Before(*dj)
+	case di != nil && dj == nil:
+		return true
+	case di == nil && dj != nil:
+		return false
+	}
+	return s[i].Pod < s[j].Pod
+}
+func (s apiQueuedPods) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
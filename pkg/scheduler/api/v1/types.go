@@ -0,0 +1,135 @@
+// Package v1 declares the objects of version 1 of the scheduler's JSON API,
+// shared by the scheduler that serves them and the clients that consume them.
+package v1
+
+import (
+	"time"
+
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
+)
+
+const PathPrefix = "/api/v1/"
+
+type PortMapping struct {
+	Container     string `json:"container"`
+	ContainerPort int    `json:"containerPort"`
+	HostPort      uint64 `json:"hostPort"`
+}
+
+type Task struct {
+	Id        string        `json:"id"`
+	Pod       string        `json:"pod"` // namespace/name
+	Namespace string        `json:"namespace"`
+	State     string        `json:"state"`
+	Flags     []string      `json:"flags"`
+	Priority  string        `json:"priority,omitempty"`
+	OfferId   string        `json:"offerId,omitempty"`
+	SlaveId   string        `json:"slaveId,omitempty"`
+	Hostname  string        `json:"hostname,omitempty"`
+	Ports     []PortMapping `json:"ports,omitempty"`
+	Created   time.Time     `json:"created"`
+	Launched  *time.Time    `json:"launched,omitempty"`
+	Bound     *time.Time    `json:"bound,omitempty"`
+	Updated   *time.Time    `json:"updated,omitempty"` // time of the most recent status update
+}
+
+type TaskList struct {
+	Items []Task `json:"items"`
+}
+
+type Offer struct {
+	Id       string      `json:"id"`
+	SlaveId  string      `json:"slaveId,omitempty"` // unknown once an offer lingers
+	Hostname string      `json:"hostname"`
+	State    string      `json:"state"` // live or lingering
+	Acquired bool        `json:"acquired"`
+	Deadline time.Time   `json:"deadline"` // when a live offer expires, or a lingering offer is forgotten
+	Cpus     float64     `json:"cpus,omitempty"`
+	Mem      float64     `json:"mem,omitempty"`
+	Ports    []PortRange `json:"ports,omitempty"`
+	Roles    []string    `json:"roles,omitempty"`
+}
+
+// PortRange is an inclusive range of offered host ports
+type PortRange struct {
+	Begin uint64 `json:"begin"`
+	End   uint64 `json:"end"`
+}
+
+type OfferList struct {
+	Items []Offer `json:"items"`
+}
+
+type Slave struct {
+	Id         string                  `json:"id"`
+	Hostname   string                  `json:"hostname"`
+	Draining   bool                    `json:"draining"` // no tasks are launched on a draining slave
+	Attributes map[string]string       `json:"attributes,omitempty"`
+	Offers     []string                `json:"offers"`
+	Tasks      []string                `json:"tasks"`
+	Daemons    []messages.DaemonHealth `json:"daemons,omitempty"`
+}
+
+type SlaveList struct {
+	Items []Slave `json:"items"`
+}
+
+type QueuedPod struct {
+	Pod       string     `json:"pod"` // namespace/name
+	Namespace string     `json:"namespace"`
+	Priority  string     `json:"priority,omitempty"`
+	Deadline  *time.Time `json:"deadline,omitempty"`
+	Delay     string     `json:"delay,omitempty"` // backoff of a pod that failed to schedule
+}
+
+type QueuedPodList struct {
+	Items []QueuedPod `json:"items"`
+}
+
+type OfferFailure struct {
+	Check   string   `json:"check"`
+	Message string   `json:"message"`
+	Ports   []uint64 `json:"ports,omitempty"` // host ports that the offer lacks
+}
+
+type OfferExplanation struct {
+	OfferId  string         `json:"offerId"`
+	Fits     bool           `json:"fits"`
+	Score    int            `json:"score,omitempty"` // affinity score of offers that fit
+	Roles    []string       `json:"roles,omitempty"`
+	Failures []OfferFailure `json:"failures,omitempty"`
+}
+
+type SlaveExplanation struct {
+	SlaveId  string             `json:"slaveId"`
+	Hostname string             `json:"hostname"`
+	Offers   []OfferExplanation `json:"offers"`
+}
+
+// explains why a pod's task can, or can't, be supported by each live offer
+type PodExplanation struct {
+	Pod      string             `json:"pod"`
+	TaskId   string             `json:"taskId,omitempty"` // empty if the pod has no registered task
+	Launched bool               `json:"launched"`
+	Demand   map[string]float64 `json:"demand"`
+	Fits     int                `json:"fits"` // number of offers that could support the task
+	Error    string             `json:"error,omitempty"`
+	Slaves   []SlaveExplanation `json:"slaves"`
+}
+
+// a task that outlived its pod: the pod was deleted from the apiserver, or
+// replaced by another of the same name
+type Orphan struct {
+	Task   Task   `json:"task"`
+	Reason string `json:"reason"`
+}
+
+type OrphanList struct {
+	Items []Orphan `json:"items"`
+}
+
+// the outcome of an action such as a drain or a kill
+type Status struct {
+	Message string   `json:"message"`
+	Tasks   []string `json:"tasks,omitempty"` // tasks that were killed
+}
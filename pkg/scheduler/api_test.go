@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/gogo/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	mutil "github.com/mesos/mesos-go/mesosutil"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/api/v1"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAPITask(t *testing.T) {
+	assert := assert.New(t)
+	obj := &MockScheduler{}
+	obj.On("slaveFor", "slave1").Return(&Slave{HostName: "h1"}, true)
+
+	pod := &api.Pod{
+		ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: "web"},
+		Spec: api.PodSpec{
+			Containers: []api.Container{{Name: "nginx", Ports: []api.Port{{ContainerPort: 80, HostPort: 8080}}}},
+		},
+	}
+	task, err := podtask.New(api.NewDefaultContext(), pod, &mesos.ExecutorInfo{})
+	assert.NoError(err)
+
+	// a pending task hasn't been placed yet
+	at := newAPITask(obj, task)
+	assert.Equal(task.ID, at.Id)
+	assert.Equal("web/foo", at.Pod)
+	assert.Equal("web", at.Namespace)
+	assert.Equal("pending", at.State)
+	assert.Empty(at.SlaveId)
+	assert.Empty(at.Ports)
+	assert.Nil(at.Launched)
+
+	task.TaskInfo.SlaveId = mutil.NewSlaveID("slave1")
+	task.Ports = []podtask.HostPortMapping{{ContainerIdx: 0, PortIdx: 0, OfferPort: 31000}}
+	task.UpdatedTime = time.Now()
+
+	at = newAPITask(obj, task)
+	assert.Equal("slave1", at.SlaveId)
+	assert.Equal("h1", at.Hostname)
+	assert.Equal([]v1.PortMapping{{Container: "nginx", ContainerPort: 80, HostPort: 31000}}, at.Ports)
+	if assert.NotNil(at.Updated) {
+		assert.Equal(task.UpdatedTime, *at.Updated)
+	}
+	obj.AssertExpectations(t)
+}
+
+func TestNewAPISlave(t *testing.T) {
+	assert := assert.New(t)
+	slave := newSlave("h1")
+	slave.Offers["o2"] = empty{}
+	slave.Offers["o1"] = empty{}
+	slave.Attributes = []*mesos.Attribute{{
+		Name: proto.String("rack"),
+		Type: mesos.Value_TEXT.Enum(),
+		Text: &mesos.Value_Text{Value: proto.String("r1")},
+	}}
+
+	s := newAPISlave("slave1", slave)
+	assert.Equal("slave1", s.Id)
+	assert.Equal("h1", s.Hostname)
+	assert.Equal([]string{"o1", "o2"}, s.Offers)
+	assert.Equal([]string{}, s.Tasks)
+	assert.Equal(map[string]string{"rack": "r1"}, s.Attributes)
+}
+
+func TestAPIQueuedPodsOrder(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Second)
+	pods := apiQueuedPods{
+		{Pod: "default/c"},
+		{Pod: "default/b", Deadline: &later},
+		{Pod: "default/a"},
+		{Pod: "default/d", Deadline: &now},
+	}
+	sort.Sort(pods)
+
+	names := []string{}
+	for _, p := range pods {
+		names = append(names, p.Pod)
+	}
+	assert.Equal(t, []string{"default/d", "default/b", "default/a", "default/c"}, names)
+}
+
+func TestAPIDrainSlave(t *testing.T) {
+	assert := assert.New(t)
+	obj := &MockScheduler{}
+	slave := newSlave("h1")
+	slave.Tasks["task1"] = nil
+	slave.Tasks["task2"] = nil
+
+	pod := &api.Pod{ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: api.NamespaceDefault}}
+	task1, err := podtask.New(api.NewDefaultContext(), pod, &mesos.ExecutorInfo{})
+	assert.NoError(err)
+	task2, err := podtask.New(api.NewDefaultContext(), pod, &mesos.ExecutorInfo{})
+	assert.NoError(err)
+	task2.Set(podtask.Deleted) // already being killed
+
+	obj.On("listSlaves").Return([]string{"slave1"})
+	obj.On("slaveFor", "slave1").Return(slave, true)
+	obj.On("getTask", "task1").Return(task1, podtask.StateRunning)
+	obj.On("getTask", "task2").Return(task2, podtask.StateRunning)
+	obj.On("killTask", "task1", killReasonDrained).Return(nil)
+
+	s := &apiServer{sched: obj}
+	status, err := s.drainSlave("h1", true)
+	assert.NoError(err)
+	assert.True(slave.Draining)
+	assert.Equal([]string{"task1"}, status.Tasks)
+	assert.True(task1.Has(podtask.Drained))
+	assert.False(task2.Has(podtask.Drained))
+
+	_, err = s.drainSlave("h1", false)
+	assert.NoError(err)
+	assert.False(slave.Draining)
+
+	_, err = s.drainSlave("h2", true)
+	if assert.IsType(&apiError{}, err) {
+		assert.Equal(http.StatusNotFound, err.(*apiError).status)
+	}
+	obj.AssertExpectations(t)
+}
+
+func TestAPIReconcile(t *testing.T) {
+	assert := assert.New(t)
+	obj := &MockScheduler{}
+	obj.On("reconcileTasks").Return(reconcilingErr).Once()
+	obj.On("reconcileTasks").Return(nil).Once()
+
+	s := &apiServer{sched: obj}
+	for _, expected := range []int{http.StatusConflict, http.StatusOK} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", v1.PathPrefix+"reconcile", nil)
+		s.ServeHTTP(w, r)
+		assert.Equal(expected, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", v1.PathPrefix+"reconcile", nil)
+	s.ServeHTTP(w, r)
+	assert.Equal(http.StatusNotFound, w.Code)
+	obj.AssertExpectations(t)
+}
+
+func TestAPIListSlaves(t *testing.T) {
+	assert := assert.New(t)
+	obj := &MockScheduler{}
+	obj.On("listSlaves").Return([]string{"slave1"})
+	obj.On("slaveFor", "slave1").Return(newSlave("h1"), true)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", v1.PathPrefix+"slaves", nil)
+	(&apiServer{sched: obj}).ServeHTTP(w, r)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Equal("application/json", w.Header().Get("Content-Type"))
+
+	var list v1.SlaveList
+	if assert.NoError(json.Unmarshal(w.Body.Bytes(), &list)) && assert.Len(list.Items, 1) {
+		assert.Equal("h1", list.Items[0].Hostname)
+	}
+	obj.AssertExpectations(t)
+}
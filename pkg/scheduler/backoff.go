@@ -14,67 +14,232 @@ limitations under the License.
 // copied from k8s: plugin/pkg/scheduler/factory/factory.go
 package scheduler
 
+import "fmt"
+import "math/rand"
+import "sort"
 import "sync"
 import "time"
+import "github.com/GoogleCloudPlatform/kubernetes/pkg/api"
 import log "github.com/golang/glog"
+import "github.com/mesosphere/kubernetes-mesos/pkg/clock"
+import annotation "github.com/mesosphere/kubernetes-mesos/pkg/scheduler/meta"
 
-type clock interface {
-	Now() time.Time
+const (
+	defaultBackoffJitter = 0.2 // fraction of an exponential backoff that's randomized
+	offerSupplyInterval  = 10 * time.Second
+	offerSupplyThreshold = 0.5 // relative increase of offered resources that resets backoff
+)
+
+// BackoffStrategy determines the delays between successive attempts to
+// schedule a pod.
+type BackoffStrategy interface {
+	// returns the delay before the given attempt, counting from zero, which
+	// should fall within [min, max].
+	Delay(attempt int, min, max time.Duration) time.Duration
+}
+
+// doubles the delay upon each attempt, less a random fraction of up to Jitter
+// so that pods that failed together don't retry in lockstep.
+type ExponentialBackoff struct {
+	Jitter float64
+}
+
+func (b ExponentialBackoff) Delay(attempt int, min, max time.Duration) time.Duration {
+	d := min
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if b.Jitter > 0 {
+		d -= time.Duration(b.Jitter * rand.Float64() * float64(d))
+		if d < min {
+			d = min
+		}
+	}
+	return d
+}
+
+// grows the delay according to the fibonacci sequence, more gently than
+// ExponentialBackoff.
+type FibonacciBackoff struct{}
+
+func (FibonacciBackoff) Delay(attempt int, min, max time.Duration) time.Duration {
+	d, next := min, min
+	for i := 0; i < attempt && d < max; i++ {
+		d, next = next, d+next
+	}
+	if d > max {
+		d = max
+	}
+	return d
 }
 
-type realClock struct{}
+// always waits for the minimum delay.
+type ConstantBackoff struct{}
+
+func (ConstantBackoff) Delay(attempt int, min, max time.Duration) time.Duration {
+	return min
+}
 
-func (realClock) Now() time.Time {
-	return time.Now()
+var backoffStrategies = map[string]BackoffStrategy{
+	"exponential": ExponentialBackoff{Jitter: defaultBackoffJitter},
+	"fibonacci":   FibonacciBackoff{},
+	"constant":    ConstantBackoff{},
+}
+
+// BackoffStrategies returns the names of the known backoff strategies.
+func BackoffStrategies() []string {
+	names := make([]string, 0, len(backoffStrategies))
+	for name := range backoffStrategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func ParseBackoffStrategy(name string) (BackoffStrategy, error) {
+	if s, found := backoffStrategies[name]; found {
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown backoff strategy %q, expected one of %v", name, BackoffStrategies())
 }
 
 type backoffEntry struct {
-	backoff    time.Duration
-	lastUpdate time.Time
+	attempts    int
+	lastUpdate  time.Time
+	maxDuration time.Duration
 }
 
 type podBackoff struct {
 	perPodBackoff   map[string]*backoffEntry
 	lock            sync.Mutex
-	clock           clock
+	clock           clock.Clock
+	strategy        BackoffStrategy
 	defaultDuration time.Duration
 	maxDuration     time.Duration
 }
 
+func newPodBackoff(strategy BackoffStrategy, c clock.Clock) *podBackoff {
+	return &podBackoff{
+		perPodBackoff:   map[string]*backoffEntry{},
+		clock:           c,
+		strategy:        strategy,
+		defaultDuration: 1 * time.Second,
+		maxDuration:     60 * time.Second,
+	}
+}
+
+// the strategy and bounds of the pod's backoff, which may be overridden by
+// annotations of the pod.
+func (p *podBackoff) policyFor(pod *api.Pod) (strategy BackoffStrategy, min, max time.Duration) {
+	strategy, min, max = p.strategy, p.defaultDuration, p.maxDuration
+	if strategy == nil {
+		strategy = backoffStrategies["exponential"]
+	}
+	if pod == nil {
+		return
+	}
+	if name, found := pod.Annotations[annotation.BackoffStrategyKey]; found {
+		if s, err := ParseBackoffStrategy(name); err != nil {
+			log.Warningf("ignoring backoff strategy of pod %v/%v: %v", pod.Namespace, pod.Name, err)
+		} else {
+			strategy = s
+		}
+	}
+	parse := func(key string, d *time.Duration) {
+		if s, found := pod.Annotations[key]; found {
+			if x, err := time.ParseDuration(s); err != nil || x <= 0 {
+				log.Warningf("ignoring invalid %v annotation of pod %v/%v: %q", key, pod.Namespace, pod.Name, s)
+			} else {
+				*d = x
+			}
+		}
+	}
+	parse(annotation.BackoffMinKey, &min)
+	parse(annotation.BackoffMaxKey, &max)
+	if max < min {
+		log.Warningf("backoff of pod %v/%v is bounded by its minimum %v", pod.Namespace, pod.Name, min)
+		max = min
+	}
+	return
+}
+
 func (p *podBackoff) getEntry(podID string) *backoffEntry {
 	p.lock.Lock()
 	defer p.lock.Unlock()
 	entry, ok := p.perPodBackoff[podID]
 	if !ok {
-		entry = &backoffEntry{backoff: p.defaultDuration}
+		entry = &backoffEntry{}
 		p.perPodBackoff[podID] = entry
 	}
 	entry.lastUpdate = p.clock.Now()
 	return entry
 }
 
-// TODO(jdef): allow for pluggable backoff sequences, strategies here. For
-// example we may want to use a fibonacci backoff sequence for certain cluster
-// sizes. Or, perhaps we'll allow per-pod backoff factors at some point (ala
-// marathon).
-func (p *podBackoff) getBackoff(podID string) time.Duration {
-	entry := p.getEntry(podID)
-	duration := entry.backoff
-	entry.backoff *= 2
-	if entry.backoff > p.maxDuration {
-		entry.backoff = p.maxDuration
+// returns the number of failed attempts to schedule the pod since its backoff
+// was last reset
+func (p *podBackoff) attempts(podID string) int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if entry, ok := p.perPodBackoff[podID]; ok {
+		return entry.attempts
 	}
+	return 0
+}
+
+// returns the delay before the next attempt to schedule the pod
+func (p *podBackoff) getBackoff(podID string, pod *api.Pod) time.Duration {
+	strategy, min, max := p.policyFor(pod)
+	entry := p.getEntry(podID)
+
+	p.lock.Lock()
+	duration := strategy.Delay(entry.attempts, min, max)
+	entry.attempts++
+	entry.maxDuration = max
+	p.lock.Unlock()
+
 	log.V(3).Infof("Backing off %s for pod %s", duration.String(), podID)
 	return duration
 }
 
+// forget the backoff of every pod, so that the next failure of each backs off
+// from the minimum delay again. pods that are already queued keep their current
+// delays, though those that found no suitable offer break out of them early
+// once a fitting offer arrives.
+func (p *podBackoff) reset() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	log.V(2).Infof("resetting the backoff of %d pod(s)", len(p.perPodBackoff))
+	p.perPodBackoff = map[string]*backoffEntry{}
+}
+
 func (p *podBackoff) gc() {
 	p.lock.Lock()
 	defer p.lock.Unlock()
 	now := p.clock.Now()
 	for podID, entry := range p.perPodBackoff {
-		if now.Sub(entry.lastUpdate) > p.maxDuration {
+		if now.Sub(entry.lastUpdate) > entry.maxDuration {
 			delete(p.perPodBackoff, podID)
 		}
 	}
 }
+
+// detects large increases in the supply of offered resources, upon which pods
+// that have been backing off are likely to fit.
+type supplyMonitor struct {
+	last      resources
+	threshold float64 // relative increase that's considered significant
+}
+
+// records the current supply, returning true if it's grown significantly
+// since the previous observation.
+func (m *supplyMonitor) observe(current resources) bool {
+	grew := func(last, current float64) bool {
+		return current > 0 && current > last*(1+m.threshold)
+	}
+	changed := grew(m.last.cpus, current.cpus) || grew(m.last.mem, current.mem)
+	m.last = current
+	return changed
+}
@@ -0,0 +1,153 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
+	annotation "github.com/mesosphere/kubernetes-mesos/pkg/scheduler/meta"
+	"github.com/stretchr/testify/assert"
+)
+
+func delays(s BackoffStrategy, n int, min, max time.Duration) []time.Duration {
+	result := []time.Duration{}
+	for i := 0; i < n; i++ {
+		result = append(result, s.Delay(i, min, max))
+	}
+	return result
+}
+
+func TestBackoffStrategies(t *testing.T) {
+	assert := assert.New(t)
+	s := time.Second
+
+	assert.Equal([]time.Duration{1 * s, 2 * s, 4 * s, 8 * s, 10 * s, 10 * s}, delays(ExponentialBackoff{}, 6, s, 10*s))
+	assert.Equal([]time.Duration{1 * s, 1 * s, 2 * s, 3 * s, 5 * s, 8 * s, 10 * s}, delays(FibonacciBackoff{}, 7, s, 10*s))
+	assert.Equal([]time.Duration{1 * s, 1 * s, 1 * s}, delays(ConstantBackoff{}, 3, s, 10*s))
+
+	// jitter never takes the delay out of bounds
+	jittery := ExponentialBackoff{Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		d := jittery.Delay(i%8, s, 10*s)
+		assert.True(d >= s && d <= 10*s)
+	}
+
+	// no overflow after many attempts
+	assert.Equal(time.Minute, ExponentialBackoff{}.Delay(1000, s, time.Minute))
+	assert.Equal(time.Minute, FibonacciBackoff{}.Delay(1000, s, time.Minute))
+
+	_, err := ParseBackoffStrategy("fibonacci")
+	assert.NoError(err)
+	_, err = ParseBackoffStrategy("random")
+	assert.Error(err)
+}
+
+func TestPodBackoff(t *testing.T) {
+	assert := assert.New(t)
+	fakeClock := clock.NewFake(time.Now())
+	b := &podBackoff{
+		perPodBackoff:   map[string]*backoffEntry{},
+		clock:           fakeClock,
+		strategy:        ExponentialBackoff{},
+		defaultDuration: 1 * time.Second,
+		maxDuration:     60 * time.Second,
+	}
+
+	assert.Equal(1*time.Second, b.getBackoff("foo", nil))
+	assert.Equal(2*time.Second, b.getBackoff("foo", nil))
+	assert.Equal(4*time.Second, b.getBackoff("foo", nil))
+	assert.Equal(1*time.Second, b.getBackoff("bar", nil))
+
+	b.reset()
+	assert.Equal(1*time.Second, b.getBackoff("foo", nil))
+
+	// entries are collected once they've been idle for longer than their max
+	fakeClock.Step(61 * time.Second)
+	b.gc()
+	assert.Empty(b.perPodBackoff)
+}
+
+func TestPodBackoffAnnotations(t *testing.T) {
+	assert := assert.New(t)
+	b := &podBackoff{
+		perPodBackoff:   map[string]*backoffEntry{},
+		clock:           clock.NewFake(time.Now()),
+		strategy:        ExponentialBackoff{},
+		defaultDuration: 1 * time.Second,
+		maxDuration:     60 * time.Second,
+	}
+	pod := &api.Pod{ObjectMeta: api.ObjectMeta{
+		Name:      "foo",
+		Namespace: api.NamespaceDefault,
+		Annotations: map[string]string{
+			annotation.BackoffStrategyKey: "constant",
+			annotation.BackoffMinKey:      "5s",
+		},
+	}}
+	assert.Equal(5*time.Second, b.getBackoff("foo", pod))
+	assert.Equal(5*time.Second, b.getBackoff("foo", pod))
+
+	pod.Annotations = map[string]string{
+		annotation.BackoffStrategyKey: "fibonacci",
+		annotation.BackoffMaxKey:      "2s",
+	}
+	assert.Equal(2*time.Second, b.getBackoff("foo", pod))
+
+	// invalid annotations are ignored
+	pod.Annotations = map[string]string{
+		annotation.BackoffStrategyKey: "bogus",
+		annotation.BackoffMinKey:      "soon",
+	}
+	strategy, min, max := b.policyFor(pod)
+	assert.Equal(ExponentialBackoff{}, strategy)
+	assert.Equal(1*time.Second, min)
+	assert.Equal(60*time.Second, max)
+
+	// a max below the min is raised to it
+	pod.Annotations = map[string]string{annotation.BackoffMinKey: "2m"}
+	_, min, max = b.policyFor(pod)
+	assert.Equal(2*time.Minute, min)
+	assert.Equal(2*time.Minute, max)
+}
+
+func TestSupplyMonitor(t *testing.T) {
+	assert := assert.New(t)
+	m := &supplyMonitor{threshold: 0.5}
+
+	assert.False(m.observe(resources{}))
+	assert.True(m.observe(resources{cpus: 4, mem: 1024}))
+	assert.False(m.observe(resources{cpus: 5, mem: 1024}))
+	assert.False(m.observe(resources{cpus: 1, mem: 256}))
+	assert.True(m.observe(resources{cpus: 1, mem: 512}))
+}
+
+func TestResetBackoffExpeditesDelayedPods(t *testing.T) {
+	assert := assert.New(t)
+	fakeClock := clock.NewFake(time.Now())
+	qr := newQueuer(nil, nil, fakeClock)
+	eh := &errorHandler{
+		backoff: newPodBackoff(ExponentialBackoff{}, fakeClock),
+		qr:      qr,
+	}
+
+	newPod := func(name string) *api.Pod {
+		return &api.Pod{ObjectMeta: api.ObjectMeta{Name: name, Namespace: api.NamespaceDefault}}
+	}
+	delay := time.Minute
+	qr.requeue(&Pod{Pod: newPod("delayed"), delay: &delay})
+	now := fakeClock.Now()
+	qr.reoffer(&Pod{Pod: newPod("ready"), deadline: &now})
+
+	assert.Equal("default/ready", qr.podQueue.TryPop().GetUID())
+	assert.Nil(qr.podQueue.TryPop())
+
+	// the delayed pod is popped without waiting out its backoff
+	eh.backoff.getBackoff("default/delayed", nil)
+	eh.resetBackoff()
+	assert.Equal(1*time.Second, eh.backoff.getBackoff("default/delayed", nil))
+	if x := qr.podQueue.TryPop(); assert.NotNil(x) {
+		assert.Equal("default/delayed", x.GetUID())
+		assert.Equal(time.Duration(0), x.(*Pod).GetDelay())
+	}
+}
@@ -0,0 +1,234 @@
+package scheduler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	annotation "github.com/mesosphere/kubernetes-mesos/pkg/scheduler/meta"
+)
+
+// the pseudo-attribute that evaluates to the hostname of a slave
+const hostnameField = "hostname"
+
+// placement constraint operators, as understood by marathon
+type constraintOperator string
+
+const (
+	uniqueOperator  = constraintOperator("UNIQUE")   // one task per attribute value
+	clusterOperator = constraintOperator("CLUSTER")  // all tasks on the same attribute value
+	groupByOperator = constraintOperator("GROUP_BY") // tasks evenly spread across attribute values
+	likeOperator    = constraintOperator("LIKE")     // attribute value matches a regex
+	unlikeOperator  = constraintOperator("UNLIKE")   // attribute value doesn't match a regex
+)
+
+// a placement constraint relates an attribute of the slave of an offer to the
+// attributes of the slaves of the pod's peers: the tasks of pods that carry
+// (at least) the same labels as the pod, e.g. the replicas of a replication
+// controller.
+type constraint struct {
+	field    string
+	operator constraintOperator
+	value    string
+	pattern  *regexp.Regexp // compiled value of LIKE and UNLIKE constraints
+	groups   int            // minimum number of groups of GROUP_BY constraints
+}
+
+type constraints []constraint
+
+func (c *constraint) String() string {
+	if c.value == "" {
+		return c.field + ":" + string(c.operator)
+	}
+	return c.field + ":" + string(c.operator) + ":" + c.value
+}
+
+// indicates that the constraints annotation of a pod couldn't be parsed
+type constraintsError struct {
+	err error
+}
+
+func (e *constraintsError) Error() string {
+	return fmt.Sprintf("invalid %v annotation: %v", annotation.ConstraintsKey, e.err)
+}
+
+// parses semicolon separated terms of the form "field:OPERATOR[:value]"
+func parseConstraints(spec string) (constraints, error) {
+	result := constraints{}
+	for _, term := range strings.Split(spec, ";") {
+		if term = strings.TrimSpace(term); term == "" {
+			continue
+		}
+		parts := strings.SplitN(term, ":", 3)
+		if len(parts) < 2 || parts[0] == "" {
+			return nil, fmt.Errorf("expected field:OPERATOR[:value] instead of %q", term)
+		}
+		c := constraint{field: parts[0], operator: constraintOperator(strings.ToUpper(parts[1]))}
+		if len(parts) == 3 {
+			c.value = parts[2]
+		}
+		switch c.operator {
+		case uniqueOperator:
+			if c.value != "" {
+				return nil, fmt.Errorf("unexpected value in %q", term)
+			}
+		case clusterOperator:
+		case groupByOperator:
+			c.groups = 1
+			if c.value != "" {
+				n, err := strconv.Atoi(c.value)
+				if err != nil || n < 1 {
+					return nil, fmt.Errorf("expected a positive number of groups in %q", term)
+				}
+				c.groups = n
+			}
+		case likeOperator, unlikeOperator:
+			if c.value == "" {
+				return nil, fmt.Errorf("expected a regular expression in %q", term)
+			}
+			pattern, err := regexp.Compile("^(?:" + c.value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression in %q: %v", term, err)
+			}
+			c.pattern = pattern
+		default:
+			return nil, fmt.Errorf("unsupported operator in %q", term)
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// returns the placement constraints declared by the annotations of the pod
+func constraintsOf(pod *api.Pod) (constraints, error) {
+	spec, found := pod.Annotations[annotation.ConstraintsKey]
+	if !found {
+		return nil, nil
+	}
+	cs, err := parseConstraints(spec)
+	if err != nil {
+		return nil, &constraintsError{err}
+	}
+	return cs, nil
+}
+
+// returns the value of the named attribute of a slave. TEXT and SCALAR
+// attributes are supported.
+func attributeValue(hostname string, attributes []*mesos.Attribute, field string) (string, bool) {
+	if field == hostnameField {
+		return hostname, hostname != ""
+	}
+	for _, a := range attributes {
+		if a.GetName() != field {
+			continue
+		}
+		switch a.GetType() {
+		case mesos.Value_TEXT:
+			return a.GetText().GetValue(), true
+		case mesos.Value_SCALAR:
+			return strconv.FormatFloat(a.GetScalar().GetValue(), 'f', -1, 64), true
+		}
+	}
+	return "", false
+}
+
+// the distribution of the peers of a pod across the attribute values of the
+// known slaves, for each of the fields that the pod is constrained by.
+type distribution struct {
+	counts map[string]map[string]int // field -> attribute value -> number of peer tasks
+	values map[string]util.StringSet // field -> attribute values of known slaves
+}
+
+func newDistribution(slaves SlaveIndex, pod *api.Pod, cs constraints) *distribution {
+	d := &distribution{
+		counts: map[string]map[string]int{},
+		values: map[string]util.StringSet{},
+	}
+	for _, c := range cs {
+		d.counts[c.field] = map[string]int{}
+		d.values[c.field] = util.StringSet{}
+	}
+	if len(cs) == 0 {
+		return d
+	}
+	selector := labels.SelectorFromSet(labels.Set(pod.Labels))
+	for _, id := range slaves.listSlaves() {
+		slave, ok := slaves.slaveFor(id)
+		if !ok {
+			continue
+		}
+		peers := 0
+		if len(pod.Labels) > 0 {
+			for _, l := range slave.Tasks {
+				if selector.Matches(l) {
+					peers++
+				}
+			}
+		}
+		for field := range d.counts {
+			if v, ok := attributeValue(slave.HostName, slave.Attributes, field); ok {
+				d.values[field].Insert(v)
+				d.counts[field][v] += peers
+			}
+		}
+	}
+	return d
+}
+
+// returns true if placing a peer on a slave whose attribute has the given
+// value honors the constraint
+func (c *constraint) admits(value string, found bool, d *distribution) bool {
+	if !found {
+		return c.operator == unlikeOperator
+	}
+	counts := d.counts[c.field]
+	switch c.operator {
+	case uniqueOperator:
+		return counts[value] == 0
+	case clusterOperator:
+		if c.value != "" {
+			return value == c.value
+		}
+		// cluster around the value that the peers have already settled on
+		for v, n := range counts {
+			if n > 0 && v != value {
+				return false
+			}
+		}
+		return true
+	case groupByOperator:
+		known := util.NewStringSet(value)
+		known.Insert(d.values[c.field].List()...)
+		if len(known) < c.groups {
+			// there are groups that we haven't been offered yet, which are empty
+			return counts[value] == 0
+		}
+		for v := range known {
+			if counts[v] < counts[value] {
+				return false
+			}
+		}
+		return true
+	case likeOperator:
+		return c.pattern.MatchString(value)
+	case unlikeOperator:
+		return !c.pattern.MatchString(value)
+	}
+	return false
+}
+
+// returns true if the offer honors all of the constraints
+func (cs constraints) admits(offer *mesos.Offer, d *distribution) bool {
+	for i := range cs {
+		value, found := attributeValue(offer.GetHostname(), offer.GetAttributes(), cs[i].field)
+		if !cs[i].admits(value, found, d) {
+			return false
+		}
+	}
+	return true
+}
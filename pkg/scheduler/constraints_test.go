@@ -0,0 +1,113 @@
+package scheduler
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
+	"github.com/gogo/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	annotation "github.com/mesosphere/kubernetes-mesos/pkg/scheduler/meta"
+	"github.com/stretchr/testify/assert"
+)
+
+func rackOffer(hostname, rack string) *mesos.Offer {
+	return &mesos.Offer{
+		Hostname: proto.String(hostname),
+		Attributes: []*mesos.Attribute{{
+			Name: proto.String("rack"),
+			Type: mesos.Value_TEXT.Enum(),
+			Text: &mesos.Value_Text{Value: proto.String(rack)},
+		}, {
+			Name:   proto.String("gen"),
+			Type:   mesos.Value_SCALAR.Enum(),
+			Scalar: &mesos.Value_Scalar{Value: proto.Float64(2)},
+		}},
+	}
+}
+
+// registers slaves with the mock, each running the given number of peer tasks
+func rackSlaves(obj *MockScheduler, peers map[string]int, racks map[string]string) {
+	ids := []string{}
+	for host, rack := range racks {
+		slave := newSlave(host)
+		slave.Attributes = rackOffer(host, rack).Attributes
+		for i := 0; i < peers[host]; i++ {
+			slave.Tasks[host+"-"+strconv.Itoa(i)] = labels.Set{"app": "web"}
+		}
+		obj.On("slaveFor", host).Return(slave, true)
+		ids = append(ids, host)
+	}
+	obj.On("listSlaves").Return(ids)
+}
+
+func TestParseConstraints(t *testing.T) {
+	assert := assert.New(t)
+
+	cs, err := parseConstraints("hostname:UNIQUE; rack:GROUP_BY:3;zone:CLUSTER:us-east;rack:like:r[0-9]+")
+	assert.NoError(err)
+	assert.Equal(4, len(cs))
+	assert.Equal(groupByOperator, cs[1].operator)
+	assert.Equal(3, cs[1].groups)
+	assert.Equal("us-east", cs[2].value)
+	assert.True(cs[3].pattern.MatchString("r12"))
+	assert.False(cs[3].pattern.MatchString("xr12"))
+
+	for _, spec := range []string{
+		"hostname",
+		"hostname:SPREAD",
+		"hostname:UNIQUE:1",
+		"rack:GROUP_BY:none",
+		"rack:LIKE",
+		"rack:LIKE:[",
+	} {
+		_, err = parseConstraints(spec)
+		assert.Error(err, spec)
+	}
+
+	pod := &api.Pod{ObjectMeta: api.ObjectMeta{Annotations: map[string]string{annotation.ConstraintsKey: "rack:NEAR"}}}
+	_, err = constraintsOf(pod)
+	_, invalid := err.(*constraintsError)
+	assert.True(invalid)
+}
+
+func TestConstraintsAdmit(t *testing.T) {
+	assert := assert.New(t)
+	obj := &MockScheduler{}
+	rackSlaves(obj, map[string]int{"h1": 1, "h2": 2}, map[string]string{"h1": "r1", "h2": "r2", "h3": "r2"})
+	pod := &api.Pod{ObjectMeta: api.ObjectMeta{Labels: map[string]string{"app": "web"}}}
+
+	admits := func(spec string, offer *mesos.Offer) bool {
+		cs, err := parseConstraints(spec)
+		assert.NoError(err)
+		return cs.admits(offer, newDistribution(obj, pod, cs))
+	}
+
+	assert.False(admits("hostname:UNIQUE", rackOffer("h1", "r1")))
+	assert.True(admits("hostname:UNIQUE", rackOffer("h3", "r2")))
+	assert.False(admits("rack:UNIQUE", rackOffer("h3", "r2")))
+
+	assert.True(admits("rack:CLUSTER:r2", rackOffer("h3", "r2")))
+	assert.False(admits("rack:CLUSTER:r2", rackOffer("h1", "r1")))
+	assert.False(admits("rack:CLUSTER", rackOffer("h1", "r1"))) // peers are already spread
+
+	// r1 has fewer peers than r2
+	assert.True(admits("rack:GROUP_BY", rackOffer("h1", "r1")))
+	assert.False(admits("rack:GROUP_BY", rackOffer("h3", "r2")))
+	// a third rack hasn't been seen yet, so only it is admitted
+	assert.False(admits("rack:GROUP_BY:3", rackOffer("h1", "r1")))
+	assert.True(admits("rack:GROUP_BY:3", rackOffer("h4", "r3")))
+
+	assert.True(admits("rack:LIKE:r[12]", rackOffer("h1", "r1")))
+	assert.False(admits("rack:UNLIKE:r[12]", rackOffer("h1", "r1")))
+	assert.True(admits("gen:LIKE:2", rackOffer("h1", "r1")))
+
+	// offers without the attribute only satisfy UNLIKE
+	assert.False(admits("zone:LIKE:.*", rackOffer("h1", "r1")))
+	assert.True(admits("zone:UNLIKE:us-.*", rackOffer("h1", "r1")))
+
+	// pods without labels have no peers
+	pod.Labels = nil
+	assert.True(admits("hostname:UNIQUE", rackOffer("h2", "r2")))
+}
@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	log "github.com/golang/glog"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/metrics"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+)
+
+// DecisionLogConfig configures the audit log of scheduling decisions, which
+// records why each pod landed where it did (or didn't land at all).
+type DecisionLogConfig struct {
+	Writer     io.Writer // receives one JSON record per line; decisions aren't logged if nil
+	SampleRate float64   // fraction of decisions that are logged, in (0, 1]
+}
+
+// number of records that may await a write before decisions are dropped
+const decisionLogBacklog = 1024
+
+// one line of the decision log
+type decisionRecord struct {
+	Time     time.Time       `json:"time"`
+	Pod      string          `json:"pod"` // pod key
+	TaskId   string          `json:"taskId"`
+	Attempt  int             `json:"attempt"` // counting from 1, since the backoff of the pod was last reset
+	Offers   []decisionOffer `json:"offers"`  // candidates, in the order that they were considered
+	OfferId  string          `json:"offerId,omitempty"`
+	SlaveId  string          `json:"slaveId,omitempty"`
+	Hostname string          `json:"hostname,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Timings  decisionTimings `json:"timings"`
+}
+
+// an offer considered by a scheduling decision
+type decisionOffer struct {
+	OfferId  string   `json:"offerId"`
+	SlaveId  string   `json:"slaveId"`
+	Hostname string   `json:"hostname"`
+	Chosen   bool     `json:"chosen,omitempty"`
+	Reasons  []string `json:"reasons,omitempty"` // why the offer was rejected
+}
+
+type decisionTimings struct {
+	ScheduleMicros int64 `json:"scheduleMicros"` // spent in the schedule func
+	PendingMicros  int64 `json:"pendingMicros"`  // since the task was created
+}
+
+// records are written by a goroutine of their own, so that the scheduler lock
+// isn't held while waiting on the writer.
+type decisionLog struct {
+	records    chan *decisionRecord // awaiting a write, nil if decisions aren't logged
+	sampleRate float64
+	attempts   func(podKey string) int // failed attempts to schedule the pod so far
+	clock      clock.Clock
+}
+
+func newDecisionLog(config DecisionLogConfig, attempts func(podKey string) int, c clock.Clock) *decisionLog {
+	d := &decisionLog{
+		sampleRate: config.SampleRate,
+		attempts:   attempts,
+		clock:      c,
+	}
+	if config.Writer != nil {
+		d.records = make(chan *decisionRecord, decisionLogBacklog)
+		go d.write(json.NewEncoder(config.Writer))
+	}
+	return d
+}
+
+func (d *decisionLog) write(out *json.Encoder) {
+	for r := range d.records {
+		if err := out.Encode(r); err != nil {
+			log.Warningf("failed to write scheduling decision of pod %v: %v", r.Pod, err)
+		}
+	}
+}
+
+// returns true if the next decision should be logged
+func (d *decisionLog) sample() bool {
+	if d == nil || d.records == nil {
+		return false
+	}
+	return rand.Float64() < d.sampleRate
+}
+
+// log the decision to place the task on the chosen offer, which is nil if the
+// decision failed. the reasons that the other candidates were rejected are
+// recovered by explaining them. assumes that the caller holds the scheduler
+// lock, at least for reading; the record is written once the lock is released,
+// or dropped if the writer has fallen behind.
+func (d *decisionLog) record(slaves SlaveIndex, task *podtask.T, candidates []*mesos.Offer, chosen *mesos.Offer, err error, latency time.Duration) {
+	now := d.clock.Now()
+	r := &decisionRecord{
+		Time:    now,
+		Pod:     task.GetPodKey(),
+		TaskId:  task.ID,
+		Attempt: d.attempts(task.GetPodKey()) + 1,
+		Offers:  []decisionOffer{},
+		Timings: decisionTimings{
+			ScheduleMicros: int64(metrics.InMicroseconds(latency)),
+			PendingMicros:  int64(metrics.InMicroseconds(now.Sub(task.CreateTime))),
+		},
+	}
+	if chosen != nil {
+		r.OfferId = chosen.GetId().GetValue()
+		r.SlaveId = chosen.GetSlaveId().GetValue()
+		r.Hostname = chosen.GetHostname()
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	filter, filterErr := newOfferFilter(slaves, task)
+	for _, offer := range candidates {
+		o := decisionOffer{
+			OfferId:  offer.GetId().GetValue(),
+			SlaveId:  offer.GetSlaveId().GetValue(),
+			Hostname: offer.GetHostname(),
+		}
+		switch {
+		case chosen != nil && o.OfferId == r.OfferId:
+			o.Chosen = true
+		case filterErr != nil:
+			o.Reasons = []string{filterErr.Error()}
+		default:
+			e := filter.explain(offer)
+			for _, f := range e.Failures {
+				o.Reasons = append(o.Reasons, f.Check+": "+f.Message)
+			}
+			if e.Fits {
+				// acquired by another task, or a more preferable offer was found
+				o.Reasons = []string{fmt.Sprintf("fits with affinity score %d, but wasn't chosen", e.Score)}
+			}
+		}
+		r.Offers = append(r.Offers, o)
+	}
+
+	select {
+	case d.records <- r:
+	default:
+		log.Warningf("decision log is falling behind, dropped the scheduling decision of pod %v", r.Pod)
+	}
+}
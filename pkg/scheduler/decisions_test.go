@@ -0,0 +1,122 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/gogo/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	mutil "github.com/mesos/mesos-go/mesosutil"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+	"github.com/stretchr/testify/assert"
+)
+
+func newDecisionOffer(id, slaveId string, cpus float64) *mesos.Offer {
+	return &mesos.Offer{
+		Id:       mutil.NewOfferID(id),
+		SlaveId:  mutil.NewSlaveID(slaveId),
+		Hostname: proto.String("host-" + slaveId),
+		Resources: []*mesos.Resource{
+			mutil.NewScalarResource("cpus", cpus),
+			mutil.NewScalarResource("mem", 1024),
+		},
+	}
+}
+
+func TestDecisionLog(t *testing.T) {
+	assert := assert.New(t)
+	obj := &MockScheduler{}
+	obj.On("listSlaves").Return([]string{})
+	obj.On("slaveFor", "slave1").Return(nil, false)
+	obj.On("slaveFor", "slave2").Return(nil, false)
+
+	pod := &api.Pod{ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: api.NamespaceDefault}}
+	task, err := podtask.New(api.NewDefaultContext(), pod, &mesos.ExecutorInfo{})
+	assert.NoError(err)
+
+	now := time.Now()
+	task.CreateTime = now.Add(-time.Second)
+	// records are written asynchronously, read them as they arrive
+	out, writer := io.Pipe()
+	attempts := func(podKey string) int {
+		assert.Equal(task.GetPodKey(), podKey)
+		return 2
+	}
+	d := newDecisionLog(DecisionLogConfig{Writer: writer, SampleRate: 1}, attempts, clock.NewFake(now))
+	assert.True(d.sample())
+
+	rejected, chosen := newDecisionOffer("offer1", "slave1", 0.01), newDecisionOffer("offer2", "slave2", 4)
+	d.record(obj, task, []*mesos.Offer{rejected, chosen}, chosen, nil, time.Millisecond)
+	d.record(obj, task, []*mesos.Offer{rejected}, nil, noSuitableOffersErr, time.Millisecond)
+
+	decoder := json.NewDecoder(out)
+	var r decisionRecord
+	if assert.NoError(decoder.Decode(&r)) {
+		assert.Equal(task.ID, r.TaskId)
+		assert.Equal(3, r.Attempt)
+		assert.Equal("offer2", r.OfferId)
+		assert.Equal("host-slave2", r.Hostname)
+		assert.Equal(int64(1000), r.Timings.ScheduleMicros)
+		assert.Equal(int64(1000000), r.Timings.PendingMicros)
+		if assert.Len(r.Offers, 2) {
+			assert.False(r.Offers[0].Chosen)
+			if assert.Len(r.Offers[0].Reasons, 1) {
+				assert.Contains(r.Offers[0].Reasons[0], cpuCheck+": ")
+			}
+			assert.True(r.Offers[1].Chosen)
+			assert.Empty(r.Offers[1].Reasons)
+		}
+	}
+	r = decisionRecord{}
+	if assert.NoError(decoder.Decode(&r)) {
+		assert.Equal("", r.OfferId)
+		assert.Equal(noSuitableOffersErr.Error(), r.Error)
+		assert.Len(r.Offers, 1)
+	}
+	obj.AssertExpectations(t)
+}
+
+func TestDecisionLogSampling(t *testing.T) {
+	assert := assert.New(t)
+	var d *decisionLog
+	assert.False(d.sample())
+
+	d = newDecisionLog(DecisionLogConfig{SampleRate: 1}, nil, clock.RealClock{})
+	assert.False(d.sample())
+
+	d = newDecisionLog(DecisionLogConfig{Writer: &bytes.Buffer{}, SampleRate: 1}, nil, clock.RealClock{})
+	for i := 0; i < 100; i++ {
+		assert.True(d.sample())
+	}
+
+	d = newDecisionLog(DecisionLogConfig{Writer: &bytes.Buffer{}, SampleRate: 0.5}, nil, clock.RealClock{})
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		if d.sample() {
+			sampled++
+		}
+	}
+	assert.InDelta(500, sampled, 100)
+}
+
+// a writer that always fails, so that logging errors are never fatal
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestDecisionLogWriteFailure(t *testing.T) {
+	obj := &MockScheduler{}
+	obj.On("listSlaves").Return([]string{})
+	pod := &api.Pod{ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: api.NamespaceDefault}}
+	task, err := podtask.New(api.NewDefaultContext(), pod, &mesos.ExecutorInfo{})
+	assert.NoError(t, err)
+
+	d := newDecisionLog(DecisionLogConfig{Writer: failingWriter{}, SampleRate: 1}, func(string) int { return 0 }, clock.RealClock{})
+	d.record(obj, task, nil, nil, noSuitableOffersErr, 0)
+}
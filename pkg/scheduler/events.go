@@ -0,0 +1,182 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client/record"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
+	log "github.com/golang/glog"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
+	"github.com/mesosphere/kubernetes-mesos/pkg/offers"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+)
+
+// reasons of the events that the scheduler records about pods
+const (
+	scheduledEvent        = "Scheduled"
+	failedSchedulingEvent = "FailedScheduling"
+	offerExpiredEvent     = "OfferExpired"
+	preemptedEvent        = "Preempted"
+	backoffEvent          = "Backoff"
+	invalidUpdateEvent    = "InvalidUpdate"
+)
+
+const (
+	eventRepeatInterval = 2 * time.Minute // events of the same reason for the same pod are recorded at most once per interval
+	eventQPS            = 5               // sustained rate at which events are recorded
+	eventBurst          = 25              // maximum burst of recorded events
+)
+
+type eventHistory struct {
+	recorded   time.Time // when the event was last recorded
+	suppressed int       // number of events suppressed since
+}
+
+// records events about pods via the apiserver, rate limited and de-duplicated
+// so that pods stuck in a scheduling loop don't spam the apiserver. an event
+// that repeats the reason of one recently recorded for the same pod is
+// suppressed, and counted as a repetition by the next that isn't. a nil
+// recorder discards events.
+type eventRecorder struct {
+	recorder record.EventRecorder
+	limiter  util.RateLimiter
+	clock    clock.Clock
+	lock     sync.Mutex
+	history  map[string]*eventHistory // keyed by namespace/name/reason
+	lastGc   time.Time
+}
+
+func newEventRecorder(recorder record.EventRecorder, c clock.Clock) *eventRecorder {
+	return &eventRecorder{
+		recorder: recorder,
+		limiter:  util.NewTokenBucketRateLimiter(eventQPS, eventBurst),
+		clock:    c,
+		history:  map[string]*eventHistory{},
+	}
+}
+
+func (r *eventRecorder) Eventf(pod *api.Pod, reason, messageFmt string, args ...interface{}) {
+	r.EventFunc(pod, reason, func() string {
+		return fmt.Sprintf(messageFmt, args...)
+	})
+}
+
+// like Eventf, except that the message is only built if the event is going to
+// be recorded, for messages that are expensive to build.
+func (r *eventRecorder) EventFunc(pod *api.Pod, reason string, message func() string) {
+	if r == nil || pod == nil {
+		return
+	}
+	suppressed, ok := r.admit(pod, reason)
+	if !ok {
+		log.V(4).Infof("suppressed %v event for pod %v/%v", reason, pod.Namespace, pod.Name)
+		return
+	}
+	msg := message()
+	if suppressed > 0 {
+		msg = fmt.Sprintf("%s (repeated %d times)", msg, suppressed+1)
+	}
+	r.recorder.Event(pod, reason, msg)
+}
+
+// returns true if the event should be recorded, along with the number of
+// repetitions that were suppressed before it.
+func (r *eventRecorder) admit(pod *api.Pod, reason string) (int, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := r.clock.Now()
+	r.gc(now)
+
+	key := pod.Namespace + "/" + pod.Name + "/" + reason
+	h, found := r.history[key]
+	if found && now.Sub(h.recorded) < eventRepeatInterval {
+		h.suppressed++
+		return 0, false
+	}
+	if !r.limiter.CanAccept() {
+		if found {
+			h.suppressed++
+		}
+		return 0, false
+	}
+	suppressed := 0
+	if found {
+		suppressed = h.suppressed
+	}
+	r.history[key] = &eventHistory{recorded: now}
+	return suppressed, true
+}
+
+// forget events that are no longer suppressing repetitions, and those whose
+// repetitions stopped (e.g. because the pod was scheduled or deleted) before
+// they could be reported; assumes that the caller holds the lock.
+func (r *eventRecorder) gc(now time.Time) {
+	if now.Sub(r.lastGc) < eventRepeatInterval {
+		return
+	}
+	r.lastGc = now
+	for key, h := range r.history {
+		if age := now.Sub(h.recorded); age >= 2*eventRepeatInterval || (age >= eventRepeatInterval && h.suppressed == 0) {
+			delete(r.history, key)
+		}
+	}
+}
+
+// summarizes why none of the offers in the registry can support the task,
+// e.g. "0 of 3 offers fit: 2 insufficient resources, 1 placement constraints
+// violated". assumes that the caller holds the scheduler lock.
+func explainDeclines(r offers.Registry, slaves SlaveIndex, task *podtask.T) string {
+	filter, err := newOfferFilter(slaves, task)
+	if err != nil {
+		return err.Error()
+	}
+	total, fits := 0, 0
+	reasons := map[string]int{}
+	r.Walk(func(p offers.Perishable) (bool, error) {
+		offer := p.Details()
+		if offer == nil {
+			return false, nil
+		}
+		total++
+		if _, err := filter.evaluate(offer); err != nil {
+			reasons[declineReason(err)]++
+		} else {
+			fits++
+		}
+		return false, nil
+	})
+	if total == 0 {
+		return "no offers available"
+	}
+	summary := make([]string, 0, len(reasons))
+	for reason, n := range reasons {
+		summary = append(summary, fmt.Sprintf("%d %s", n, reason))
+	}
+	sort.Strings(summary)
+	return fmt.Sprintf("%d of %d offers fit: %s", fits, total, strings.Join(summary, ", "))
+}
+
+// categorizes the reason that an offer was declined
+func declineReason(err error) string {
+	switch err.(type) {
+	case *podtask.InsufficientResourcesError:
+		return "insufficient resources"
+	case *podtask.PortAllocationError:
+		return "insufficient host ports"
+	case *podtask.DuplicateHostPortError:
+		return "duplicate host ports"
+	}
+	switch err {
+	case placementViolatedErr:
+		return "placement constraints violated"
+	case affinityViolatedErr:
+		return "affinity constraints violated"
+	}
+	return err.Error()
+}
@@ -0,0 +1,84 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/runtime"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+	"github.com/stretchr/testify/assert"
+)
+
+// implements record.EventRecorder
+type fakeEventRecorder struct {
+	events []string
+}
+
+func (f *fakeEventRecorder) Event(object runtime.Object, reason, message string) {
+	f.events = append(f.events, reason+": "+message)
+}
+
+func (f *fakeEventRecorder) Eventf(object runtime.Object, reason, messageFmt string, args ...interface{}) {
+	f.Event(object, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func TestEventRecorderDeduplication(t *testing.T) {
+	assert := assert.New(t)
+	fake := &fakeEventRecorder{}
+	fakeClock := clock.NewFake(time.Now())
+	r := newEventRecorder(fake, fakeClock)
+	foo := &api.Pod{ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: api.NamespaceDefault}}
+	bar := &api.Pod{ObjectMeta: api.ObjectMeta{Name: "bar", Namespace: api.NamespaceDefault}}
+
+	r.Eventf(foo, backoffEvent, "Back-off %v", time.Second)
+	r.Eventf(foo, backoffEvent, "Back-off %v", 2*time.Second)
+	r.Eventf(foo, failedSchedulingEvent, "no offers")
+	r.Eventf(bar, backoffEvent, "Back-off %v", time.Second)
+	assert.Equal([]string{
+		"Backoff: Back-off 1s",
+		"FailedScheduling: no offers",
+		"Backoff: Back-off 1s",
+	}, fake.events)
+
+	// repetitions are counted once the interval has passed
+	fakeClock.Step(eventRepeatInterval)
+	r.Eventf(foo, backoffEvent, "Back-off %v", 4*time.Second)
+	assert.Equal("Backoff: Back-off 4s (repeated 2 times)", fake.events[3])
+
+	// messages of suppressed events aren't built
+	r.EventFunc(foo, backoffEvent, func() string {
+		t.Fatalf("unexpected message of a suppressed event")
+		return ""
+	})
+
+	// repetitions that stop before they're reported are eventually forgotten
+	fakeClock.Step(2 * eventRepeatInterval)
+	r.Eventf(bar, scheduledEvent, "Successfully assigned bar to host")
+	_, found := r.history["default/foo/Backoff"]
+	assert.False(found)
+
+	// a nil recorder discards events
+	var none *eventRecorder
+	none.Eventf(foo, scheduledEvent, "Successfully assigned foo to bar")
+}
+
+func TestEventRecorderRateLimit(t *testing.T) {
+	fake := &fakeEventRecorder{}
+	r := newEventRecorder(fake, clock.NewFake(time.Now()))
+	for i := 0; i < 2*eventBurst; i++ {
+		pod := &api.Pod{ObjectMeta: api.ObjectMeta{Name: fmt.Sprintf("pod%d", i), Namespace: api.NamespaceDefault}}
+		r.Eventf(pod, scheduledEvent, "Successfully assigned")
+	}
+	assert.True(t, len(fake.events) < 2*eventBurst)
+}
+
+func TestDeclineReason(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("insufficient resources", declineReason(&podtask.InsufficientResourcesError{}))
+	assert.Equal("insufficient host ports", declineReason(&podtask.PortAllocationError{}))
+	assert.Equal("placement constraints violated", declineReason(placementViolatedErr))
+	assert.Equal("oops", declineReason(fmt.Errorf("oops")))
+}
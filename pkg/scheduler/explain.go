@@ -0,0 +1,196 @@
+package scheduler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/mesosphere/kubernetes-mesos/pkg/offers"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/api/v1"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+)
+
+// the reasons that an offer can't support a task
+const (
+	cpuCheck       = "cpu"
+	memCheck       = "mem"
+	portsCheck     = "ports"
+	attributeCheck = "attributes"
+	affinityCheck  = "affinity"
+	roleCheck      = "role"
+	drainCheck     = "drain"
+)
+
+// evaluates the task against every live offer in the registry, grouped by
+// slave. offers are never acquired. assumes that the caller holds the
+// scheduler lock, at least for reading.
+func explainTask(r offers.Registry, slaves SlaveIndex, task *podtask.T) *v1.PodExplanation {
+	cpus, mem := task.Demand()
+	result := &v1.PodExplanation{
+		Pod:    task.Pod.Namespace + "/" + task.Pod.Name,
+		Demand: map[string]float64{"cpus": cpus, "mem": mem},
+		Slaves: []v1.SlaveExplanation{},
+	}
+	filter, err := newOfferFilter(slaves, task)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	bySlave := map[string]*v1.SlaveExplanation{}
+	r.Walk(func(p offers.Perishable) (bool, error) {
+		offer := p.Details()
+		if offer == nil || p.HasExpired() {
+			return false, nil
+		}
+		slaveId := offer.GetSlaveId().GetValue()
+		s, found := bySlave[slaveId]
+		if !found {
+			s = &v1.SlaveExplanation{SlaveId: slaveId, Hostname: offer.GetHostname()}
+			bySlave[slaveId] = s
+		}
+		e := filter.explain(offer)
+		if e.Fits {
+			result.Fits++
+		}
+		s.Offers = append(s.Offers, e)
+		return false, nil
+	})
+
+	ids := make([]string, 0, len(bySlave))
+	for id := range bySlave {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		result.Slaves = append(result.Slaves, *bySlave[id])
+	}
+	return result
+}
+
+// like evaluate, but reports every requirement of the task that the offer
+// fails to meet
+func (f *offerFilter) explain(offer *mesos.Offer) v1.OfferExplanation {
+	e := v1.OfferExplanation{OfferId: offer.GetId().GetValue()}
+	fail := func(check, format string, args ...interface{}) {
+		e.Failures = append(e.Failures, v1.OfferFailure{Check: check, Message: fmt.Sprintf(format, args...)})
+	}
+
+	roles := map[string]bool{}
+	offered, unreserved := resources{}, resources{}
+	for _, resource := range offer.Resources {
+		role := resource.GetRole()
+		roles[role] = true
+		var r resources
+		switch resource.GetName() {
+		case "cpus":
+			r.cpus = resource.GetScalar().GetValue()
+		case "mem":
+			r.mem = resource.GetScalar().GetValue()
+		}
+		offered = offered.add(r)
+		if role == "*" {
+			unreserved = unreserved.add(r)
+		}
+	}
+	for role := range roles {
+		e.Roles = append(e.Roles, role)
+	}
+	sort.Strings(e.Roles)
+
+	cpus, mem := f.task.Demand()
+	demand := resources{cpus: cpus, mem: mem}
+	if offered.cpus < demand.cpus {
+		fail(cpuCheck, "offered %v cpus, %v required", offered.cpus, demand.cpus)
+	}
+	if offered.mem < demand.mem {
+		fail(memCheck, "offered %v MB of memory, %v required", offered.mem, demand.mem)
+	}
+	if offered.covers(demand) && !unreserved.covers(demand) {
+		fail(roleCheck, "only %v cpus and %v MB of memory are unreserved, roles offered: %v",
+			unreserved.cpus, unreserved.mem, strings.Join(e.Roles, ","))
+	}
+
+	switch err := f.task.CheckOffer(offer).(type) {
+	case *podtask.PortAllocationError:
+		sorted := append([]uint64(nil), err.Ports...)
+		sort.Sort(uint64s(sorted))
+		e.Failures = append(e.Failures, v1.OfferFailure{Check: portsCheck, Message: err.Error(), Ports: sorted})
+	case *podtask.DuplicateHostPortError:
+		fail(portsCheck, "%v", err)
+	}
+
+	for i := range f.placement {
+		c := &f.placement[i]
+		value, found := attributeValue(offer.GetHostname(), offer.GetAttributes(), c.field)
+		if !c.admits(value, found, f.peers) {
+			if found {
+				fail(attributeCheck, "%v violated by %v=%v", c, c.field, value)
+			} else {
+				fail(attributeCheck, "%v violated, %v is not an attribute of the slave", c, c.field)
+			}
+		}
+	}
+
+	slaveId := offer.GetSlaveId().GetValue()
+	if slave, found := f.slaves.slaveFor(slaveId); found && slave.Draining {
+		fail(drainCheck, "slave %v is draining", slave.HostName)
+	}
+	score, ok := f.affinity.evaluate(colocatedLabels(f.slaves, slaveId))
+	if !ok {
+		fail(affinityCheck, "%v", affinityViolatedErr)
+	}
+	e.Fits = len(e.Failures) == 0
+	if e.Fits {
+		e.Score = score
+	}
+	return e
+}
+
+type uint64s []uint64
+
+func (s uint64s) Len() int           { return len(s) }
+func (s uint64s) Less(i, j int) bool { return s[i] < s[j] }
+func (s uint64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// explains the fit of a pod's task with each live offer. pods that don't have
+// a task yet, because they're waiting in the scheduling queue, are evaluated
+// with a temporary task that's never registered.
+func (q *queuer) explain(sched SchedulerInterface, namespace, name string) (*v1.PodExplanation, error) {
+	ctx := api.WithNamespace(api.NewDefaultContext(), namespace)
+	podKey, err := podtask.MakePodKey(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// pods without tasks are waiting in the scheduling queue, or the pod store
+	var pod *api.Pod
+	if x, found := q.podQueue.Get(namespace + "/" + name); found {
+		pod = x.(*Pod).Pod
+	} else if x, found, _ := q.podUpdates.GetByKey(namespace + "/" + name); found {
+		pod = x.(*Pod).Pod
+	}
+
+	sched.RLocker().Lock()
+	defer sched.RLocker().Unlock()
+
+	if taskId, found := sched.taskForPod(podKey); found {
+		if task, state := sched.getTask(taskId); state != podtask.StateUnknown {
+			result := explainTask(sched.offers(), sched, task)
+			result.TaskId = taskId
+			result.Launched = task.Has(podtask.Launched) || state != podtask.StatePending
+			return result, nil
+		}
+	}
+	if pod == nil {
+		return nil, apiNotFound("pod", namespace+"/"+name)
+	}
+	task, err := sched.createPodTask(ctx, pod)
+	if err != nil {
+		return nil, &apiError{http.StatusInternalServerError, err.Error()}
+	}
+	return explainTask(sched.offers(), sched, task), nil
+}
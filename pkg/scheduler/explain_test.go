@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/gogo/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	mutil "github.com/mesos/mesos-go/mesosutil"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/api/v1"
+	annotation "github.com/mesosphere/kubernetes-mesos/pkg/scheduler/meta"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+	"github.com/stretchr/testify/assert"
+)
+
+func explainedChecks(e v1.OfferExplanation) []string {
+	checks := []string{}
+	for _, f := range e.Failures {
+		checks = append(checks, f.Check)
+	}
+	return checks
+}
+
+func TestExplainOffer(t *testing.T) {
+	assert := assert.New(t)
+	obj := &MockScheduler{}
+	obj.On("listSlaves").Return([]string{})
+	obj.On("slaveFor", "slave1").Return(nil, false)
+
+	pod := &api.Pod{
+		ObjectMeta: api.ObjectMeta{
+			Name:        "foo",
+			Namespace:   api.NamespaceDefault,
+			Annotations: map[string]string{annotation.ConstraintsKey: "rack:LIKE:r1"},
+		},
+		Spec: api.PodSpec{
+			Containers: []api.Container{{Name: "web", Ports: []api.Port{{HostPort: 8080}, {HostPort: 8081}}}},
+		},
+	}
+	task, err := podtask.New(api.NewDefaultContext(), pod, &mesos.ExecutorInfo{})
+	assert.NoError(err)
+	filter, err := newOfferFilter(obj, task)
+	assert.NoError(err)
+
+	offer := &mesos.Offer{
+		Id:       mutil.NewOfferID("offer1"),
+		SlaveId:  mutil.NewSlaveID("slave1"),
+		Hostname: proto.String("h1"),
+		Resources: []*mesos.Resource{
+			mutil.NewScalarResource("cpus", 0.1),
+			mutil.NewScalarResource("mem", 1024),
+			mutil.NewRangesResource("ports", []*mesos.Value_Range{mutil.NewValueRange(8081, 8081)}),
+		},
+	}
+	e := filter.explain(offer)
+	assert.False(e.Fits)
+	assert.Equal([]string{cpuCheck, portsCheck, attributeCheck}, explainedChecks(e))
+	assert.Equal([]uint64{8080}, e.Failures[1].Ports)
+
+	offer.Resources = []*mesos.Resource{
+		mutil.NewScalarResource("cpus", 4),
+		mutil.NewScalarResource("mem", 1024),
+		mutil.NewRangesResource("ports", []*mesos.Value_Range{mutil.NewValueRange(8000, 9000)}),
+	}
+	offer.Resources[0].Role = proto.String("analytics")
+	offer.Attributes = []*mesos.Attribute{{
+		Name: proto.String("rack"),
+		Type: mesos.Value_TEXT.Enum(),
+		Text: &mesos.Value_Text{Value: proto.String("r1")},
+	}}
+	e = filter.explain(offer)
+	assert.Equal([]string{roleCheck}, explainedChecks(e))
+	assert.Equal([]string{"*", "analytics"}, e.Roles)
+
+	offer.Resources[0].Role = proto.String("*")
+	e = filter.explain(offer)
+	assert.True(e.Fits)
+	assert.Empty(e.Failures)
+}
@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+)
+
+// NamespaceWeights determine the relative shares of cluster resources that
+// namespaces are entitled to; namespaces that aren't listed have a weight of 1.
+type NamespaceWeights map[string]float64
+
+// ParseNamespaceWeights parses a comma separated list of namespace=weight pairs.
+func ParseNamespaceWeights(spec string) (NamespaceWeights, error) {
+	weights := NamespaceWeights{}
+	for _, pair := range strings.Split(spec, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("expected namespace=weight instead of %q", pair)
+		}
+		w, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil || w <= 0 {
+			return nil, fmt.Errorf("expected a positive weight for namespace %q instead of %q", kv[0], kv[1])
+		}
+		weights[kv[0]] = w
+	}
+	return weights, nil
+}
+
+func (w NamespaceWeights) weightOf(namespace string) float64 {
+	if x, found := w[namespace]; found {
+		return x
+	}
+	return 1
+}
+
+// returns the dominant share of the total resources that is allocated to each
+// namespace, divided by the weight of the namespace.
+func dominantShares(allocated map[string]resources, total resources, weights NamespaceWeights) map[string]float64 {
+	shares := map[string]float64{}
+	for namespace, r := range allocated {
+		share := 0.0
+		if total.cpus > 0 {
+			share = r.cpus / total.cpus
+		}
+		if total.mem > 0 {
+			share = math.Max(share, r.mem/total.mem)
+		}
+		shares[namespace] = share / weights.weightOf(namespace)
+	}
+	return shares
+}
+
+// returns the weighted dominant share of each namespace. the resources of the
+// cluster are approximated by those allotted to launched tasks along with
+// those that are currently offered.
+func (k *k8smScheduler) namespaceShares() map[string]float64 {
+	k.RLock()
+	defer k.RUnlock()
+
+	allocated := map[string]resources{}
+	total := resources{}
+	for _, state := range []podtask.StateType{podtask.StatePending, podtask.StateRunning} {
+		for _, task := range k.listTasks(state) {
+			if !task.Has(podtask.Launched) {
+				continue
+			}
+			cpus, mem := task.Allotment()
+			r := resources{cpus: cpus, mem: mem}
+			allocated[task.Pod.Namespace] = allocated[task.Pod.Namespace].add(r)
+			total = total.add(r)
+		}
+	}
+	total = total.add(totalOffered(k.KubernetesScheduler.offers))
+	return dominantShares(allocated, total, k.weights)
+}
@@ -0,0 +1,51 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNamespaceWeights(t *testing.T) {
+	assert := assert.New(t)
+
+	weights, err := ParseNamespaceWeights("")
+	assert.Nil(err)
+	assert.Equal(0, len(weights))
+	assert.Equal(1.0, weights.weightOf("default"))
+
+	weights, err = ParseNamespaceWeights("kube-system=4, batch=0.5,")
+	assert.Nil(err)
+	assert.Equal(NamespaceWeights{"kube-system": 4, "batch": 0.5}, weights)
+	assert.Equal(0.5, weights.weightOf("batch"))
+	assert.Equal(1.0, weights.weightOf("default"))
+
+	_, err = ParseNamespaceWeights("batch")
+	assert.NotNil(err)
+	_, err = ParseNamespaceWeights("batch=heavy")
+	assert.NotNil(err)
+	_, err = ParseNamespaceWeights("batch=0")
+	assert.NotNil(err)
+	_, err = ParseNamespaceWeights("=2")
+	assert.NotNil(err)
+}
+
+func TestDominantShares(t *testing.T) {
+	assert := assert.New(t)
+
+	total := resources{cpus: 10, mem: 1000}
+	allocated := map[string]resources{
+		"cpu-heavy": {cpus: 5, mem: 100},
+		"mem-heavy": {cpus: 1, mem: 400},
+		"weighted":  {cpus: 4, mem: 400},
+	}
+	shares := dominantShares(allocated, total, NamespaceWeights{"weighted": 2})
+	assert.InDelta(0.5, shares["cpu-heavy"], 1e-9)
+	assert.InDelta(0.4, shares["mem-heavy"], 1e-9)
+	assert.InDelta(0.2, shares["weighted"], 1e-9)
+	assert.Equal(0.0, shares["idle"])
+
+	// nothing to share
+	shares = dominantShares(allocated, resources{}, nil)
+	assert.Equal(0.0, shares["cpu-heavy"])
+}
@@ -4,12 +4,15 @@ import (
 	"fmt"
 	log "github.com/golang/glog"
 
+	mesos "github.com/mesos/mesos-go/mesosproto"
 	"github.com/mesosphere/kubernetes-mesos/pkg/offers"
 	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
 )
 
 // A first-come-first-serve scheduler: acquires the first offer that can support the task
-func FCFSScheduleFunc(r offers.Registry, unused SlaveIndex, task *podtask.T) (offers.Perishable, error) {
+// without violating its placement or affinity constraints. if the task prefers to be co-located with
+// (or apart from) other tasks then the offer of the most preferable slave is acquired.
+func FCFSScheduleFunc(r offers.Registry, slaves SlaveIndex, task *podtask.T) (offers.Perishable, error) {
 	if task.HasAcceptedOffer() {
 		// verify that the offer is still on the table
 		offerId := task.GetOfferId()
@@ -21,18 +24,35 @@ func FCFSScheduleFunc(r offers.Registry, unused SlaveIndex, task *podtask.T) (of
 		task.ClearTaskInfo()
 	}
 
-	var acceptedOffer offers.Perishable
-	err := r.Walk(func(p offers.Perishable) (bool, error) {
+	filter, err := newOfferFilter(slaves, task)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		acceptedOffer offers.Perishable
+		bestScore     int
+	)
+	err = r.Walk(func(p offers.Perishable) (bool, error) {
 		offer := p.Details()
 		if offer == nil {
 			return false, fmt.Errorf("nil offer while scheduling task %v", task.ID)
 		}
-		if task.AcceptOffer(offer) {
-			if p.Acquire() {
-				acceptedOffer = p
-				log.V(3).Infof("Pod %v accepted offer %v", task.Pod.Name, offer.Id.GetValue())
-				return true, nil // stop, we found an offer
+		score, err := filter.evaluate(offer)
+		if err != nil {
+			log.V(3).Infof("Pod %v declined offer %v: %v", task.Pod.Name, offer.Id.GetValue(), err)
+			return false, nil
+		}
+		if acceptedOffer != nil && score <= bestScore {
+			return false, nil
+		}
+		if p.Acquire() {
+			if acceptedOffer != nil {
+				acceptedOffer.Release()
 			}
+			acceptedOffer, bestScore = p, score
+			log.V(3).Infof("Pod %v accepted offer %v", task.Pod.Name, offer.Id.GetValue())
+			// stop, we found an offer; unless a more preferable one may follow
+			return !filter.affinity.preferential(), nil
 		}
 		return false, nil // continue
 	})
@@ -49,3 +69,47 @@ func FCFSScheduleFunc(r offers.Registry, unused SlaveIndex, task *podtask.T) (of
 	log.V(2).Infof("failed to find a fit for pod: %v", task.Pod.Name)
 	return nil, noSuitableOffersErr
 }
+
+// evaluates offers against the resource, placement and affinity requirements
+// of a task
+type offerFilter struct {
+	task      *podtask.T
+	slaves    SlaveIndex
+	placement constraints
+	peers     *distribution
+	affinity  affinityRules
+}
+
+func newOfferFilter(slaves SlaveIndex, task *podtask.T) (*offerFilter, error) {
+	placement, err := constraintsOf(task.Pod)
+	if err != nil {
+		return nil, err
+	}
+	return &offerFilter{
+		task:      task,
+		slaves:    slaves,
+		placement: placement,
+		peers:     newDistribution(slaves, task.Pod, placement),
+		affinity:  affinityOf(task.Pod),
+	}, nil
+}
+
+// returns the affinity score of an offer that can support the task, otherwise
+// an error that describes why it can't.
+func (f *offerFilter) evaluate(offer *mesos.Offer) (int, error) {
+	if err := f.task.CheckOffer(offer); err != nil {
+		return 0, err
+	}
+	if !f.placement.admits(offer, f.peers) {
+		return 0, placementViolatedErr
+	}
+	slaveId := offer.GetSlaveId().GetValue()
+	if slave, found := f.slaves.slaveFor(slaveId); found && slave.Draining {
+		return 0, slaveDrainingErr
+	}
+	score, ok := f.affinity.evaluate(colocatedLabels(f.slaves, slaveId))
+	if !ok {
+		return 0, affinityViolatedErr
+	}
+	return score, nil
+}
@@ -0,0 +1,259 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
+	log "github.com/golang/glog"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
+	annotation "github.com/mesosphere/kubernetes-mesos/pkg/scheduler/meta"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+)
+
+const (
+	gangReservationTTL = 2 * time.Minute  // placed gangs that aren't launched within this period are released
+	gangGcInterval     = 30 * time.Second // how often to look for expired or abandoned gangs
+)
+
+// returns the key of the pod group that the pod belongs to, along with the
+// minimum number of members that must start together.
+func gangOf(pod *api.Pod) (key string, minMembers int, ok bool) {
+	name := pod.Annotations[annotation.PodGroupKey]
+	if name == "" {
+		return
+	}
+	minMembers = 1
+	if s, found := pod.Annotations[annotation.PodGroupMinMembersKey]; found {
+		if n, err := strconv.Atoi(s); err != nil || n < 1 {
+			log.Warningf("ignoring invalid %v annotation of pod %v/%v: %q", annotation.PodGroupMinMembersKey, pod.Namespace, pod.Name, s)
+		} else {
+			minMembers = n
+		}
+	}
+	return pod.Namespace + "/" + name, minMembers, true
+}
+
+type gang struct {
+	key        string
+	minMembers int
+	members    util.StringSet    // keys of the pods that have joined the gang
+	placed     util.StringSet    // keys of the pods whose tasks hold offers on behalf of the gang
+	hosts      map[string]string // keys of the placed pods, and the hosts of their offers
+	staged     map[string]string // keys of the placed pods that have been bound, and their hosts
+	placedAt   time.Time
+}
+
+// coordinates the scheduling of pod groups ("gangs") whose members are useless
+// unless they start together: no member is placed until offers have been found
+// for at least the minimum number of members, and no member is launched until
+// all of the placed members have been bound. if any member fails to bind then
+// the offers of the whole gang are released. all methods assume that the
+// caller has acquired the scheduler lock.
+type gangScheduler struct {
+	api      SchedulerInterface
+	gangs    map[string]*gang
+	expedite func(*api.Pod) // hurry a member through the scheduling queue
+	clock    clock.Clock
+}
+
+func newGangScheduler(api SchedulerInterface, expedite func(*api.Pod), c clock.Clock) *gangScheduler {
+	return &gangScheduler{
+		api:      api,
+		gangs:    map[string]*gang{},
+		expedite: expedite,
+		clock:    c,
+	}
+}
+
+func (s *gangScheduler) isMember(task *podtask.T) bool {
+	_, _, ok := gangOf(task.Pod)
+	return ok
+}
+
+// returns the gang of the task, after recording its membership, or nil if the
+// task doesn't belong to a gang.
+func (s *gangScheduler) join(task *podtask.T) *gang {
+	key, minMembers, ok := gangOf(task.Pod)
+	if !ok {
+		return nil
+	}
+	g, found := s.gangs[key]
+	if !found {
+		g = &gang{
+			key:     key,
+			members: util.StringSet{},
+			placed:  util.StringSet{},
+			hosts:   map[string]string{},
+			staged:  map[string]string{},
+		}
+		s.gangs[key] = g
+	}
+	g.minMembers = minMembers
+	g.members.Insert(task.GetPodKey())
+	return g
+}
+
+// returns the pending, unlaunched tasks of the given pods ordered by pod key.
+// pods without tasks are forgotten by the gang.
+func (s *gangScheduler) pending(g *gang, podKeys util.StringSet) []*podtask.T {
+	tasks := []*podtask.T{}
+	for _, podKey := range podKeys.List() {
+		taskId, found := s.api.taskForPod(podKey)
+		if !found {
+			g.members.Delete(podKey)
+			continue
+		}
+		if task, state := s.api.getTask(taskId); state == podtask.StatePending && !task.Has(podtask.Launched) {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// ensures that the gang of the task has been placed: that offers have been
+// assigned to all of its pending members. members are placed by the given
+// func, as are tasks that don't belong to a gang. returns the host that the
+// task was placed on, or gangIncompleteErr if too few members are pending.
+func (s *gangScheduler) place(task *podtask.T, placeTask func(*podtask.T) (string, error)) (string, error) {
+	g := s.join(task)
+	if g == nil {
+		return placeTask(task)
+	}
+	podKey := task.GetPodKey()
+	if len(g.placed) > 0 {
+		if g.placed.Has(podKey) && task.HasAcceptedOffer() {
+			return g.hosts[podKey], nil
+		}
+		// the member lost its offer, or joined after the gang was placed
+		log.V(2).Infof("re-placing pod group %v for pod %v", g.key, podKey)
+		s.release(g, task)
+	}
+
+	members := s.pending(g, g.members)
+	if len(members) < g.minMembers {
+		log.V(2).Infof("pod group %v has %d of %d members pending", g.key, len(members), g.minMembers)
+		return "", gangIncompleteErr
+	}
+	hosts := map[string]string{}
+	for i, m := range members {
+		host, err := placeTask(m)
+		if err != nil {
+			log.V(2).Infof("failed to place pod group %v, member %v: %v", g.key, m.GetPodKey(), err)
+			for _, placed := range members[:i+1] {
+				releaseOffer(placed)
+			}
+			return "", noSuitableOffersErr
+		}
+		hosts[m.GetPodKey()] = host
+	}
+
+	g.placed = util.StringSet{}
+	g.hosts = hosts
+	g.staged = map[string]string{}
+	g.placedAt = s.clock.Now()
+	for _, m := range members {
+		g.placed.Insert(m.GetPodKey())
+		if m != task {
+			s.expedite(m.Pod)
+		}
+	}
+	log.Infof("placed %d member(s) of pod group %v", len(members), g.key)
+	if host, found := hosts[podKey]; found {
+		return host, nil
+	}
+	// the task isn't registered as pending, so it wasn't placed along with the gang
+	return placeTask(task)
+}
+
+// records that the task has been bound to the host, launching all of the
+// members of its gang via the given func once they've all been bound.
+func (s *gangScheduler) bind(task *podtask.T, host string, launch func(*podtask.T, string) error) error {
+	podKey := task.GetPodKey()
+	key, _, _ := gangOf(task.Pod)
+	g, found := s.gangs[key]
+	if !found || !g.placed.Has(podKey) {
+		releaseOffer(task)
+		return fmt.Errorf("pod %v was not placed along with its group %v", podKey, key)
+	}
+	g.staged[podKey] = host
+
+	members := s.pending(g, g.placed)
+	if len(members) < g.minMembers {
+		// members were deleted while we were waiting for the others to bind
+		s.release(g, task)
+		return gangIncompleteErr
+	}
+	for _, m := range members {
+		if _, bound := g.staged[m.GetPodKey()]; !bound {
+			log.V(2).Infof("pod %v is waiting for the other members of pod group %v to bind", podKey, g.key)
+			return nil
+		}
+	}
+
+	for _, m := range members {
+		if err := launch(m, g.staged[m.GetPodKey()]); err != nil {
+			// mesos can't launch tasks across slaves atomically, release those
+			// members that haven't been launched
+			log.Errorf("failed to launch pod group %v: %v", g.key, err)
+			s.release(g, task)
+			return err
+		}
+	}
+	log.Infof("launched %d member(s) of pod group %v", len(members), g.key)
+	delete(s.gangs, g.key)
+	return nil
+}
+
+// release the offers of the task's gang because the task failed to bind.
+func (s *gangScheduler) abort(task *podtask.T) {
+	key, _, ok := gangOf(task.Pod)
+	if !ok {
+		return
+	}
+	if g, found := s.gangs[key]; found && len(g.placed) > 0 {
+		log.Infof("releasing pod group %v, member %v failed to bind", g.key, task.GetPodKey())
+		s.release(g, task)
+	}
+}
+
+// release the offers held by the unlaunched members of the gang, queueing
+// those members (except for the given task) to be scheduled again.
+func (s *gangScheduler) release(g *gang, except *podtask.T) {
+	for _, m := range s.pending(g, g.placed) {
+		releaseOffer(m)
+		if m != except {
+			s.expedite(m.Pod)
+		}
+	}
+	g.placed = util.StringSet{}
+	g.hosts = map[string]string{}
+	g.staged = map[string]string{}
+}
+
+// release gangs that have been placed for too long and forget those that no
+// longer have members.
+func (s *gangScheduler) gc(now time.Time) {
+	for key, g := range s.gangs {
+		if len(g.placed) > 0 && now.Sub(g.placedAt) > gangReservationTTL {
+			log.Warningf("releasing pod group %v, it wasn't launched within %v", key, gangReservationTTL)
+			s.release(g, nil)
+		}
+		if s.pending(g, g.members); len(g.members) == 0 {
+			delete(s.gangs, key)
+		}
+	}
+}
+
+// relinquish the offer held by a pending task
+func releaseOffer(task *podtask.T) {
+	if task.Offer != nil {
+		task.Offer.Release()
+	}
+	if task.HasAcceptedOffer() {
+		task.ClearTaskInfo()
+	}
+	task.Offer = nil
+}
@@ -0,0 +1,210 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	mutil "github.com/mesos/mesos-go/mesosutil"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
+	annotation "github.com/mesosphere/kubernetes-mesos/pkg/scheduler/meta"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+	"github.com/stretchr/testify/assert"
+)
+
+// returns a pending task for a member of the "mpi" pod group, registered with the mock
+func gangMember(t *testing.T, obj *MockScheduler, name string, minMembers int) *podtask.T {
+	pod := &api.Pod{ObjectMeta: api.ObjectMeta{
+		Name:      name,
+		Namespace: api.NamespaceDefault,
+		Annotations: map[string]string{
+			annotation.PodGroupKey:           "mpi",
+			annotation.PodGroupMinMembersKey: strconv.Itoa(minMembers),
+		},
+	}}
+	task, err := podtask.New(api.NewDefaultContext(), pod, &mesos.ExecutorInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj.On("taskForPod", task.GetPodKey()).Return(task.ID, true)
+	obj.On("getTask", task.ID).Return(task, podtask.StatePending)
+	return task
+}
+
+// places tasks by assigning them a task id, failing for the named pods
+func fakePlacement(fail ...string) func(*podtask.T) (string, error) {
+	return func(task *podtask.T) (string, error) {
+		for _, name := range fail {
+			if task.Pod.Name == name {
+				return "", noSuitableOffersErr
+			}
+		}
+		task.TaskInfo.TaskId = mutil.NewTaskID(task.ID)
+		return "host", nil
+	}
+}
+
+func TestGangOf(t *testing.T) {
+	assert := assert.New(t)
+
+	pod := &api.Pod{ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: "ns"}}
+	_, _, ok := gangOf(pod)
+	assert.False(ok)
+
+	pod.Annotations = map[string]string{annotation.PodGroupKey: "mpi"}
+	key, minMembers, ok := gangOf(pod)
+	assert.True(ok)
+	assert.Equal("ns/mpi", key)
+	assert.Equal(1, minMembers)
+
+	pod.Annotations[annotation.PodGroupMinMembersKey] = "3"
+	_, minMembers, _ = gangOf(pod)
+	assert.Equal(3, minMembers)
+
+	pod.Annotations[annotation.PodGroupMinMembersKey] = "zero"
+	_, minMembers, _ = gangOf(pod)
+	assert.Equal(1, minMembers)
+}
+
+func TestGangPlacement(t *testing.T) {
+	assert := assert.New(t)
+	obj := &MockScheduler{}
+	expedited := []string{}
+	gangs := newGangScheduler(obj, func(pod *api.Pod) {
+		expedited = append(expedited, pod.Name)
+	}, clock.RealClock{})
+
+	a := gangMember(t, obj, "a", 3)
+	b := gangMember(t, obj, "b", 3)
+	c := gangMember(t, obj, "c", 3)
+
+	// members are held until enough of them are pending
+	_, err := gangs.place(a, fakePlacement())
+	assert.Equal(gangIncompleteErr, err)
+	_, err = gangs.place(b, fakePlacement())
+	assert.Equal(gangIncompleteErr, err)
+	assert.False(a.HasAcceptedOffer())
+
+	// offers must be found for every member, or none at all
+	_, err = gangs.place(c, fakePlacement("c"))
+	assert.Equal(noSuitableOffersErr, err)
+	assert.False(a.HasAcceptedOffer())
+	assert.False(b.HasAcceptedOffer())
+
+	placements := 0
+	host, err := gangs.place(c, func(task *podtask.T) (string, error) {
+		placements++
+		return fakePlacement()(task)
+	})
+	assert.NoError(err)
+	assert.Equal("host", host)
+	assert.Equal(3, placements)
+	assert.True(a.HasAcceptedOffer())
+	assert.True(b.HasAcceptedOffer())
+	assert.True(c.HasAcceptedOffer())
+	assert.Equal([]string{"a", "b"}, expedited)
+
+	// the other members have already been placed
+	host, err = gangs.place(a, fakePlacement("a"))
+	assert.NoError(err)
+	assert.Equal("host", host)
+
+	// pods that don't belong to a gang are placed on their own
+	pod := &api.Pod{ObjectMeta: api.ObjectMeta{Name: "loner", Namespace: api.NamespaceDefault}}
+	loner, err := podtask.New(api.NewDefaultContext(), pod, &mesos.ExecutorInfo{})
+	assert.NoError(err)
+	host, err = gangs.place(loner, fakePlacement())
+	assert.NoError(err)
+	assert.Equal("host", host)
+	assert.True(loner.HasAcceptedOffer())
+}
+
+func TestGangBind(t *testing.T) {
+	assert := assert.New(t)
+	obj := &MockScheduler{}
+	gangs := newGangScheduler(obj, func(*api.Pod) {}, clock.RealClock{})
+
+	a := gangMember(t, obj, "a", 2)
+	b := gangMember(t, obj, "b", 2)
+	_, err := gangs.place(a, fakePlacement())
+	assert.Equal(gangIncompleteErr, err)
+	_, err = gangs.place(b, fakePlacement())
+	assert.NoError(err)
+
+	launched := map[string]string{}
+	launch := func(task *podtask.T, host string) error {
+		launched[task.Pod.Name] = host
+		return nil
+	}
+
+	// nothing is launched until every member is bound
+	assert.NoError(gangs.bind(a, "host-a", launch))
+	assert.Empty(launched)
+	assert.NoError(gangs.bind(b, "host-b", launch))
+	assert.Equal(map[string]string{"a": "host-a", "b": "host-b"}, launched)
+	assert.Empty(gangs.gangs)
+}
+
+func TestGangBindFailure(t *testing.T) {
+	assert := assert.New(t)
+	obj := &MockScheduler{}
+	expedited := []string{}
+	gangs := newGangScheduler(obj, func(pod *api.Pod) {
+		expedited = append(expedited, pod.Name)
+	}, clock.RealClock{})
+
+	a := gangMember(t, obj, "a", 2)
+	b := gangMember(t, obj, "b", 2)
+	_, err := gangs.place(a, fakePlacement())
+	assert.Equal(gangIncompleteErr, err)
+	_, err = gangs.place(b, fakePlacement())
+	assert.NoError(err)
+	expedited = expedited[:0]
+
+	launch := func(task *podtask.T, host string) error {
+		return fmt.Errorf("unexpected launch of %v", task.Pod.Name)
+	}
+	assert.NoError(gangs.bind(a, "host-a", launch))
+
+	// a member that fails to bind releases the whole gang
+	gangs.abort(b)
+	assert.False(a.HasAcceptedOffer())
+	assert.False(b.HasAcceptedOffer())
+	assert.Equal([]string{"a"}, expedited)
+
+	// and must be placed again before binding
+	assert.Error(gangs.bind(a, "host-a", launch))
+}
+
+func TestGangExpiry(t *testing.T) {
+	assert := assert.New(t)
+	obj := &MockScheduler{}
+	expedited := []string{}
+	fake := clock.NewFake(time.Now())
+	gangs := newGangScheduler(obj, func(pod *api.Pod) {
+		expedited = append(expedited, pod.Name)
+	}, fake)
+
+	a := gangMember(t, obj, "a", 2)
+	b := gangMember(t, obj, "b", 2)
+	_, err := gangs.place(a, fakePlacement())
+	assert.Equal(gangIncompleteErr, err)
+	_, err = gangs.place(b, fakePlacement())
+	assert.NoError(err)
+	expedited = expedited[:0]
+
+	// placed gangs are held for the reservation ttl, on the scheduler's clock
+	fake.Step(gangReservationTTL)
+	gangs.gc(fake.Now())
+	assert.True(a.HasAcceptedOffer())
+	assert.True(b.HasAcceptedOffer())
+
+	fake.Step(time.Second)
+	gangs.gc(fake.Now())
+	assert.False(a.HasAcceptedOffer())
+	assert.False(b.HasAcceptedOffer())
+	assert.Equal([]string{"a", "b"}, expedited)
+}
@@ -2,8 +2,40 @@ package meta
 
 // kubernetes api object annotations
 const (
+	// prefix of the keys of all k8sm annotations
+	AnnotationPrefix = "k8s.mesosphere.io/"
+
 	BindingHostKey = "k8s.mesosphere.io/bindingHost"
 	TaskIdKey      = "k8s.mesosphere.io/taskId"
 	SlaveIdKey     = "k8s.mesosphere.io/slaveId"
 	OfferIdKey     = "k8s.mesosphere.io/offerId"
+
+	// the host that the apiserver still binds a rescheduled pod to; it refuses
+	// to rebind pods, so the executor doesn't post a binding for such a pod
+	BoundHostKey = "k8s.mesosphere.io/boundHost"
+
+	// W3C traceparent of the span that traces the launch of a pod, so that the
+	// executor may continue the trace
+	TraceContextKey = "k8s.mesosphere.io/traceContext"
+
+	// scheduling hints, set by the user
+	PriorityClassKey   = "k8s.mesosphere.io/priorityClass"
+	BackoffStrategyKey = "k8s.mesosphere.io/backoffStrategy"
+	BackoffMinKey      = "k8s.mesosphere.io/backoffMin" // a duration, e.g. "500ms"
+	BackoffMaxKey      = "k8s.mesosphere.io/backoffMax" // a duration, e.g. "5m"
+
+	// pods of the same group are only launched once offers can satisfy the
+	// minimum number of members
+	PodGroupKey           = "k8s.mesosphere.io/podGroup"
+	PodGroupMinMembersKey = "k8s.mesosphere.io/podGroupMinMembers"
+
+	// label selectors of the tasks that pods should, or shouldn't, be
+	// co-located with: semicolon separated terms of the form "selector" for
+	// hard constraints or "weight:selector" for soft preferences
+	AffinityKey     = "k8s.mesosphere.io/affinity"
+	AntiAffinityKey = "k8s.mesosphere.io/antiAffinity"
+
+	// marathon-style placement constraints, semicolon separated terms of the
+	// form "field:OPERATOR[:value]", e.g. "hostname:UNIQUE;rack:GROUP_BY:3"
+	ConstraintsKey = "k8s.mesosphere.io/constraints"
 )
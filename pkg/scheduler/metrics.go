@@ -0,0 +1,118 @@
+package scheduler
+
+import (
+	"time"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/mesosphere/kubernetes-mesos/pkg/offers"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/metrics"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+)
+
+const (
+	metricsUpdateInterval = 15 * time.Second // how often to publish the number of tasks, offers and slaves
+)
+
+// publish the number of tasks, offers and slaves known to the scheduler
+func updateMetrics(api SchedulerInterface) {
+	api.RLocker().Lock()
+	defer api.RLocker().Unlock()
+
+	metrics.Tasks.Reset()
+	for _, state := range []podtask.StateType{podtask.StatePending, podtask.StateRunning, podtask.StateFinished} {
+		for _, task := range api.listTasks(state) {
+			namespace, hostname := taskLabels(api, task)
+			metrics.Tasks.WithLabelValues(state.String(), namespace, hostname).Inc()
+		}
+	}
+
+	metrics.Offers.Reset()
+	for _, offer := range api.offers().List() {
+		state := "live"
+		if offer.Lingering {
+			state = "lingering"
+		}
+		metrics.Offers.WithLabelValues(state, offer.Hostname).Inc()
+	}
+
+	counts := map[string]int{"active": 0, "draining": 0}
+	for _, id := range api.listSlaves() {
+		if slave, found := api.slaveFor(id); found && slave.Draining {
+			counts["draining"]++
+		} else {
+			counts["active"]++
+		}
+	}
+	for state, n := range counts {
+		metrics.Slaves.WithLabelValues(state).Set(float64(n))
+	}
+}
+
+// returns the namespace of the task's pod and the hostname of the slave that
+// the task was launched on, either of which may be empty
+func taskLabels(slaves SlaveIndex, task *podtask.T) (namespace, hostname string) {
+	if task == nil {
+		return
+	}
+	if task.Pod != nil {
+		namespace = task.Pod.Namespace
+	}
+	if task.TaskInfo != nil && task.TaskInfo.SlaveId != nil {
+		if slave, found := slaves.slaveFor(task.TaskInfo.SlaveId.GetValue()); found {
+			hostname = slave.HostName
+		}
+	}
+	return
+}
+
+// count a status update of a task, which may be unknown to the registry;
+// assumes that the caller is holding the scheduler lock
+func (k *KubernetesScheduler) countStatus(status *mesos.TaskStatus, task *podtask.T) {
+	namespace, _ := taskLabels(&k8smScheduler{k}, task)
+	hostname := ""
+	if slave, found := k.slaves[status.GetSlaveId().GetValue()]; found {
+		hostname = slave.HostName
+	}
+	metrics.StatusUpdates.WithLabelValues(status.GetState().String(), namespace, hostname).Inc()
+}
+
+// returns the type of a scheduling error, as reported by the scheduling_errors metric
+func schedulingErrorType(err error) string {
+	switch err {
+	case noSuitableOffersErr:
+		return "no_suitable_offers"
+	case noSuchPodErr:
+		return "no_such_pod"
+	case noSuchTaskErr:
+		return "no_such_task"
+	case gangIncompleteErr:
+		return "gang_incomplete"
+	case placementViolatedErr:
+		return "placement_violated"
+	case affinityViolatedErr:
+		return "affinity_violated"
+	case slaveDrainingErr:
+		return "slave_draining"
+	}
+	return "other"
+}
+
+// counts the offers that a schedule func considers
+type walkedOffers struct {
+	offers.Registry
+	walked  int
+	record  bool           // if true, the details of the offers walked are retained
+	details []*mesos.Offer // live offers walked, in order
+}
+
+func (r *walkedOffers) Walk(w offers.Walker) error {
+	return r.Registry.Walk(func(p offers.Perishable) (bool, error) {
+		r.walked++
+		if r.record {
+			if offer := p.Details(); offer != nil {
+				r.details = append(r.details, offer)
+			}
+		}
+		return w(p)
+	})
+}
@@ -9,15 +9,45 @@ import (
 
 const (
 	schedulerSubsystem = "scheduler"
+
+	// labels shared by the metrics of this package, so that they may be
+	// graphed per slave and per namespace
+	NamespaceLabel = "namespace"
+	HostnameLabel  = "hostname" // of the slave, as labelled by the offers metrics
 )
 
 var (
-	QueueWaitTime = prometheus.NewSummary(
+	QueueWaitTime = prometheus.NewSummaryVec(
 		prometheus.SummaryOpts{
 			Subsystem: schedulerSubsystem,
 			Name:      "queue_wait_time_microseconds",
 			Help:      "Launch queue wait time in microseconds",
 		},
+		[]string{"priority"},
+	)
+	QueueLength = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: schedulerSubsystem,
+			Name:      "queue_length",
+			Help:      "Number of pods waiting to be scheduled.",
+		},
+		[]string{"priority"},
+	)
+	NamespaceQueueLength = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: schedulerSubsystem,
+			Name:      "namespace_queue_length",
+			Help:      "Number of pods waiting to be scheduled, by namespace.",
+		},
+		[]string{NamespaceLabel},
+	)
+	Placements = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: schedulerSubsystem,
+			Name:      "placements",
+			Help:      "Number of pod-tasks launched, by namespace.",
+		},
+		[]string{NamespaceLabel},
 	)
 	BindLatency = prometheus.NewSummary(
 		prometheus.SummaryOpts{
@@ -26,6 +56,73 @@ var (
 			Help:      "Latency in microseconds between pod-task launch and pod binding.",
 		},
 	)
+	Tasks = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: schedulerSubsystem,
+			Name:      "tasks",
+			Help:      "Number of pod-tasks in the registry, by state (pending, running or finished), namespace and slave.",
+		},
+		[]string{"state", NamespaceLabel, HostnameLabel},
+	)
+	Offers = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: schedulerSubsystem,
+			Name:      "offers",
+			Help:      "Number of offers in the registry, by state (live or lingering) and slave.",
+		},
+		[]string{"state", HostnameLabel},
+	)
+	Slaves = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: schedulerSubsystem,
+			Name:      "slaves",
+			Help:      "Number of registered slaves, by state (active or draining).",
+		},
+		[]string{"state"},
+	)
+	ScheduleLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: schedulerSubsystem,
+			Name:      "schedule_latency_microseconds",
+			Help:      "Latency in microseconds of the schedule func, per scheduling decision.",
+			Buckets:   prometheus.ExponentialBuckets(10, 2, 16),
+		},
+		[]string{NamespaceLabel},
+	)
+	OffersWalked = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: schedulerSubsystem,
+			Name:      "offers_walked",
+			Help:      "Number of offers considered by the schedule func, per scheduling decision.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+		},
+		[]string{NamespaceLabel},
+	)
+	ReconciliationLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: schedulerSubsystem,
+			Name:      "reconciliation_latency_microseconds",
+			Help:      "Duration in microseconds of task reconciliation, by result (success or failure).",
+			Buckets:   prometheus.ExponentialBuckets(100000, 2, 14),
+		},
+		[]string{"result"},
+	)
+	SchedulingErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: schedulerSubsystem,
+			Name:      "scheduling_errors",
+			Help:      "Number of failed attempts to schedule a pod, by type of error and namespace.",
+		},
+		[]string{"type", NamespaceLabel},
+	)
+	StatusUpdates = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: schedulerSubsystem,
+			Name:      "status_updates",
+			Help:      "Number of task status updates received from mesos, by task state, namespace and slave.",
+		},
+		[]string{"state", NamespaceLabel, HostnameLabel},
+	)
 )
 
 var registerMetrics sync.Once
@@ -33,7 +130,18 @@ var registerMetrics sync.Once
 func Register() {
 	registerMetrics.Do(func() {
 		prometheus.MustRegister(QueueWaitTime)
+		prometheus.MustRegister(QueueLength)
+		prometheus.MustRegister(NamespaceQueueLength)
+		prometheus.MustRegister(Placements)
 		prometheus.MustRegister(BindLatency)
+		prometheus.MustRegister(Tasks)
+		prometheus.MustRegister(Offers)
+		prometheus.MustRegister(Slaves)
+		prometheus.MustRegister(ScheduleLatency)
+		prometheus.MustRegister(OffersWalked)
+		prometheus.MustRegister(ReconciliationLatency)
+		prometheus.MustRegister(SchedulingErrors)
+		prometheus.MustRegister(StatusUpdates)
 	})
 }
 
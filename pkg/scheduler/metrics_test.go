@@ -0,0 +1,72 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	mutil "github.com/mesos/mesos-go/mesosutil"
+	"github.com/mesosphere/kubernetes-mesos/pkg/offers"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+	"github.com/stretchr/testify/assert"
+)
+
+// a registry of n live offers, walked in order
+type fakeOffers struct {
+	offers.Registry
+	n int
+}
+
+func (r *fakeOffers) Walk(w offers.Walker) error {
+	for i := 0; i < r.n; i++ {
+		if stop, err := w(nil); stop || err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestWalkedOffers(t *testing.T) {
+	walked := &walkedOffers{Registry: &fakeOffers{n: 5}}
+	walked.Walk(func(offers.Perishable) (bool, error) { return false, nil })
+	assert.Equal(t, 5, walked.walked)
+
+	walked = &walkedOffers{Registry: &fakeOffers{n: 5}}
+	i := 0
+	walked.Walk(func(offers.Perishable) (bool, error) {
+		i++
+		return i == 2, nil
+	})
+	assert.Equal(t, 2, walked.walked)
+}
+
+func TestSchedulingErrorType(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("no_suitable_offers", schedulingErrorType(noSuitableOffersErr))
+	assert.Equal("slave_draining", schedulingErrorType(slaveDrainingErr))
+	assert.Equal("other", schedulingErrorType(errors.New("task is not pending")))
+}
+
+func TestTaskLabels(t *testing.T) {
+	assert := assert.New(t)
+	obj := &MockScheduler{}
+	obj.On("slaveFor", "slave1").Return(&Slave{HostName: "h1"}, true)
+
+	pod := &api.Pod{ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: "ns1"}}
+	task, err := podtask.New(api.NewDefaultContext(), pod, &mesos.ExecutorInfo{})
+	assert.NoError(err)
+
+	namespace, hostname := taskLabels(obj, task)
+	assert.Equal("ns1", namespace)
+	assert.Equal("", hostname)
+
+	task.TaskInfo = &mesos.TaskInfo{SlaveId: mutil.NewSlaveID("slave1")}
+	namespace, hostname = taskLabels(obj, task)
+	assert.Equal("ns1", namespace)
+	assert.Equal("h1", hostname)
+
+	namespace, hostname = taskLabels(obj, nil)
+	assert.Equal("", namespace+hostname)
+	obj.AssertExpectations(t)
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
 	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
 	"github.com/mesosphere/kubernetes-mesos/pkg/offers"
 	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
 	"github.com/stretchr/testify/mock"
@@ -26,6 +27,10 @@ func (m *MockScheduler) slaveFor(id string) (slave *Slave, ok bool) {
 	ok = args.Bool(1)
 	return
 }
+func (m *MockScheduler) listSlaves() []string {
+	args := m.Called()
+	return args.Get(0).([]string)
+}
 func (m *MockScheduler) algorithm() (f PodScheduleFunc) {
 	args := m.Called()
 	x := args.Get(0)
@@ -79,14 +84,30 @@ func (m *MockScheduler) taskForPod(podID string) (taskID string, ok bool) {
 func (m *MockScheduler) unregisterPodTask(task *podtask.T) {
 	m.Called(task)
 }
-func (m *MockScheduler) killTask(taskId string) error {
-	args := m.Called(taskId)
+func (m *MockScheduler) listTasks(state podtask.StateType) (tasks []*podtask.T) {
+	args := m.Called(state)
+	x := args.Get(0)
+	if x != nil {
+		tasks = x.([]*podtask.T)
+	}
+	return
+}
+func (m *MockScheduler) reconcileTasks() error {
+	args := m.Called()
+	return args.Error(0)
+}
+func (m *MockScheduler) killTask(taskId, reason string) error {
+	args := m.Called(taskId, reason)
 	return args.Error(0)
 }
 func (m *MockScheduler) launchTask(task *podtask.T) error {
 	args := m.Called(task)
 	return args.Error(0)
 }
+func (m *MockScheduler) updateTask(task *podtask.T, update *messages.PodUpdate) error {
+	args := m.Called(task, update)
+	return args.Error(0)
+}
 
 // @deprecated this is a placeholder for me to test the mock package
 func TestNoSlavesYet(t *testing.T) {
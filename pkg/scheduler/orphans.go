@@ -0,0 +1,309 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api/errors"
+	log "github.com/golang/glog"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/api/v1"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+)
+
+// reasons that a task is orphaned
+const (
+	orphanPodNotFound = "pod not found"
+	orphanPodReplaced = "pod replaced"
+	orphanUnknownTask = "task unknown to the scheduler"
+)
+
+// what caused an orphan to be killed, reported in the audit log
+const (
+	orphanTriggerDetector = "detector"
+	orphanTriggerAPI      = "api"
+)
+
+// a task of this framework that the leading mesos master believes is active
+type MasterTask struct {
+	Id      string
+	SlaveId string
+}
+
+// lists the tasks of a framework that the leading mesos master believes are active
+type MasterTaskLister func(frameworkId string) ([]MasterTask, error)
+
+// OrphanConfig configures the periodic detection, and killing, of orphaned
+// tasks: those that mesos is running but whose pods no longer exist, or that
+// the scheduler doesn't know about at all (e.g. because its state was lost).
+// the pods of unknown tasks can't be found, so such tasks are only reported
+// by the detector, and only killed when an operator names them.
+type OrphanConfig struct {
+	Interval    time.Duration    // how often to look for orphans; zero disables periodic detection
+	DryRun      bool             // if true, orphans are reported but never killed by the detector
+	Audit       io.Writer        // receives a JSON record of every orphan found, may be nil
+	MasterTasks MasterTaskLister // may be nil, in which case only reconciliation reveals unknown tasks
+}
+
+// looks up a pod in the apiserver, returning nil if it doesn't exist
+type podLookupFunc func(namespace, name string) (*api.Pod, error)
+
+func (k *KubernetesScheduler) lookupPod(namespace, name string) (*api.Pod, error) {
+	pod, err := k.client.Pods(namespace).Get(name)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	return pod, err
+}
+
+// one line of the orphan audit log
+type orphanRecord struct {
+	Time    time.Time `json:"time"`
+	TaskId  string    `json:"taskId"`
+	Pod     string    `json:"pod,omitempty"`
+	SlaveId string    `json:"slaveId,omitempty"`
+	Reason  string    `json:"reason"`
+	Action  string    `json:"action"`  // killed, kill-failed, dry-run or reported
+	Trigger string    `json:"trigger"` // detector or api
+	Error   string    `json:"error,omitempty"`
+}
+
+// compares the tasks that mesos is running with the pods of the apiserver
+// and the tasks of the registry
+type orphanDetector struct {
+	api         SchedulerInterface
+	lookup      podLookupFunc
+	master      MasterTaskLister // may be nil
+	frameworkId func() string
+	config      OrphanConfig
+	clock       clock.Clock
+
+	lock    sync.Mutex
+	unknown map[string]string // active tasks that the registry doesn't know, reported by status updates: task id -> slave id
+	audit   *json.Encoder     // nil if there's no audit log
+}
+
+func newOrphanDetector(api SchedulerInterface, lookup podLookupFunc, frameworkId func() string, config OrphanConfig, c clock.Clock) *orphanDetector {
+	d := &orphanDetector{
+		api:         api,
+		lookup:      lookup,
+		master:      config.MasterTasks,
+		frameworkId: frameworkId,
+		config:      config,
+		clock:       c,
+		unknown:     map[string]string{},
+	}
+	if config.Audit != nil {
+		d.audit = json.NewEncoder(config.Audit)
+	}
+	return d
+}
+
+// remember an active task, reported by a status update (typically in
+// response to reconciliation), that the registry doesn't know about
+func (d *orphanDetector) observe(status *mesos.TaskStatus) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.unknown[status.GetTaskId().GetValue()] = status.GetSlaveId().GetValue()
+}
+
+func (d *orphanDetector) forget(taskId string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.unknown, taskId)
+}
+
+// a task that mesos may be running, and the pod that it was created for
+type orphanCandidate struct {
+	task      v1.Task
+	uid       string
+	namespace string
+	name      string
+}
+
+// returns the tasks that mesos may be running but whose pods no longer exist,
+// or that the registry doesn't know about, ordered by task id. tasks that are
+// already being killed aren't reported, nor are those whose pods can't be
+// looked up. neither the apiserver nor the master is consulted while holding
+// the scheduler lock.
+func (d *orphanDetector) detect() ([]v1.Orphan, error) {
+	candidates := func() (result []orphanCandidate) {
+		d.api.RLocker().Lock()
+		defer d.api.RLocker().Unlock()
+
+		for _, state := range []podtask.StateType{podtask.StatePending, podtask.StateRunning} {
+			for _, task := range d.api.listTasks(state) {
+				if task.Pod == nil || task.Has(podtask.Deleted) || (state == podtask.StatePending && !task.Has(podtask.Launched)) {
+					continue
+				}
+				result = append(result, orphanCandidate{
+					task:      newAPITask(d.api, task),
+					uid:       string(task.Pod.UID),
+					namespace: task.Pod.Namespace,
+					name:      task.Pod.Name,
+				})
+			}
+		}
+		return
+	}()
+
+	orphans := []v1.Orphan{}
+	for _, c := range candidates {
+		reason, err := d.orphaned(c)
+		if err != nil {
+			log.Warningf("failed to look up pod %v/%v of task %v: %v", c.namespace, c.name, c.task.Id, err)
+			continue
+		}
+		if reason != "" {
+			orphans = append(orphans, v1.Orphan{Task: c.task, Reason: reason})
+		}
+	}
+
+	unknown, err := d.unknownTasks()
+	if err != nil {
+		return nil, err
+	}
+	orphans = append(orphans, unknown...)
+	sort.Sort(apiOrphans(orphans))
+	return orphans, nil
+}
+
+// returns the reason that a task is orphaned, or "" if its pod still exists
+func (d *orphanDetector) orphaned(c orphanCandidate) (string, error) {
+	pod, err := d.lookup(c.namespace, c.name)
+	switch {
+	case err != nil:
+		return "", err
+	case pod == nil:
+		return orphanPodNotFound, nil
+	case c.uid != "" && string(pod.UID) != c.uid:
+		return orphanPodReplaced, nil
+	}
+	return "", nil
+}
+
+// returns the active tasks, reported by status updates or the master, that
+// the registry doesn't know about
+func (d *orphanDetector) unknownTasks() ([]v1.Orphan, error) {
+	active := func() map[string]string {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		result := make(map[string]string, len(d.unknown))
+		for taskId, slaveId := range d.unknown {
+			result[taskId] = slaveId
+		}
+		return result
+	}()
+	if d.master != nil {
+		if frameworkId := d.frameworkId(); frameworkId != "" {
+			tasks, err := d.master(frameworkId)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list the tasks of the mesos master: %v", err)
+			}
+			for _, t := range tasks {
+				active[t.Id] = t.SlaveId
+			}
+		}
+	}
+
+	d.api.RLocker().Lock()
+	defer d.api.RLocker().Unlock()
+
+	orphans := []v1.Orphan{}
+	for taskId, slaveId := range active {
+		if _, state := d.api.getTask(taskId); state != podtask.StateUnknown {
+			d.forget(taskId)
+			continue
+		}
+		t := v1.Task{Id: taskId, State: podtask.StateUnknown.String(), Flags: []string{}, SlaveId: slaveId}
+		if slave, found := d.api.slaveFor(slaveId); found {
+			t.Hostname = slave.HostName
+		}
+		orphans = append(orphans, v1.Orphan{Task: t, Reason: orphanUnknownTask})
+	}
+	return orphans, nil
+}
+
+// kills an orphaned task, recording the outcome in the audit log
+func (d *orphanDetector) kill(o v1.Orphan, trigger string) error {
+	err := func() error {
+		d.api.Lock()
+		defer d.api.Unlock()
+
+		task, _ := d.api.getTask(o.Task.Id)
+		if err := d.api.killTask(o.Task.Id, killReasonOrphaned); err != nil {
+			return err
+		}
+		if task != nil {
+			task.Set(podtask.Deleted)
+		}
+		return nil
+	}()
+	if err != nil {
+		d.record(o, "kill-failed", trigger, err)
+		return err
+	}
+	d.forget(o.Task.Id)
+	d.record(o, "killed", trigger, nil)
+	return nil
+}
+
+func (d *orphanDetector) record(o v1.Orphan, action, trigger string, err error) {
+	r := &orphanRecord{
+		Time:    d.clock.Now(),
+		TaskId:  o.Task.Id,
+		Pod:     o.Task.Pod,
+		SlaveId: o.Task.SlaveId,
+		Reason:  o.Reason,
+		Action:  action,
+		Trigger: trigger,
+	}
+	if err != nil {
+		r.Error = err.Error()
+		log.Errorf("failed to kill orphaned task %v (%v): %v", o.Task.Id, o.Reason, err)
+	} else {
+		log.Infof("orphaned task %v (%v) of pod %q on slave %v: %v", o.Task.Id, o.Reason, o.Task.Pod, o.Task.SlaveId, action)
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.audit != nil {
+		if err := d.audit.Encode(r); err != nil {
+			log.Warningf("failed to write orphan audit record: %v", err)
+		}
+	}
+}
+
+// returns true if the orphan's pod is known not to exist, which isn't the case
+// for tasks unknown to the scheduler: the pods of those may still exist, e.g.
+// when the scheduler's state was lost in a failover.
+func podConfirmedAbsent(o v1.Orphan) bool {
+	return o.Reason != orphanUnknownTask
+}
+
+// looks for orphans once, killing those whose pods are confirmed absent
+// unless configured for a dry run
+func (d *orphanDetector) run() {
+	orphans, err := d.detect()
+	if err != nil {
+		log.Errorf("orphan detection failed: %v", err)
+		return
+	}
+	for _, o := range orphans {
+		if d.config.DryRun {
+			d.record(o, "dry-run", orphanTriggerDetector, nil)
+			continue
+		}
+		if !podConfirmedAbsent(o) {
+			d.record(o, "reported", orphanTriggerDetector, nil)
+			continue
+		}
+		d.kill(o, orphanTriggerDetector)
+	}
+}
@@ -0,0 +1,229 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	mutil "github.com/mesos/mesos-go/mesosutil"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+	"github.com/stretchr/testify/assert"
+)
+
+// a scheduler with running tasks whose pods are alive, gone, replaced, can't
+// be looked up, or are gone and already being killed, and a pending task that
+// hasn't been launched
+func newOrphanFixture(t *testing.T) (*MockScheduler, map[string]*podtask.T, podLookupFunc) {
+	obj := &MockScheduler{}
+	tasks := map[string]*podtask.T{}
+	for _, meta := range []api.ObjectMeta{
+		{Name: "alive", UID: "1"},
+		{Name: "gone", UID: "2"},
+		{Name: "replaced", UID: "3"},
+		{Name: "pending", UID: "4"},
+		{Name: "broken", UID: "6"},
+		{Name: "deleting", UID: "7"},
+	} {
+		meta.Namespace = api.NamespaceDefault
+		task, err := podtask.New(api.NewDefaultContext(), &api.Pod{ObjectMeta: meta}, &mesos.ExecutorInfo{})
+		assert.NoError(t, err)
+		tasks[meta.Name] = task
+	}
+	obj.On("listTasks", podtask.StatePending).Return([]*podtask.T{tasks["pending"]})
+	obj.On("listTasks", podtask.StateRunning).Return([]*podtask.T{tasks["alive"], tasks["gone"], tasks["replaced"], tasks["broken"], tasks["deleting"]})
+	tasks["deleting"].Set(podtask.Deleted)
+
+	lookup := func(namespace, name string) (*api.Pod, error) {
+		switch name {
+		case "alive":
+			return tasks["alive"].Pod, nil
+		case "replaced":
+			return &api.Pod{ObjectMeta: api.ObjectMeta{Name: name, Namespace: namespace, UID: "5"}}, nil
+		case "broken":
+			return nil, errors.New("apiserver unavailable")
+		}
+		return nil, nil
+	}
+	return obj, tasks, lookup
+}
+
+func TestOrphanDetection(t *testing.T) {
+	assert := assert.New(t)
+	obj, tasks, lookup := newOrphanFixture(t)
+	obj.On("getTask", "unknown1").Return(nil, podtask.StateUnknown)
+	obj.On("getTask", "unknown2").Return(nil, podtask.StateUnknown)
+	obj.On("getTask", "known").Return(tasks["alive"], podtask.StateRunning)
+	obj.On("slaveFor", "slave1").Return(&Slave{HostName: "h1"}, true)
+	obj.On("slaveFor", "slave2").Return(nil, false)
+
+	master := func(frameworkId string) ([]MasterTask, error) {
+		assert.Equal("framework1", frameworkId)
+		return []MasterTask{{Id: "unknown2", SlaveId: "slave2"}, {Id: "known", SlaveId: "slave1"}}, nil
+	}
+	d := newOrphanDetector(obj, lookup, func() string { return "framework1" }, OrphanConfig{MasterTasks: master}, clock.RealClock{})
+	d.observe(&mesos.TaskStatus{
+		TaskId:  mutil.NewTaskID("unknown1"),
+		SlaveId: mutil.NewSlaveID("slave1"),
+		State:   mesos.TaskState_TASK_RUNNING.Enum(),
+	})
+
+	orphans, err := d.detect()
+	assert.NoError(err)
+	reasons := map[string]string{}
+	for _, o := range orphans {
+		name := o.Task.Pod
+		if name == "" {
+			name = o.Task.Id + "@" + o.Task.Hostname
+		}
+		reasons[name] = o.Reason
+	}
+	assert.Equal(map[string]string{
+		"default/gone":     orphanPodNotFound,
+		"default/replaced": orphanPodReplaced,
+		"unknown1@h1":      orphanUnknownTask,
+		"unknown2@":        orphanUnknownTask,
+	}, reasons)
+	obj.AssertExpectations(t)
+}
+
+func TestOrphanDetectorKillsOrphans(t *testing.T) {
+	assert := assert.New(t)
+	obj, tasks, lookup := newOrphanFixture(t)
+	gone, replaced := tasks["gone"], tasks["replaced"]
+	obj.On("getTask", gone.ID).Return(gone, podtask.StateRunning)
+	obj.On("getTask", replaced.ID).Return(replaced, podtask.StateRunning)
+	obj.On("killTask", gone.ID, killReasonOrphaned).Return(nil)
+	obj.On("killTask", replaced.ID, killReasonOrphaned).Return(nil)
+	obj.On("getTask", "unknown1").Return(nil, podtask.StateUnknown)
+	obj.On("slaveFor", "slave1").Return(nil, false)
+
+	now := time.Now()
+	audit := &bytes.Buffer{}
+	config := OrphanConfig{DryRun: true, Audit: audit}
+	d := newOrphanDetector(obj, lookup, func() string { return "" }, config, clock.NewFake(now))
+	d.observe(&mesos.TaskStatus{
+		TaskId:  mutil.NewTaskID("unknown1"),
+		SlaveId: mutil.NewSlaveID("slave1"),
+		State:   mesos.TaskState_TASK_RUNNING.Enum(),
+	})
+
+	// a dry run only reports the orphans
+	d.run()
+	assert.False(gone.Has(podtask.Deleted))
+	records := decodeOrphanRecords(t, audit)
+	if assert.Len(records, 3) {
+		assert.Equal("dry-run", records[0].Action)
+		assert.Equal(orphanTriggerDetector, records[0].Trigger)
+		assert.True(now.Equal(records[0].Time))
+	}
+
+	// unknown tasks are reported, but not killed, since their pods may exist
+	d.config.DryRun = false
+	d.run()
+	assert.True(gone.Has(podtask.Deleted))
+	assert.True(replaced.Has(podtask.Deleted))
+	actions := map[string]string{}
+	for _, r := range decodeOrphanRecords(t, audit) {
+		actions[r.TaskId] = r.Action
+	}
+	assert.Equal(map[string]string{gone.ID: "killed", replaced.ID: "killed", "unknown1": "reported"}, actions)
+
+	// killed orphans aren't reported again while mesos confirms the kill
+	orphans, err := d.detect()
+	assert.NoError(err)
+	if assert.Len(orphans, 1) {
+		assert.Equal("unknown1", orphans[0].Task.Id)
+	}
+	obj.AssertExpectations(t)
+}
+
+func TestAPIKillOrphan(t *testing.T) {
+	assert := assert.New(t)
+	obj, tasks, lookup := newOrphanFixture(t)
+	alive, gone := tasks["alive"], tasks["gone"]
+	obj.On("getTask", alive.ID).Return(alive, podtask.StateRunning)
+	obj.On("getTask", gone.ID).Return(gone, podtask.StateRunning)
+	obj.On("killTask", gone.ID, killReasonOrphaned).Return(nil)
+
+	audit := &bytes.Buffer{}
+	s := &apiServer{sched: obj, orphans: newOrphanDetector(obj, lookup, func() string { return "" }, OrphanConfig{Audit: audit}, clock.RealClock{})}
+
+	// tasks whose pods still exist may not be killed
+	_, err := s.killOrphan(alive.ID)
+	if assert.IsType(&apiError{}, err) {
+		assert.Equal(http.StatusConflict, err.(*apiError).status)
+	}
+
+	status, err := s.killOrphan(gone.ID)
+	assert.NoError(err)
+	assert.Equal([]string{gone.ID}, status.Tasks)
+	records := decodeOrphanRecords(t, audit)
+	if assert.Len(records, 1) {
+		assert.Equal(orphanTriggerAPI, records[0].Trigger)
+		assert.Equal("default/gone", records[0].Pod)
+	}
+	obj.AssertExpectations(t)
+}
+
+func TestAPIKillOrphans(t *testing.T) {
+	assert := assert.New(t)
+	obj, tasks, lookup := newOrphanFixture(t)
+	gone, replaced := tasks["gone"], tasks["replaced"]
+	obj.On("getTask", gone.ID).Return(gone, podtask.StateRunning)
+	obj.On("getTask", replaced.ID).Return(replaced, podtask.StateRunning)
+	obj.On("getTask", "unknown1").Return(nil, podtask.StateUnknown)
+	obj.On("slaveFor", "slave1").Return(nil, false)
+	obj.On("killTask", gone.ID, killReasonOrphaned).Return(nil)
+	obj.On("killTask", replaced.ID, killReasonOrphaned).Return(nil)
+	obj.On("killTask", "unknown1", killReasonOrphaned).Return(nil)
+
+	d := newOrphanDetector(obj, lookup, func() string { return "" }, OrphanConfig{}, clock.RealClock{})
+	d.observe(&mesos.TaskStatus{
+		TaskId:  mutil.NewTaskID("unknown1"),
+		SlaveId: mutil.NewSlaveID("slave1"),
+		State:   mesos.TaskState_TASK_RUNNING.Enum(),
+	})
+	s := &apiServer{sched: obj, orphans: d}
+
+	// nothing is killed if any of the given tasks isn't orphaned
+	_, err := s.killOrphans([]string{gone.ID, tasks["alive"].ID})
+	if assert.IsType(&apiError{}, err) {
+		assert.Equal(http.StatusConflict, err.(*apiError).status)
+	}
+	assert.False(gone.Has(podtask.Deleted))
+
+	// unknown tasks are only killed when they're named
+	status, err := s.killOrphans(nil)
+	assert.NoError(err)
+	assert.Equal(2, len(status.Tasks))
+	assert.True(gone.Has(podtask.Deleted))
+	assert.True(replaced.Has(podtask.Deleted))
+
+	status, err = s.killOrphans([]string{"unknown1"})
+	assert.NoError(err)
+	assert.Equal([]string{"unknown1"}, status.Tasks)
+	obj.AssertExpectations(t)
+}
+
+// consumes the records of the audit log written so far
+func decodeOrphanRecords(t *testing.T, audit *bytes.Buffer) []orphanRecord {
+	records := []orphanRecord{}
+	for _, line := range strings.Split(strings.TrimSpace(audit.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var r orphanRecord
+		if assert.NoError(t, json.Unmarshal([]byte(line), &r)) {
+			records = append(records, r)
+		}
+	}
+	audit.Reset()
+	return records
+}
@@ -1,9 +1,11 @@
 package scheduler
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,6 +13,7 @@ import (
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api/errors"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/client/cache"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client/record"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet/envvars"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/runtime"
@@ -21,18 +24,23 @@ import (
 	log "github.com/golang/glog"
 	mesos "github.com/mesos/mesos-go/mesosproto"
 	mutil "github.com/mesos/mesos-go/mesosutil"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
 	"github.com/mesosphere/kubernetes-mesos/pkg/offers"
 	"github.com/mesosphere/kubernetes-mesos/pkg/queue"
 	annotation "github.com/mesosphere/kubernetes-mesos/pkg/scheduler/meta"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/metrics"
 	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+	"github.com/mesosphere/kubernetes-mesos/pkg/trace"
 	"gopkg.in/v2/yaml"
 )
 
 const (
-	enqueuePopTimeout  = 200 * time.Millisecond
-	enqueueWaitTimeout = 1 * time.Second
-	yieldPopTimeout    = 200 * time.Millisecond
-	yieldWaitTimeout   = 1 * time.Second
+	enqueuePopTimeout    = 200 * time.Millisecond
+	enqueueWaitTimeout   = 1 * time.Second
+	yieldPopTimeout      = 200 * time.Millisecond
+	yieldWaitTimeout     = 1 * time.Second
+	queueMetricsInterval = 5 * time.Second
 )
 
 // scheduler abstraction to allow for easier unit testing
@@ -44,12 +52,15 @@ type SchedulerInterface interface {
 	algorithm() PodScheduleFunc
 	createPodTask(api.Context, *api.Pod) (*podtask.T, error)
 	getTask(taskId string) (task *podtask.T, currentState podtask.StateType)
+	listTasks(state podtask.StateType) []*podtask.T
 	offers() offers.Registry
 	registerPodTask(*podtask.T, error) (*podtask.T, error)
 	taskForPod(podID string) (taskID string, ok bool)
 	unregisterPodTask(*podtask.T)
-	killTask(taskId string) error
+	killTask(taskId, reason string) error
 	launchTask(*podtask.T) error
+	updateTask(*podtask.T, *messages.PodUpdate) error
+	reconcileTasks() error
 }
 
 type k8smScheduler struct {
@@ -69,13 +80,26 @@ func (k *k8smScheduler) taskForPod(podID string) (string, bool) {
 }
 
 func (k *k8smScheduler) createPodTask(ctx api.Context, pod *api.Pod) (*podtask.T, error) {
-	return podtask.New(ctx, pod, k.executor)
+	task, err := podtask.New(ctx, pod, k.executor)
+	if err == nil {
+		task.Priority = string(k.priorities.ClassOf(pod))
+	}
+	return task, err
 }
 
 func (k *k8smScheduler) getTask(taskId string) (*podtask.T, podtask.StateType) {
 	return k.KubernetesScheduler.taskRegistry.Get(taskId)
 }
 
+func (k *k8smScheduler) listTasks(state podtask.StateType) (tasks []*podtask.T) {
+	for _, id := range k.KubernetesScheduler.taskRegistry.List(&state) {
+		if task, current := k.KubernetesScheduler.taskRegistry.Get(id); current == state {
+			tasks = append(tasks, task)
+		}
+	}
+	return
+}
+
 func (k *k8smScheduler) registerPodTask(task *podtask.T, err error) (*podtask.T, error) {
 	return k.KubernetesScheduler.taskRegistry.Register(task, err)
 }
@@ -85,12 +109,22 @@ func (k *k8smScheduler) slaveFor(id string) (slave *Slave, ok bool) {
 	return
 }
 
+func (k *k8smScheduler) listSlaves() []string {
+	ids := make([]string, 0, len(k.slaves))
+	for id := range k.slaves {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
 func (k *k8smScheduler) unregisterPodTask(task *podtask.T) {
 	k.KubernetesScheduler.taskRegistry.Unregister(task)
 }
 
-func (k *k8smScheduler) killTask(taskId string) error {
+func (k *k8smScheduler) killTask(taskId, reason string) error {
 	// assume caller is holding scheduler lock
+	log.Infof("killing task %v: %v", taskId, reason)
 	killTaskId := mutil.NewTaskID(taskId)
 	_, err := k.KubernetesScheduler.driver.KillTask(killTaskId)
 	return err
@@ -105,9 +139,35 @@ func (k *k8smScheduler) launchTask(task *podtask.T) error {
 	return err
 }
 
+// starts an explicit reconciliation of running tasks, unless one is already
+// running
+func (k *k8smScheduler) reconcileTasks() error {
+	// assume caller is holding scheduler lock
+	if !k.KubernetesScheduler.registered {
+		return notRegisteredErr
+	}
+	if k.KubernetesScheduler.reconciler.Run(k.KubernetesScheduler.driver) == nil {
+		return reconcilingErr
+	}
+	return nil
+}
+
+func (k *k8smScheduler) updateTask(task *podtask.T, update *messages.PodUpdate) error {
+	// assume caller is holding scheduler lock
+	data, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	_, err = k.KubernetesScheduler.driver.SendFrameworkMessage(task.TaskInfo.Executor.ExecutorId,
+		task.TaskInfo.SlaveId, messages.PodUpdatePrefix+string(data))
+	return err
+}
+
 type binder struct {
-	api    SchedulerInterface
-	client *client.Client
+	api      SchedulerInterface
+	client   *client.Client
+	gangs    *gangScheduler
+	recorder *eventRecorder
 }
 
 // implements binding.Registry, launches the pod-associated-task in mesos
@@ -143,6 +203,22 @@ func (b *binder) Bind(binding *api.Binding) error {
 
 // assumes that: caller has acquired scheduler lock and that the task is still pending
 func (b *binder) bind(ctx api.Context, binding *api.Binding, task *podtask.T) (err error) {
+	span := task.Span.Child("bind")
+	defer func() {
+		span.SetError(err)
+		span.Finish()
+		if err != nil {
+			abandonLaunchTrace(task, err)
+		}
+	}()
+	if b.gangs != nil && b.gangs.isMember(task) {
+		defer func() {
+			if err != nil {
+				b.gangs.abort(task)
+			}
+		}()
+	}
+
 	// sanity check: ensure that the task hasAcceptedOffer(), it's possible that between
 	// Schedule() and now that the offer for this task was rescinded or invalidated.
 	// ((we should never see this here))
@@ -156,23 +232,66 @@ func (b *binder) bind(ctx api.Context, binding *api.Binding, task *podtask.T) (e
 		// already rescinded or timed out or otherwise invalidated
 		task.Offer.Release()
 		task.ClearTaskInfo()
+		b.recorder.Eventf(task.Pod, offerExpiredEvent, "Offer %v expired before the pod could be bound", offerId)
 		return fmt.Errorf("failed prior to launchTask due to expired offer for task %v", task.ID)
 	}
 
 	if err = b.prepareTaskForLaunch(ctx, binding.Host, task, offerId); err == nil {
+		if b.gangs != nil && b.gangs.isMember(task) {
+			// members of a pod group are launched together, once all are bound
+			return b.gangs.bind(task, binding.Host, b.launch)
+		}
+		return b.launch(task, binding.Host)
+	}
+	task.Offer.Release()
+	task.ClearTaskInfo()
+	return fmt.Errorf("Failed to launch task %v: %v", task.ID, err)
+}
+
+// assumes that: caller has acquired scheduler lock and that the task has been
+// prepared for launch
+func (b *binder) launch(task *podtask.T, host string) (err error) {
+	offerId := task.GetOfferId()
+	if offer, ok := b.api.offers().Get(offerId); !ok || offer.HasExpired() {
+		err = fmt.Errorf("offer %v has expired", offerId)
+		b.recorder.Eventf(task.Pod, offerExpiredEvent, "Offer %v expired before the task could be launched", offerId)
+	} else {
 		log.V(2).Infof("launching task : %v", task)
-		if err = b.api.launchTask(task); err == nil {
+		span := task.Span.Child("launchTasks")
+		err = b.api.launchTask(task)
+		span.SetError(err)
+		span.Finish()
+		if err == nil {
 			b.api.offers().Invalidate(offerId)
-			task.Pod.Status.Host = binding.Host
+			task.Pod.Status.Host = host
 			task.Set(podtask.Launched)
+			if slave, ok := b.api.slaveFor(task.TaskInfo.GetSlaveId().GetValue()); ok {
+				// index the task right away so that affinity applies to the next pod
+				slave.Tasks[task.ID] = labels.Set(task.Pod.Labels)
+			}
+			metrics.Placements.WithLabelValues(task.Pod.Namespace).Inc()
+			b.recorder.Eventf(task.Pod, scheduledEvent, "Successfully assigned %v to %v", task.Pod.Name, host)
+			// the executor continues the trace from here
+			task.Span.Tag("hostname", host)
+			task.Span.Finish()
 			return
 		}
 	}
 	task.Offer.Release()
 	task.ClearTaskInfo()
+	abandonLaunchTrace(task, err)
 	return fmt.Errorf("Failed to launch task %v: %v", task.ID, err)
 }
 
+// ends the trace of a launch attempt that failed, or that was abandoned, so
+// that the root span is exported along with its children. the next attempt to
+// schedule the task begins a new trace.
+func abandonLaunchTrace(task *podtask.T, err error) {
+	task.Span.SetError(err)
+	task.Span.Finish()
+	task.Span = nil
+}
+
 func (b *binder) prepareTaskForLaunch(ctx api.Context, machine string, task *podtask.T, offerId string) error {
 	pod, err := b.client.Pods(api.NamespaceValue(ctx)).Get(task.Pod.Name)
 	if err != nil {
@@ -207,6 +326,13 @@ func (b *binder) prepareTaskForLaunch(ctx api.Context, machine string, task *pod
 	boundPod.Annotations[annotation.TaskIdKey] = task.ID
 	boundPod.Annotations[annotation.SlaveIdKey] = task.TaskInfo.SlaveId.GetValue()
 	boundPod.Annotations[annotation.OfferIdKey] = offerId
+	if pod.Status.Host != "" {
+		// a preempted pod that's being rescheduled, see requeuePreempted
+		boundPod.Annotations[annotation.BoundHostKey] = pod.Status.Host
+	}
+	if c := task.Span.Context(); c != nil {
+		boundPod.Annotations[annotation.TraceContextKey] = c.String()
+	}
 	//TODO(jdef): include TaskInfo.Resources in annotations?
 
 	//TODO(jdef) using anything other than the default k8s host-port mapping may
@@ -242,8 +368,13 @@ func (b *binder) getServiceEnvironmentVariables(ctx api.Context) (result []api.E
 }
 
 type kubeScheduler struct {
-	api        SchedulerInterface
-	podUpdates queue.FIFO
+	api          SchedulerInterface
+	podUpdates   queue.FIFO
+	reservations *reservations  // resources freed by preemption, may be nil
+	gangs        *gangScheduler // may be nil
+	decisions    *decisionLog   // may be nil
+	tracer       *trace.Tracer  // may be nil
+	clock        clock.Clock
 }
 
 // Schedule implements the Scheduler interface of the Kubernetes.
@@ -277,9 +408,8 @@ func (k *kubeScheduler) Schedule(pod api.Pod, unused algorithm.MinionLister) (st
 		}
 		return k.doSchedule(k.api.registerPodTask(k.api.createPodTask(ctx, &pod)))
 	} else {
-		//TODO(jdef) it's possible that the pod state has diverged from what
-		//we knew previously, we should probably update the task.Pod state here
-		//before proceeding with scheduling
+		// changes to the mutable state of the pod are applied to task.Pod by
+		// the updater, see deleter.Run
 
 		switch task, state := k.api.getTask(taskID); state {
 		case podtask.StatePending:
@@ -303,13 +433,67 @@ func (k *kubeScheduler) Schedule(pod api.Pod, unused algorithm.MinionLister) (st
 
 // Call ScheduleFunc and subtract some resources, returning the name of the machine the task is scheduled on
 func (k *kubeScheduler) doSchedule(task *podtask.T, err error) (string, error) {
-	var offer offers.Perishable
-	if err == nil {
-		offer, err = k.api.algorithm()(k.api.offers(), k.api, task)
+	if err != nil {
+		return "", err
+	}
+	if task.Span == nil {
+		// the launch of a task is traced from its first attempt to schedule it
+		task.Span = k.tracer.Start("launch", nil)
+		task.Span.Tag("pod", task.GetPodKey())
+		task.Span.Tag("task", task.ID)
+	}
+	span := task.Span.Child("schedule")
+	defer span.Finish()
+
+	var hostname string
+	if k.gangs != nil {
+		// the members of a pod group are placed together, or not at all
+		hostname, err = k.gangs.place(task, k.placeTask)
+	} else {
+		hostname, err = k.placeTask(task)
+	}
+	if err != nil {
+		span.SetError(err)
+	} else {
+		span.Tag("hostname", hostname)
+	}
+	return hostname, err
+}
+
+// assign an offer to the task, returning the name of the machine that it's on
+func (k *kubeScheduler) placeTask(task *podtask.T) (hostname string, err error) {
+	registry := k.api.offers()
+	if k.reservations != nil {
+		cpus, mem := task.Demand()
+		registry = &reservedOffers{
+			Registry:     registry,
+			reservations: k.reservations,
+			podKey:       task.GetPodKey(),
+			demand:       resources{cpus: cpus, mem: mem},
+			clock:        k.clock,
+		}
+	}
+	walked := &walkedOffers{Registry: registry, record: k.decisions.sample()}
+	start := time.Now()
+	offer, err := k.api.algorithm()(walked, k.api, task)
+	latency := time.Since(start)
+	metrics.ScheduleLatency.WithLabelValues(task.Pod.Namespace).Observe(metrics.InMicroseconds(latency))
+	metrics.OffersWalked.WithLabelValues(task.Pod.Namespace).Observe(float64(walked.walked))
+	if walked.record {
+		var chosen *mesos.Offer
+		if err == nil {
+			chosen = offer.Details()
+		}
+		defer func() {
+			k.decisions.record(k.api, task, walked.details, chosen, err, latency)
+		}()
 	}
 	if err != nil {
 		return "", err
 	}
+	if k.reservations != nil {
+		k.reservations.release(task.GetPodKey())
+	}
 	details := offer.Details()
 	if details == nil {
 		return "", fmt.Errorf("offer already invalid/expired for task %v", task.ID)
@@ -337,12 +521,19 @@ type queuer struct {
 	podQueue        *queue.DelayFIFO // queue of pods to be scheduled
 	deltaCond       sync.Cond        // pod changes are available for processing
 	unscheduledCond sync.Cond        // there are unscheduled pods for processing
+	priorities      PriorityPolicy   // determines the priority class of queued pods
+	namespaces      util.StringSet   // namespaces of queued pods as of the last metrics update
+	clock           clock.Clock      // determines the deadlines of queued pods
 }
 
-func newQueuer(store queue.FIFO) *queuer {
+// pods are popped from the scheduling queue fairly across namespaces according
+// to the given shares, which may be nil.
+func newQueuer(store queue.FIFO, shares queue.ShareFunc, c clock.Clock) *queuer {
 	q := &queuer{
-		podQueue:   queue.NewDelayFIFO(),
+		podQueue:   queue.NewFairDelayFIFOWithClock(shares, c),
 		podUpdates: store,
+		namespaces: util.StringSet{},
+		clock:      c,
 	}
 	q.deltaCond.L = &q.lock
 	q.unscheduledCond.L = &q.lock
@@ -376,19 +567,75 @@ func (q *queuer) dequeue(id string) {
 	q.podQueue.Delete(id)
 }
 
+// assign the priority class that determines the pod's position in the queue
+func (q *queuer) prioritize(pod *Pod) {
+	pod.priority = q.priorities.ClassOf(pod.Pod)
+}
+
+// publish the length of the scheduling queue, by priority class and by namespace
+func (q *queuer) updateMetrics() {
+	counts := map[PriorityClass]int{}
+	for _, c := range PriorityClasses() {
+		counts[c] = 0
+	}
+	depths := map[string]int{}
+	for ns := range q.namespaces {
+		depths[ns] = 0
+	}
+	q.namespaces = util.StringSet{}
+	for _, x := range q.podQueue.List() {
+		pod := x.(*Pod)
+		counts[pod.priority]++
+		depths[pod.Namespace]++
+		q.namespaces.Insert(pod.Namespace)
+	}
+	for c, n := range counts {
+		metrics.QueueLength.WithLabelValues(string(c)).Set(float64(n))
+	}
+	for ns, n := range depths {
+		metrics.NamespaceQueueLength.WithLabelValues(ns).Set(float64(n))
+	}
+}
+
 // re-add a pod to the to-be-scheduled queue, will not overwrite existing pod data (that
 // may have already changed).
 func (q *queuer) requeue(pod *Pod) {
 	// use KeepExisting in case the pod has already been updated (can happen if binding fails
 	// due to constraint voilations); we don't want to overwrite a newer entry with stale data.
+	q.prioritize(pod)
 	q.podQueue.Add(pod, queue.KeepExisting)
 	q.unscheduledCond.Broadcast()
 }
 
+// move a pod to the front of the to-be-scheduled queue, queueing it if it's not
+// already; the queued version of the pod is preferred, it may be more recent.
+func (q *queuer) expedite(pod *Pod) {
+	if x, found := q.podQueue.Get(pod.GetUID()); found {
+		pod = &Pod{Pod: x.(*Pod).Pod}
+	}
+	q.podQueue.Delete(pod.GetUID())
+	now := q.clock.Now()
+	pod.deadline = &now
+	q.reoffer(pod)
+}
+
+// move the pods that are backing off to the front of the to-be-scheduled
+// queue, returning the number of pods moved.
+func (q *queuer) expediteDelayed() (n int) {
+	for _, x := range q.podQueue.List() {
+		if pod := x.(*Pod); pod.delay != nil {
+			q.expedite(pod)
+			n++
+		}
+	}
+	return
+}
+
 // same as requeue but calls podQueue.Offer instead of podQueue.Add
 func (q *queuer) reoffer(pod *Pod) {
 	// use KeepExisting in case the pod has already been updated (can happen if binding fails
 	// due to constraint voilations); we don't want to overwrite a newer entry with stale data.
+	q.prioritize(pod)
 	if q.podQueue.Offer(pod, queue.KeepExisting) {
 		q.unscheduledCond.Broadcast()
 	}
@@ -397,6 +644,7 @@ func (q *queuer) reoffer(pod *Pod) {
 // spawns a go-routine to watch for unscheduled pods and queue them up
 // for scheduling. returns immediately.
 func (q *queuer) Run() {
+	go util.Forever(q.updateMetrics, queueMetricsInterval)
 	go util.Forever(func() {
 		log.Info("Watching for newly created pods")
 		q.lock.Lock()
@@ -425,25 +673,43 @@ func (q *queuer) Run() {
 				continue
 			}
 
-			pod := p.(*Pod)
-			if pod.Status.Host != "" {
-				log.V(3).Infof("dequeuing pod for scheduling: %v", pod.Pod.Name)
-				q.dequeue(pod.GetUID())
-			} else {
-				// use ReplaceExisting because we are always pushing the latest state
-				now := time.Now()
-				pod.deadline = &now
-				if q.podQueue.Offer(pod, queue.ReplaceExisting) {
-					q.unscheduledCond.Broadcast()
-					log.V(3).Infof("queued pod for scheduling: %v", pod.Pod.Name)
-				} else {
-					log.Warningf("failed to queue pod for scheduling: %v", pod.Pod.Name)
-				}
-			}
+			q.enqueue(p.(*Pod))
 		}
 	}, 1*time.Second)
 }
 
+// queue the latest state of an unscheduled pod, or dequeue a pod that's been
+// scheduled. assumes that the caller has acquired the queuer lock.
+func (q *queuer) enqueue(pod *Pod) {
+	if pod.Status.Host != "" {
+		if x, found := q.podQueue.Get(pod.GetUID()); found && isRebinding(x.(*Pod).Pod) {
+			// the apiserver keeps preempted pods bound, see requeuePreempted
+			log.V(3).Infof("pod remains queued for rescheduling: %v", pod.Pod.Name)
+			return
+		}
+		log.V(3).Infof("dequeuing pod for scheduling: %v", pod.Pod.Name)
+		q.dequeue(pod.GetUID())
+	} else {
+		// use ReplaceExisting because we are always pushing the latest state
+		now := q.clock.Now()
+		pod.deadline = &now
+		q.prioritize(pod)
+		if q.podQueue.Offer(pod, queue.ReplaceExisting) {
+			q.unscheduledCond.Broadcast()
+			log.V(3).Infof("queued pod for scheduling: %v", pod.Pod.Name)
+		} else {
+			log.Warningf("failed to queue pod for scheduling: %v", pod.Pod.Name)
+		}
+	}
+}
+
+// returns true if the pod is an unbound copy of a preempted pod that's still
+// bound in the apiserver, see requeuePreempted
+func isRebinding(pod *api.Pod) bool {
+	_, found := pod.Annotations[annotation.BoundHostKey]
+	return found
+}
+
 // implementation of scheduling plugin's NextPod func; see k8s plugin/pkg/scheduler
 func (q *queuer) yield() *api.Pod {
 	log.V(2).Info("attempting to yield a pod")
@@ -478,7 +744,7 @@ func (q *queuer) yield() *api.Pod {
 		pod := kpod.(*Pod).Pod
 		if podName, err := cache.MetaNamespaceKeyFunc(pod); err != nil {
 			log.Warningf("yield unable to understand pod object %+v, will skip: %v", pod, err)
-		} else if !q.podUpdates.Poll(podName, queue.POP_EVENT) {
+		} else if !isRebinding(pod) && !q.podUpdates.Poll(podName, queue.POP_EVENT) {
 			log.V(1).Infof("yield popped a transitioning pod, skipping: %+v", pod)
 		} else if pod.Status.Host != "" {
 			// should never happen if enqueuePods is filtering properly
@@ -490,14 +756,17 @@ func (q *queuer) yield() *api.Pod {
 }
 
 type errorHandler struct {
-	api     SchedulerInterface
-	backoff *podBackoff
-	qr      *queuer
+	api       SchedulerInterface
+	backoff   *podBackoff
+	qr        *queuer
+	preemptor *preemptor // may be nil
+	recorder  *eventRecorder
 }
 
 // implementation of scheduling plugin's Error func; see plugin/pkg/scheduler
 func (k *errorHandler) handleSchedulingError(pod *api.Pod, schedulingErr error) {
 
+	metrics.SchedulingErrors.WithLabelValues(schedulingErrorType(schedulingErr), pod.Namespace).Inc()
 	if schedulingErr == noSuchPodErr {
 		log.V(2).Infof("Not rescheduling non-existent pod %v", pod.Name)
 		return
@@ -514,6 +783,10 @@ func (k *errorHandler) handleSchedulingError(pod *api.Pod, schedulingErr error)
 		return
 	}
 
+	if schedulingErr == noSuitableOffersErr && k.preemptor != nil && k.preemptor.preempt(podKey) {
+		log.Infof("preempted lower priority tasks to make room for pod %v", podKey)
+	}
+
 	k.backoff.gc()
 	k.api.RLocker().Lock()
 	defer k.api.RLocker().Unlock()
@@ -531,6 +804,13 @@ func (k *errorHandler) handleSchedulingError(pod *api.Pod, schedulingErr error)
 			log.V(2).Infof("Skipping re-scheduling for already-launched pod %v", podKey)
 			return
 		}
+		if schedulingErr == noSuitableOffersErr {
+			k.recorder.EventFunc(pod, failedSchedulingEvent, func() string {
+				return fmt.Sprintf("%v: %v", schedulingErr, explainDeclines(k.api.offers(), k.api, task))
+			})
+		} else {
+			k.recorder.Eventf(pod, failedSchedulingEvent, "%v", schedulingErr)
+		}
 		breakoutEarly := queue.BreakChan(nil)
 		if schedulingErr == noSuitableOffersErr {
 			log.V(3).Infof("adding backoff breakout handler for pod %v", podKey)
@@ -546,21 +826,44 @@ func (k *errorHandler) handleSchedulingError(pod *api.Pod, schedulingErr error)
 				}
 			}))
 		}
-		delay := k.backoff.getBackoff(podKey)
+		delay := k.backoff.getBackoff(podKey, pod)
 		log.V(3).Infof("requeuing pod %v with delay %v", podKey, delay)
+		k.recorder.Eventf(pod, backoffEvent, "Back-off %v before retrying to schedule the pod", delay)
 		k.qr.requeue(&Pod{Pod: pod, delay: &delay, notify: breakoutEarly})
 	default:
 		log.V(2).Infof("Task is no longer pending, aborting reschedule for pod %v", podKey)
 	}
 }
 
+// reset the backoff of all pods when the supply of offered resources grows
+// significantly, since pods that were backing off are then likely to fit.
+func (k *errorHandler) resetBackoffUponSupply() {
+	monitor := &supplyMonitor{threshold: offerSupplyThreshold}
+	util.Forever(func() {
+		if monitor.observe(totalOffered(k.api.offers())) {
+			log.V(1).Infoln("supply of offered resources has grown, resetting pod backoff")
+			k.resetBackoff()
+		}
+	}, offerSupplyInterval)
+}
+
+// forget the backoff of all pods, and stop delaying those that are queued;
+// otherwise they'd wait out their current backoff before trying the offers.
+func (k *errorHandler) resetBackoff() {
+	k.backoff.reset()
+	if n := k.qr.expediteDelayed(); n > 0 {
+		log.V(2).Infof("expedited %d pod(s) that were backing off", n)
+	}
+}
+
 type deleter struct {
-	api SchedulerInterface
-	qr  *queuer
+	api     SchedulerInterface
+	qr      *queuer
+	updater *updater // may be nil
 }
 
 // currently monitors for "pod deleted" events, upon which handle()
-// is invoked.
+// is invoked. "pod updated" events are handed to the updater.
 func (k *deleter) Run(updates <-chan queue.Entry) {
 	go util.Forever(func() {
 		for {
@@ -572,6 +875,11 @@ func (k *deleter) Run(updates <-chan queue.Entry) {
 				}
 			} else if !entry.Is(queue.POP_EVENT) {
 				k.qr.updatesAvailable()
+				if entry.Is(queue.UPDATE_EVENT) && k.updater != nil {
+					if err := k.updater.updateOne(pod); err != nil {
+						log.Error(err)
+					}
+				}
 			}
 		}
 	}, 1*time.Second)
@@ -615,6 +923,7 @@ func (k *deleter) deleteOne(pod *Pod) error {
 				task.Offer.Release()
 				task.ClearTaskInfo()
 			}
+			abandonLaunchTrace(task, podDeletedErr)
 			k.api.unregisterPodTask(task)
 			return nil
 		}
@@ -622,7 +931,7 @@ func (k *deleter) deleteOne(pod *Pod) error {
 	case podtask.StateRunning:
 		// signal to watchers that the related pod is going down
 		task.Set(podtask.Deleted)
-		return k.api.killTask(taskId)
+		return k.api.killTask(taskId, killReasonDeleted)
 	default:
 		log.Infof("cannot kill pod '%s': task not found %v", podKey, taskId)
 		return noSuchTaskErr
@@ -634,48 +943,82 @@ func (k *KubernetesScheduler) NewPluginConfig(startLatch <-chan struct{}) *Plugi
 
 	// Watch and queue pods that need scheduling.
 	updates := make(chan queue.Entry, defaultUpdatesBacklog)
-	podUpdates := &podStoreAdapter{queue.NewHistorical(updates)}
+	podUpdates := &podStoreAdapter{queue.NewHistoricalWithClock(updates, k.clock)}
 	reflector := cache.NewReflector(createAllPodsLW(k.client), &api.Pod{}, podUpdates)
 
 	// lock that guards critial sections that involve transferring pods from
 	// the store (cache) to the scheduling queue; its purpose is to maintain
 	// an ordering (vs interleaving) of operations that's easier to reason about.
 	kapi := &k8smScheduler{k}
-	q := newQueuer(podUpdates)
+	q := newQueuer(podUpdates, kapi.namespaceShares, k.clock)
+	q.priorities = k.priorities
+	if k.aging > 0 {
+		q.podQueue.SetAging(k.aging)
+	}
+	reserved := newReservations()
+	gangs := newGangScheduler(kapi, func(pod *api.Pod) {
+		q.expedite(&Pod{Pod: pod})
+	}, k.clock)
+	recorder := newEventRecorder(record.FromSource(api.EventSource{Component: "scheduler"}), k.clock)
 	podDeleter := &deleter{
 		api: kapi,
 		qr:  q,
+		updater: &updater{
+			api:      kapi,
+			recorder: recorder,
+		},
 	}
+	backoff := newPodBackoff(k.backoff, k.clock)
 	eh := &errorHandler{
-		api: kapi,
-		backoff: &podBackoff{
-			perPodBackoff:   map[string]*backoffEntry{},
-			clock:           realClock{},
-			defaultDuration: 1 * time.Second,
-			maxDuration:     60 * time.Second,
+		api:     kapi,
+		backoff: backoff,
+		qr:      q,
+		preemptor: &preemptor{
+			api:          kapi,
+			reservations: reserved,
+			recorder:     recorder,
+			clock:        k.clock,
 		},
-		qr: q,
+		recorder: recorder,
 	}
 	go func() {
 		select {
 		case <-startLatch:
+			go eh.resetBackoffUponSupply()
+			go util.Forever(func() {
+				kapi.Lock()
+				defer kapi.Unlock()
+				gangs.gc(k.clock.Now())
+			}, gangGcInterval)
+			go util.Forever(func() { updateMetrics(kapi) }, metricsUpdateInterval)
+			if interval := k.orphans.config.Interval; interval > 0 {
+				go util.Forever(k.orphans.run, interval)
+			}
 			reflector.Run()
 			podDeleter.Run(updates)
 			q.Run()
 		}
 	}()
 	q.installDebugHandlers()
+	q.installAPIHandlers(kapi, k.orphans)
 	podtask.InstallDebugHandlers(k.RLocker(), k.taskRegistry)
 	return &PluginConfig{
 		Config: &plugin.Config{
 			MinionLister: nil,
 			Algorithm: &kubeScheduler{
-				api:        kapi,
-				podUpdates: podUpdates,
+				api:          kapi,
+				podUpdates:   podUpdates,
+				reservations: reserved,
+				gangs:        gangs,
+				decisions:    newDecisionLog(k.decisions, backoff.attempts, k.clock),
+				tracer:       k.tracer,
+				clock:        k.clock,
 			},
 			Binder: &binder{
-				api:    kapi,
-				client: k.client,
+				api:      kapi,
+				client:   k.client,
+				gangs:    gangs,
+				recorder: recorder,
 			},
 			NextPod: q.yield,
 			Error:   eh.handleSchedulingError,
@@ -721,9 +1064,7 @@ type schedulingPlugin struct {
 //      host=""    |  host=""       ; perhaps no updates to process?
 //      host=""    |  host="..."    ; pod has been scheduled and assigned, is there a task assigned? (check TaskIdKey in binding?)
 //      host="..." |  host=""       ; pod is no longer scheduled, does it need to be re-queued?
-//      host="..." |  host="..."    ; perhaps no updates to process?
-//
-// TODO(jdef) this needs an integration test
+//      host="..." |  host="..."    ; nothing to do, the deleter pushes updates of the pod to the executor
 func (s *schedulingPlugin) reconcilePod(oldPod api.Pod) {
 	log.V(1).Infof("reconcile pod %v", oldPod.Name)
 	ctx := api.WithNamespace(api.NewDefaultContext(), oldPod.Namespace)
@@ -762,7 +1103,7 @@ func (s *schedulingPlugin) reconcilePod(oldPod api.Pod) {
 				return
 			}
 
-			now := time.Now()
+			now := s.qr.clock.Now()
 			log.V(3).Infof("reoffering pod %v", podKey)
 			s.qr.reoffer(&Pod{
 				Pod:      pod,
@@ -776,12 +1117,60 @@ func (s *schedulingPlugin) reconcilePod(oldPod api.Pod) {
 			log.Errorf("pod already scheduled: %v", pod.Name)
 		}
 	} else {
-		//TODO(jdef) for now, ignore the fact that the rest of the spec may be different
-		//and assume that our knowledge of the pod aligns with that of the apiserver
-		log.Error("pod reconciliation does not support updates; not yet implemented")
+		// changes to the mutable state of the pod arrive via the pod watch and
+		// are pushed to the executor by the deleter, see deleter.Run
+		log.V(2).Infof("pod %v is still bound to %v, nothing to reconcile", pod.Name, pod.Status.Host)
 	}
 }
 
+// the apiserver refuses to bind a pod that's already bound, and won't unbind
+// one. deleting and recreating a preempted (or drained) pod would lose its UID
+// and status, and race its replication controller, so instead an unbound copy
+// of the pod is queued for scheduling right away. the copy is annotated with
+// the host that the apiserver still binds the pod to, which tells the executor
+// not to post a binding for the task that's launched for it.
+func (s *schedulingPlugin) requeuePreempted(oldPod api.Pod) {
+	ctx := api.WithNamespace(api.NewDefaultContext(), oldPod.Namespace)
+	podKey, err := podtask.MakePodKey(ctx, oldPod.Name)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	if func() bool {
+		s.api.RLocker().Lock()
+		defer s.api.RLocker().Unlock()
+		_, exists := s.api.taskForPod(podKey)
+		return exists
+	}() {
+		log.V(2).Infof("not requeuing preempted pod %v, a task is already registered", podKey)
+		return
+	}
+
+	pod, err := s.client.Pods(api.NamespaceValue(ctx)).Get(oldPod.Name)
+	if errors.IsNotFound(err) || (err == nil && pod.UID != oldPod.UID) {
+		log.V(2).Infof("not requeuing preempted pod %v, it has been deleted or replaced", podKey)
+		return
+	} else if err != nil {
+		log.Errorf("failed to requeue preempted pod %v: %v", podKey, err)
+		return
+	}
+
+	unbound := *pod
+	if pod.Status.Host != "" {
+		unbound.Annotations = make(map[string]string, len(pod.Annotations)+1)
+		for k, v := range pod.Annotations {
+			unbound.Annotations[k] = v
+		}
+		unbound.Annotations[annotation.BoundHostKey] = pod.Status.Host
+		unbound.Status.Host = ""
+	}
+
+	now := s.qr.clock.Now()
+	s.qr.reoffer(&Pod{Pod: &unbound, deadline: &now})
+	log.V(3).Infof("requeued preempted pod %v for rescheduling", podKey)
+}
+
 type listWatch struct {
 	client        *client.Client
 	fieldSelector labels.Selector
@@ -1,11 +1,20 @@
 package scheduler
 
 import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api/latest"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/runtime"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
 	"github.com/mesosphere/kubernetes-mesos/pkg/queue"
+	annotation "github.com/mesosphere/kubernetes-mesos/pkg/scheduler/meta"
 	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+	"github.com/mesosphere/kubernetes-mesos/pkg/trace"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -13,7 +22,7 @@ func TestDeleteOne_NonexistentPod(t *testing.T) {
 	assert := assert.New(t)
 	obj := &MockScheduler{}
 	obj.On("taskForPod", "/pods/default/foo").Return("", false)
-	qr := newQueuer(nil)
+	qr := newQueuer(nil, nil, clock.RealClock{})
 	assert.Equal(0, len(qr.podQueue.List()))
 	d := &deleter{
 		api: obj,
@@ -40,6 +49,8 @@ func TestDeleteOne_PendingPod(t *testing.T) {
 			Namespace: api.NamespaceDefault,
 		}}}
 	task := &podtask.T{ID: "bar", Pod: pod.Pod}
+	spans := &bytes.Buffer{}
+	task.Span = trace.New("scheduler", trace.NewFileExporter(spans)).Start("launch", nil)
 
 	// set expectations
 	obj.On("taskForPod", podKey).Return(task.ID, true)
@@ -47,7 +58,7 @@ func TestDeleteOne_PendingPod(t *testing.T) {
 	obj.On("unregisterPodTask", task).Return()
 
 	// preconditions
-	qr := newQueuer(nil)
+	qr := newQueuer(nil, nil, clock.RealClock{})
 	qr.podQueue.Add(pod, queue.ReplaceExisting)
 	assert.Equal(1, len(qr.podQueue.List()))
 	_, found := qr.podQueue.Get("default/foo")
@@ -63,6 +74,10 @@ func TestDeleteOne_PendingPod(t *testing.T) {
 	_, found = qr.podQueue.Get("foo0")
 	assert.False(found)
 	assert.Equal(0, len(qr.podQueue.List()))
+
+	// the trace of the abandoned launch is exported
+	assert.Nil(task.Span)
+	assert.Contains(spans.String(), podDeletedErr.Error())
 	obj.AssertExpectations(t)
 }
 
@@ -83,10 +98,10 @@ func TestDeleteOne_Running(t *testing.T) {
 	// set expectations
 	obj.On("taskForPod", podKey).Return(task.ID, true)
 	obj.On("getTask", task.ID).Return(task, podtask.StatePending)
-	obj.On("killTask", task.ID).Return(nil)
+	obj.On("killTask", task.ID, killReasonDeleted).Return(nil)
 
 	// preconditions
-	qr := newQueuer(nil)
+	qr := newQueuer(nil, nil, clock.RealClock{})
 	qr.podQueue.Add(pod, queue.ReplaceExisting)
 	assert.Equal(1, len(qr.podQueue.List()))
 	_, found := qr.podQueue.Get("default/foo")
@@ -125,7 +140,7 @@ func TestDeleteOne_Unknown(t *testing.T) {
 	// exec & post conditions
 	d := &deleter{
 		api: obj,
-		qr:  newQueuer(nil),
+		qr:  newQueuer(nil, nil, clock.RealClock{}),
 	}
 	err := d.deleteOne(pod)
 	assert.Equal(err, noSuchTaskErr)
@@ -139,7 +154,7 @@ func TestDeleteOne_badPodNaming(t *testing.T) {
 	pod := &Pod{Pod: &api.Pod{}}
 	d := &deleter{
 		api: obj,
-		qr:  newQueuer(nil),
+		qr:  newQueuer(nil, nil, clock.RealClock{}),
 	}
 
 	err := d.deleteOne(pod)
@@ -156,3 +171,54 @@ func TestDeleteOne_badPodNaming(t *testing.T) {
 
 	obj.AssertExpectations(t)
 }
+
+func TestRequeuePreempted(t *testing.T) {
+	assert := assert.New(t)
+	pod := &api.Pod{
+		ObjectMeta: api.ObjectMeta{
+			Name:        "foo",
+			Namespace:   api.NamespaceDefault,
+			UID:         "foo-uid",
+			Annotations: map[string]string{"bar": "baz"},
+		},
+		Status: api.PodStatus{Host: "host1"},
+	}
+	methods := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods <- r.Method
+		w.Write([]byte(runtime.EncodeOrDie(latest.Codec, pod)))
+	}))
+	defer srv.Close()
+
+	obj := &MockScheduler{}
+	obj.On("taskForPod", "/pods/default/foo").Return("", false)
+	qr := newQueuer(nil, nil, clock.RealClock{})
+	s := &schedulingPlugin{
+		api:    obj,
+		client: client.NewOrDie(&client.Config{Host: srv.URL, Version: latest.Version}),
+		qr:     qr,
+	}
+
+	oldPod := *pod
+	s.requeuePreempted(oldPod)
+	obj.AssertExpectations(t)
+
+	// the pod is queued locally, the apiserver's copy is left alone
+	assert.Equal("GET", <-methods)
+	assert.Equal(0, len(methods))
+	x, found := qr.podQueue.Get("default/foo")
+	if !assert.True(found) {
+		return
+	}
+	queued := x.(*Pod).Pod
+	assert.Equal(pod.UID, queued.UID)
+	assert.Equal("", queued.Status.Host)
+	assert.Equal("host1", queued.Annotations[annotation.BoundHostKey])
+	assert.Equal("baz", queued.Annotations["bar"])
+	assert.True(isRebinding(queued))
+
+	// updates of the pod, still bound in the apiserver, don't dequeue it
+	qr.enqueue(&Pod{Pod: pod})
+	_, found = qr.podQueue.Get("default/foo")
+	assert.True(found)
+}
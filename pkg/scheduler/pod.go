@@ -15,6 +15,7 @@ type Pod struct {
 	deadline *time.Time
 	delay    *time.Duration
 	notify   queue.BreakChan
+	priority PriorityClass
 }
 
 // implements Copyable
@@ -55,10 +56,20 @@ func (p *Pod) Breaker() queue.BreakChan {
 	return p.notify
 }
 
+// implements Prioritized
+func (p *Pod) GetPriority() int {
+	return p.priority.Rank()
+}
+
+// implements Grouped, pods are scheduled fairly across namespaces
+func (p *Pod) GetGroup() string {
+	return p.Namespace
+}
+
 func (p *Pod) String() string {
 	displayDeadline := "<none>"
 	if deadline, ok := p.Deadline(); ok {
 		displayDeadline = deadline.String()
 	}
-	return fmt.Sprintf("{pod:%v, deadline:%v, delay:%v}", p.Pod.Name, displayDeadline, p.GetDelay())
+	return fmt.Sprintf("{pod:%v, deadline:%v, delay:%v, priority:%v}", p.Pod.Name, displayDeadline, p.GetDelay(), p.priority)
 }
@@ -9,8 +9,10 @@ import (
 	log "github.com/golang/glog"
 	mesos "github.com/mesos/mesos-go/mesosproto"
 	mutil "github.com/mesos/mesos-go/mesosutil"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
 	"github.com/mesosphere/kubernetes-mesos/pkg/offers"
 	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/metrics"
+	"github.com/mesosphere/kubernetes-mesos/pkg/trace"
 )
 
 const (
@@ -27,12 +29,36 @@ const (
 	StateUnknown
 )
 
+func (s StateType) String() string {
+	switch s {
+	case StatePending:
+		return "pending"
+	case StateRunning:
+		return "running"
+	case StateFinished:
+		return "finished"
+	}
+	return "unknown"
+}
+
+// parses the name of a state, as returned by String
+func ParseState(name string) (StateType, error) {
+	for _, s := range []StateType{StatePending, StateRunning, StateFinished, StateUnknown} {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+	return StateUnknown, fmt.Errorf("unknown task state %q", name)
+}
+
 type FlagType string
 
 const (
-	Launched = FlagType("launched")
-	Bound    = FlagType("bound")
-	Deleted  = FlagType("deleted")
+	Launched  = FlagType("launched")
+	Bound     = FlagType("bound")
+	Deleted   = FlagType("deleted")
+	Preempted = FlagType("preempted") // killed to make room for a pod of higher priority
+	Drained   = FlagType("drained")   // killed because its slave is being drained
 )
 
 // A struct that describes a pod task.
@@ -46,7 +72,10 @@ type T struct {
 	Flags       map[FlagType]struct{}
 	podKey      string
 	CreateTime  time.Time
-	UpdatedTime time.Time // time of the most recent StatusUpdate we've seen from the mesos master
+	UpdatedTime time.Time          // time of the most recent StatusUpdate we've seen from the mesos master
+	Usage       *messages.PodUsage // most recent resource usage reported by the executor
+	Priority    string             // priority class of the pod
+	Span        *trace.Span        // traces the launch of the task, nil if tracing is disabled
 	launchTime  time.Time
 	bindTime    time.Time
 	mapper      HostPortMappingFunc
@@ -65,6 +94,10 @@ func (t *T) GetOfferId() string {
 
 // Fill the TaskInfo in the T, should be called during k8s scheduling,
 // before binding.
+func (t *T) GetPodKey() string {
+	return t.podKey
+}
+
 func (t *T) FillFromDetails(details *mesos.Offer) error {
 	if details == nil {
 		//programming error
@@ -108,9 +141,19 @@ func (t *T) ClearTaskInfo() {
 }
 
 func (t *T) AcceptOffer(offer *mesos.Offer) bool {
-	if offer == nil {
+	if err := t.CheckOffer(offer); err != nil {
+		log.V(3).Info(err)
 		return false
 	}
+	return true
+}
+
+// returns an error that describes why the offer can't support the task, or
+// nil if it can.
+func (t *T) CheckOffer(offer *mesos.Offer) error {
+	if offer == nil {
+		return fmt.Errorf("nil offer for task %v", t.ID)
+	}
 	var (
 		cpus float64 = 0
 		mem  float64 = 0
@@ -125,14 +168,43 @@ func (t *T) AcceptOffer(offer *mesos.Offer) bool {
 		}
 	}
 	if _, err := t.mapper(t, offer); err != nil {
-		log.V(3).Info(err)
-		return false
+		return err
 	}
 	if (cpus < containerCpus) || (mem < containerMem) {
-		log.V(3).Infof("not enough resources: cpus: %f mem: %f", cpus, mem)
+		return &InsufficientResourcesError{Cpus: cpus, Mem: mem}
+	}
+	return nil
+}
+
+// returns the cpu and mem resources allotted to this task by its TaskInfo
+func (t *T) Allotment() (cpus, mem float64) {
+	if t.TaskInfo == nil {
+		return
+	}
+	for _, resource := range t.TaskInfo.Resources {
+		switch resource.GetName() {
+		case "cpus":
+			cpus += resource.GetScalar().GetValue()
+		case "mem":
+			mem += resource.GetScalar().GetValue()
+		}
+	}
+	return
+}
+
+// returns the cpu and mem resources that an offer must provide in order to
+// launch this task
+func (t *T) Demand() (cpus, mem float64) {
+	return containerCpus, containerMem
+}
+
+// returns true if the most recently reported usage of the task exceeds its allotment
+func (t *T) Overrun() bool {
+	if t.Usage == nil {
 		return false
 	}
-	return true
+	cpus, mem := t.Allotment()
+	return t.Usage.Cpus > cpus || t.Usage.Mem > mem
 }
 
 func (t *T) Set(f FlagType) {
@@ -140,7 +212,7 @@ func (t *T) Set(f FlagType) {
 	if Launched == f {
 		t.launchTime = time.Now()
 		queueWaitTime := t.launchTime.Sub(t.CreateTime)
-		metrics.QueueWaitTime.Observe(metrics.InMicroseconds(queueWaitTime))
+		metrics.QueueWaitTime.WithLabelValues(t.Priority).Observe(metrics.InMicroseconds(queueWaitTime))
 	}
 }
 
@@ -149,6 +221,18 @@ func (t *T) Has(f FlagType) (exists bool) {
 	return
 }
 
+// returns the time at which the task was launched, or the zero time if it
+// hasn't been yet
+func (t *T) LaunchTime() time.Time {
+	return t.launchTime
+}
+
+// returns the time at which the pod of the task was bound, or the zero time
+// if it hasn't been yet
+func (t *T) BindTime() time.Time {
+	return t.bindTime
+}
+
 // create a duplicate task, one that refers to the same pod specification and
 // executor as the current task. all other state is reset to "factory settings"
 // (as if returned from New())
@@ -201,6 +285,14 @@ func (err *PortAllocationError) Error() string {
 	return fmt.Sprintf("Could not schedule pod %s: %d port(s) could not be allocated", err.PodId, len(err.Ports))
 }
 
+type InsufficientResourcesError struct {
+	Cpus, Mem float64 // offered resources
+}
+
+func (err *InsufficientResourcesError) Error() string {
+	return fmt.Sprintf("not enough resources: cpus: %f mem: %f", err.Cpus, err.Mem)
+}
+
 type DuplicateHostPortError struct {
 	m1, m2 HostPortMapping
 }
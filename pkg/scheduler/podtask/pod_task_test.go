@@ -6,6 +6,7 @@ import (
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
 	mesos "github.com/mesos/mesos-go/mesosproto"
 	mutil "github.com/mesos/mesos-go/mesosutil"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
 )
 
 const (
@@ -154,3 +155,38 @@ func TestAcceptOfferPorts(t *testing.T) {
 		t.Fatalf("accepted offer %v:", offer)
 	}
 }
+
+func TestOverrun(t *testing.T) {
+	t.Parallel()
+	task, _ := fakePodTask("foo")
+	if task.Overrun() {
+		t.Fatalf("task without usage should not overrun")
+	}
+	task.TaskInfo.Resources = []*mesos.Resource{
+		mutil.NewScalarResource("cpus", containerCpus),
+		mutil.NewScalarResource("mem", containerMem),
+	}
+	if cpus, mem := task.Allotment(); cpus != containerCpus || mem != containerMem {
+		t.Fatalf("unexpected allotment cpus=%v mem=%v", cpus, mem)
+	}
+	task.Usage = &messages.PodUsage{Cpus: containerCpus / 2, Mem: containerMem / 2}
+	if task.Overrun() {
+		t.Fatalf("task within its allotment should not overrun")
+	}
+	task.Usage.Mem = containerMem * 2
+	if !task.Overrun() {
+		t.Fatalf("expected task to overrun its memory allotment")
+	}
+}
+
+func TestParseState(t *testing.T) {
+	t.Parallel()
+	for _, s := range []StateType{StatePending, StateRunning, StateFinished, StateUnknown} {
+		if parsed, err := ParseState(s.String()); err != nil || parsed != s {
+			t.Fatalf("failed to parse %v: %v, %v", s, parsed, err)
+		}
+	}
+	if _, err := ParseState("lost"); err == nil {
+		t.Fatalf("expected an error for an unknown state")
+	}
+}
@@ -5,10 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
-	"time"
 
 	log "github.com/golang/glog"
 	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
 	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/metrics"
 )
 
@@ -39,13 +39,19 @@ type inMemoryRegistry struct {
 	taskRegistry  map[string]*T
 	tasksFinished *ring.Ring
 	podToTask     map[string]string
+	clock         clock.Clock // timestamps status updates, see T.UpdatedTime
 }
 
 func NewInMemoryRegistry() Registry {
+	return NewInMemoryRegistryWithClock(clock.RealClock{})
+}
+
+func NewInMemoryRegistryWithClock(c clock.Clock) Registry {
 	return &inMemoryRegistry{
 		taskRegistry:  make(map[string]*T),
 		tasksFinished: ring.New(defaultFinishedTasksSize),
 		podToTask:     make(map[string]string),
+		clock:         c,
 	}
 }
 
@@ -138,7 +144,7 @@ func (k *inMemoryRegistry) handleTaskStarting(task *T, state StateType, status *
 	// here.
 	switch state {
 	case StatePending:
-		task.UpdatedTime = time.Now()
+		task.UpdatedTime = k.clock.Now()
 		if !task.Has(Bound) {
 			task.Set(Bound)
 			task.bindTime = task.UpdatedTime
@@ -153,12 +159,12 @@ func (k *inMemoryRegistry) handleTaskStarting(task *T, state StateType, status *
 func (k *inMemoryRegistry) handleTaskRunning(task *T, state StateType, status *mesos.TaskStatus) {
 	switch state {
 	case StatePending:
-		task.UpdatedTime = time.Now()
+		task.UpdatedTime = k.clock.Now()
 		log.Infof("Received running status for pending task: %+v", status)
 		fillRunningPodInfo(task, status)
 		task.State = StateRunning
 	case StateRunning:
-		task.UpdatedTime = time.Now()
+		task.UpdatedTime = k.clock.Now()
 		log.V(2).Info("Ignore status TASK_RUNNING because the the task is already running")
 	case StateFinished:
 		log.Warningf("Ignore status TASK_RUNNING because the the task is already finished")
@@ -185,7 +191,7 @@ func (k *inMemoryRegistry) handleTaskFinished(task *T, state StateType, status *
 		log.V(2).Infof("received finished status for running task: %+v", status)
 		delete(k.podToTask, task.podKey)
 		task.State = StateFinished
-		task.UpdatedTime = time.Now()
+		task.UpdatedTime = k.clock.Now()
 		k.tasksFinished = k.recordFinishedTask(task.ID)
 	case StateFinished:
 		log.Warningf("Ignore status TASK_FINISHED because the the task is already finished")
@@ -225,7 +231,7 @@ func (k *inMemoryRegistry) handleTaskFailed(task *T, state StateType, status *me
 func (k *inMemoryRegistry) handleTaskKilled(task *T, state StateType, status *mesos.TaskStatus) {
 	defer func() {
 		msg := fmt.Sprintf("task killed: %+v, task %+v", status, task)
-		if task != nil && task.Has(Deleted) {
+		if task != nil && (task.Has(Deleted) || task.Has(Preempted) || task.Has(Drained)) {
 			// we were expecting this, nothing out of the ordinary
 			log.V(2).Infoln(msg)
 		} else {
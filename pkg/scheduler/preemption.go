@@ -0,0 +1,358 @@
+package scheduler
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
+	"github.com/mesosphere/kubernetes-mesos/pkg/offers"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+)
+
+const (
+	preemptionReservationTTL = 1 * time.Minute // how long freed resources are held for the preempting pod
+	preemptionWindow         = 1 * time.Minute // preemptions are rate limited over this sliding window
+	preemptionBurst          = 5               // max number of preemptions within the window
+)
+
+// cpu and memory resources, either offered by or allotted on a slave
+type resources struct {
+	cpus float64
+	mem  float64
+}
+
+func (r resources) add(o resources) resources {
+	return resources{cpus: r.cpus + o.cpus, mem: r.mem + o.mem}
+}
+
+func (r resources) sub(o resources) resources {
+	return resources{cpus: r.cpus - o.cpus, mem: r.mem - o.mem}
+}
+
+func (r resources) covers(o resources) bool {
+	return r.cpus >= o.cpus && r.mem >= o.mem
+}
+
+// a running task that may be killed to make room for a pod of higher priority
+type preemptionCandidate struct {
+	taskId    string
+	slaveId   string
+	rank      int // priority rank of the task's pod
+	allotment resources
+}
+
+// returns the slave, along with the smallest set of its tasks, whose preemption
+// frees enough resources to satisfy demand. only candidates of lower rank than
+// the preempting pod are eligible. slaves that require fewer victims are
+// preferred, then those whose victims have the lowest priorities. returns "" if
+// preemption can't help.
+//
+// resources that a slave already offers aren't taken into account: mesos offers
+// the resources of killed tasks anew, and the scheduler launches a task from a
+// single offer.
+func selectVictims(demand resources, rank int, candidates []preemptionCandidate) (string, []preemptionCandidate) {
+	bySlave := map[string][]preemptionCandidate{}
+	for _, c := range candidates {
+		if c.rank < rank {
+			bySlave[c.slaveId] = append(bySlave[c.slaveId], c)
+		}
+	}
+
+	var (
+		bestSlave   string
+		bestVictims []preemptionCandidate
+	)
+	for slaveId, eligible := range bySlave {
+		victims := victimsOnSlave(demand, eligible)
+		if len(victims) == 0 {
+			continue
+		}
+		if bestVictims == nil || betterVictims(victims, bestVictims) ||
+			(!betterVictims(bestVictims, victims) && slaveId < bestSlave) {
+			bestSlave, bestVictims = slaveId, victims
+		}
+	}
+	return bestSlave, bestVictims
+}
+
+// returns an irreducible set of the eligible tasks whose preemption frees enough
+// resources to satisfy demand, or else nil. tasks of the lowest priority, and
+// then the largest tasks, are chosen first.
+func victimsOnSlave(demand resources, eligible []preemptionCandidate) []preemptionCandidate {
+	sorted := append([]preemptionCandidate(nil), eligible...)
+	sort.Sort(byPreemptionOrder(sorted))
+
+	victims := []preemptionCandidate{}
+	freed := resources{}
+	for _, c := range sorted {
+		victims = append(victims, c)
+		if freed = freed.add(c.allotment); freed.covers(demand) {
+			break
+		}
+	}
+	if !freed.covers(demand) {
+		return nil
+	}
+	// spare the victims that aren't needed after all, most important first
+	for i := len(victims) - 1; i >= 0; i-- {
+		if freed.sub(victims[i].allotment).covers(demand) {
+			freed = freed.sub(victims[i].allotment)
+			victims = append(victims[:i], victims[i+1:]...)
+		}
+	}
+	return victims
+}
+
+// returns true if the victims in a are a better choice than those in b
+func betterVictims(a, b []preemptionCandidate) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return totalRank(a) < totalRank(b)
+}
+
+func totalRank(victims []preemptionCandidate) (total int) {
+	for _, v := range victims {
+		total += v.rank
+	}
+	return
+}
+
+// orders candidates by ascending priority, then by descending size
+type byPreemptionOrder []preemptionCandidate
+
+func (s byPreemptionOrder) Len() int      { return len(s) }
+func (s byPreemptionOrder) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byPreemptionOrder) Less(i, j int) bool {
+	if s[i].rank != s[j].rank {
+		return s[i].rank < s[j].rank
+	}
+	if s[i].allotment.cpus != s[j].allotment.cpus {
+		return s[i].allotment.cpus > s[j].allotment.cpus
+	}
+	if s[i].allotment.mem != s[j].allotment.mem {
+		return s[i].allotment.mem > s[j].allotment.mem
+	}
+	return s[i].taskId < s[j].taskId
+}
+
+// resources freed by preemption on a slave, held for the preempting pod
+type reservation struct {
+	podKey    string
+	resources resources
+	expires   time.Time
+}
+
+// tracks reservations by slave and rate limits the preemptions that create them
+type reservations struct {
+	lock       sync.Mutex
+	bySlave    map[string]*reservation
+	recent     []time.Time // times of recent preemptions, oldest first
+	window     time.Duration
+	burst      int
+	defaultTTL time.Duration
+}
+
+func newReservations() *reservations {
+	return &reservations{
+		bySlave:    map[string]*reservation{},
+		window:     preemptionWindow,
+		burst:      preemptionBurst,
+		defaultTTL: preemptionReservationTTL,
+	}
+}
+
+// returns true, and records a preemption, if another preemption is permitted
+// by the rate limit.
+func (r *reservations) allowPreemption(now time.Time) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	cutoff := now.Add(-r.window)
+	for len(r.recent) > 0 && !r.recent[0].After(cutoff) {
+		r.recent = r.recent[1:]
+	}
+	if len(r.recent) >= r.burst {
+		return false
+	}
+	r.recent = append(r.recent, now)
+	return true
+}
+
+func (r *reservations) reserve(slaveId, podKey string, res resources, now time.Time) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.bySlave[slaveId] = &reservation{
+		podKey:    podKey,
+		resources: res,
+		expires:   now.Add(r.defaultTTL),
+	}
+}
+
+// release any reservation held for the pod
+func (r *reservations) release(podKey string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for slaveId, res := range r.bySlave {
+		if res.podKey == podKey {
+			delete(r.bySlave, slaveId)
+		}
+	}
+}
+
+// returns true if an unexpired reservation is held for the pod
+func (r *reservations) holds(podKey string, now time.Time) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for slaveId, res := range r.bySlave {
+		if now.After(res.expires) {
+			delete(r.bySlave, slaveId)
+		} else if res.podKey == podKey {
+			return true
+		}
+	}
+	return false
+}
+
+// returns true if the pod may consume an offer of the given resources from the
+// slave without encroaching upon resources reserved for some other pod.
+func (r *reservations) admits(slaveId, podKey string, offered, demand resources, now time.Time) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	res, found := r.bySlave[slaveId]
+	if !found || res.podKey == podKey {
+		return true
+	}
+	if now.After(res.expires) {
+		delete(r.bySlave, slaveId)
+		return true
+	}
+	return offered.sub(res.resources).covers(demand)
+}
+
+// kills running tasks of lower priority to make room for pods that don't fit
+// any of the current offers.
+type preemptor struct {
+	api          SchedulerInterface
+	reservations *reservations
+	recorder     *eventRecorder
+	clock        clock.Clock
+}
+
+// attempt to free resources for the pending task of the pod. returns true if
+// tasks were killed on its behalf.
+func (p *preemptor) preempt(podKey string) bool {
+	p.api.Lock()
+	defer p.api.Unlock()
+
+	taskId, exists := p.api.taskForPod(podKey)
+	if !exists {
+		return false
+	}
+	task, state := p.api.getTask(taskId)
+	if state != podtask.StatePending || task.Has(podtask.Launched) {
+		return false
+	}
+	now := p.clock.Now()
+	if p.reservations.holds(podKey, now) {
+		// we've already made room, wait for the victims' resources to be offered
+		return false
+	}
+
+	running := p.api.listTasks(podtask.StateRunning)
+	candidates := make([]preemptionCandidate, 0, len(running))
+	for _, t := range running {
+		if t.Has(podtask.Deleted) || t.Has(podtask.Preempted) || t.TaskInfo == nil {
+			continue
+		}
+		cpus, mem := t.Allotment()
+		candidates = append(candidates, preemptionCandidate{
+			taskId:    t.ID,
+			slaveId:   t.TaskInfo.GetSlaveId().GetValue(),
+			rank:      PriorityClass(t.Priority).Rank(),
+			allotment: resources{cpus: cpus, mem: mem},
+		})
+	}
+
+	cpus, mem := task.Demand()
+	demand := resources{cpus: cpus, mem: mem}
+	slaveId, victims := selectVictims(demand, PriorityClass(task.Priority).Rank(), candidates)
+	if len(victims) == 0 {
+		log.V(2).Infof("no lower priority tasks to preempt for pod %v", podKey)
+		return false
+	}
+	if !p.reservations.allowPreemption(now) {
+		log.Warningf("preemption rate limit exceeded, not preempting tasks for pod %v", podKey)
+		return false
+	}
+
+	freed := resources{}
+	for _, v := range victims {
+		if err := p.api.killTask(v.taskId, killReasonPreempted); err != nil {
+			log.Errorf("failed to preempt task %v for pod %v: %v", v.taskId, podKey, err)
+			continue
+		}
+		// the status update for the kill can't be processed until we release the lock
+		victim, _ := p.api.getTask(v.taskId)
+		victim.Set(podtask.Preempted)
+		log.Infof("preempted task %v on slave %v for pod %v", v.taskId, slaveId, podKey)
+		p.recorder.Eventf(victim.Pod, preemptedEvent, "Preempted to make room for pod %v", podKey)
+		freed = freed.add(v.allotment)
+	}
+	if freed == (resources{}) {
+		return false
+	}
+	p.reservations.reserve(slaveId, podKey, freed, now)
+	return true
+}
+
+// hides offers whose resources are reserved for some other pod
+type reservedOffers struct {
+	offers.Registry
+	reservations *reservations
+	podKey       string
+	demand       resources
+	clock        clock.Clock
+}
+
+func (r *reservedOffers) Walk(w offers.Walker) error {
+	now := r.clock.Now()
+	return r.Registry.Walk(func(p offers.Perishable) (bool, error) {
+		if offer := p.Details(); offer != nil {
+			slaveId := offer.GetSlaveId().GetValue()
+			if !r.reservations.admits(slaveId, r.podKey, offeredResources(offer), r.demand, now) {
+				log.V(3).Infof("skipping offer %v, slave %v is reserved", offer.Id.GetValue(), slaveId)
+				return false, nil
+			}
+		}
+		return w(p)
+	})
+}
+
+// returns the cpu and mem resources of the live offers of the registry
+func totalOffered(r offers.Registry) (total resources) {
+	r.Walk(func(p offers.Perishable) (bool, error) {
+		if offer := p.Details(); offer != nil {
+			total = total.add(offeredResources(offer))
+		}
+		return false, nil
+	})
+	return
+}
+
+// returns the cpu and mem resources of an offer
+func offeredResources(offer *mesos.Offer) (r resources) {
+	for _, resource := range offer.Resources {
+		switch resource.GetName() {
+		case "cpus":
+			r.cpus += resource.GetScalar().GetValue()
+		case "mem":
+			r.mem += resource.GetScalar().GetValue()
+		}
+	}
+	return
+}
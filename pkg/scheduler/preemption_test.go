@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func candidate(taskId, slaveId string, rank int, cpus, mem float64) preemptionCandidate {
+	return preemptionCandidate{
+		taskId:    taskId,
+		slaveId:   slaveId,
+		rank:      rank,
+		allotment: resources{cpus: cpus, mem: mem},
+	}
+}
+
+func victimIds(victims []preemptionCandidate) []string {
+	ids := []string{}
+	for _, v := range victims {
+		ids = append(ids, v.taskId)
+	}
+	return ids
+}
+
+func TestSelectVictims(t *testing.T) {
+	assert := assert.New(t)
+	demand := resources{cpus: 1, mem: 128}
+
+	// nothing of lower priority
+	slaveId, victims := selectVictims(demand, 1, []preemptionCandidate{
+		candidate("a", "s1", 1, 2, 256),
+		candidate("b", "s1", 2, 2, 256),
+	})
+	assert.Equal("", slaveId)
+	assert.Len(victims, 0)
+
+	// not enough to free on any one slave
+	slaveId, victims = selectVictims(demand, 2, []preemptionCandidate{
+		candidate("a", "s1", 0, 0.5, 64),
+		candidate("b", "s2", 0, 0.5, 64),
+	})
+	assert.Equal("", slaveId)
+	assert.Len(victims, 0)
+
+	// prefer the slave that needs the fewest victims
+	slaveId, victims = selectVictims(demand, 2, []preemptionCandidate{
+		candidate("a", "s1", 0, 0.5, 64),
+		candidate("b", "s1", 0, 0.5, 64),
+		candidate("c", "s2", 1, 1, 128),
+	})
+	assert.Equal("s2", slaveId)
+	assert.Equal([]string{"c"}, victimIds(victims))
+
+	// then the slave whose victims are least important
+	slaveId, victims = selectVictims(demand, 2, []preemptionCandidate{
+		candidate("a", "s1", 1, 1, 128),
+		candidate("b", "s2", 0, 1, 128),
+	})
+	assert.Equal("s2", slaveId)
+	assert.Equal([]string{"b"}, victimIds(victims))
+}
+
+func TestSelectVictimsMinimal(t *testing.T) {
+	assert := assert.New(t)
+	demand := resources{cpus: 1, mem: 128}
+
+	// the low priority task alone doesn't free enough memory; once the normal
+	// priority task is chosen the low priority task is no longer needed
+	slaveId, victims := selectVictims(demand, 2, []preemptionCandidate{
+		candidate("low", "s1", 0, 1, 32),
+		candidate("normal", "s1", 1, 1, 256),
+		candidate("high", "s1", 2, 4, 1024),
+	})
+	assert.Equal("s1", slaveId)
+	assert.Equal([]string{"normal"}, victimIds(victims))
+
+	// several small tasks of the same priority, largest first
+	slaveId, victims = selectVictims(demand, 3, []preemptionCandidate{
+		candidate("a", "s1", 0, 0.25, 32),
+		candidate("b", "s1", 0, 0.5, 64),
+		candidate("c", "s1", 0, 0.5, 64),
+	})
+	assert.Equal("s1", slaveId)
+	assert.Equal([]string{"b", "c"}, victimIds(victims))
+}
+
+func TestReservations(t *testing.T) {
+	assert := assert.New(t)
+	r := newReservations()
+	now := time.Now()
+	demand := resources{cpus: 1, mem: 128}
+
+	r.reserve("s1", "pod-a", resources{cpus: 1, mem: 128}, now)
+	assert.True(r.holds("pod-a", now))
+	assert.False(r.holds("pod-b", now))
+
+	// the reserved resources are off limits to other pods...
+	assert.True(r.admits("s1", "pod-a", resources{cpus: 1, mem: 128}, demand, now))
+	assert.False(r.admits("s1", "pod-b", resources{cpus: 1, mem: 128}, demand, now))
+	assert.True(r.admits("s1", "pod-b", resources{cpus: 2, mem: 256}, demand, now))
+	assert.True(r.admits("s2", "pod-b", resources{cpus: 1, mem: 128}, demand, now))
+
+	// ...until they expire
+	later := now.Add(preemptionReservationTTL + time.Second)
+	assert.True(r.admits("s1", "pod-b", resources{cpus: 1, mem: 128}, demand, later))
+	assert.False(r.holds("pod-a", later))
+
+	r.reserve("s1", "pod-a", resources{cpus: 1, mem: 128}, now)
+	r.release("pod-a")
+	assert.False(r.holds("pod-a", now))
+	assert.True(r.admits("s1", "pod-b", resources{cpus: 1, mem: 128}, demand, now))
+}
+
+func TestPreemptionRateLimit(t *testing.T) {
+	assert := assert.New(t)
+	r := newReservations()
+	now := time.Now()
+
+	for i := 0; i < preemptionBurst; i++ {
+		assert.True(r.allowPreemption(now.Add(time.Duration(i) * time.Second)))
+	}
+	assert.False(r.allowPreemption(now.Add(preemptionBurst * time.Second)))
+
+	// the oldest preemption falls out of the window
+	assert.True(r.allowPreemption(now.Add(preemptionWindow + time.Second/2)))
+	assert.False(r.allowPreemption(now.Add(preemptionWindow + time.Second/2)))
+}
@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	log "github.com/golang/glog"
+	annotation "github.com/mesosphere/kubernetes-mesos/pkg/scheduler/meta"
+)
+
+// PriorityClass determines the order in which pods whose scheduling deadlines
+// have passed are popped from the scheduling queue.
+type PriorityClass string
+
+const (
+	PriorityLow      = PriorityClass("low")      // batch jobs
+	PriorityNormal   = PriorityClass("normal")   // the default
+	PriorityHigh     = PriorityClass("high")     // latency sensitive services
+	PriorityCritical = PriorityClass("critical") // cluster infrastructure
+)
+
+var priorityRanks = map[PriorityClass]int{
+	PriorityLow:      0,
+	PriorityNormal:   1,
+	PriorityHigh:     2,
+	PriorityCritical: 3,
+}
+
+// PriorityClasses returns all priority classes, lowest first.
+func PriorityClasses() []PriorityClass {
+	return []PriorityClass{PriorityLow, PriorityNormal, PriorityHigh, PriorityCritical}
+}
+
+// Rank returns the relative importance of the class, higher is more important.
+func (c PriorityClass) Rank() int {
+	if r, ok := priorityRanks[c]; ok {
+		return r
+	}
+	return priorityRanks[PriorityNormal]
+}
+
+func ParsePriorityClass(s string) (PriorityClass, error) {
+	c := PriorityClass(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := priorityRanks[c]; !ok {
+		return "", fmt.Errorf("unknown priority class %q", s)
+	}
+	return c, nil
+}
+
+// PriorityPolicy maps namespaces to the priority class of pods that don't
+// declare one via annotation.
+type PriorityPolicy map[string]PriorityClass
+
+// ParsePriorityPolicy parses a comma separated list of namespace=class pairs.
+func ParsePriorityPolicy(spec string) (PriorityPolicy, error) {
+	policy := PriorityPolicy{}
+	for _, pair := range strings.Split(spec, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("expected namespace=class instead of %q", pair)
+		}
+		c, err := ParsePriorityClass(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		policy[kv[0]] = c
+	}
+	return policy, nil
+}
+
+// ClassOf returns the priority class declared by the pod's annotation, or
+// else the default of its namespace, or else PriorityNormal.
+func (p PriorityPolicy) ClassOf(pod *api.Pod) PriorityClass {
+	if s, found := pod.Annotations[annotation.PriorityClassKey]; found {
+		if c, err := ParsePriorityClass(s); err == nil {
+			return c
+		} else {
+			log.Warningf("ignoring priority class of pod %v/%v: %v", pod.Namespace, pod.Name, err)
+		}
+	}
+	if c, found := p[pod.Namespace]; found {
+		return c
+	}
+	return PriorityNormal
+}
@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	annotation "github.com/mesosphere/kubernetes-mesos/pkg/scheduler/meta"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePriorityPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	policy, err := ParsePriorityPolicy("")
+	assert.Nil(err)
+	assert.Equal(0, len(policy))
+
+	policy, err = ParsePriorityPolicy("kube-system=critical, batch=LOW,")
+	assert.Nil(err)
+	assert.Equal(PriorityPolicy{"kube-system": PriorityCritical, "batch": PriorityLow}, policy)
+
+	_, err = ParsePriorityPolicy("batch")
+	assert.NotNil(err)
+	_, err = ParsePriorityPolicy("batch=urgent")
+	assert.NotNil(err)
+	_, err = ParsePriorityPolicy("=low")
+	assert.NotNil(err)
+}
+
+func TestPriorityClassOf(t *testing.T) {
+	assert := assert.New(t)
+
+	policy := PriorityPolicy{"batch": PriorityLow}
+	pod := func(ns, class string) *api.Pod {
+		p := &api.Pod{ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: ns}}
+		if class != "" {
+			p.Annotations = map[string]string{annotation.PriorityClassKey: class}
+		}
+		return p
+	}
+
+	assert.Equal(PriorityNormal, policy.ClassOf(pod(api.NamespaceDefault, "")))
+	assert.Equal(PriorityLow, policy.ClassOf(pod("batch", "")))
+	assert.Equal(PriorityHigh, policy.ClassOf(pod("batch", "high")))
+	assert.Equal(PriorityLow, policy.ClassOf(pod("batch", "bogus")))
+	assert.Equal(PriorityNormal, PriorityPolicy(nil).ClassOf(pod(api.NamespaceDefault, "")))
+
+	assert.True(PriorityCritical.Rank() > PriorityHigh.Rank())
+	assert.True(PriorityHigh.Rank() > PriorityNormal.Rank())
+	assert.True(PriorityNormal.Rank() > PriorityLow.Rank())
+	assert.Equal(PriorityNormal.Rank(), PriorityClass("bogus").Rank())
+}
@@ -0,0 +1,429 @@
+package scheduler
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api/errors"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api/latest"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet/dockertools"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/runtime"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/tools"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/watch"
+	"github.com/gogo/protobuf/proto"
+	execbindings "github.com/mesos/mesos-go/executor"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	mutil "github.com/mesos/mesos-go/mesosutil"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor"
+	"github.com/mesosphere/kubernetes-mesos/pkg/fakemesos"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+	"github.com/stretchr/testify/assert"
+)
+
+const scenarioTimeout = 30 * time.Second
+
+// an in-memory apiserver that serves the pods, services and bindings that the
+// scheduler and the executor depend upon. like the real apiserver, it refuses
+// to bind a pod that's already bound.
+type fakeAPIServer struct {
+	*httptest.Server
+	lock            sync.Mutex
+	pods            map[string]*api.Pod // by namespace/name
+	history         []watch.Event       // the resource version of a pod is the length of the history once it's changed
+	changed         chan struct{}       // closed, and replaced, upon each change
+	done            chan struct{}       // closed to end the watches, which would otherwise block Close
+	bindingFailures int                 // number of bindings that fail before the rest succeed
+}
+
+func newFakeAPIServer() *fakeAPIServer {
+	s := &fakeAPIServer{
+		pods:    map[string]*api.Pod{},
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *fakeAPIServer) Close() {
+	close(s.done)
+	s.Server.Close()
+}
+
+func (s *fakeAPIServer) client() *client.Client {
+	return client.NewOrDie(&client.Config{Host: s.URL, Version: latest.Version})
+}
+
+// records a change to a pod, which is deleted if the event says so. assumes
+// that the caller holds the lock.
+func (s *fakeAPIServer) record(t watch.EventType, pod *api.Pod) {
+	pod.ResourceVersion = strconv.Itoa(len(s.history) + 1)
+	key := pod.Namespace + "/" + pod.Name
+	if t == watch.Deleted {
+		delete(s.pods, key)
+	} else {
+		s.pods[key] = pod
+	}
+	copied := *pod
+	s.history = append(s.history, watch.Event{Type: t, Object: &copied})
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *fakeAPIServer) createPod(pod *api.Pod) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	created := *pod
+	s.record(watch.Added, &created)
+}
+
+func (s *fakeAPIServer) failBindings(n int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.bindingFailures = n
+}
+
+func (s *fakeAPIServer) getPod(namespace, name string) (pod api.Pod, found bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if p, ok := s.pods[namespace+"/"+name]; ok {
+		return *p, true
+	}
+	return
+}
+
+func (s *fakeAPIServer) serve(w http.ResponseWriter, r *http.Request) {
+	// legacy api versions name the namespace in the query, later ones in the path
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 3 || parts[0] != "api" {
+		s.writeError(w, errors.NewNotFound("path", r.URL.Path))
+		return
+	}
+	parts = parts[2:]
+	watching := parts[0] == "watch"
+	if watching {
+		parts = parts[1:]
+	}
+	namespace := r.URL.Query().Get("namespace")
+	if len(parts) > 2 && (parts[0] == "ns" || parts[0] == "namespaces") {
+		namespace, parts = parts[1], parts[2:]
+	}
+	if len(parts) == 0 {
+		s.writeError(w, errors.NewNotFound("path", r.URL.Path))
+		return
+	}
+
+	switch resource := parts[0]; {
+	case resource == "pods" && watching:
+		s.watchPods(w, r.URL.Query().Get("resourceVersion"))
+	case resource == "pods" && len(parts) == 1 && r.Method == "GET":
+		s.listPods(w, namespace)
+	case resource == "pods" && len(parts) == 2 && r.Method == "GET":
+		if namespace == "" {
+			namespace = api.NamespaceDefault
+		}
+		if pod, found := s.getPod(namespace, parts[1]); found {
+			s.write(w, http.StatusOK, &pod)
+		} else {
+			s.writeError(w, errors.NewNotFound("pod", parts[1]))
+		}
+	case resource == "services" && r.Method == "GET":
+		s.write(w, http.StatusOK, &api.ServiceList{})
+	case resource == "bindings" && r.Method == "POST":
+		s.bind(w, r, namespace)
+	default:
+		s.writeError(w, errors.NewNotFound(resource, r.URL.Path))
+	}
+}
+
+func (s *fakeAPIServer) write(w http.ResponseWriter, code int, obj runtime.Object) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write([]byte(runtime.EncodeOrDie(latest.Codec, obj)))
+}
+
+func (s *fakeAPIServer) writeError(w http.ResponseWriter, err error) {
+	status := err.(*errors.StatusError).ErrStatus
+	s.write(w, status.Code, &status)
+}
+
+func (s *fakeAPIServer) listPods(w http.ResponseWriter, namespace string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	list := &api.PodList{}
+	list.ResourceVersion = strconv.Itoa(len(s.history))
+	for _, pod := range s.pods {
+		if namespace == "" || pod.Namespace == namespace {
+			list.Items = append(list.Items, *pod)
+		}
+	}
+	s.write(w, http.StatusOK, list)
+}
+
+// streams the changes to the pods that follow the resource version
+func (s *fakeAPIServer) watchPods(w http.ResponseWriter, resourceVersion string) {
+	next, _ := strconv.Atoi(resourceVersion)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Transfer-Encoding", "chunked")
+	w.WriteHeader(http.StatusOK)
+	flusher := w.(http.Flusher)
+	closed := w.(http.CloseNotifier).CloseNotify()
+	for {
+		s.lock.Lock()
+		events := s.history[next:]
+		changed := s.changed
+		s.lock.Unlock()
+
+		for _, e := range events {
+			fmt.Fprintf(w, `{"type":%q,"object":%s}`+"\n", e.Type, runtime.EncodeOrDie(latest.Codec, e.Object))
+			next++
+		}
+		flusher.Flush()
+		select {
+		case <-changed:
+		case <-closed:
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *fakeAPIServer) bind(w http.ResponseWriter, r *http.Request, namespace string) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s.writeError(w, errors.NewBadRequest(err.Error()))
+		return
+	}
+	binding := &api.Binding{}
+	if err := latest.Codec.DecodeInto(data, binding); err != nil {
+		s.writeError(w, errors.NewBadRequest(err.Error()))
+		return
+	}
+	if binding.Namespace != "" {
+		namespace = binding.Namespace
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	p, found := s.pods[namespace+"/"+binding.PodID]
+	switch {
+	case !found:
+		s.writeError(w, errors.NewNotFound("pod", binding.PodID))
+	case s.bindingFailures > 0:
+		s.bindingFailures--
+		s.writeError(w, errors.NewInternalError(fmt.Errorf("binding of pod %v failed", binding.PodID)))
+	case p.Status.Host != "":
+		s.writeError(w, errors.NewConflict("binding", binding.PodID, fmt.Errorf("pod is already assigned to host %q", p.Status.Host)))
+	default:
+		bound := *p
+		bound.Status.Host = binding.Host
+		s.record(watch.Modified, &bound)
+		s.write(w, http.StatusCreated, &api.Status{Status: api.StatusSuccess})
+	}
+}
+
+// stands in for the kubelet of an executor: the pods that the executor hands
+// to it are reported as running until the executor takes them away.
+type fakeKubelet struct {
+	lock    sync.Mutex
+	source  string
+	running map[string]bool // by pod full name
+}
+
+func newFakeKubelet(source string) (*fakeKubelet, chan<- interface{}) {
+	kl := &fakeKubelet{source: source, running: map[string]bool{}}
+	updates := make(chan interface{})
+	go func() {
+		for x := range updates {
+			kl.update(x.(kubelet.PodUpdate))
+		}
+	}()
+	return kl, updates
+}
+
+func (kl *fakeKubelet) update(u kubelet.PodUpdate) {
+	kl.lock.Lock()
+	defer kl.lock.Unlock()
+	if u.Op != kubelet.SET {
+		return
+	}
+	kl.running = map[string]bool{}
+	for _, pod := range u.Pods {
+		kl.running[kubelet.GetPodFullName(&api.BoundPod{
+			ObjectMeta: api.ObjectMeta{
+				Name:        pod.Name,
+				Namespace:   pod.Namespace,
+				Annotations: map[string]string{kubelet.ConfigSourceAnnotationKey: kl.source},
+			},
+		})] = true
+	}
+}
+
+func (kl *fakeKubelet) podStatus(podFullName string) (api.PodStatus, error) {
+	kl.lock.Lock()
+	defer kl.lock.Unlock()
+	if !kl.running[podFullName] {
+		return api.PodStatus{}, fmt.Errorf("pod %v is not running", podFullName)
+	}
+	return api.PodStatus{Phase: api.PodRunning}, nil
+}
+
+// the kubernetes scheduler, with its plugin, and the executors of its tasks,
+// running against a fake mesos master and a fake apiserver
+type scenario struct {
+	t         *testing.T
+	apiserver *fakeAPIServer
+	master    *fakemesos.Master
+	sched     *KubernetesScheduler
+	slaveId   string
+}
+
+func newScenario(t *testing.T) *scenario {
+	apiserver := newFakeAPIServer()
+	master := fakemesos.NewMaster()
+	s := &scenario{t: t, apiserver: apiserver, master: master}
+
+	s.slaveId = master.AddSlave(fakemesos.SlaveConfig{
+		Hostname: "host-1",
+		Cpus:     4,
+		Mem:      4096,
+		Executor: func(*mesos.ExecutorInfo) execbindings.Executor {
+			kl, updates := newFakeKubelet("scenario")
+			outbox, _ := executor.NewOutbox("", 0)
+			return executor.New(kl.podStatus, updates, "scenario", apiserver.client(), watch.NewFake(), &dockertools.FakeDockerClient{}, outbox, nil)
+		},
+	})
+
+	s.sched = New(Config{
+		Executor: &mesos.ExecutorInfo{
+			ExecutorId: mutil.NewExecutorID("executor"),
+			Command:    &mesos.CommandInfo{Value: proto.String("true")},
+		},
+		ScheduleFunc: FCFSScheduleFunc,
+		Client:       apiserver.client(),
+		EtcdClient:   tools.NewFakeEtcdClient(t),
+	})
+	started := make(chan struct{})
+	plugin := NewPlugin(s.sched.NewPluginConfig(started))
+	driver := master.NewSchedulerDriver(s.sched, &mesos.FrameworkInfo{
+		Name: proto.String("scenario"),
+		User: proto.String("scenario"),
+	})
+	s.sched.Init(driver, plugin)
+	if _, err := driver.Start(); err != nil {
+		t.Fatal(err)
+	}
+	master.Flush()
+	close(started)
+	plugin.Run()
+	return s
+}
+
+func (s *scenario) Close() {
+	s.master.Close()
+	s.apiserver.Close()
+}
+
+// makes offers until the condition holds, failing the test if it doesn't in time
+func (s *scenario) await(what string, cond func() bool) {
+	deadline := time.Now().Add(scenarioTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			s.t.Fatalf("timed out waiting for %v", what)
+		}
+		s.master.OfferCycle()
+		s.master.Flush()
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// returns the ids of the tasks that the master knows of, in the given state
+func (s *scenario) tasksIn(state mesos.TaskState) (ids []string) {
+	for id, st := range s.master.Tasks() {
+		if st == state {
+			ids = append(ids, id)
+		}
+	}
+	return
+}
+
+// returns the state of the task of the pod, as far as the scheduler knows
+func (s *scenario) podTask(name string) (taskId string, state podtask.StateType) {
+	s.sched.RLock()
+	defer s.sched.RUnlock()
+	taskId, found := s.sched.taskRegistry.TaskForPod("/pods/default/" + name)
+	if !found {
+		return "", podtask.StateUnknown
+	}
+	_, state = s.sched.taskRegistry.Get(taskId)
+	return
+}
+
+func newScenarioPod(name string) *api.Pod {
+	return &api.Pod{
+		ObjectMeta: api.ObjectMeta{Name: name, Namespace: api.NamespaceDefault},
+		Spec:       api.PodSpec{Containers: []api.Container{{Name: name, Image: "nginx"}}},
+	}
+}
+
+// the plugin installs http handlers, so there's a single scenario per test binary
+func TestScenario(t *testing.T) {
+	assert := assert.New(t)
+	s := newScenario(t)
+	defer s.Close()
+
+	// the pod is scheduled, bound by the executor and then reported running
+	s.apiserver.createPod(newScenarioPod("foo"))
+	s.await("the task of foo to run", func() bool {
+		_, state := s.podTask("foo")
+		return state == podtask.StateRunning
+	})
+	foo, _ := s.podTask("foo")
+	assert.Equal([]string{foo}, s.tasksIn(mesos.TaskState_TASK_RUNNING))
+	pod, _ := s.apiserver.getPod(api.NamespaceDefault, "foo")
+	assert.Equal("host-1", pod.Status.Host)
+
+	// the first binding of the next pod fails, so it remains unbound in the
+	// apiserver and reconciliation puts it back into the scheduling queue
+	s.apiserver.failBindings(1)
+	s.apiserver.createPod(newScenarioPod("bar"))
+	s.await("the task of bar to run", func() bool {
+		_, state := s.podTask("bar")
+		return state == podtask.StateRunning
+	})
+	failed := s.tasksIn(mesos.TaskState_TASK_FAILED)
+	if assert.Equal(1, len(failed)) {
+		_, state := s.sched.taskRegistry.Get(failed[0])
+		assert.Equal(podtask.StateUnknown, state)
+	}
+	bar, _ := s.podTask("bar")
+	assert.Equal(2, len(s.tasksIn(mesos.TaskState_TASK_RUNNING)))
+	pod, _ = s.apiserver.getPod(api.NamespaceDefault, "bar")
+	assert.Equal("host-1", pod.Status.Host)
+
+	// the tasks of a lost slave are dropped, and its executor is told to kill
+	// them in case the slave comes back
+	s.master.LoseSlave(s.slaveId)
+	s.master.Flush()
+	for name, taskId := range map[string]string{"foo": foo, "bar": bar} {
+		_, state := s.podTask(name)
+		assert.Equal(podtask.StateUnknown, state)
+		assert.Contains(s.master.Messages(), fakemesos.FrameworkMessage{
+			ExecutorId: "executor",
+			SlaveId:    s.slaveId,
+			Data:       "task-lost:" + taskId,
+		})
+	}
+	assert.Equal(2, len(s.tasksIn(mesos.TaskState_TASK_LOST)))
+}
@@ -1,23 +1,29 @@
 package scheduler
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/tools"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
 	log "github.com/golang/glog"
 	mesos "github.com/mesos/mesos-go/mesosproto"
 	mutil "github.com/mesos/mesos-go/mesosutil"
 	bindings "github.com/mesos/mesos-go/scheduler"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
 	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
 	"github.com/mesosphere/kubernetes-mesos/pkg/offers"
 	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/meta"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/metrics"
 	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+	"github.com/mesosphere/kubernetes-mesos/pkg/trace"
 )
 
 const (
@@ -28,14 +34,19 @@ const (
 )
 
 type Slave struct {
-	HostName string
-	Offers   map[string]empty
+	HostName   string
+	Offers     map[string]empty
+	Daemons    []messages.DaemonHealth // most recently reported health of the executor's sidecar daemons
+	Tasks      map[string]labels.Set   // labels of the pods of tasks launched on the slave, by task id
+	Attributes []*mesos.Attribute      // attributes of the most recent offer, used to evaluate constraints
+	Draining   bool                    // if true, the offers of the slave are not used to launch tasks
 }
 
 func newSlave(hostName string) *Slave {
 	return &Slave{
 		HostName: hostName,
 		Offers:   make(map[string]empty),
+		Tasks:    make(map[string]labels.Set),
 	}
 }
 
@@ -44,6 +55,10 @@ type PluginInterface interface {
 	// so reconcile our records, but only for this one pod
 	reconcilePod(api.Pod)
 
+	// queue a pod whose task was killed, to make room for another or to drain
+	// its slave, to be scheduled once again
+	requeuePreempted(api.Pod)
+
 	// execute the Scheduling plugin, should start a go routine and return immediately
 	Run()
 }
@@ -65,25 +80,53 @@ type KubernetesScheduler struct {
 	frameworkId *mesos.FrameworkID
 	masterInfo  *mesos.MasterInfo
 	registered  bool
+	reconciler  *Reconciler // explicit reconciliation of running tasks, periodic or on demand
 
 	offers       offers.Registry
 	slaves       map[string]*Slave // SlaveID => slave.
 	slaveIDs     map[string]string // Slave's hostname => slaveID
 	taskRegistry podtask.Registry
 
-	scheduleFunc PodScheduleFunc // The function that does scheduling.
+	scheduleFunc PodScheduleFunc   // The function that does scheduling.
+	priorities   PriorityPolicy    // default priority classes of pods, by namespace
+	aging        time.Duration     // waiting that's worth one rank of priority
+	weights      NamespaceWeights  // fair shares of cluster resources, by namespace
+	backoff      BackoffStrategy   // default strategy for pods that fail to schedule
+	clock        clock.Clock       // measures offer expiration, queue deadlines and backoff
+	orphans      *orphanDetector   // finds tasks that mesos runs on behalf of pods that no longer exist
+	decisions    DecisionLogConfig // audit log of scheduling decisions
+	tracer       *trace.Tracer     // traces the launch of tasks, may be nil
 
 	client     *client.Client
 	plugin     PluginInterface
 	etcdClient tools.EtcdClient
 }
 
+// Config holds the collaborators and tunables of a KubernetesScheduler
+type Config struct {
+	Executor     *mesos.ExecutorInfo
+	ScheduleFunc PodScheduleFunc
+	Client       *client.Client
+	EtcdClient   tools.EtcdClient
+	Priorities   PriorityPolicy    // default priority classes of pods, by namespace
+	Aging        time.Duration     // waiting that's worth one rank of priority; zero uses queue.DefaultPriorityAging
+	Weights      NamespaceWeights  // fair shares of cluster resources, by namespace
+	Backoff      BackoffStrategy   // default strategy for pods that fail to schedule, may be nil
+	Clock        clock.Clock       // may be nil, in which case the real clock is used
+	Orphans      OrphanConfig      // detection of orphaned tasks, disabled by default
+	Decisions    DecisionLogConfig // audit log of scheduling decisions, disabled by default
+	Tracer       *trace.Tracer     // traces the launch of tasks, may be nil
+}
+
 // New create a new KubernetesScheduler
-func New(executor *mesos.ExecutorInfo, scheduleFunc PodScheduleFunc, client *client.Client, etcdClient tools.EtcdClient) *KubernetesScheduler {
+func New(config Config) *KubernetesScheduler {
+	if config.Clock == nil {
+		config.Clock = clock.RealClock{}
+	}
 	var k *KubernetesScheduler
 	k = &KubernetesScheduler{
 		RWMutex:  new(sync.RWMutex),
-		executor: executor,
+		executor: config.Executor,
 		offers: offers.CreateRegistry(offers.RegistryConfig{
 			DeclineOffer: func(id string) error {
 				offerId := mutil.NewOfferID(id)
@@ -94,14 +137,28 @@ func New(executor *mesos.ExecutorInfo, scheduleFunc PodScheduleFunc, client *cli
 			TTL:           defaultOfferTTL * time.Second,
 			LingerTTL:     defaultOfferLingerTTL * time.Second, // remember expired offers so that we can tell if a previously scheduler offer relies on one
 			ListenerDelay: defaultListenerDelay * time.Second,
+			Clock:         config.Clock,
 		}),
 		slaves:       make(map[string]*Slave),
 		slaveIDs:     make(map[string]string),
-		taskRegistry: podtask.NewInMemoryRegistry(),
-		scheduleFunc: scheduleFunc,
-		client:       client,
-		etcdClient:   etcdClient,
+		taskRegistry: podtask.NewInMemoryRegistryWithClock(config.Clock),
+		scheduleFunc: config.ScheduleFunc,
+		priorities:   config.Priorities,
+		aging:        config.Aging,
+		weights:      config.Weights,
+		backoff:      config.Backoff,
+		decisions:    config.Decisions,
+		tracer:       config.Tracer,
+		clock:        config.Clock,
+		client:       config.Client,
+		etcdClient:   config.EtcdClient,
 	}
+	k.reconciler = &Reconciler{Action: k.ReconcileRunningTasks}
+	k.orphans = newOrphanDetector(&k8smScheduler{k}, k.lookupPod, func() string {
+		k.RLock()
+		defer k.RUnlock()
+		return k.frameworkId.GetValue()
+	}, config.Orphans, config.Clock)
 	return k
 }
 
@@ -121,8 +178,7 @@ func (k *KubernetesScheduler) Registered(driver bindings.SchedulerDriver,
 	log.Infof("Scheduler registered with the master: %v with frameworkId: %v\n", masterInfo, frameworkId)
 
 	//TODO(jdef) partial reconciliation started... needs work
-	r := &Reconciler{Action: k.ReconcileRunningTasks}
-	go util.Forever(func() { r.Run(driver) }, 5*time.Minute) // TODO(jdef) parameterize reconciliation interval
+	go util.Forever(func() { k.reconciler.Run(driver) }, 5*time.Minute) // TODO(jdef) parameterize reconciliation interval
 }
 
 func (k *KubernetesScheduler) storeFrameworkId() {
@@ -139,8 +195,7 @@ func (k *KubernetesScheduler) Reregistered(driver bindings.SchedulerDriver, mast
 	k.registered = true
 
 	//TODO(jdef) partial reconciliation started... needs work
-	r := &Reconciler{Action: k.ReconcileRunningTasks}
-	go util.Forever(func() { r.Run(driver) }, 5*time.Minute) // TODO(jdef) parameterize reconciliation interval
+	go util.Forever(func() { k.reconciler.Run(driver) }, 5*time.Minute) // TODO(jdef) parameterize reconciliation interval
 }
 
 // Disconnected is called when the scheduler loses connection to the master.
@@ -174,6 +229,7 @@ func (k *KubernetesScheduler) ResourceOffers(driver bindings.SchedulerDriver, of
 			slave = k.slaves[slaveId]
 		}
 		slave.Offers[offerId] = empty{}
+		slave.Attributes = offer.GetAttributes()
 		k.slaveIDs[slave.HostName] = slaveId
 	}
 }
@@ -208,6 +264,18 @@ func (k *KubernetesScheduler) StatusUpdate(driver bindings.SchedulerDriver, task
 	defer k.Unlock()
 
 	log.Infof("Received status update %v\n", taskStatus)
+	defer k.indexTask(taskStatus)
+
+	task, state := k.taskRegistry.Get(taskStatus.GetTaskId().GetValue())
+	k.countStatus(taskStatus, task)
+
+	switch taskStatus.GetState() {
+	case mesos.TaskState_TASK_STAGING, mesos.TaskState_TASK_STARTING, mesos.TaskState_TASK_RUNNING:
+		if state == podtask.StateUnknown {
+			// typically revealed by reconciliation after the scheduler lost its state
+			k.orphans.observe(taskStatus)
+		}
+	}
 
 	switch taskStatus.GetState() {
 	case mesos.TaskState_TASK_STAGING:
@@ -221,9 +289,11 @@ func (k *KubernetesScheduler) StatusUpdate(driver bindings.SchedulerDriver, task
 			log.Warningf("Ignore status %+v because the slave does not exist", taskStatus)
 			return
 		}
-		fallthrough
-	case mesos.TaskState_TASK_KILLED:
 		k.taskRegistry.UpdateStatus(taskStatus)
+	case mesos.TaskState_TASK_KILLED:
+		if task, _ := k.taskRegistry.UpdateStatus(taskStatus); task != nil && (task.Has(podtask.Preempted) || task.Has(podtask.Drained)) {
+			go k.plugin.requeuePreempted(*task.Pod)
+		}
 	case mesos.TaskState_TASK_FAILED:
 		if task, _ := k.taskRegistry.UpdateStatus(taskStatus); task != nil {
 			if task.Has(podtask.Launched) && messages.CreateBindingFailure == taskStatus.GetMessage() {
@@ -248,10 +318,87 @@ func (k *KubernetesScheduler) StatusUpdate(driver bindings.SchedulerDriver, task
 	}
 }
 
+// maintain the index of the tasks of each slave, used to evaluate affinity.
+// assumes that the caller has acquired the scheduler lock.
+func (k *KubernetesScheduler) indexTask(status *mesos.TaskStatus) {
+	slave, ok := k.slaves[status.GetSlaveId().GetValue()]
+	if !ok {
+		return
+	}
+	taskId := status.GetTaskId().GetValue()
+	switch status.GetState() {
+	case mesos.TaskState_TASK_STARTING, mesos.TaskState_TASK_RUNNING:
+		if task, _ := k.taskRegistry.Get(taskId); task != nil {
+			slave.Tasks[taskId] = labels.Set(task.Pod.Labels)
+		}
+	case mesos.TaskState_TASK_FINISHED, mesos.TaskState_TASK_FAILED, mesos.TaskState_TASK_KILLED, mesos.TaskState_TASK_LOST:
+		delete(slave.Tasks, taskId)
+	}
+}
+
 // FrameworkMessage is called when the scheduler receives a message from the executor.
 func (k *KubernetesScheduler) FrameworkMessage(driver bindings.SchedulerDriver,
 	executorId *mesos.ExecutorID, slaveId *mesos.SlaveID, message string) {
 	log.Infof("Received messages from executor %v of slave %v, %v\n", executorId, slaveId, message)
+
+	switch {
+	case strings.HasPrefix(message, messages.PodUsagePrefix):
+		k.handlePodUsage(slaveId, message[len(messages.PodUsagePrefix):])
+	case strings.HasPrefix(message, messages.DaemonHealthPrefix):
+		k.handleDaemonHealth(slaveId, message[len(messages.DaemonHealthPrefix):])
+	}
+}
+
+// record the health of the sidecar daemons running alongside an executor
+func (k *KubernetesScheduler) handleDaemonHealth(slaveId *mesos.SlaveID, data string) {
+	var health []messages.DaemonHealth
+	if err := json.Unmarshal([]byte(data), &health); err != nil {
+		log.Errorf("failed to unmarshal daemon health from slave %v: %v", slaveId, err)
+		return
+	}
+	for _, h := range health {
+		if !h.Healthy {
+			log.Warningf("daemon %v on slave %v is unhealthy: state=%v restarts=%d error=%q",
+				h.Name, slaveId.GetValue(), h.State, h.Restarts, h.LastError)
+		}
+	}
+
+	k.Lock()
+	defer k.Unlock()
+
+	if slave, found := k.slaves[slaveId.GetValue()]; found {
+		slave.Daemons = health
+	} else {
+		log.V(2).Infof("ignoring daemon health of unknown slave %v", slaveId.GetValue())
+	}
+}
+
+// record pod resource usage reported by an executor, flagging tasks that have
+// exceeded the resources allotted to them.
+func (k *KubernetesScheduler) handlePodUsage(slaveId *mesos.SlaveID, data string) {
+	var usage []messages.PodUsage
+	if err := json.Unmarshal([]byte(data), &usage); err != nil {
+		log.Errorf("failed to unmarshal pod usage from slave %v: %v", slaveId, err)
+		return
+	}
+
+	k.Lock()
+	defer k.Unlock()
+
+	for i := range usage {
+		u := &usage[i]
+		task, state := k.taskRegistry.Get(u.TaskId)
+		if state != podtask.StateRunning {
+			log.V(2).Infof("ignoring usage report for task %v in state %v", u.TaskId, state)
+			continue
+		}
+		task.Usage = u
+		if task.Overrun() {
+			cpus, mem := task.Allotment()
+			log.Warningf("task %v (pod %v) exceeds its resource allotment: cpus %.3f/%.3f, mem %.1f/%.1f MB",
+				task.ID, u.PodName, u.Cpus, cpus, u.Mem, mem)
+		}
+	}
 }
 
 // SlaveLost is called when some slave is lost.
@@ -299,7 +446,7 @@ func (k *KubernetesScheduler) ReconcileRunningTasks(driver bindings.SchedulerDri
 	filter := podtask.StateRunning
 	remaining := util.NewStringSet()
 	remaining.Insert(k.taskRegistry.List(&filter)...)
-	start := time.Now()
+	start := k.clock.Now()
 	const maxBackoff = 120 * time.Second // TODO(jdef) extract constant
 	first := true
 	for backoff := 1 * time.Second; first || remaining.Len() > 0; backoff = backoff * 2 {
@@ -311,7 +458,7 @@ func (k *KubernetesScheduler) ReconcileRunningTasks(driver bindings.SchedulerDri
 		select {
 		case <-canceled:
 			return nil //TODO(jdef) should probably return a cancelation error
-		case <-time.After(backoff):
+		case <-k.clock.After(backoff):
 			func() {
 				k.RLock()
 				defer k.RUnlock()
@@ -341,10 +488,14 @@ func (r *Reconciler) Run(driver bindings.SchedulerDriver) <-chan struct{} {
 		canceled := make(chan struct{})
 		go func() {
 			defer atomic.StoreInt32(&r.running, 0)
+			start := time.Now()
 			err := r.Action(driver, canceled)
+			result := "success"
 			if err != nil {
+				result = "failure"
 				log.Errorf("reconciler action failed: %v", err)
 			}
+			metrics.ReconciliationLatency.WithLabelValues(result).Observe(metrics.InMicroseconds(time.Since(start)))
 		}()
 		return canceled
 	}
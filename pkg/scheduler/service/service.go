@@ -22,6 +22,7 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"os"
 	"os/user"
 	"strconv"
 	"strings"
@@ -48,10 +49,13 @@ import (
 	bindings "github.com/mesos/mesos-go/scheduler"
 	kmcloud "github.com/mesosphere/kubernetes-mesos/pkg/cloud/mesos"
 	"github.com/mesosphere/kubernetes-mesos/pkg/executor/config"
+	"github.com/mesosphere/kubernetes-mesos/pkg/queue"
+	"github.com/mesosphere/kubernetes-mesos/pkg/rotate"
 	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler"
 	sconfig "github.com/mesosphere/kubernetes-mesos/pkg/scheduler/config"
 	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/meta"
 	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/metrics"
+	"github.com/mesosphere/kubernetes-mesos/pkg/trace"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/pflag"
 	"golang.org/x/net/context"
@@ -84,17 +88,36 @@ type SchedulerServer struct {
 	MesosAuthProvider    string
 	DriverPort           uint
 	HostnameOverride     string
+	SidecarConfig        string
+	NamespacePriorities  string
+	PriorityAging        time.Duration
+	NamespaceWeights     string
+	PodBackoffStrategy   string
+	OrphanInterval       time.Duration
+	OrphanDryRun         bool
+	OrphanAuditLog       string
+	DecisionLog          string
+	DecisionLogMaxSize   int
+	DecisionLogBackups   int
+	DecisionSampleRate   float64
+	TraceFile            string
+	ExecutorTraceFile    string
 }
 
 // NewSchedulerServer creates a new SchedulerServer with default parameters
 func NewSchedulerServer() *SchedulerServer {
 	s := SchedulerServer{
-		Port:              ports.SchedulerPort,
-		Address:           util.IP(net.ParseIP("127.0.0.1")),
-		FailoverTimeout:   time.Duration((1 << 62) - 1).Seconds(),
-		ExecutorRunProxy:  true,
-		MesosAuthProvider: sasl.ProviderName,
-		MesosUser:         defaultMesosUser,
+		Port:               ports.SchedulerPort,
+		Address:            util.IP(net.ParseIP("127.0.0.1")),
+		FailoverTimeout:    time.Duration((1 << 62) - 1).Seconds(),
+		ExecutorRunProxy:   true,
+		MesosAuthProvider:  sasl.ProviderName,
+		MesosUser:          defaultMesosUser,
+		PodBackoffStrategy: "exponential",
+		PriorityAging:      queue.DefaultPriorityAging,
+		DecisionLogMaxSize: 100, // MB
+		DecisionLogBackups: 5,
+		DecisionSampleRate: 1,
 	}
 	return &s
 }
@@ -122,6 +145,71 @@ func (s *SchedulerServer) AddFlags(fs *pflag.FlagSet) {
 	fs.UintVar(&s.DriverPort, "driver_port", s.DriverPort, "Port that the Mesos scheduler driver process should listen on.")
 	fs.StringVar(&s.HostnameOverride, "hostname_override", s.HostnameOverride, "If non-empty, will use this string as identification instead of the actual hostname.")
 	fs.IntVar(&s.ExecutorLogV, "executor_logv", s.ExecutorLogV, "Logging verbosity of spawned executor processes.")
+	fs.StringVar(&s.SidecarConfig, "sidecar_config", s.SidecarConfig, "Path to a YAML or JSON file that declares sidecar daemons for executors to run on each slave.")
+	fs.StringVar(&s.NamespacePriorities, "namespace_priority_classes", s.NamespacePriorities, fmt.Sprintf("Default priority class of pods, by namespace: comma separated namespace=class pairs where class is one of %v. Pods may override it with the %v annotation.", scheduler.PriorityClasses(), meta.PriorityClassKey))
+	fs.DurationVar(&s.PriorityAging, "priority_aging", s.PriorityAging, "Time that a queued pod must wait to be scheduled ahead of pods one priority class above it.")
+	fs.StringVar(&s.NamespaceWeights, "namespace_weights", s.NamespaceWeights, "Fair shares of cluster resources, by namespace: comma separated namespace=weight pairs. Namespaces that aren't listed have a weight of 1.")
+	fs.StringVar(&s.PodBackoffStrategy, "pod_backoff_strategy", s.PodBackoffStrategy, fmt.Sprintf("Backoff strategy of pods that fail to schedule, one of %v. Pods may override it, and its bounds, with the %v, %v and %v annotations.", scheduler.BackoffStrategies(), meta.BackoffStrategyKey, meta.BackoffMinKey, meta.BackoffMaxKey))
+	fs.DurationVar(&s.OrphanInterval, "orphan_detection_interval", s.OrphanInterval, "How often to look for, and kill, tasks whose pods no longer exist. Zero disables periodic detection.")
+	fs.BoolVar(&s.OrphanDryRun, "orphan_dry_run", s.OrphanDryRun, "If true, orphaned tasks are reported but never killed by periodic detection.")
+	fs.StringVar(&s.OrphanAuditLog, "orphan_audit_log", s.OrphanAuditLog, "If non-empty, path of a file to which a JSON record of every orphaned task found is appended.")
+	fs.StringVar(&s.DecisionLog, "decision_log", s.DecisionLog, "If non-empty, path of a file (or - for stdout) to which a JSON record of every scheduling decision is appended.")
+	fs.IntVar(&s.DecisionLogMaxSize, "decision_log_max_size", s.DecisionLogMaxSize, "Size in MB beyond which the decision log file is rotated, 0 disables rotation.")
+	fs.IntVar(&s.DecisionLogBackups, "decision_log_max_backups", s.DecisionLogBackups, "Number of rotated decision log files to retain.")
+	fs.Float64Var(&s.DecisionSampleRate, "decision_log_sample_rate", s.DecisionSampleRate, "Fraction of scheduling decisions that are logged, in (0, 1].")
+	fs.StringVar(&s.TraceFile, "trace_file", s.TraceFile, "If non-empty, path of a file to which the spans that trace task launches are appended, as Zipkin v2 JSON.")
+	fs.StringVar(&s.ExecutorTraceFile, "executor_trace_file", s.ExecutorTraceFile, "If non-empty, path of a file on each slave to which executors append the spans that continue the traces of task launches.")
+}
+
+func (s *SchedulerServer) orphanConfig() (scheduler.OrphanConfig, error) {
+	config := scheduler.OrphanConfig{
+		Interval: s.OrphanInterval,
+		DryRun:   s.OrphanDryRun,
+	}
+	if s.OrphanAuditLog != "" {
+		f, err := os.OpenFile(s.OrphanAuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return config, err
+		}
+		config.Audit = f
+	}
+	if enumerator, err := kmcloud.NewTaskEnumerator(); err != nil {
+		log.Warningf("orphan detection will not consult the mesos master: %v", err)
+	} else {
+		config.MasterTasks = func(frameworkId string) ([]scheduler.MasterTask, error) {
+			ctx, cancel := context.WithCancel(context.TODO())
+			defer cancel()
+			tasks, err := enumerator.EnumerateTasks(ctx, frameworkId)
+			if err != nil {
+				return nil, err
+			}
+			result := make([]scheduler.MasterTask, 0, len(tasks))
+			for _, t := range tasks {
+				result = append(result, scheduler.MasterTask{Id: t.Id, SlaveId: t.SlaveId})
+			}
+			return result, nil
+		}
+	}
+	return config, nil
+}
+
+func (s *SchedulerServer) decisionLogConfig() (scheduler.DecisionLogConfig, error) {
+	config := scheduler.DecisionLogConfig{SampleRate: s.DecisionSampleRate}
+	if s.DecisionSampleRate <= 0 || s.DecisionSampleRate > 1 {
+		return config, fmt.Errorf("sample rate %v is not in (0, 1]", s.DecisionSampleRate)
+	}
+	switch s.DecisionLog {
+	case "":
+	case "-":
+		config.Writer = os.Stdout
+	default:
+		f, err := rotate.Open(s.DecisionLog, int64(s.DecisionLogMaxSize)*1024*1024, s.DecisionLogBackups)
+		if err != nil {
+			return config, err
+		}
+		config.Writer = f
+	}
+	return config, nil
 }
 
 // returns (downloadURI, basename(path))
@@ -171,6 +259,10 @@ func (s *SchedulerServer) prepareExecutorInfo() *mesos.ExecutorInfo {
 	executorCommand = fmt.Sprintf("%s --proxy_bindall=%v", executorCommand, s.ExecutorProxyBindall)
 	executorCommand = fmt.Sprintf("%s --run_proxy=%v", executorCommand, s.ExecutorRunProxy)
 
+	if s.ExecutorTraceFile != "" {
+		executorCommand = fmt.Sprintf("%s --trace_file=%s", executorCommand, s.ExecutorTraceFile)
+	}
+
 	if len(s.EtcdServerList) > 0 {
 		etcdServerArguments := strings.Join(s.EtcdServerList, ",")
 		executorCommand = fmt.Sprintf("%s --etcd_servers=%s", executorCommand, etcdServerArguments)
@@ -186,6 +278,17 @@ func (s *SchedulerServer) prepareExecutorInfo() *mesos.ExecutorInfo {
 		executorCommand = fmt.Sprintf("%s --auth_path=%s", executorCommand, basename)
 	}
 
+	if s.SidecarConfig != "" {
+		sidecarUris, err := s.prepareSidecars()
+		if err != nil {
+			log.Fatalf("misconfigured sidecars: %v", err)
+		}
+		executorUris = append(executorUris, sidecarUris...)
+		uri, basename := s.serveExecutorArtifact(s.SidecarConfig)
+		executorUris = append(executorUris, &mesos.CommandInfo_URI{Value: uri})
+		executorCommand = fmt.Sprintf("%s --sidecar_config=./%s", executorCommand, basename)
+	}
+
 	log.V(1).Infof("prepared executor command '%v'", executorCommand)
 
 	// Create mesos scheduler driver.
@@ -200,6 +303,32 @@ func (s *SchedulerServer) prepareExecutorInfo() *mesos.ExecutorInfo {
 	}
 }
 
+// returns the URIs of the sidecar executables declared in the sidecar config file;
+// sidecars that are located on the scheduler host are served by the scheduler.
+func (s *SchedulerServer) prepareSidecars() ([]*mesos.CommandInfo_URI, error) {
+	data, err := ioutil.ReadFile(s.SidecarConfig)
+	if err != nil {
+		return nil, err
+	}
+	sidecars, err := config.ParseSidecars(data)
+	if err != nil {
+		return nil, err
+	}
+	uris := []*mesos.CommandInfo_URI{}
+	for i := range sidecars {
+		sidecar := &sidecars[i]
+		var uri *string
+		if sidecar.IsRemote() {
+			uri = proto.String(sidecar.URI)
+		} else {
+			uri, _ = s.serveExecutorArtifact(sidecar.URI)
+		}
+		log.V(1).Infof("shipping sidecar %v from %v", sidecar.Name, *uri)
+		uris = append(uris, &mesos.CommandInfo_URI{Value: uri, Executable: proto.Bool(true)})
+	}
+	return uris, nil
+}
+
 // TODO(jdef): hacked from kubelet/server/server.go
 // TODO(k8s): replace this with clientcmd
 func (s *SchedulerServer) createAPIServerClient() (*client.Client, error) {
@@ -254,7 +383,45 @@ func (s *SchedulerServer) Run(_ []string) error {
 
 	// Create mesos scheduler driver.
 	executor := s.prepareExecutorInfo()
-	mesosPodScheduler := scheduler.New(executor, scheduler.FCFSScheduleFunc, client, etcdClient)
+	priorities, err := scheduler.ParsePriorityPolicy(s.NamespacePriorities)
+	if err != nil {
+		log.Fatalf("Misconfigured namespace priority classes: %v", err)
+	}
+	weights, err := scheduler.ParseNamespaceWeights(s.NamespaceWeights)
+	if err != nil {
+		log.Fatalf("Misconfigured namespace weights: %v", err)
+	}
+	backoff, err := scheduler.ParseBackoffStrategy(s.PodBackoffStrategy)
+	if err != nil {
+		log.Fatalf("Misconfigured pod backoff: %v", err)
+	}
+	orphans, err := s.orphanConfig()
+	if err != nil {
+		log.Fatalf("Misconfigured orphan detection: %v", err)
+	}
+	decisions, err := s.decisionLogConfig()
+	if err != nil {
+		log.Fatalf("Misconfigured decision log: %v", err)
+	}
+	var tracer *trace.Tracer
+	if s.TraceFile != "" {
+		if tracer, err = trace.NewFileTracer("k8sm-scheduler", s.TraceFile); err != nil {
+			log.Fatalf("Misconfigured tracing: %v", err)
+		}
+	}
+	mesosPodScheduler := scheduler.New(scheduler.Config{
+		Executor:     executor,
+		ScheduleFunc: scheduler.FCFSScheduleFunc,
+		Client:       client,
+		EtcdClient:   etcdClient,
+		Priorities:   priorities,
+		Aging:        s.PriorityAging,
+		Weights:      weights,
+		Backoff:      backoff,
+		Orphans:      orphans,
+		Decisions:    decisions,
+		Tracer:       tracer,
+	})
 	info, cred, err := s.buildFrameworkInfo(etcdClient)
 	if err != nil {
 		log.Fatalf("Misconfigured mesos framework: %v", err)
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/mesosphere/kubernetes-mesos/pkg/queue"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/meta"
+	"github.com/spf13/pflag"
+)
+
+// SimulationServer runs a workload against a simulated cluster, without
+// mesos or kubernetes, and reports where its pods were placed.
+type SimulationServer struct {
+	ClusterFile         string
+	WorkloadFile        string
+	Output              string
+	NamespacePriorities string
+	PriorityAging       time.Duration
+	NamespaceWeights    string
+	PodBackoffStrategy  string
+}
+
+// NewSimulationServer creates a new SimulationServer with default parameters
+func NewSimulationServer() *SimulationServer {
+	return &SimulationServer{
+		Output:             "text",
+		PodBackoffStrategy: "exponential",
+		PriorityAging:      queue.DefaultPriorityAging,
+	}
+}
+
+func (s *SimulationServer) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&s.ClusterFile, "cluster", s.ClusterFile, "Path to a YAML or JSON file that declares the slaves of the simulated cluster.")
+	fs.StringVar(&s.WorkloadFile, "workload", s.WorkloadFile, "Path to a YAML or JSON file that declares the pods to schedule.")
+	fs.StringVar(&s.Output, "output", s.Output, "Format of the simulation report, one of [text json].")
+	fs.StringVar(&s.NamespacePriorities, "namespace_priority_classes", s.NamespacePriorities, fmt.Sprintf("Default priority class of pods, by namespace: comma separated namespace=class pairs where class is one of %v. Pods may override it with the %v annotation.", scheduler.PriorityClasses(), meta.PriorityClassKey))
+	fs.DurationVar(&s.PriorityAging, "priority_aging", s.PriorityAging, "Time that a queued pod must wait to be scheduled ahead of pods one priority class above it.")
+	fs.StringVar(&s.NamespaceWeights, "namespace_weights", s.NamespaceWeights, "Fair shares of cluster resources, by namespace: comma separated namespace=weight pairs. Namespaces that aren't listed have a weight of 1.")
+	fs.StringVar(&s.PodBackoffStrategy, "pod_backoff_strategy", s.PodBackoffStrategy, fmt.Sprintf("Backoff strategy of pods that fail to schedule, one of %v.", scheduler.BackoffStrategies()))
+}
+
+func (s *SimulationServer) Run(_ []string) error {
+	if s.ClusterFile == "" || s.WorkloadFile == "" {
+		return errors.New("both -cluster and -workload are required")
+	}
+	if s.Output != "text" && s.Output != "json" {
+		return fmt.Errorf("unsupported output format %q", s.Output)
+	}
+	data, err := ioutil.ReadFile(s.ClusterFile)
+	if err != nil {
+		return err
+	}
+	cluster, err := scheduler.ParseSimulatedCluster(data)
+	if err != nil {
+		return fmt.Errorf("misconfigured cluster %v: %v", s.ClusterFile, err)
+	}
+	data, err = ioutil.ReadFile(s.WorkloadFile)
+	if err != nil {
+		return err
+	}
+	workload, err := scheduler.ParseSimulatedWorkload(data)
+	if err != nil {
+		return fmt.Errorf("misconfigured workload %v: %v", s.WorkloadFile, err)
+	}
+	priorities, err := scheduler.ParsePriorityPolicy(s.NamespacePriorities)
+	if err != nil {
+		return fmt.Errorf("misconfigured namespace priority classes: %v", err)
+	}
+	weights, err := scheduler.ParseNamespaceWeights(s.NamespaceWeights)
+	if err != nil {
+		return fmt.Errorf("misconfigured namespace weights: %v", err)
+	}
+	backoff, err := scheduler.ParseBackoffStrategy(s.PodBackoffStrategy)
+	if err != nil {
+		return fmt.Errorf("misconfigured pod backoff: %v", err)
+	}
+
+	report, err := scheduler.Simulate(cluster, workload, scheduler.Config{
+		Priorities: priorities,
+		Aging:      s.PriorityAging,
+		Weights:    weights,
+		Backoff:    backoff,
+	})
+	if err != nil {
+		return err
+	}
+	if s.Output == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(os.Stdout, "%s\n", data)
+		return err
+	}
+	return report.Write(os.Stdout)
+}
@@ -0,0 +1,528 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/gogo/protobuf/proto"
+	log "github.com/golang/glog"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	mutil "github.com/mesos/mesos-go/mesosutil"
+	bindings "github.com/mesos/mesos-go/scheduler"
+	"github.com/mesosphere/kubernetes-mesos/pkg/clock"
+	"github.com/mesosphere/kubernetes-mesos/pkg/fakemesos"
+	"github.com/mesosphere/kubernetes-mesos/pkg/queue"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+	"gopkg.in/v2/yaml"
+)
+
+const defaultSimulatedOfferInterval = 1 * time.Second
+
+// SimulatedSlave declares one or more identical slaves of a simulated cluster.
+type SimulatedSlave struct {
+	Hostname   string                `json:"hostname"`
+	Count      int                   `json:"count,omitempty"` // if > 1, hostnames are suffixed with an index
+	Cpus       float64               `json:"cpus"`
+	Mem        float64               `json:"mem"` // MB
+	Ports      []fakemesos.PortRange `json:"ports,omitempty"`
+	Attributes map[string]string     `json:"attributes,omitempty"`
+}
+
+type SimulatedCluster struct {
+	Slaves []SimulatedSlave `json:"slaves"`
+}
+
+// SimulatedPods declares replicas of a pod spec.
+type SimulatedPods struct {
+	Replicas int     `json:"replicas,omitempty"` // if > 1, pod names are suffixed with an index
+	Pod      api.Pod `json:"pod"`
+}
+
+type SimulatedWorkload struct {
+	Pods []SimulatedPods `json:"pods"`
+}
+
+// decodes YAML, or JSON, into a value whose fields carry json tags: the api
+// types only declare json tags.
+func decodeYAMLOrJSON(data []byte, v interface{}) error {
+	var x interface{}
+	if err := yaml.Unmarshal(data, &x); err != nil {
+		return err
+	}
+	data, err := json.Marshal(jsonify(x))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// converts the maps decoded by yaml, which are keyed by interface{}, into maps
+// that encoding/json can marshal
+func jsonify(x interface{}) interface{} {
+	switch x := x.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, v := range x {
+			m[fmt.Sprint(k)] = jsonify(v)
+		}
+		return m
+	case []interface{}:
+		for i := range x {
+			x[i] = jsonify(x[i])
+		}
+	}
+	return x
+}
+
+// ParseSimulatedCluster decodes and validates a YAML (or JSON) cluster description.
+func ParseSimulatedCluster(data []byte) (*SimulatedCluster, error) {
+	cluster := &SimulatedCluster{}
+	if err := decodeYAMLOrJSON(data, cluster); err != nil {
+		return nil, err
+	}
+	if len(cluster.Slaves) == 0 {
+		return nil, fmt.Errorf("cluster has no slaves")
+	}
+	for i := range cluster.Slaves {
+		s := &cluster.Slaves[i]
+		if s.Hostname == "" {
+			return nil, fmt.Errorf("slave %d has no hostname", i)
+		}
+		if s.Count < 0 || s.Cpus < 0 || s.Mem < 0 {
+			return nil, fmt.Errorf("slave %q has a negative count or resources", s.Hostname)
+		}
+		if s.Count == 0 {
+			s.Count = 1
+		}
+		for _, r := range s.Ports {
+			if r.Begin > r.End {
+				return nil, fmt.Errorf("slave %q has an invalid port range %d-%d", s.Hostname, r.Begin, r.End)
+			}
+		}
+	}
+	return cluster, nil
+}
+
+// ParseSimulatedWorkload decodes and validates a YAML (or JSON) list of pod specs.
+func ParseSimulatedWorkload(data []byte) (*SimulatedWorkload, error) {
+	workload := &SimulatedWorkload{}
+	if err := decodeYAMLOrJSON(data, workload); err != nil {
+		return nil, err
+	}
+	for i := range workload.Pods {
+		p := &workload.Pods[i]
+		if p.Pod.Name == "" {
+			return nil, fmt.Errorf("pod %d has no name", i)
+		}
+		if p.Replicas < 0 {
+			return nil, fmt.Errorf("pod %q has a negative number of replicas", p.Pod.Name)
+		}
+		if p.Replicas == 0 {
+			p.Replicas = 1
+		}
+		if p.Pod.Namespace == "" {
+			p.Pod.Namespace = api.NamespaceDefault
+		}
+	}
+	return workload, nil
+}
+
+type SimulatedPlacement struct {
+	Pod  string        `json:"pod"`
+	Host string        `json:"host"`
+	Time time.Duration `json:"time"` // virtual time since the start of the simulation
+}
+
+type SimulatedFailure struct {
+	Pod      string `json:"pod"`
+	Attempts int    `json:"attempts"`
+	Reason   string `json:"reason"` // of the most recent attempt
+}
+
+type SimulatedUsage struct {
+	Hostname string  `json:"hostname"`
+	Tasks    int     `json:"tasks"`
+	Cpus     float64 `json:"cpus"`
+	Mem      float64 `json:"mem"`
+	UsedCpus float64 `json:"usedCpus"`
+	UsedMem  float64 `json:"usedMem"`
+}
+
+// describes how the unallocated resources of the cluster are spread across
+// its slaves. resources are stranded on slaves that lack either the cpus or
+// the memory to launch another task of the workload.
+type SimulatedFragmentation struct {
+	FreeCpus        float64 `json:"freeCpus"`
+	FreeMem         float64 `json:"freeMem"`
+	LargestFreeCpus float64 `json:"largestFreeCpus"` // on a single slave
+	LargestFreeMem  float64 `json:"largestFreeMem"`  // on a single slave
+	StrandedCpus    float64 `json:"strandedCpus"`
+	StrandedMem     float64 `json:"strandedMem"`
+}
+
+type SimulationReport struct {
+	Pods          int                    `json:"pods"`
+	Placed        int                    `json:"placed"`
+	OfferCycles   int                    `json:"offerCycles"`
+	Elapsed       time.Duration          `json:"elapsed"` // virtual time
+	Placements    []SimulatedPlacement   `json:"placements"`
+	Unschedulable []SimulatedFailure     `json:"unschedulable"`
+	Slaves        []SimulatedUsage       `json:"slaves"`
+	Fragmentation SimulatedFragmentation `json:"fragmentation"`
+}
+
+// Write prints the report as a series of tables.
+func (r *SimulationReport) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "placed %d of %d pods in %d offer cycles (%v of virtual time)\n\n", r.Placed, r.Pods, r.OfferCycles, r.Elapsed)
+
+	fmt.Fprintln(tw, "POD\tHOST\tTIME")
+	for _, p := range r.Placements {
+		fmt.Fprintf(tw, "%s\t%s\t%v\n", p.Pod, p.Host, p.Time)
+	}
+
+	fmt.Fprintln(tw, "\nHOST\tTASKS\tCPUS\tMEM")
+	for _, s := range r.Slaves {
+		fmt.Fprintf(tw, "%s\t%d\t%.2f/%.2f\t%.0f/%.0f\n", s.Hostname, s.Tasks, s.UsedCpus, s.Cpus, s.UsedMem, s.Mem)
+	}
+
+	f := r.Fragmentation
+	fmt.Fprintf(tw, "\nfree: %.2f cpus and %.0f MB, at most %.2f cpus and %.0f MB on a single slave\n",
+		f.FreeCpus, f.FreeMem, f.LargestFreeCpus, f.LargestFreeMem)
+	fmt.Fprintf(tw, "stranded: %.2f cpus and %.0f MB on slaves that can't launch another task\n", f.StrandedCpus, f.StrandedMem)
+
+	if len(r.Unschedulable) > 0 {
+		fmt.Fprintln(tw, "\nUNSCHEDULABLE POD\tATTEMPTS\tREASON")
+		for _, p := range r.Unschedulable {
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", p.Pod, p.Attempts, p.Reason)
+		}
+	}
+	return tw.Flush()
+}
+
+// registers with the fake master without storing the framework id in etcd,
+// or starting task reconciliation
+type simulatedScheduler struct {
+	*KubernetesScheduler
+}
+
+func (k *simulatedScheduler) Registered(driver bindings.SchedulerDriver, frameworkId *mesos.FrameworkID, masterInfo *mesos.MasterInfo) {
+	k.frameworkId = frameworkId
+	k.masterInfo = masterInfo
+	k.registered = true
+}
+
+// a pod that failed to schedule, waiting for its backoff to expire
+type simulatedRetry struct {
+	pod      *api.Pod
+	due      time.Time
+	attempts int
+	reason   string
+	placed   int // number of pods placed as of the most recent attempt
+}
+
+type simulation struct {
+	api      *k8smScheduler
+	master   *fakemesos.Master
+	queue    *queuer
+	sched    *kubeScheduler
+	binder   *binder
+	backoff  *podBackoff
+	clock    *clock.Fake
+	start    time.Time
+	interval time.Duration
+	usage    map[string]*SimulatedUsage // by slave id
+	retries  map[string]*simulatedRetry // by pod key
+	report   *SimulationReport
+	minCpus  float64 // smallest demand of the tasks of the workload
+	minMem   float64
+}
+
+// Simulate runs the workload through the scheduling queue, the schedule
+// func, and the offer registry, against an in-memory mesos cluster. Pods
+// that fail to schedule back off in virtual time, which advances by an offer
+// interval per offer cycle, and the simulation ends once the remaining pods
+// have failed to schedule since the most recent placement. Preemption and pod
+// groups aren't simulated. The client, etcd client, executor and clock of the
+// config are ignored: the scheduler runs on the virtual clock instead.
+func Simulate(cluster *SimulatedCluster, workload *SimulatedWorkload, config Config) (*SimulationReport, error) {
+	if config.ScheduleFunc == nil {
+		config.ScheduleFunc = FCFSScheduleFunc
+	}
+	config.Client = nil
+	config.EtcdClient = nil
+	start := time.Now()
+	virtual := clock.NewFake(start)
+	config.Clock = virtual
+	config.Executor = &mesos.ExecutorInfo{
+		ExecutorId: mutil.NewExecutorID("simulated-executor"),
+		Command:    &mesos.CommandInfo{Value: proto.String("true")},
+	}
+	k := New(config)
+
+	master := fakemesos.NewMaster()
+	defer master.Close()
+
+	s := &simulation{
+		api:      &k8smScheduler{k},
+		master:   master,
+		clock:    virtual,
+		start:    start,
+		interval: defaultSimulatedOfferInterval,
+		backoff:  newPodBackoff(k.backoff, virtual),
+		usage:    map[string]*SimulatedUsage{},
+		retries:  map[string]*simulatedRetry{},
+		report:   &SimulationReport{Placements: []SimulatedPlacement{}, Unschedulable: []SimulatedFailure{}},
+		minCpus:  math.Inf(1),
+		minMem:   math.Inf(1),
+	}
+	for _, spec := range cluster.Slaves {
+		for i := 0; i < spec.Count; i++ {
+			hostname := spec.Hostname
+			if spec.Count > 1 {
+				hostname = fmt.Sprintf("%s-%d", spec.Hostname, i)
+			}
+			id := master.AddSlave(fakemesos.SlaveConfig{
+				Hostname:   hostname,
+				Cpus:       spec.Cpus,
+				Mem:        spec.Mem,
+				Ports:      spec.Ports,
+				Attributes: spec.Attributes,
+			})
+			s.usage[id] = &SimulatedUsage{Hostname: hostname, Cpus: spec.Cpus, Mem: spec.Mem}
+		}
+	}
+
+	driver := master.NewSchedulerDriver(&simulatedScheduler{k}, &mesos.FrameworkInfo{
+		Name: proto.String("simulation"),
+		User: proto.String("simulation"),
+	})
+	k.Init(driver, nil)
+	if _, err := driver.Start(); err != nil {
+		return nil, err
+	}
+	defer driver.Stop(false)
+	master.Flush()
+
+	store := &podStoreAdapter{queue.NewHistorical(nil)}
+	s.queue = newQueuer(store, s.api.namespaceShares, k.clock)
+	s.queue.priorities = k.priorities
+	if k.aging > 0 {
+		s.queue.podQueue.SetAging(k.aging)
+	}
+	s.sched = &kubeScheduler{api: s.api, podUpdates: store}
+	s.binder = &binder{api: s.api}
+
+	s.queue.lock.Lock()
+	for i := range workload.Pods {
+		spec := &workload.Pods[i]
+		for j := 0; j < spec.Replicas; j++ {
+			pod := spec.Pod
+			if spec.Replicas > 1 {
+				pod.Name = fmt.Sprintf("%s-%d", spec.Pod.Name, j)
+			}
+			store.Add(&pod)
+			s.queue.enqueue(&Pod{Pod: &pod})
+			s.report.Pods++
+		}
+	}
+	s.queue.lock.Unlock()
+
+	s.run()
+	return s.report, nil
+}
+
+func (s *simulation) run() {
+	for {
+		s.report.OfferCycles++
+		s.master.OfferCycle()
+		s.master.Flush()
+
+		for pod := s.next(); pod != nil; pod = s.next() {
+			s.schedule(pod)
+		}
+		if len(s.retries) == 0 {
+			break
+		}
+
+		// stop once placements can no longer change
+		stalled := true
+		var due time.Time
+		for _, r := range s.retries {
+			if r.placed != s.report.Placed {
+				stalled = false
+			}
+			if due.IsZero() || r.due.Before(due) {
+				due = r.due
+			}
+		}
+		if stalled {
+			break
+		}
+		s.declineOffers()
+		s.clock.Step(s.interval)
+		if due.After(s.clock.Now()) {
+			s.clock.Set(due)
+		}
+
+		// requeue the pods whose backoff has expired
+		s.queue.lock.Lock()
+		for key, r := range s.retries {
+			if !r.due.After(s.clock.Now()) {
+				delete(s.retries, key)
+				s.queue.enqueue(&Pod{Pod: r.pod})
+			}
+		}
+		s.queue.lock.Unlock()
+	}
+
+	s.report.Elapsed = s.clock.Now().Sub(s.start)
+	s.summarize()
+}
+
+// declines the offers that are left over from the cycle, before virtual time
+// advances past their expiration, so that the master offers their resources
+// again in the next cycle.
+func (s *simulation) declineOffers() {
+	for _, offer := range s.api.offers.List() {
+		if !offer.Lingering && !offer.Acquired {
+			s.api.offers.Delete(offer.Id)
+		}
+	}
+	s.master.Flush()
+}
+
+// returns the next pod in the scheduling queue that's due in virtual time, or
+// nil if there's none; waiting would block forever, since virtual time only
+// advances between offer cycles.
+func (s *simulation) next() *api.Pod {
+	if x := s.queue.podQueue.TryPop(); x != nil {
+		return x.(*Pod).Pod
+	}
+	return nil
+}
+
+// schedules and launches the task of the pod, recording a retry upon failure
+func (s *simulation) schedule(pod *api.Pod) {
+	ctx := api.WithNamespace(api.NewDefaultContext(), pod.Namespace)
+	podKey, err := podtask.MakePodKey(ctx, pod.Name)
+	if err != nil {
+		log.Errorf("skipping simulated pod %v: %v", pod.Name, err)
+		return
+	}
+	host, err := s.sched.Schedule(*pod, nil)
+	if err == nil {
+		err = s.launch(podKey, host)
+	}
+	if err != nil {
+		s.fail(podKey, pod, err)
+		return
+	}
+	// the remaining resources of the slave are offered for the next pod
+	s.master.OfferCycle()
+	s.master.Flush()
+}
+
+func (s *simulation) launch(podKey, host string) error {
+	s.api.Lock()
+	defer s.api.Unlock()
+
+	taskId, _ := s.api.taskForPod(podKey)
+	task, state := s.api.getTask(taskId)
+	if state != podtask.StatePending {
+		return fmt.Errorf("task %v of pod %v is not pending", taskId, podKey)
+	}
+	cpus, mem := task.Demand()
+	s.minCpus, s.minMem = math.Min(s.minCpus, cpus), math.Min(s.minMem, mem)
+
+	if err := s.binder.launch(task, host); err != nil {
+		return err
+	}
+	if usage, found := s.usage[task.TaskInfo.GetSlaveId().GetValue()]; found {
+		cpus, mem := task.Allotment()
+		usage.Tasks++
+		usage.UsedCpus += cpus
+		usage.UsedMem += mem
+	}
+	s.report.Placed++
+	s.report.Placements = append(s.report.Placements, SimulatedPlacement{
+		Pod:  podKey,
+		Host: host,
+		Time: s.clock.Now().Sub(s.start),
+	})
+	return nil
+}
+
+func (s *simulation) fail(podKey string, pod *api.Pod, err error) {
+	reason := err.Error()
+	if err == noSuitableOffersErr {
+		reason = fmt.Sprintf("%v: %v", err, s.explain(podKey))
+	}
+	r, found := s.retries[podKey]
+	if !found {
+		r = &simulatedRetry{pod: pod}
+		s.retries[podKey] = r
+	}
+	r.attempts++
+	r.reason = reason
+	r.placed = s.report.Placed
+	r.due = s.clock.Now().Add(s.backoff.getBackoff(podKey, pod))
+	log.V(2).Infof("simulated pod %v failed to schedule: %v", podKey, reason)
+}
+
+func (s *simulation) explain(podKey string) string {
+	s.api.RLock()
+	defer s.api.RUnlock()
+
+	taskId, _ := s.api.taskForPod(podKey)
+	if task, state := s.api.getTask(taskId); state == podtask.StatePending {
+		cpus, mem := task.Demand()
+		s.minCpus, s.minMem = math.Min(s.minCpus, cpus), math.Min(s.minMem, mem)
+		return explainDeclines(s.api.offers(), s.api, task)
+	}
+	return "no pending task"
+}
+
+func (s *simulation) summarize() {
+	for key, r := range s.retries {
+		s.report.Unschedulable = append(s.report.Unschedulable, SimulatedFailure{
+			Pod:      key,
+			Attempts: r.attempts,
+			Reason:   r.reason,
+		})
+	}
+	sort.Sort(simulatedFailures(s.report.Unschedulable))
+
+	f := &s.report.Fragmentation
+	for _, usage := range s.usage {
+		s.report.Slaves = append(s.report.Slaves, *usage)
+		cpus, mem := usage.Cpus-usage.UsedCpus, usage.Mem-usage.UsedMem
+		f.FreeCpus += cpus
+		f.FreeMem += mem
+		f.LargestFreeCpus = math.Max(f.LargestFreeCpus, cpus)
+		f.LargestFreeMem = math.Max(f.LargestFreeMem, mem)
+		if !math.IsInf(s.minCpus, 1) && (cpus < s.minCpus || mem < s.minMem) {
+			f.StrandedCpus += cpus
+			f.StrandedMem += mem
+		}
+	}
+	sort.Sort(simulatedUsages(s.report.Slaves))
+}
+
+type simulatedFailures []SimulatedFailure
+
+func (s simulatedFailures) Len() int           { return len(s) }
+func (s simulatedFailures) Less(i, j int) bool { return s[i].Pod < s[j].Pod }
+func (s simulatedFailures) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+type simulatedUsages []SimulatedUsage
+
+func (s simulatedUsages) Len() int           { return len(s) }
+func (s simulatedUsages) Less(i, j int) bool { return s[i].Hostname < s[j].Hostname }
+func (s simulatedUsages) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
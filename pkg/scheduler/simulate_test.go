@@ -0,0 +1,128 @@
+package scheduler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/mesosphere/kubernetes-mesos/pkg/fakemesos"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSimulatedCluster(t *testing.T) {
+	assert := assert.New(t)
+
+	cluster, err := ParseSimulatedCluster([]byte(`
+slaves:
+- hostname: small
+  count: 3
+  cpus: 1
+  mem: 1024
+  ports:
+  - begin: 31000
+    end: 31100
+  attributes:
+    rack: r1
+- hostname: big
+  cpus: 8
+  mem: 16384
+`))
+	assert.Nil(err)
+	assert.Equal(&SimulatedCluster{Slaves: []SimulatedSlave{
+		{
+			Hostname:   "small",
+			Count:      3,
+			Cpus:       1,
+			Mem:        1024,
+			Ports:      []fakemesos.PortRange{{Begin: 31000, End: 31100}},
+			Attributes: map[string]string{"rack": "r1"},
+		},
+		{Hostname: "big", Count: 1, Cpus: 8, Mem: 16384},
+	}}, cluster)
+
+	_, err = ParseSimulatedCluster([]byte(`{"slaves": []}`))
+	assert.NotNil(err)
+	_, err = ParseSimulatedCluster([]byte(`{"slaves": [{"cpus": 1}]}`))
+	assert.NotNil(err)
+	_, err = ParseSimulatedCluster([]byte(`{"slaves": [{"hostname": "h", "ports": [{"begin": 2, "end": 1}]}]}`))
+	assert.NotNil(err)
+}
+
+func TestParseSimulatedWorkload(t *testing.T) {
+	assert := assert.New(t)
+
+	workload, err := ParseSimulatedWorkload([]byte(`{
+  "pods": [{
+    "replicas": 2,
+    "pod": {
+      "metadata": {"name": "web", "labels": {"app": "web"}},
+      "spec": {"containers": [{"name": "nginx", "image": "nginx"}]}
+    }
+  }]
+}`))
+	assert.Nil(err)
+	assert.Equal(1, len(workload.Pods))
+	p := workload.Pods[0]
+	assert.Equal(2, p.Replicas)
+	assert.Equal("web", p.Pod.Name)
+	assert.Equal(api.NamespaceDefault, p.Pod.Namespace)
+	assert.Equal("web", p.Pod.Labels["app"])
+	assert.Equal("nginx", p.Pod.Spec.Containers[0].Image)
+
+	_, err = ParseSimulatedWorkload([]byte(`pods: [{pod: {spec: {}}}]`))
+	assert.NotNil(err)
+}
+
+func TestSimulate(t *testing.T) {
+	assert := assert.New(t)
+
+	// each slave fits four tasks
+	cluster := &SimulatedCluster{Slaves: []SimulatedSlave{{Hostname: "h", Count: 2, Cpus: 1, Mem: 1024}}}
+	workload := &SimulatedWorkload{Pods: []SimulatedPods{{
+		Replicas: 10,
+		Pod: api.Pod{
+			ObjectMeta: api.ObjectMeta{Name: "web", Namespace: api.NamespaceDefault},
+			Spec:       api.PodSpec{Containers: []api.Container{{Name: "web", Image: "nginx"}}},
+		},
+	}}}
+	task, err := podtask.New(api.NewDefaultContext(), &workload.Pods[0].Pod, &mesos.ExecutorInfo{})
+	assert.Nil(err)
+	cpus, mem := task.Demand()
+	assert.Equal(1.0, 4*cpus)
+
+	// virtual time passes without waiting on the wall clock
+	var report *SimulationReport
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		report, err = Simulate(cluster, workload, Config{})
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatalf("timed out waiting for the simulation")
+	}
+	assert.Nil(err)
+
+	assert.Equal(10, report.Pods)
+	assert.Equal(8, report.Placed)
+	assert.Equal(8, len(report.Placements))
+	assert.Equal(2, len(report.Unschedulable))
+	for _, f := range report.Unschedulable {
+		assert.True(strings.Contains(f.Reason, "insufficient resources"), f.Reason)
+	}
+	assert.Equal([]SimulatedUsage{
+		{Hostname: "h-0", Tasks: 4, Cpus: 1, Mem: 1024, UsedCpus: 4 * cpus, UsedMem: 4 * mem},
+		{Hostname: "h-1", Tasks: 4, Cpus: 1, Mem: 1024, UsedCpus: 4 * cpus, UsedMem: 4 * mem},
+	}, report.Slaves)
+	assert.Equal(0.0, report.Fragmentation.FreeCpus)
+	assert.Equal(2*(1024-4*mem), report.Fragmentation.StrandedMem)
+
+	buf := &bytes.Buffer{}
+	assert.Nil(report.Write(buf))
+	assert.True(strings.HasPrefix(buf.String(), "placed 8 of 10 pods"))
+}
@@ -25,9 +25,24 @@ type PodScheduleFunc func(r offers.Registry, slaves SlaveIndex, task *podtask.T)
 type empty struct{}
 
 var (
-	noSuitableOffersErr = errors.New("No suitable offers for pod/task")
-	noSuchPodErr        = errors.New("No such pod exists")
-	noSuchTaskErr       = errors.New("No such task exists")
+	noSuitableOffersErr  = errors.New("No suitable offers for pod/task")
+	noSuchPodErr         = errors.New("No such pod exists")
+	noSuchTaskErr        = errors.New("No such task exists")
+	gangIncompleteErr    = errors.New("Waiting for more members of the pod group")
+	placementViolatedErr = errors.New("Placement constraints violated")
+	affinityViolatedErr  = errors.New("Affinity constraints violated")
+	slaveDrainingErr     = errors.New("Slave is draining")
+	notRegisteredErr     = errors.New("Scheduler is not registered with a mesos master")
+	reconcilingErr       = errors.New("Task reconciliation is already running")
+	podDeletedErr        = errors.New("Pod was deleted before its task was launched")
+)
+
+// reasons for killing a task, reported alongside kill requests
+const (
+	killReasonDeleted   = "pod-deleted"
+	killReasonPreempted = "preempted"
+	killReasonDrained   = "slave-drained"
+	killReasonOrphaned  = "orphaned"
 )
 
 // adapter for k8s pkg/scheduler/Scheduler interface
@@ -39,4 +54,5 @@ func (f SchedulerFunc) Schedule(pod api.Pod, lister algorithm.MinionLister) (str
 
 type SlaveIndex interface {
 	slaveFor(id string) (*Slave, bool)
+	listSlaves() []string
 }
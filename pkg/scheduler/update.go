@@ -0,0 +1,117 @@
+package scheduler
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
+	log "github.com/golang/glog"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+)
+
+// returns the changes to the mutable state of a pod (labels, annotations and
+// container images), or nil if there are none. returns an error if any other
+// part of the pod spec has changed.
+func diffPod(old, new *api.Pod) (*messages.PodUpdate, error) {
+	if len(old.Spec.Containers) != len(new.Spec.Containers) {
+		return nil, fmt.Errorf("containers may not be added to or removed from pod %v", new.Name)
+	}
+	update := &messages.PodUpdate{
+		Labels:      new.Labels,
+		Annotations: new.Annotations,
+		Images:      map[string]string{},
+	}
+	spec := new.Spec
+	spec.Containers = append([]api.Container(nil), new.Spec.Containers...)
+	for i, c := range old.Spec.Containers {
+		if spec.Containers[i].Name != c.Name {
+			return nil, fmt.Errorf("containers of pod %v may not be renamed", new.Name)
+		}
+		if spec.Containers[i].Image != c.Image {
+			update.Images[c.Name] = spec.Containers[i].Image
+			spec.Containers[i].Image = c.Image
+		}
+	}
+	if !reflect.DeepEqual(old.Spec, spec) {
+		return nil, fmt.Errorf("only the images of the containers of pod %v may be updated", new.Name)
+	}
+	if len(update.Images) == 0 && sameStrings(old.Labels, new.Labels) && sameStrings(old.Annotations, new.Annotations) {
+		return nil, nil
+	}
+	return update, nil
+}
+
+// like reflect.DeepEqual except that nil and empty maps are equal
+func sameStrings(a, b map[string]string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// propagates updates of the mutable state of pods to their tasks. the tasks
+// of pods that have been launched are updated by the executor.
+type updater struct {
+	api      SchedulerInterface
+	recorder *eventRecorder
+}
+
+func (u *updater) updateOne(pod *Pod) error {
+	ctx := api.WithNamespace(api.NewDefaultContext(), pod.Namespace)
+	podKey, err := podtask.MakePodKey(ctx, pod.Name)
+	if err != nil {
+		return err
+	}
+
+	u.api.Lock()
+	defer u.api.Unlock()
+
+	taskId, exists := u.api.taskForPod(podKey)
+	if !exists {
+		// the scheduling queue always has the latest state of unscheduled pods
+		return nil
+	}
+	task, state := u.api.getTask(taskId)
+	switch state {
+	case podtask.StatePending, podtask.StateRunning:
+	default:
+		return nil
+	}
+	if pod.UID != task.Pod.UID {
+		// the pod was replaced, the deleter will catch up with the old one
+		log.V(2).Infof("ignoring update of pod %v, task %v belongs to an older incarnation", podKey, taskId)
+		return nil
+	}
+
+	update, err := diffPod(task.Pod, pod.Pod)
+	if err != nil {
+		u.recorder.Eventf(pod.Pod, invalidUpdateEvent, "%v", err)
+		return err
+	}
+	if update == nil {
+		return nil
+	}
+	update.TaskId = taskId
+
+	if state == podtask.StateRunning || task.Has(podtask.Launched) {
+		log.Infof("pushing update of pod %v to task %v", podKey, taskId)
+		if err := u.api.updateTask(task, update); err != nil {
+			return err
+		}
+	}
+
+	// task.Pod may be shared with the pod store, so don't modify it in place
+	updated := *task.Pod
+	update.Apply(&updated.ObjectMeta, &updated.Spec)
+	task.Pod = &updated
+	if task.TaskInfo != nil {
+		if slave, ok := u.api.slaveFor(task.TaskInfo.GetSlaveId().GetValue()); ok {
+			if _, indexed := slave.Tasks[taskId]; indexed {
+				slave.Tasks[taskId] = labels.Set(updated.Labels)
+			}
+		}
+	}
+	return nil
+}
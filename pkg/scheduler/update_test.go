@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
+	"github.com/mesosphere/kubernetes-mesos/pkg/scheduler/podtask"
+	"github.com/stretchr/testify/assert"
+)
+
+func updatablePod() *api.Pod {
+	return &api.Pod{
+		ObjectMeta: api.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+			UID:       "foo-1",
+			Labels:    map[string]string{"app": "web"},
+		},
+		Spec: api.PodSpec{
+			Containers: []api.Container{{Name: "web", Image: "nginx:1.7"}},
+		},
+	}
+}
+
+func TestDiffPod(t *testing.T) {
+	assert := assert.New(t)
+	old := updatablePod()
+
+	update, err := diffPod(old, updatablePod())
+	assert.NoError(err)
+	assert.Nil(update)
+
+	pod := updatablePod()
+	pod.Labels = map[string]string{"app": "web", "tier": "front"}
+	pod.Spec.Containers[0].Image = "nginx:1.8"
+	update, err = diffPod(old, pod)
+	assert.NoError(err)
+	assert.Equal(pod.Labels, update.Labels)
+	assert.Equal(map[string]string{"web": "nginx:1.8"}, update.Images)
+	assert.Equal("nginx:1.7", pod.Spec.Containers[0].Image)
+
+	pod = updatablePod()
+	pod.Spec.Containers = append(pod.Spec.Containers, api.Container{Name: "sidecar"})
+	_, err = diffPod(old, pod)
+	assert.Error(err)
+
+	pod = updatablePod()
+	pod.Spec.Containers[0].Ports = []api.Port{{ContainerPort: 80}}
+	_, err = diffPod(old, pod)
+	assert.Error(err)
+}
+
+func TestUpdateRunningPod(t *testing.T) {
+	assert := assert.New(t)
+	obj := &MockScheduler{}
+	u := &updater{api: obj}
+
+	task, err := podtask.New(api.NewDefaultContext(), updatablePod(), &mesos.ExecutorInfo{})
+	assert.NoError(err)
+	task.Set(podtask.Launched)
+	obj.On("taskForPod", task.GetPodKey()).Return(task.ID, true)
+	obj.On("getTask", task.ID).Return(task, podtask.StateRunning)
+	obj.On("slaveFor", "").Return(nil, false)
+
+	pod := updatablePod()
+	pod.Annotations = map[string]string{"owner": "ops"}
+	obj.On("updateTask", task, &messages.PodUpdate{
+		TaskId:      task.ID,
+		Labels:      pod.Labels,
+		Annotations: pod.Annotations,
+		Images:      map[string]string{},
+	}).Return(nil)
+	assert.NoError(u.updateOne(&Pod{Pod: pod}))
+	obj.AssertExpectations(t)
+	assert.Equal("ops", task.Pod.Annotations["owner"])
+
+	// immutable changes are rejected
+	pod = updatablePod()
+	pod.Spec.RestartPolicy = api.RestartPolicy{Never: &api.RestartPolicyNever{}}
+	assert.Error(u.updateOne(&Pod{Pod: pod}))
+}
@@ -0,0 +1,224 @@
+// Package trace records spans of work that cross process boundaries, such as
+// the launch of a pod by the scheduler, the executor and the apiserver. Trace
+// context is propagated in the W3C traceparent format and finished spans are
+// exported in the Zipkin v2 JSON format.
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+// Context identifies a span within a trace
+type Context struct {
+	TraceId string // 32 hex digits
+	SpanId  string // 16 hex digits
+}
+
+// String returns the context in the W3C traceparent format
+func (c Context) String() string {
+	return fmt.Sprintf("00-%s-%s-01", c.TraceId, c.SpanId)
+}
+
+// Parse reads a context in the W3C traceparent format
+func Parse(s string) (*Context, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 4 || parts[0] != "00" || !isHex(parts[1], 32) || !isHex(parts[2], 16) {
+		return nil, fmt.Errorf("malformed trace context %q", s)
+	}
+	return &Context{TraceId: parts[1], SpanId: parts[2]}, nil
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n || strings.Trim(s, "0") == "" {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// Exporter receives spans as they finish
+type Exporter interface {
+	Export(s *Span) error
+}
+
+// Tracer starts the spans of a service. A nil *Tracer is valid and starts nil
+// spans, whose methods do nothing, so that tracing may be disabled at no cost.
+type Tracer struct {
+	Service  string
+	Exporter Exporter
+}
+
+func New(service string, exporter Exporter) *Tracer {
+	return &Tracer{Service: service, Exporter: exporter}
+}
+
+// Start begins a span; a nil parent begins a new trace
+func (t *Tracer) Start(name string, parent *Context) *Span {
+	if t == nil || t.Exporter == nil {
+		return nil
+	}
+	s := &Span{
+		tracer: t,
+		name:   name,
+		start:  time.Now(),
+		tags:   map[string]string{},
+	}
+	if parent != nil {
+		s.context.TraceId = parent.TraceId
+		s.parentId = parent.SpanId
+	} else {
+		s.context.TraceId = newId(16)
+	}
+	s.context.SpanId = newId(8)
+	return s
+}
+
+func newId(bytes int) string {
+	b := make([]byte, bytes)
+	if _, err := rand.Read(b); err != nil {
+		// fall back to the clock, ids need only be unlikely to collide
+		now := time.Now().UnixNano()
+		for i := range b {
+			b[i] = byte(now >> uint(8*(i%8)))
+		}
+	}
+	return hex.EncodeToString(b)
+}
+
+// Span is a timed operation within a trace
+type Span struct {
+	tracer   *Tracer
+	context  Context
+	parentId string
+	name     string
+	start    time.Time
+
+	lock     sync.Mutex
+	tags     map[string]string
+	duration time.Duration
+	finished bool
+}
+
+// Context returns the context of the span, or nil if the span is nil
+func (s *Span) Context() *Context {
+	if s == nil {
+		return nil
+	}
+	c := s.context
+	return &c
+}
+
+// Child begins a span of the same service whose parent is this span
+func (s *Span) Child(name string) *Span {
+	if s == nil {
+		return nil
+	}
+	return s.tracer.Start(name, &s.context)
+}
+
+func (s *Span) Tag(key, value string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.tags[key] = value
+}
+
+// SetError tags the span with the error, if any
+func (s *Span) SetError(err error) {
+	if err != nil {
+		s.Tag("error", err.Error())
+	}
+}
+
+// Finish ends the span and exports it; spans are exported at most once
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if s.finished {
+		s.lock.Unlock()
+		return
+	}
+	s.finished = true
+	s.duration = time.Since(s.start)
+	s.lock.Unlock()
+
+	if err := s.tracer.Exporter.Export(s); err != nil {
+		// tracing is best effort, never fatal
+		log.Warningf("failed to export span %v of trace %v: %v", s.context.SpanId, s.context.TraceId, err)
+	}
+}
+
+// a span in the Zipkin v2 JSON format
+type zipkinSpan struct {
+	TraceId       string            `json:"traceId"`
+	Id            string            `json:"id"`
+	ParentId      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	Timestamp     int64             `json:"timestamp"` // microseconds since the epoch
+	Duration      int64             `json:"duration"`  // microseconds
+	LocalEndpoint zipkinEndpoint    `json:"localEndpoint"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// MarshalJSON encodes the span in the Zipkin v2 JSON format
+func (s *Span) MarshalJSON() ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	z := &zipkinSpan{
+		TraceId:       s.context.TraceId,
+		Id:            s.context.SpanId,
+		ParentId:      s.parentId,
+		Name:          s.name,
+		Timestamp:     s.start.UnixNano() / int64(time.Microsecond),
+		Duration:      int64(s.duration / time.Microsecond),
+		LocalEndpoint: zipkinEndpoint{ServiceName: s.tracer.Service},
+		Tags:          s.tags,
+	}
+	return json.Marshal(z)
+}
+
+// FileExporter writes each span that it receives as a line of JSON, which is
+// convenient for local testing. A list of spans, in brackets, may be posted
+// to the /api/v2/spans endpoint of Zipkin.
+type FileExporter struct {
+	lock sync.Mutex
+	out  *json.Encoder
+}
+
+func NewFileExporter(w io.Writer) *FileExporter {
+	return &FileExporter{out: json.NewEncoder(w)}
+}
+
+func (e *FileExporter) Export(s *Span) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.out.Encode(s)
+}
+
+// NewFileTracer returns a tracer that appends the spans of the service to the
+// file at path
+func NewFileTracer(service, path string) (*Tracer, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return New(service, NewFileExporter(f)), nil
+}
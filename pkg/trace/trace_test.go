@@ -0,0 +1,85 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext(t *testing.T) {
+	assert := assert.New(t)
+	c := Context{TraceId: "4bf92f3577b34da6a3ce929d0e0e4736", SpanId: "00f067aa0ba902b7"}
+	assert.Equal("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", c.String())
+
+	parsed, err := Parse(c.String())
+	if assert.NoError(err) {
+		assert.Equal(c, *parsed)
+	}
+	for _, s := range []string{
+		"",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902bx-01",
+	} {
+		_, err := Parse(s)
+		assert.Error(err, s)
+	}
+}
+
+func TestSpans(t *testing.T) {
+	assert := assert.New(t)
+	out := &bytes.Buffer{}
+	tracer := New("scheduler", NewFileExporter(out))
+
+	root := tracer.Start("launch", nil)
+	child := root.Child("bind")
+	child.Tag("pod", "default/foo")
+	child.SetError(errors.New("offer expired"))
+	child.Finish()
+	child.Finish()
+	root.Finish()
+
+	remote := New("executor", NewFileExporter(out)).Start("launch", root.Context())
+	remote.Finish()
+
+	decoder := json.NewDecoder(out)
+	spans := []zipkinSpan{}
+	for decoder.More() {
+		var s zipkinSpan
+		if !assert.NoError(decoder.Decode(&s)) {
+			return
+		}
+		spans = append(spans, s)
+	}
+	if !assert.Len(spans, 3) {
+		return
+	}
+	bind, launch, executor := spans[0], spans[1], spans[2]
+	assert.Equal("bind", bind.Name)
+	assert.Equal(launch.TraceId, bind.TraceId)
+	assert.Equal(launch.Id, bind.ParentId)
+	assert.Equal(map[string]string{"pod": "default/foo", "error": "offer expired"}, bind.Tags)
+	assert.Equal("", launch.ParentId)
+	assert.Len(launch.TraceId, 32)
+	assert.Len(launch.Id, 16)
+	assert.Equal("scheduler", launch.LocalEndpoint.ServiceName)
+	assert.Equal("executor", executor.LocalEndpoint.ServiceName)
+	assert.Equal(launch.TraceId, executor.TraceId)
+	assert.Equal(launch.Id, executor.ParentId)
+}
+
+func TestDisabledTracing(t *testing.T) {
+	var tracer *Tracer
+	span := tracer.Start("launch", nil)
+	assert.Nil(t, span)
+	assert.Nil(t, span.Context())
+	span.Child("bind").Tag("pod", "default/foo")
+	span.SetError(errors.New("ignored"))
+	span.Finish()
+
+	assert.Nil(t, New("scheduler", nil).Start("launch", nil))
+}